@@ -0,0 +1,80 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Anomalies logged by anomalyLog
+const (
+	anomalySpoofAttempt      = "spoofAttempt"
+	anomalyInvalidToken      = "invalidToken"
+	anomalyDepthOutOfBounds  = "depthOutOfBounds"
+	anomalyInvalidRemoteAddr = "invalidRemoteAddr"
+	anomalyTrustLookup       = "trustLookupFailed"
+)
+
+// Defaults of the anomaly log
+const (
+	defaultAnomalyLogRateLimit = 60
+	anomalyLogWindow           = time.Minute
+)
+
+// anomalyLogger rate-limits anomaly log lines to limit per anomalyLogWindow, so a flood of
+// bad requests cannot fill the logs. Dropped lines are counted and reported once the
+// window ends.
+type anomalyLogger struct {
+	limit int
+
+	mu          sync.Mutex
+	windowStart time.Time
+	logged      int
+	suppressed  int
+}
+
+// newAnomalyLogger returns an anomaly logger allowing limit lines per window (default: 60)
+func newAnomalyLogger(name string, limit int) (*anomalyLogger, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("%s: anomalyLogRateLimit cannot be negative", name)
+	}
+	if limit == 0 {
+		limit = defaultAnomalyLogRateLimit
+	}
+	return &anomalyLogger{limit: limit}, nil
+}
+
+// allow reports whether a line can be logged at now, and how many lines the window that
+// just ended suppressed
+func (l *anomalyLogger) allow(now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	suppressed := 0
+	if now.Sub(l.windowStart) >= anomalyLogWindow {
+		suppressed = l.suppressed
+		l.windowStart, l.logged, l.suppressed = now, 0, 0
+	}
+	if l.logged >= l.limit {
+		l.suppressed++
+		return false, suppressed
+	}
+	l.logged++
+	return true, suppressed
+}
+
+// logAnomaly logs an anomaly of req when anomalyLog is enabled and the rate limit allows it
+func (r *Resolver) logAnomaly(req *http.Request, anomaly, detail string) {
+	if r.anomalyLog == nil {
+		return
+	}
+
+	ok, suppressed := r.anomalyLog.allow(time.Now())
+	if suppressed > 0 {
+		logf(r.name, "anomaly: %d anomalies suppressed by the rate limit", suppressed)
+	}
+	if ok {
+		r.requestLogf(req, "anomaly: %s from %s %s %s: %s", anomaly, req.RemoteAddr, req.Method, req.URL.Path, detail)
+	}
+}
@@ -0,0 +1,98 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnomalyLoggerAllow(t *testing.T) {
+	logger, err := newAnomalyLogger(pluginName, 2)
+	if err != nil {
+		t.Fatalf("failed to create anomaly logger: %v", err)
+	}
+	start := time.Unix(1700000000, 0)
+
+	for i, expected := range []bool{true, true, false, false} {
+		if ok, _ := logger.allow(start.Add(time.Duration(i) * time.Second)); ok != expected {
+			t.Errorf("line %d: expected allowed %v, but got %v", i, expected, ok)
+		}
+	}
+
+	ok, suppressed := logger.allow(start.Add(anomalyLogWindow))
+	if !ok || suppressed != 2 {
+		t.Errorf("expected a new window reporting 2 suppressed lines, but got (%v, %d)", ok, suppressed)
+	}
+}
+
+func TestAnomalyLog(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	tests := []struct {
+		name       string
+		anomalyLog bool
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"NormalTraffic", true, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 198.51.100.1"}, ""},
+		{"SpoofAttempt", true, "192.0.2.1:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, "anomaly: spoofAttempt from 192.0.2.1:1234 GET /test"},
+		{"DepthOutOfBounds", true, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, "anomaly: depthOutOfBounds from 10.0.0.1:1234 GET /test: X-Forwarded-For"},
+		{"InvalidRemoteAddr", true, "invalid", nil, "anomaly: invalidRemoteAddr from invalid"},
+		{"Disabled", false, "192.0.2.1:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"10.0.0.0/8"}
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: 1},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+			cfg.AnomalyLog = tt.anomalyLog
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			line := strings.TrimSpace(logs.String())
+			if tt.expected == "" && line != "" {
+				t.Errorf("expected no log lines, but got: %s", line)
+			}
+			if tt.expected != "" && !strings.Contains(line, tt.expected) {
+				t.Errorf("expected log line containing '%s', but got: '%s'", tt.expected, line)
+			}
+		})
+	}
+
+	t.Run("NegativeRateLimit", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.AnomalyLogRateLimit = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected an error for a negative anomalyLogRateLimit")
+		}
+		if plugin != nil {
+			t.Error("expected nil plugin for a negative anomalyLogRateLimit")
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+)
+
+// ipAnonymizer masks the low bits of emitted IP addresses
+type ipAnonymizer struct {
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+}
+
+// newIPAnonymizer validates the prefix lengths kept for each address family
+func newIPAnonymizer(name string, ipv4Prefix, ipv6Prefix int) (*ipAnonymizer, error) {
+	if ipv4Prefix < 0 || ipv4Prefix > 32 {
+		return nil, fmt.Errorf("%s: anonymizeIPv4Prefix must be between 0 and 32, got %d", name, ipv4Prefix)
+	}
+	if ipv6Prefix < 0 || ipv6Prefix > 128 {
+		return nil, fmt.Errorf("%s: anonymizeIPv6Prefix must be between 0 and 128, got %d", name, ipv6Prefix)
+	}
+
+	return &ipAnonymizer{
+		ipv4Mask: net.CIDRMask(ipv4Prefix, 32),
+		ipv6Mask: net.CIDRMask(ipv6Prefix, 128),
+	}, nil
+}
+
+// anonymize returns ip with the bits beyond the configured prefix zeroed, e.g. 203.0.113.57 -> 203.0.113.0.
+// Values that are not IP addresses are returned unchanged.
+func (a *ipAnonymizer) anonymize(ip string) string {
+	parsed := parseAddress(ip)
+	if parsed == nil {
+		return ip
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.Mask(a.ipv4Mask).String()
+	}
+	return parsed.Mask(a.ipv6Mask).String()
+}
+
+// resolution returns a copy of resolved whose client IP is anonymized. The hops to its
+// right are proxies and are kept as they are.
+func (a *ipAnonymizer) resolution(resolved resolution) resolution {
+	if resolved.ip == "" {
+		return resolved
+	}
+
+	anonymized := resolved
+	anonymized.ip = a.anonymize(resolved.ip)
+	anonymized.chain = append([]string(nil), resolved.chain...)
+	if resolved.index < len(anonymized.chain) {
+		anonymized.chain[resolved.index] = anonymized.ip
+	}
+	return anonymized
+}
@@ -0,0 +1,97 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAnonymizer(t *testing.T) {
+	anonymizer, err := newIPAnonymizer(pluginName, 24, 48)
+	if err != nil {
+		t.Fatalf("failed to create anonymizer: %v", err)
+	}
+
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"203.0.113.57", "203.0.113.0"},
+		{"::ffff:203.0.113.57", "203.0.113.0"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::"},
+		{"not-an-ip", "not-an-ip"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if anonymized := anonymizer.anonymize(tt.ip); anonymized != tt.expected {
+				t.Errorf("expected '%s', but got: '%s'", tt.expected, anonymized)
+			}
+		})
+	}
+
+	t.Run("InvalidPrefixes", func(t *testing.T) {
+		for _, prefixes := range [][2]int{{33, 48}, {-1, 48}, {24, 129}, {24, -1}} {
+			if _, err := newIPAnonymizer(pluginName, prefixes[0], prefixes[1]); err == nil {
+				t.Errorf("expected error for prefixes %v, but got none", prefixes)
+			}
+		}
+	})
+}
+
+func TestAnonymize(t *testing.T) {
+	cfg := &Config{
+		Enabled:             true,
+		HeaderName:          "X-Real-IP",
+		ProcessHeaders:      []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}},
+		ForceOverwrite:      true,
+		TrustAll:            true,
+		RewriteForwardedFor: true,
+		RewriteRemoteAddr:   true,
+		Anonymize:           true,
+		AnonymizeIPv4Prefix: 16,
+		AnonymizeIPv6Prefix: 48,
+		GeoIPDatabase:       writeTestMMDB(t, buildTestMMDB(t, 6, 28, "GeoLite2-City", testGeoIPNetworks)),
+		GeoCityHeaderName:   "X-Real-IP-City",
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 81.2.69.10:5555, 10.0.0.1")
+
+	plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+	if realIP := req.Header.Get("X-Real-IP"); realIP != "81.2.0.0" {
+		t.Errorf("expected anonymized real IP '81.2.0.0', but got: '%s'", realIP)
+	}
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "81.2.0.0, 10.0.0.1" {
+		t.Errorf("expected anonymized X-Forwarded-For '81.2.0.0, 10.0.0.1', but got: '%s'", xff)
+	}
+	if req.RemoteAddr != "81.2.0.0:5555" {
+		t.Errorf("expected anonymized RemoteAddr '81.2.0.0:5555', but got: '%s'", req.RemoteAddr)
+	}
+	if city := req.Header.Get("X-Real-IP-City"); city != "London" {
+		t.Errorf("expected geolocation on the full IP, but got city '%s'", city)
+	}
+
+	t.Run("InvalidPrefix", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Anonymize = true
+		cfg.AnonymizeIPv4Prefix = 40
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an invalid prefix, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// auditTrace renders a compact trace of the processing of a request for auditHeaderName, e.g.
+// "trust=trustedIPs; X-Forwarded-For=selected[1],discarded(empty)x1; clientAddress=not reached;
+// decision=forwarded". It only contains configured names and fixed reasons, never values the
+// client sent.
+func auditTrace(report *DecisionReport, decision string) string {
+	parts := []string{"trust=" + report.TrustReason}
+
+	for _, header := range report.Headers {
+		var outcome []string
+		switch {
+		case header.Selected:
+			outcome = append(outcome, fmt.Sprintf("selected[%d]", report.Index))
+		case header.Skipped != "":
+			outcome = append(outcome, header.Skipped)
+		}
+
+		discarded := map[string]int{}
+		for _, candidate := range header.Candidates {
+			if candidate.Rejected != "" {
+				discarded[candidate.Rejected]++
+			}
+		}
+		reasons := make([]string, 0, len(discarded))
+		for reason := range discarded {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			outcome = append(outcome, fmt.Sprintf("discarded(%s)x%d", reason, discarded[reason]))
+		}
+
+		if len(outcome) > 0 {
+			parts = append(parts, header.HeaderName+"="+strings.Join(outcome, ","))
+		}
+	}
+
+	if report.Fallback != "" {
+		parts = append(parts, "fallback="+report.Fallback)
+	}
+	parts = append(parts, "decision="+decision)
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,64 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuditHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		forged     string
+		expected   string
+	}{
+		{"TrustedSource", "10.0.0.1:1234", "203.0.113.1, , 198.51.100.2", "", "trust=trustedIPs; X-Forwarded-For=selected[1],discarded(empty)x1; clientAddress=not reached; decision=forwarded"},
+		{"UntrustedSource", "192.0.2.1:1234", "203.0.113.1", "", "trust=notTrusted; X-Forwarded-For=untrusted source; clientAddress=selected[0]; decision=forwarded"},
+		{"OverwritesForgedTrace", "192.0.2.1:1234", "", "trust=trustAll", "trust=notTrusted; X-Forwarded-For=untrusted source; clientAddress=selected[0]; decision=forwarded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"10.0.0.0/8"}
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: 0},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+			cfg.AuditHeaderName = "X-Real-IP-Audit"
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.forged != "" {
+				req.Header.Set("X-Real-IP-Audit", tt.forged)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if trace := req.Header.Get("X-Real-IP-Audit"); trace != tt.expected {
+				t.Errorf("expected audit trace '%s', but got: '%s'", tt.expected, trace)
+			}
+		})
+	}
+
+	t.Run("Fallback", func(t *testing.T) {
+		report := &DecisionReport{TrustReason: trustReasonTrustedIPs, Fallback: fallbackRemoteAddr, Headers: []HeaderReport{{HeaderName: "X-Forwarded-For", Skipped: skipReasonMissing}}}
+
+		expected := "trust=trustedIPs; X-Forwarded-For=header not present; fallback=remoteAddr; decision=forwarded"
+		if trace := auditTrace(report, debugDecisionForwarded); trace != expected {
+			t.Errorf("expected audit trace '%s', but got: '%s'", expected, trace)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// certTrust trusts requests whose client certificate names match configured patterns, for
+// upstream proxies with rotating IPs but stable certificates. Names are read from the TLS
+// connection when Traefik terminates mTLS, or from the info header of Traefik's
+// passTLSClientCert middleware. Anyone can send the header, so it is only read from the
+// TLS terminators listed in infoSources.
+type certTrust struct {
+	patterns    []string        // Glob patterns (path.Match syntax) matched against the subject CN and DNS SANs
+	infoHeader  string          // passTLSClientCert info header, e.g. "X-Forwarded-Tls-Client-Cert-Info"
+	infoSources *IpLookupHelper // Sources the info header is read from, nil without an info header
+}
+
+// newCertTrust validates the trustedClientCertNames, trustedClientCertInfoHeader and
+// trustedClientCertInfoSources configuration
+func newCertTrust(name string, patterns []string, infoHeader string, infoSources []string) (*certTrust, error) {
+	if len(patterns) == 0 {
+		if infoHeader != "" {
+			return nil, fmt.Errorf("%s: trustedClientCertInfoHeader requires trustedClientCertNames", name)
+		}
+		if len(infoSources) > 0 {
+			return nil, fmt.Errorf("%s: trustedClientCertInfoSources requires trustedClientCertNames", name)
+		}
+		return nil, nil
+	}
+	if infoHeader != "" && len(infoSources) == 0 {
+		return nil, fmt.Errorf("%s: trustedClientCertInfoHeader requires trustedClientCertInfoSources", name)
+	}
+	if infoHeader == "" && len(infoSources) > 0 {
+		return nil, fmt.Errorf("%s: trustedClientCertInfoSources requires trustedClientCertInfoHeader", name)
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("%s: invalid trustedClientCertNames pattern %q", name, pattern)
+		}
+	}
+
+	trust := &certTrust{patterns: patterns, infoHeader: infoHeader}
+	if infoHeader != "" {
+		sources, err := NewIpLookupHelper(infoSources)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to parse trustedClientCertInfoSources: %w", name, err)
+		}
+		trust.infoSources = sources
+	}
+	return trust, nil
+}
+
+// names returns the subject CN and DNS SANs of the client certificate of req, which came
+// from source. The info header is only read when source is one of the infoSources.
+func (c *certTrust) names(req *http.Request, source net.IP) []string {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		cert := req.TLS.PeerCertificates[0]
+		return append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	}
+	if c.infoHeader != "" && c.infoFrom(source) {
+		return parseCertInfo(req.Header.Get(c.infoHeader))
+	}
+	return nil
+}
+
+// infoFrom reports whether the info header is read from source
+func (c *certTrust) infoFrom(source net.IP) bool {
+	if source == nil {
+		return false
+	}
+	contained, _, err := c.infoSources.IsContained(source)
+	return err == nil && contained
+}
+
+// matches reports whether any name of the client certificate of req, which came from
+// source, matches a pattern
+func (c *certTrust) matches(req *http.Request, source net.IP) bool {
+	for _, name := range c.names(req, source) {
+		if name == "" {
+			continue
+		}
+		for _, pattern := range c.patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseCertInfo extracts the subject CN and SANs of the leaf certificate from a
+// passTLSClientCert info header, e.g. (before URL-escaping)
+// Subject="C=FR,CN=proxy.example.com";Issuer="CN=ca";SAN="edge-1.example.com,edge-2.example.com"
+func parseCertInfo(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	// Certificates are URL-escaped and comma-separated; the leaf comes first
+	if i := strings.Index(value, ","); i >= 0 {
+		value = value[:i]
+	}
+	info, err := url.QueryUnescape(value)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, field := range strings.Split(info, ";") {
+		key, fieldValue, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		fieldValue = strings.Trim(fieldValue, `"`)
+
+		switch key {
+		case "Subject":
+			for _, attribute := range strings.Split(fieldValue, ",") {
+				if cn, ok := strings.CutPrefix(attribute, "CN="); ok {
+					names = append(names, cn)
+				}
+			}
+		case "SAN":
+			for _, san := range strings.Split(fieldValue, ",") {
+				if san != "" {
+					names = append(names, san)
+				}
+			}
+		}
+	}
+	return names
+}
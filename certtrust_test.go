@@ -0,0 +1,162 @@
+package traefik_realip
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseCertInfo(t *testing.T) {
+	escape := url.QueryEscape
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"SubjectAndSANs", escape(`Subject="C=FR,O=Edge,CN=proxy.example.com";Issuer="CN=ca";NB="1700000000";SAN="edge-1.example.com,edge-2.example.com"`), []string{"proxy.example.com", "edge-1.example.com", "edge-2.example.com"}},
+		{"SubjectOnly", escape(`Subject="CN=proxy.example.com"`), []string{"proxy.example.com"}},
+		{"LeafOnly", escape(`Subject="CN=leaf.example.com"`) + "," + escape(`Subject="CN=intermediate.example.com"`), []string{"leaf.example.com"}},
+		{"Empty", "", nil},
+		{"InvalidEscape", "%zz", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if names := parseCertInfo(tt.value); !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("expected %v, but got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestClientCertTrust(t *testing.T) {
+	newPlugin := func(t *testing.T, infoHeader string) http.Handler {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "X-Forwarded-For", Depth: -1},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.TrustAll = false
+		cfg.TrustedClientCertNames = []string{"*.edge.example.com", "gateway.example.com"}
+		cfg.TrustedClientCertInfoHeader = infoHeader
+		if infoHeader != "" {
+			cfg.TrustedClientCertInfoSources = []string{"192.0.2.0/24"}
+		}
+		cfg.TrustedHeader = "X-Is-Trusted"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	peer := func(cn string, sans ...string) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}, DNSNames: sans}}}
+	}
+
+	tests := []struct {
+		name          string
+		infoHeader    string
+		tls           *tls.ConnectionState
+		info          string
+		expectedTrust string
+	}{
+		{"MatchingCN", "", peer("gateway.example.com"), "", "yes"},
+		{"MatchingSAN", "", peer("unrelated", "node-7.edge.example.com"), "", "yes"},
+		{"NonMatchingCert", "", peer("client.example.org", "client.example.org"), "", "no"},
+		{"SuffixMustMatch", "", peer("a.b.edge.example.com.evil.org"), "", "no"},
+		{"NoCert", "", nil, "", "no"},
+		{"InfoHeader", "X-Forwarded-Tls-Client-Cert-Info", nil, url.QueryEscape(`Subject="CN=node-1.edge.example.com"`), "yes"},
+		{"InfoHeaderIgnoredWhenNotConfigured", "", nil, url.QueryEscape(`Subject="CN=node-1.edge.example.com"`), "no"},
+		{"TLSStateTakesPrecedence", "X-Forwarded-Tls-Client-Cert-Info", peer("client.example.org"), url.QueryEscape(`Subject="CN=node-1.edge.example.com"`), "no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.infoHeader)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.TLS = tt.tls
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			if tt.info != "" {
+				req.Header.Set("X-Forwarded-Tls-Client-Cert-Info", tt.info)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrust {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTrust, trusted)
+			}
+			expectedIP := "192.0.2.1"
+			if tt.expectedTrust == "yes" {
+				expectedIP = "203.0.113.1"
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("InfoHeaderSpoofed", func(t *testing.T) {
+		plugin := newPlugin(t, "X-Forwarded-Tls-Client-Cert-Info")
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "198.51.100.9:1234"
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		req.Header.Set("X-Forwarded-Tls-Client-Cert-Info", url.QueryEscape(`Subject="CN=gateway.example.com"`))
+
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if trusted := req.Header.Get("X-Is-Trusted"); trusted != "no" {
+			t.Errorf("expected the info header of an untrusted source to be ignored, but got trusted header '%s'", trusted)
+		}
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "198.51.100.9" {
+			t.Errorf("expected real IP '198.51.100.9', but got: '%s'", realIP)
+		}
+		if info := req.Header.Get("X-Forwarded-Tls-Client-Cert-Info"); info != "" {
+			t.Errorf("expected the forged info header to be removed, but got: '%s'", info)
+		}
+	})
+
+	invalid := []struct {
+		name        string
+		patterns    []string
+		infoHeader  string
+		infoSources []string
+	}{
+		{"BadPattern", []string{"[edge"}, "", nil},
+		{"EmptyPattern", []string{""}, "", nil},
+		{"InfoHeaderWithoutNames", nil, "X-Forwarded-Tls-Client-Cert-Info", []string{"192.0.2.0/24"}},
+		{"InfoHeaderWithoutSources", []string{"gateway.example.com"}, "X-Forwarded-Tls-Client-Cert-Info", nil},
+		{"SourcesWithoutInfoHeader", []string{"gateway.example.com"}, "", []string{"192.0.2.0/24"}},
+		{"InvalidSource", []string{"gateway.example.com"}, "X-Forwarded-Tls-Client-Cert-Info", []string{"not-a-cidr"}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"10.0.0.0/8"}
+			cfg.TrustedClientCertNames = tt.patterns
+			cfg.TrustedClientCertInfoHeader = tt.infoHeader
+			cfg.TrustedClientCertInfoSources = tt.infoSources
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for invalid client certificate trust, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
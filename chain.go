@@ -0,0 +1,41 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"strings"
+)
+
+// chainTrustedMarker annotates chain entries inside the trusted ranges
+const chainTrustedMarker = "(trusted)"
+
+// chain returns the cleaned candidate IPs of every processed header the request is trusted
+// for, in configuration and header order, comma-joined for chainHeaderName. Candidates inside
+// trustedIPs or trustedIPsFile are marked, e.g. "203.0.113.1, 10.0.0.2(trusted)".
+func (r *Resolver) chain(req *http.Request, isTrusted bool) string {
+	var entries []string
+	for i, headerConfig := range r.processHeaders {
+		var headerValue string
+		if r.isSynthetic(headerConfig.HeaderName) {
+			headerValue = r.syntheticValue(headerConfig.HeaderName, req)
+		} else if r.headerTrusted(i, req, isTrusted) {
+			headerValue, _ = r.limitHeaderValue(r.headerValue(req, headerConfig.HeaderName))
+		}
+		if headerValue == "" {
+			continue
+		}
+
+		candidates, _ := r.splitCandidates(headerConfig.HeaderName, headerValue)
+		for _, ip := range candidates {
+			cleanIP := r.outputIP(r.cleanIPAddress(ip))
+			if cleanIP == "" {
+				continue
+			}
+			if parsed := parseAddress(cleanIP); parsed != nil && r.inTrustedRanges(parsed) {
+				cleanIP += chainTrustedMarker
+			}
+			entries = append(entries, cleanIP)
+		}
+	}
+
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,67 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainHeader(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.TrustAll = false
+	cfg.TrustedIPs = []string{"10.0.0.0/8"}
+	cfg.ChainHeaderName = "X-Real-IP-Chain"
+	cfg.ProcessHeaders = []HeaderConfig{
+		{HeaderName: "X-Forwarded-For", Depth: -1},
+		{HeaderName: "CF-Connecting-IP", Depth: -1},
+		{HeaderName: "clientAddress", Depth: -1},
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "AllHeaders",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.1:5678, 10.0.0.2", "CF-Connecting-IP": "198.51.100.1"},
+			expected:   "203.0.113.1, 10.0.0.2(trusted), 198.51.100.1, 10.0.0.1(trusted)",
+		},
+		{
+			name:       "EmptyAndNonIPEntriesDropped",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "unknown, , 203.0.113.1"},
+			expected:   "203.0.113.1, 10.0.0.1(trusted)",
+		},
+		{
+			name:       "UntrustedOnlyClientAddress",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.1", "X-Real-IP-Chain": "spoofed"},
+			expected:   "192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if chain := req.Header.Get("X-Real-IP-Chain"); chain != tt.expected {
+				t.Errorf("expected chain '%s', but got: '%s'", tt.expected, chain)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// How requests whose X-Forwarded-For does not end with the connecting address are handled
+const (
+	chainValidationOff    = "off"
+	chainValidationFlag   = "flag"
+	chainValidationReject = "reject"
+)
+
+// rejectReasonInvalidChain is the reason code of requests rejected by chain validation
+const rejectReasonInvalidChain = "chainValidation"
+
+// parseChainValidation validates the chainValidation configuration, defaulting to off
+func parseChainValidation(name, mode, chainValidHeaderName string) (string, error) {
+	switch mode {
+	case "":
+		return chainValidationOff, nil
+	case chainValidationOff, chainValidationReject:
+		return mode, nil
+	case chainValidationFlag:
+		if chainValidHeaderName == "" {
+			return "", fmt.Errorf("%s: chainValidHeaderName cannot be empty when chainValidation is %q", name, chainValidationFlag)
+		}
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s: chainValidation must be %q, %q or %q, got %q", name, chainValidationOff, chainValidationFlag, chainValidationReject, mode)
+	}
+}
+
+// chainValid reports whether the connecting address is the rightmost X-Forwarded-For entry,
+// for setups whose proxies append themselves. A request without X-Forwarded-For does not
+// claim to be proxied and is valid; one whose chain ends elsewhere comes from a proxy that
+// forgot to append itself, or from a client posing as a proxy.
+func (r *Resolver) chainValid(req *http.Request) bool {
+	chain := r.headerValue(req, "X-Forwarded-For")
+	if chain == "" {
+		return true
+	}
+
+	last, _ := lastEntries(chain, 1)
+	return sameAddress(r.cleanIPAddress(last), r.cleanIPAddress(req.RemoteAddr))
+}
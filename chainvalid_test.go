@@ -0,0 +1,83 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainValidation(t *testing.T) {
+	tests := []struct {
+		name               string
+		mode               string
+		remoteAddr         string
+		xff                []string
+		expectedStatus     int
+		expectedChainValid string
+	}{
+		{"ProxyAppendedItself", chainValidationFlag, "10.0.0.1:1234", []string{"203.0.113.5, 10.0.0.1"}, http.StatusOK, "yes"},
+		{"ProxyAppendedItselfInSecondInstance", chainValidationFlag, "10.0.0.1:1234", []string{"203.0.113.5", "10.0.0.1:443"}, http.StatusOK, "yes"},
+		{"DirectConnection", chainValidationFlag, "203.0.113.5:1234", nil, http.StatusOK, "yes"},
+		{"ProxyForgotItself", chainValidationFlag, "10.0.0.1:1234", []string{"203.0.113.5"}, http.StatusOK, "no"},
+		{"SpoofedDirectConnection", chainValidationReject, "203.0.113.5:1234", []string{"198.51.100.7"}, http.StatusForbidden, ""},
+		{"ValidNotRejected", chainValidationReject, "10.0.0.1:1234", []string{"203.0.113.5, 10.0.0.1"}, http.StatusOK, "yes"},
+		{"Off", "", "10.0.0.1:1234", []string{"203.0.113.5"}, http.StatusOK, "forged"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ChainValidation = tt.mode
+			cfg.RejectReasonHeaderName = "X-Reject-Reason"
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				req.Header.Add("X-Forwarded-For", xff)
+			}
+			req.Header.Set("X-Chain-Valid", "forged")
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				if reason := rr.Header().Get("X-Reject-Reason"); reason != rejectReasonInvalidChain {
+					t.Errorf("expected reject reason %q, but got %q", rejectReasonInvalidChain, reason)
+				}
+				return
+			}
+			if chainValid := req.Header.Get("X-Chain-Valid"); chainValid != tt.expectedChainValid {
+				t.Errorf("expected X-Chain-Valid '%s', but got: '%s'", tt.expectedChainValid, chainValid)
+			}
+		})
+	}
+
+	t.Run("InvalidConfigurations", func(t *testing.T) {
+		for _, modify := range []func(*Config){
+			func(cfg *Config) { cfg.ChainValidation = "enforce" },
+			func(cfg *Config) {
+				cfg.ChainValidation = chainValidationFlag
+				cfg.ChainValidHeaderName = ""
+			},
+		} {
+			cfg := CreateConfig()
+			modify(cfg)
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		}
+	})
+}
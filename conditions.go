@@ -0,0 +1,159 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Conditions an output header can be restricted to with outputConditions
+const (
+	whenTrusted   = "trusted"
+	whenUntrusted = "untrusted"
+	whenResolved  = "resolved"
+	whenConflict  = "conflict"
+)
+
+// requestState is a set of the conditions that hold for a request
+type requestState uint8
+
+const (
+	stateTrusted requestState = 1 << iota
+	stateUntrusted
+	stateResolved
+	stateConflict
+)
+
+// requestStates maps condition names to their state bit
+var requestStates = map[string]requestState{
+	whenTrusted:   stateTrusted,
+	whenUntrusted: stateUntrusted,
+	whenResolved:  stateResolved,
+	whenConflict:  stateConflict,
+}
+
+// headerOutput is a header the plugin writes and the value it writes
+type headerOutput struct {
+	header string
+	value  string
+}
+
+// outputConditions restricts output headers to requests in given states.
+// Headers without a condition are always emitted.
+type outputConditions struct {
+	conditions map[string]requestState // Canonical header name -> states any of which allows the header
+	all        requestState            // Union of every condition, to skip computing unused states
+}
+
+// newOutputConditions parses the outputConditions configuration. Each key must be one of
+// the configured output headers; each value is a comma-separated list of conditions.
+func newOutputConditions(name string, configured map[string]string, outputHeaders []string) (*outputConditions, error) {
+	if len(configured) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(outputHeaders))
+	for _, header := range outputHeaders {
+		if header != "" {
+			known[http.CanonicalHeaderKey(header)] = true
+		}
+	}
+
+	conditions := &outputConditions{conditions: make(map[string]requestState, len(configured))}
+	for header, when := range configured {
+		canonical := http.CanonicalHeaderKey(header)
+		if !known[canonical] {
+			return nil, fmt.Errorf("%s: outputConditions references %q, which is not a configured output header", name, header)
+		}
+
+		var states requestState
+		for _, condition := range strings.Split(when, ",") {
+			condition = strings.ToLower(strings.TrimSpace(condition))
+			state, ok := requestStates[condition]
+			if !ok {
+				return nil, fmt.Errorf("%s: outputConditions for %q has unknown condition %q (expected trusted, untrusted, resolved or conflict)", name, header, condition)
+			}
+			states |= state
+		}
+
+		conditions.conditions[canonical] = states
+		conditions.all |= states
+	}
+
+	return conditions, nil
+}
+
+// allows reports whether header may be emitted for a request in state
+func (c *outputConditions) allows(header string, state requestState) bool {
+	if c == nil {
+		return true
+	}
+	states, ok := c.conditions[http.CanonicalHeaderKey(header)]
+	return !ok || states&state != 0
+}
+
+// needsConflict reports whether any condition depends on conflict detection
+func (c *outputConditions) needsConflict() bool {
+	return c != nil && c.all&stateConflict != 0
+}
+
+// requestState computes the conditions that hold for a request. Conflicts are those of
+// conflictPolicy: the processed headers other than clientAddress disagree on the client IP.
+func (r *Resolver) requestState(isTrusted bool, resolved resolution) requestState {
+	var state requestState
+	if isTrusted {
+		state |= stateTrusted
+	} else {
+		state |= stateUntrusted
+	}
+	if resolved.ip != "" {
+		state |= stateResolved
+	}
+	if r.outputConditions.needsConflict() && r.sourcesConflict(resolved) {
+		state |= stateConflict
+	}
+	return state
+}
+
+// defaultMaxOutputLength caps output header values well below common backend header limits
+const defaultMaxOutputLength = 256
+
+// outputWriter writes the output headers of one request
+type outputWriter struct {
+	r         *Resolver
+	req       *http.Request
+	state     requestState
+	merge     bool            // Whether values an earlier instance wrote are kept
+	earlier   map[string]bool // Output headers earlier instances in this process wrote; nil to keep any
+	written   map[string]bool // Output headers written, by canonical name
+	truncated bool            // Whether any value was cut to maxOutputLength
+}
+
+// set writes an output header. A header whose condition does not hold is removed,
+// so clients cannot supply it; otherwise the usual forceOverwrite rules apply.
+// Values longer than maxOutputLength are truncated to it. When merging into the outputs
+// of an earlier instance, headers it wrote and that have a value are kept; a value the
+// client sent is not.
+func (w *outputWriter) set(header, value string) {
+	if header == "" {
+		return
+	}
+	if w.merge && w.req.Header.Get(header) != "" && (w.earlier == nil || w.earlier[http.CanonicalHeaderKey(header)]) {
+		return
+	}
+	if !w.r.outputConditions.allows(header, w.state) {
+		w.req.Header.Del(header)
+		return
+	}
+	if w.r.maxOutputLength > 0 && len(value) > w.r.maxOutputLength {
+		value = value[:w.r.maxOutputLength]
+		w.truncated = true
+	}
+	if w.r.forceOverwrite || value != "" {
+		w.req.Header.Set(header, value)
+		if w.written == nil {
+			w.written = make(map[string]bool)
+		}
+		w.written[http.CanonicalHeaderKey(header)] = true
+	}
+}
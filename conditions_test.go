@@ -0,0 +1,224 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOutputConditions(t *testing.T) {
+	newPlugin := func(t *testing.T, conditions map[string]string) http.Handler {
+		cfg := &Config{
+			Enabled:    true,
+			HeaderName: "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{
+				{HeaderName: "CF-Connecting-IP", Depth: -1},
+				{HeaderName: "X-Forwarded-For", Depth: 0},
+				{HeaderName: "clientAddress", Depth: -1},
+			},
+			ForceOverwrite:   true,
+			TrustedIPs:       []string{"10.0.0.0/8"},
+			TrustedHeader:    "X-Is-Trusted",
+			SourceHeaderName: "X-Real-IP-Source",
+			OutputConditions: conditions,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name           string
+		conditions     map[string]string
+		remoteAddr     string
+		headers        map[string]string
+		expectedSource string
+	}{
+		{"NoCondition", nil, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, "X-Forwarded-For[0]"},
+		{"TrustedMatches", map[string]string{"X-Real-IP-Source": "trusted"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, "X-Forwarded-For[0]"},
+		{"UntrustedSuppressed", map[string]string{"X-Real-IP-Source": "untrusted"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, ""},
+		{"UntrustedMatches", map[string]string{"X-Real-IP-Source": "untrusted"}, "198.51.100.1:1234", nil, "clientAddress[0]"},
+		{"ResolvedMatches", map[string]string{"X-Real-IP-Source": "resolved"}, "198.51.100.1:1234", nil, "clientAddress[0]"},
+		{"ConflictMatches", map[string]string{"X-Real-IP-Source": "conflict"}, "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "203.0.113.1", "X-Forwarded-For": "203.0.113.2"}, "CF-Connecting-IP[0]"},
+		{"NoConflict", map[string]string{"X-Real-IP-Source": "conflict"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, ""},
+		{"SameAddressNoConflict", map[string]string{"X-Real-IP-Source": "conflict"}, "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "2001:db8::1", "X-Forwarded-For": "2001:DB8:0::1"}, ""},
+		{"AnyOf", map[string]string{"X-Real-IP-Source": "untrusted, conflict"}, "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "203.0.113.1", "X-Forwarded-For": "203.0.113.2"}, "CF-Connecting-IP[0]"},
+		{"CaseInsensitiveHeader", map[string]string{"x-real-ip-source": "Untrusted"}, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.conditions)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Real-IP-Source", "spoofed")
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if source := req.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected source '%s', but got: '%s'", tt.expectedSource, source)
+			}
+			if _, present := req.Header["X-Real-IP-Source"]; tt.expectedSource == "" && present {
+				t.Error("expected suppressed header to be removed")
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP == "" {
+				t.Error("expected unconditioned X-Real-IP to be set")
+			}
+		})
+	}
+
+	t.Run("TrustedHeaderCondition", func(t *testing.T) {
+		plugin := newPlugin(t, map[string]string{"X-Is-Trusted": "untrusted"})
+
+		for _, remoteAddr := range []string{"10.0.0.1:1234", "198.51.100.1:1234"} {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("X-Is-Trusted", "yes")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			expected := "no"
+			if remoteAddr == "10.0.0.1:1234" {
+				expected = ""
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != expected {
+				t.Errorf("%s: expected trusted header '%s', but got: '%s'", remoteAddr, expected, trusted)
+			}
+		}
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		for _, conditions := range []map[string]string{
+			{"X-Unknown": "trusted"},
+			{"X-Real-IP-Source": "sometimes"},
+			{"X-Real-IP-Source": ""},
+		} {
+			cfg := CreateConfig()
+			cfg.SourceHeaderName = "X-Real-IP-Source"
+			cfg.OutputConditions = conditions
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Errorf("expected error for outputConditions %v, but got none", conditions)
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		}
+	})
+}
+
+func TestSelectIndex(t *testing.T) {
+	tests := []struct {
+		count, depth  int
+		expectedIndex int
+		expectedOK    bool
+	}{
+		{3, -1, 0, true},
+		{3, -2, 1, true},
+		{3, -3, 2, true},
+		{3, -4, 0, false},
+		{3, 0, 2, true},
+		{3, 2, 0, true},
+		{3, 3, 0, false},
+		{0, -1, 0, false},
+	}
+
+	for _, tt := range tests {
+		index, ok := selectIndex(tt.count, tt.depth)
+		if index != tt.expectedIndex || ok != tt.expectedOK {
+			t.Errorf("selectIndex(%d, %d) = (%d, %v), expected (%d, %v)", tt.count, tt.depth, index, ok, tt.expectedIndex, tt.expectedOK)
+		}
+	}
+}
+
+func TestMaxOutputLength(t *testing.T) {
+	newPlugin := func(t *testing.T, maxOutputLength int) http.Handler {
+		cfg := &Config{
+			Enabled:             true,
+			HeaderName:          "X-Real-IP",
+			ProcessHeaders:      []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			ForceOverwrite:      true,
+			TrustAll:            true,
+			SourceHeaderName:    "X-Real-IP-Source",
+			MaxOutputLength:     maxOutputLength,
+			TruncatedHeaderName: "X-Real-IP-Truncated",
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name              string
+		maxOutputLength   int
+		xff               string
+		expectedRealIP    string
+		expectedTruncated string
+	}{
+		{"ShortValue", 0, "203.0.113.1", "203.0.113.1", ""},
+		{"LongValueNotAnIP", 0, strings.Repeat("a", 1000), "", ""},
+		{"CustomLimit", 8, "2001:db8::1", "2001:db8", "yes"},
+		{"SourceExactlyAtLimit", len("X-Forwarded-For[0]"), "203.0.113.1", "203.0.113.1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.maxOutputLength)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			req.Header.Set("X-Real-IP-Truncated", "spoofed")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedRealIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedRealIP, realIP)
+			}
+			if truncated := req.Header.Get("X-Real-IP-Truncated"); truncated != tt.expectedTruncated {
+				t.Errorf("expected truncated flag '%s', but got: '%s'", tt.expectedTruncated, truncated)
+			}
+		})
+	}
+
+	t.Run("SourceHeaderTruncated", func(t *testing.T) {
+		plugin := newPlugin(t, 10)
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		// "X-Forwarded-For[0]" exceeds the limit even though the IP does not
+		if source := req.Header.Get("X-Real-IP-Source"); source != "X-Forwarde" {
+			t.Errorf("expected truncated source 'X-Forwarde', but got: '%s'", source)
+		}
+		if truncated := req.Header.Get("X-Real-IP-Truncated"); truncated != "yes" {
+			t.Errorf("expected truncated flag, but got: '%s'", truncated)
+		}
+	})
+
+	t.Run("NegativeLimit", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.MaxOutputLength = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a negative maxOutputLength, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
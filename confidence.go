@@ -0,0 +1,61 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// defaultHeaderWeight is the weight of processHeaders entries without one
+const defaultHeaderWeight = 1.0
+
+// unvalidatedPenalty scales the confidence of real IPs that are not valid IP addresses,
+// such as values passed on by the lastHeaderRaw fallback
+const unvalidatedPenalty = 0.5
+
+// parseWeights validates the weight of every processed header. Weights range from 0
+// (exclusive) to 1; a missing weight is 1.
+func parseWeights(name string, headers []HeaderConfig) ([]float64, error) {
+	weights := make([]float64, len(headers))
+	var problems configErrors
+	for i, headerConfig := range headers {
+		switch weight := headerConfig.Weight; {
+		case weight == 0:
+			weights[i] = defaultHeaderWeight
+		case weight > 0 && weight <= 1:
+			weights[i] = weight
+		default:
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): weight must be between 0 and 1, got %v", name, i, headerConfig.HeaderName, weight))
+		}
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// confidence scores how far downstream systems can rely on a resolution, from 0 (nothing
+// resolved) to 1: the weight of the header that produced the real IP, halved when the
+// value is not a valid IP address
+func (r *Resolver) confidence(resolved resolution) float64 {
+	if resolved.ip == "" {
+		return 0
+	}
+
+	score := defaultHeaderWeight
+	for i, headerConfig := range r.processHeaders {
+		if http.CanonicalHeaderKey(headerConfig.HeaderName) == http.CanonicalHeaderKey(resolved.header) {
+			score = r.weights[i]
+			break
+		}
+	}
+	if parseAddress(resolved.ip) == nil {
+		score *= unvalidatedPenalty
+	}
+	return score
+}
+
+// formatConfidence renders a confidence score with two decimals, e.g. "0.80"
+func formatConfidence(score float64) string {
+	return strconv.FormatFloat(score, 'f', 2, 64)
+}
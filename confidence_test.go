@@ -0,0 +1,74 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		name               string
+		fallback           string
+		cfConnectingIP     string
+		xff                string
+		remoteAddr         string
+		expectedConfidence string
+	}{
+		{"HighWeightSource", "", "203.0.113.5", "198.51.100.7", "192.0.2.1:1234", "1.00"},
+		{"LowerWeightSource", "", "", "198.51.100.7", "192.0.2.1:1234", "0.60"},
+		{"DefaultWeight", "", "", "", "192.0.2.1:1234", "0.20"},
+		{"Unvalidated", fallbackLastHeaderRaw, "", "not-an-ip", "invalid", "0.00"},
+		{"Unresolved", "", "", "", "", "0.00"},
+		{"UnvalidatedClientAddress", "", "", "", "invalid", "0.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "CF-Connecting-IP"},
+				{HeaderName: "X-Forwarded-For", Weight: 0.6},
+				{HeaderName: "clientAddress", Weight: 0.2},
+			}
+			cfg.Fallback = tt.fallback
+			cfg.ConfidenceHeaderName = "X-Real-IP-Confidence"
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.cfConnectingIP != "" {
+				req.Header.Set("CF-Connecting-IP", tt.cfConnectingIP)
+			}
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Real-IP-Confidence", "1.00")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if confidence := req.Header.Get("X-Real-IP-Confidence"); confidence != tt.expectedConfidence {
+				t.Errorf("expected X-Real-IP-Confidence '%s', but got: '%s'", tt.expectedConfidence, confidence)
+			}
+		})
+	}
+
+	t.Run("InvalidWeight", func(t *testing.T) {
+		for _, weight := range []float64{-0.5, 1.5} {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Weight: weight}}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Errorf("expected error for weight %v, but got none", weight)
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package traefik_realip
+
+import (
+	"errors"
+	"fmt"
+)
+
+// configErrors collects the problems of a configuration, so they can all be fixed in one go
+// instead of one per restart
+type configErrors []error
+
+// add records err unless it is nil
+func (e *configErrors) add(err error) {
+	if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// err returns the recorded problems as a single error, one per line, or nil when there are none
+func (e configErrors) err() error {
+	return errors.Join(e...)
+}
+
+// parseCIDRList parses a CIDR list setting, reporting every invalid entry
+func parseCIDRList(name, field string, cidrs []string) (*IpLookupHelper, error) {
+	helper := NewEmptyIpLookupHelper()
+	var problems configErrors
+	for i, cidr := range cidrs {
+		if err := helper.AddCIDR(cidr); err != nil {
+			problems.add(fmt.Errorf("%s: failed to parse %s[%d]: %w", name, field, i, err))
+		}
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return helper, nil
+}
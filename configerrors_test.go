@@ -0,0 +1,99 @@
+package traefik_realip
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestConfigErrorsAggregated(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.TrustAll = false
+	cfg.HeaderName = ""
+	cfg.TrustedIPs = []string{"10.0.0.0/8", "10.0.0.0/33", "not-a-cidr"}
+	cfg.DenyIPs = []string{"192.0.2.300"}
+	cfg.ProcessHeaders = []HeaderConfig{
+		{HeaderName: "X-Forwarded-For", Depth: "second"},
+		{HeaderName: "X-Client", Depth: 0, Family: "ipv5"},
+		{HeaderName: "clientAddress", Depth: "rightmost-untrusted", Weight: 2},
+	}
+	cfg.Fallback = "deny"
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for an invalid configuration, but got none")
+	}
+	if plugin != nil {
+		t.Error("expected plugin to be nil, but got instance")
+	}
+
+	expected := []string{
+		"headerName cannot be empty",
+		`processHeaders[0] (X-Forwarded-For): unknown depth "second"`,
+		`processHeaders[1] (X-Client): family must be`,
+		`processHeaders[2] (clientAddress): depth "rightmost-untrusted" needs a header with a chain`,
+		`processHeaders[2] (clientAddress): weight must be between 0 and 1`,
+		"fallback",
+		"failed to parse trustedIPs[1]",
+		"failed to parse trustedIPs[2]",
+		"failed to parse denyIPs[0]",
+	}
+	for _, problem := range expected {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected error to report %q, but got:\n%v", problem, err)
+		}
+	}
+	if lines := strings.Count(err.Error(), "\n") + 1; lines != len(expected) {
+		t.Errorf("expected %d problems, one per line, but got %d:\n%v", len(expected), lines, err)
+	}
+}
+
+func TestConfigErrorsAggregatedLateSettings(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.HeaderName = ""
+	cfg.DenyStatusCode = 200
+	cfg.MaxChainLength = -1
+	cfg.ConflictPolicy = "bogus"
+	cfg.BlockedCountries = []string{"XYZ"}
+	cfg.CountryStatusCode = 200
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for an invalid configuration, but got none")
+	}
+	if plugin != nil {
+		t.Error("expected plugin to be nil, but got instance")
+	}
+
+	expected := []string{
+		"headerName cannot be empty",
+		"denyStatusCode must be a 4xx or 5xx status",
+		"maxChainLength cannot be negative",
+		"conflictPolicy must be",
+		"blockedCountries and allowedCountries require geoIPDatabase",
+		"countryStatusCode must be a 4xx or 5xx status",
+		`blockedCountries entry "XYZ" is not a two-letter ISO country code`,
+	}
+	for _, problem := range expected {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected error to report %q, but got:\n%v", problem, err)
+		}
+	}
+	if lines := strings.Count(err.Error(), "\n") + 1; lines != len(expected) {
+		t.Errorf("expected %d problems, one per line, but got %d:\n%v", len(expected), lines, err)
+	}
+}
+
+func TestParseCIDRList(t *testing.T) {
+	helper, err := parseCIDRList(pluginName, "trustedIPs", []string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("failed to parse valid list: %v", err)
+	}
+	if helper.Count() != 2 {
+		t.Errorf("expected 2 prefixes, but got %d", helper.Count())
+	}
+
+	if _, err := parseCIDRList(pluginName, "trustedIPs", []string{"bad", "10.0.0.0/8", "worse"}); err == nil || strings.Count(err.Error(), "failed to parse") != 2 {
+		t.Errorf("expected both invalid entries to be reported, but got %v", err)
+	}
+}
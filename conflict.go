@@ -0,0 +1,73 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// What happens when the source headers of a request resolve to different IPs
+const (
+	conflictIgnore      = "ignore"
+	conflictPreferFirst = "prefer-first"
+	conflictReject      = "reject"
+)
+
+// rejectReasonConflict is the reason code of requests rejected because their source headers conflict
+const rejectReasonConflict = "conflictPolicy"
+
+// parseConflictPolicy validates the conflictPolicy configuration, defaulting to prefer-first
+func parseConflictPolicy(name, policy string) (string, error) {
+	switch policy {
+	case "":
+		return conflictPreferFirst, nil
+	case conflictIgnore, conflictPreferFirst, conflictReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%s: conflictPolicy must be %q, %q or %q, got %q", name, conflictIgnore, conflictPreferFirst, conflictReject, policy)
+	}
+}
+
+// sourcesConflict reports whether the processed headers other than clientAddress that
+// yielded a valid IP in resolved disagree on it. Attackers often add extra client-IP headers
+// hoping one of them is trusted somewhere downstream.
+func (r *Resolver) sourcesConflict(resolved resolution) bool {
+	first := ""
+	for i, ip := range resolved.candidates {
+		if r.isSynthetic(r.processHeaders[i].HeaderName) || parseAddress(ip) == nil {
+			continue
+		}
+		if first == "" {
+			first = ip
+		} else if !sameAddress(ip, first) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsCandidates reports whether resolution must record the entry of every header: to
+// detect conflicts, for consensus or for entries with their own target header
+func (r *Resolver) needsCandidates() bool {
+	if r.conflictPolicy != conflictPreferFirst || r.consensus != nil || r.outputConditions.needsConflict() {
+		return true
+	}
+	for _, headerConfig := range r.processHeaders {
+		if headerConfig.TargetHeaderName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflict resolves req again when its source headers conflict under the ignore
+// policy: as for an untrusted source, so none of the conflicting headers is relied on. The
+// candidates of resolved, which conflict, are kept for consensus and the output conditions.
+func (r *Resolver) resolveConflict(req *http.Request, resolved resolution, report *DecisionReport) resolution {
+	if report != nil {
+		report.Headers, report.Fallback = nil, ""
+	}
+	candidates := resolved.candidates
+	resolved = r.hardenResolution(r.resolveRealIP(req, false, report))
+	resolved.candidates = candidates
+	return resolved
+}
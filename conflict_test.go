@@ -0,0 +1,90 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	newPlugin := func(t *testing.T, policy string) *Plugin {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "CF-Connecting-IP", Depth: 0}, {HeaderName: "True-Client-IP", Depth: 0}, {HeaderName: "clientAddress", Depth: 0}}
+		cfg.SourceHeaderName = "X-Real-IP-Source"
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+		cfg.ConflictPolicy = policy
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	conflicting := map[string]string{"CF-Connecting-IP": "203.0.113.1", "True-Client-IP": "198.51.100.1"}
+	agreeing := map[string]string{"CF-Connecting-IP": "203.0.113.1", "True-Client-IP": "203.0.113.1"}
+
+	tests := []struct {
+		name            string
+		policy          string
+		path            string
+		headers         map[string]string
+		expectedStatus  int
+		expectedIP      string
+		expectedSource  string
+		expectedReasons string
+	}{
+		{"DefaultPrefersFirst", "", "/test", conflicting, http.StatusOK, "203.0.113.1", "CF-Connecting-IP[0]", ""},
+		{"PreferFirst", conflictPreferFirst, "/test", conflicting, http.StatusOK, "203.0.113.1", "CF-Connecting-IP[0]", ""},
+		{"IgnoreConflicting", conflictIgnore, "/test", conflicting, http.StatusOK, "192.0.2.1", "clientAddress[0]", ""},
+		{"IgnoreAgreeing", conflictIgnore, "/test", agreeing, http.StatusOK, "203.0.113.1", "CF-Connecting-IP[0]", ""},
+		{"IgnoreSingleHeader", conflictIgnore, "/test", map[string]string{"True-Client-IP": "198.51.100.1"}, http.StatusOK, "198.51.100.1", "True-Client-IP[0]", ""},
+		{"IgnoreUnparseableNotConflicting", conflictIgnore, "/test", map[string]string{"CF-Connecting-IP": "203.0.113.1", "True-Client-IP": "garbage"}, http.StatusOK, "203.0.113.1", "CF-Connecting-IP[0]", ""},
+		{"RejectConflicting", conflictReject, "/test", conflicting, http.StatusForbidden, "", "", "conflictPolicy"},
+		{"RejectAgreeing", conflictReject, "/test", agreeing, http.StatusOK, "203.0.113.1", "CF-Connecting-IP[0]", ""},
+		{"RejectExemptPath", conflictReject, "/.well-known/acme-challenge/token", conflicting, http.StatusOK, "203.0.113.1", "CF-Connecting-IP[0]", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.policy)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if source := req.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected source '%s', but got: '%s'", tt.expectedSource, source)
+			}
+		})
+	}
+
+	t.Run("InvalidPolicy", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ConflictPolicy = "prefer-last"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown conflictPolicy, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
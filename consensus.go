@@ -0,0 +1,94 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// How disagreement between the headers cross-checked by consensus is handled
+const (
+	consensusOff    = "off"
+	consensusFlag   = "flag"
+	consensusReject = "reject"
+)
+
+// rejectReasonInconsistent is the reason code of requests rejected because their headers disagree
+const rejectReasonInconsistent = "consensus"
+
+// consensusCheck cross-checks the IPs several processed headers yield. Disagreement means
+// one of them was forged, which is a strong spoofing signal.
+type consensusCheck struct {
+	mode    string
+	headers []int // Indexes of the processHeaders entries compared
+}
+
+// newConsensusCheck parses the consensus configuration. Compared headers must be processHeaders
+// entries; by default every entry but the synthetic one is compared, since the connection address
+// differs from the client's whenever a proxy is involved.
+func newConsensusCheck(name, mode string, headers []string, processHeaders []HeaderConfig, synthetic, consistentHeaderName string) (*consensusCheck, error) {
+	switch mode {
+	case "", consensusOff:
+		return nil, nil
+	case consensusFlag, consensusReject:
+	default:
+		return nil, fmt.Errorf("%s: consensus must be %q, %q or %q, got %q", name, consensusOff, consensusFlag, consensusReject, mode)
+	}
+	if mode == consensusFlag && consistentHeaderName == "" {
+		return nil, fmt.Errorf("%s: consistentHeaderName cannot be empty when consensus is %q", name, consensusFlag)
+	}
+
+	check := &consensusCheck{mode: mode}
+	if len(headers) == 0 {
+		for i, headerConfig := range processHeaders {
+			if !isSynthetic(headerConfig.HeaderName, synthetic) {
+				check.headers = append(check.headers, i)
+			}
+		}
+	}
+	for _, header := range headers {
+		index := -1
+		for i, headerConfig := range processHeaders {
+			if http.CanonicalHeaderKey(headerConfig.HeaderName) == http.CanonicalHeaderKey(header) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("%s: consensusHeaders references %q, which is not in processHeaders", name, header)
+		}
+		check.headers = append(check.headers, index)
+	}
+	if len(check.headers) < 2 {
+		return nil, fmt.Errorf("%s: consensus needs at least two headers to compare", name)
+	}
+
+	return check, nil
+}
+
+// consistent reports whether the compared headers that yielded an IP in resolved agree on
+// it. Headers that are missing or not honored for the source take no part.
+func (c *consensusCheck) consistent(resolved resolution) bool {
+	first := ""
+	for _, i := range c.headers {
+		ip := resolved.candidates[i]
+		if ip == "" {
+			continue
+		}
+		if first == "" {
+			first = ip
+		} else if !sameAddress(ip, first) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameAddress compares candidates as addresses when both are IPs, so different spellings
+// of one IPv6 address agree, and as strings otherwise
+func sameAddress(a, b string) bool {
+	parsedA, parsedB := parseAddress(a), parseAddress(b)
+	if parsedA == nil || parsedB == nil {
+		return a == b
+	}
+	return parsedA.Equal(parsedB)
+}
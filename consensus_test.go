@@ -0,0 +1,134 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsensus(t *testing.T) {
+	newPlugin := func(t *testing.T, mode string) http.Handler {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP"},
+			{HeaderName: "X-Forwarded-For", Depth: 1},
+			{HeaderName: "clientAddress"},
+		}
+		cfg.Consensus = mode
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name               string
+		mode               string
+		cfConnectingIP     string
+		xff                string
+		expectedStatus     int
+		expectedConsistent string
+	}{
+		{"Agree", consensusFlag, "203.0.113.5", "203.0.113.5, 10.0.0.2", http.StatusOK, "yes"},
+		{"AgreeOnIPv6Spelling", consensusFlag, "2001:db8::1", "2001:DB8:0::1, 10.0.0.2", http.StatusOK, "yes"},
+		{"SingleSource", consensusFlag, "203.0.113.5", "", http.StatusOK, "yes"},
+		{"DisagreeFlagged", consensusFlag, "203.0.113.5", "198.51.100.7, 10.0.0.2", http.StatusOK, "no"},
+		{"DisagreeRejected", consensusReject, "203.0.113.5", "198.51.100.7, 10.0.0.2", http.StatusForbidden, ""},
+		{"AgreeNotRejected", consensusReject, "203.0.113.5", "203.0.113.5, 10.0.0.2", http.StatusOK, "yes"},
+		{"Off", "", "203.0.113.5", "198.51.100.7, 10.0.0.2", http.StatusOK, "forged"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.mode)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("CF-Connecting-IP", tt.cfConnectingIP)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Real-IP-Consistent", "forged")
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				if reason := rr.Header().Get("X-Reject-Reason"); reason != rejectReasonInconsistent {
+					t.Errorf("expected reject reason %q, but got %q", rejectReasonInconsistent, reason)
+				}
+				return
+			}
+			if consistent := req.Header.Get("X-Real-IP-Consistent"); consistent != tt.expectedConsistent {
+				t.Errorf("expected X-Real-IP-Consistent '%s', but got: '%s'", tt.expectedConsistent, consistent)
+			}
+		})
+	}
+
+	t.Run("ConsensusHeaders", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP"},
+			{HeaderName: "X-Real-IP"},
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+		}
+		cfg.Consensus = consensusFlag
+		cfg.ConsensusHeaders = []string{"cf-connecting-ip", "X-Forwarded-For"}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("CF-Connecting-IP", "203.0.113.5")
+		req.Header.Set("X-Real-IP", "198.51.100.7")
+		req.Header.Set("X-Forwarded-For", "203.0.113.5")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if consistent := req.Header.Get("X-Real-IP-Consistent"); consistent != "yes" {
+			t.Errorf("expected X-Real-IP-Consistent 'yes', but got: '%s'", consistent)
+		}
+	})
+
+	t.Run("InvalidConfigurations", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			modify func(*Config)
+		}{
+			{"UnknownMode", func(cfg *Config) { cfg.Consensus = "vote" }},
+			{"UnknownHeader", func(cfg *Config) {
+				cfg.Consensus = consensusFlag
+				cfg.ConsensusHeaders = []string{"X-Forwarded-For", "True-Client-IP"}
+			}},
+			{"SingleHeader", func(cfg *Config) {
+				cfg.Consensus = consensusReject
+				cfg.ConsensusHeaders = []string{"X-Forwarded-For"}
+			}},
+			{"FlagWithoutHeader", func(cfg *Config) {
+				cfg.Consensus = consensusFlag
+				cfg.ConsistentHeaderName = ""
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				tt.modify(cfg)
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err == nil {
+					t.Error("expected error, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+			})
+		}
+	})
+}
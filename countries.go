@@ -0,0 +1,100 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Reason codes of the country rules, reported after those of the IP rules
+const (
+	enforceReasonBlockedCountry    = "blockedCountries"
+	enforceReasonNotAllowedCountry = "allowedCountries"
+)
+
+// countryRules rejects requests by the country their real IP geolocates to
+type countryRules struct {
+	blocked map[string]bool // Upper-case ISO country codes that are rejected
+	allowed map[string]bool // Upper-case ISO country codes outside of which requests are rejected
+	status  int
+	body    []byte // Response body; the status text when nil
+}
+
+// newCountryRules parses blockedCountries and allowedCountries. The rules need the GeoIP
+// database, since the country is looked up from the resolved real IP.
+func newCountryRules(name string, blocked, allowed []string, status int, body, geoIPDatabase string) (*countryRules, error) {
+	if len(blocked) == 0 && len(allowed) == 0 {
+		return nil, nil
+	}
+
+	var problems configErrors
+	if geoIPDatabase == "" {
+		problems.add(fmt.Errorf("%s: blockedCountries and allowedCountries require geoIPDatabase", name))
+	}
+
+	if status == 0 {
+		status = defaultDenyStatusCode
+	}
+	if status < 400 || status > 599 {
+		problems.add(fmt.Errorf("%s: countryStatusCode must be a 4xx or 5xx status, got %d", name, status))
+	}
+
+	rules := &countryRules{status: status}
+	if body != "" {
+		rules.body = []byte(body)
+	}
+
+	var err error
+	rules.blocked, err = parseCountryCodes(name, "blockedCountries", blocked)
+	problems.add(err)
+	rules.allowed, err = parseCountryCodes(name, "allowedCountries", allowed)
+	problems.add(err)
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseCountryCodes validates ISO 3166-1 alpha-2 codes, matched case-insensitively
+func parseCountryCodes(name, option string, codes []string) (map[string]bool, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	parsed := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		normalized := strings.ToUpper(strings.TrimSpace(code))
+		if len(normalized) != 2 || normalized[0] < 'A' || normalized[0] > 'Z' || normalized[1] < 'A' || normalized[1] > 'Z' {
+			return nil, fmt.Errorf("%s: %s entry %q is not a two-letter ISO country code", name, option, code)
+		}
+		parsed[normalized] = true
+	}
+	return parsed, nil
+}
+
+// check returns the reason codes of the country rules rejecting countryCode. Like allowOnlyIPs,
+// allowedCountries rejects requests whose country is unknown; blockedCountries never does.
+func (c *countryRules) check(countryCode string) []string {
+	countryCode = strings.ToUpper(countryCode)
+
+	var reasons []string
+	if c.blocked != nil && c.blocked[countryCode] {
+		reasons = append(reasons, enforceReasonBlockedCountry)
+	}
+	if c.allowed != nil && !c.allowed[countryCode] {
+		reasons = append(reasons, enforceReasonNotAllowedCountry)
+	}
+	return reasons
+}
+
+// apply sets the configured body on a response to a request only the country rules rejected
+func (c *countryRules) apply(resp *Response) {
+	if c.body == nil {
+		return
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Body = c.body
+}
@@ -0,0 +1,115 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountryRules(t *testing.T) {
+	path := writeTestMMDB(t, buildTestMMDB(t, 6, 28, "GeoLite2-City", testGeoIPNetworks))
+
+	newPlugin := func(t *testing.T, blocked, allowed []string, statusCode int, body string) *Plugin {
+		cfg := &Config{
+			Enabled:                true,
+			HeaderName:             "X-Real-IP",
+			ProcessHeaders:         []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:               true,
+			GeoIPDatabase:          path,
+			DenyIPs:                []string{"175.16.199.66/32"},
+			BlockedCountries:       blocked,
+			AllowedCountries:       allowed,
+			CountryStatusCode:      statusCode,
+			CountryRejectBody:      body,
+			RejectReasonHeaderName: "X-Reject-Reason",
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		blocked         []string
+		allowed         []string
+		statusCode      int
+		body            string
+		path            string
+		xff             string
+		expectedStatus  int
+		expectedReasons string
+		expectedBody    string
+	}{
+		{"Blocked", []string{"CN"}, nil, 0, "", "/test", "175.16.199.1", http.StatusForbidden, "blockedCountries", "Forbidden\n"},
+		{"BlockedCaseInsensitive", []string{"cn"}, nil, 0, "", "/test", "175.16.199.1", http.StatusForbidden, "blockedCountries", "Forbidden\n"},
+		{"CustomStatusAndBody", []string{"CN"}, nil, http.StatusUnavailableForLegalReasons, "Not available in your region", "/test", "175.16.199.1", http.StatusUnavailableForLegalReasons, "blockedCountries", "Not available in your region"},
+		{"NotBlocked", []string{"CN"}, nil, 0, "", "/test", "81.2.69.10", http.StatusOK, "", ""},
+		{"UnknownNotBlocked", []string{"CN"}, nil, 0, "", "/test", "8.8.8.8", http.StatusOK, "", ""},
+		{"Allowed", nil, []string{"GB", "US"}, 0, "", "/test", "2001:db8::1", http.StatusOK, "", ""},
+		{"NotAllowed", nil, []string{"GB", "US"}, 0, "", "/test", "175.16.199.1", http.StatusForbidden, "allowedCountries", "Forbidden\n"},
+		{"UnknownNotAllowed", nil, []string{"GB", "US"}, 0, "", "/test", "8.8.8.8", http.StatusForbidden, "allowedCountries", "Forbidden\n"},
+		{"UnresolvedNotAllowed", nil, []string{"GB", "US"}, 0, "", "/test", "", http.StatusForbidden, "allowedCountries", "Forbidden\n"},
+		{"IPRulesTakePrecedence", []string{"CN"}, nil, http.StatusUnavailableForLegalReasons, "Not available in your region", "/test", "175.16.199.66", http.StatusForbidden, "denyIPs,blockedCountries", "Forbidden\n"},
+		{"ACMEExempt", []string{"CN"}, nil, 0, "", "/.well-known/acme-challenge/token", "175.16.199.1", http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.blocked, tt.allowed, tt.statusCode, tt.body)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if tt.expectedStatus != http.StatusOK && rr.Body.String() != tt.expectedBody {
+				t.Errorf("expected body '%s', but got: '%s'", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			database   string
+			blocked    []string
+			allowed    []string
+			statusCode int
+		}{
+			{"NoDatabase", "", []string{"CN"}, nil, 0},
+			{"InvalidCode", path, []string{"China"}, nil, 0},
+			{"EmptyCode", path, nil, []string{""}, 0},
+			{"SuccessStatus", path, []string{"CN"}, nil, http.StatusOK},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.GeoIPDatabase = tt.database
+				cfg.BlockedCountries = tt.blocked
+				cfg.AllowedCountries = tt.allowed
+				cfg.CountryStatusCode = tt.statusCode
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err == nil {
+					t.Error("expected error, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Final decisions reported by debug logging
+const (
+	debugDecisionForwarded      = "forwarded"
+	debugDecisionRejected       = "rejected"
+	debugDecisionOutputsRemoved = "forwarded without outputs"
+	debugDecisionFailed         = "failed"
+)
+
+// sampler selects one request in rate, e.g. those whose resolution is logged in debug mode
+type sampler struct {
+	rate  int64 // Select one request in rate
+	count int64 // Requests seen, accessed atomically
+}
+
+// newSampler selects one request in rate; rates below 1 select every request
+func newSampler(rate int) *sampler {
+	if rate < 1 {
+		rate = 1
+	}
+	return &sampler{rate: int64(rate)}
+}
+
+// sample reports whether the current request is selected
+func (s *sampler) sample() bool {
+	if s == nil {
+		return false
+	}
+	return (atomic.AddInt64(&s.count, 1)-1)%s.rate == 0
+}
+
+// decisionReport starts the trace of a request when it is debug-sampled, the decision log is
+// enabled or the trace is audited, or returns nil when the request is not traced
+func (r *Resolver) decisionReport(req *http.Request, isTrusted bool, trustReason string) *DecisionReport {
+	debug := r.debugSampler.sample()
+	if !debug && r.decisionLog == nil && r.auditHeaderName == "" {
+		return nil
+	}
+	return &DecisionReport{
+		Enabled:     true,
+		RemoteAddr:  req.RemoteAddr,
+		Trusted:     isTrusted,
+		TrustReason: trustReason,
+
+		debug: debug,
+	}
+}
+
+// logDecision writes the trace of a debug-sampled request as a single line, so concurrent
+// requests do not interleave, and the decision to the decision log
+func (r *Resolver) logDecision(req *http.Request, report *DecisionReport, decision string) {
+	if report == nil {
+		return
+	}
+	if report.debug {
+		r.requestLogf(req, "debug: %s", formatDebugReport(req, report, decision))
+	}
+	r.decisionLog.log(r, req, report, decision)
+}
+
+// formatDebugReport renders the trust verdict, every evaluated header with its cleaned
+// candidates and depth selection, and the final decision
+func formatDebugReport(req *http.Request, report *DecisionReport, decision string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %s from %s trusted=%t (%s)", req.Method, req.URL.Path, report.RemoteAddr, report.Trusted, report.TrustReason)
+
+	for _, header := range report.Headers {
+		fmt.Fprintf(&b, "; %s depth=%d", header.HeaderName, header.Depth)
+		if header.Value != "" {
+			fmt.Fprintf(&b, " value=%q", header.Value)
+		}
+		if len(header.Candidates) > 0 {
+			candidates := make([]string, 0, len(header.Candidates))
+			selected := ""
+			for _, candidate := range header.Candidates {
+				if candidate.Rejected != "" {
+					candidates = append(candidates, fmt.Sprintf("%q(%s)", candidate.Raw, candidate.Rejected))
+					continue
+				}
+				candidates = append(candidates, candidate.IP)
+				if candidate.Selected {
+					selected = candidate.IP
+				}
+			}
+			fmt.Fprintf(&b, " candidates=[%s]", strings.Join(candidates, " "))
+			if selected != "" {
+				fmt.Fprintf(&b, " selected=%s", selected)
+			}
+		}
+		if header.Skipped != "" {
+			fmt.Fprintf(&b, " skipped=%q", header.Skipped)
+		}
+	}
+
+	if report.RealIP != "" {
+		fmt.Fprintf(&b, "; decision=%s realIP=%s source=%s[%d]", decision, report.RealIP, report.Source, report.Index)
+	} else {
+		fmt.Fprintf(&b, "; decision=%s realIP=none", decision)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) http.Handler {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.Debug = true
+		if modify != nil {
+			modify(cfg)
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	serve := func(plugin http.Handler, remoteAddr, xff string) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("TracesDecision", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, nil)
+
+		serve(plugin, "10.0.0.1:1234", "203.0.113.1, , 198.51.100.2:8080")
+
+		line := logs.String()
+		expected := []string{
+			"debug: GET /test from 10.0.0.1:1234 trusted=true (trustedIPs)",
+			`X-Forwarded-For depth=0 value="203.0.113.1, , 198.51.100.2:8080" candidates=[203.0.113.1 " "(empty) 198.51.100.2] selected=198.51.100.2`,
+			`clientAddress depth=-1 skipped="not reached"`,
+			"decision=forwarded realIP=198.51.100.2 source=X-Forwarded-For[1]",
+		}
+		for _, part := range expected {
+			if !strings.Contains(line, part) {
+				t.Errorf("expected debug log to contain %q, but got: %s", part, line)
+			}
+		}
+		if strings.Count(line, "\n") != 1 {
+			t.Errorf("expected a single log line, but got: %s", line)
+		}
+	})
+
+	t.Run("UntrustedSource", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, nil)
+
+		serve(plugin, "192.0.2.1:1234", "203.0.113.1")
+
+		line := logs.String()
+		for _, part := range []string{
+			"trusted=false (notTrusted)",
+			`X-Forwarded-For depth=0 skipped="untrusted source"`,
+			"decision=forwarded realIP=192.0.2.1 source=clientAddress[0]",
+		} {
+			if !strings.Contains(line, part) {
+				t.Errorf("expected debug log to contain %q, but got: %s", part, line)
+			}
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.DenyIPs = []string{"203.0.113.0/24"}
+		})
+
+		serve(plugin, "10.0.0.1:1234", "203.0.113.1")
+
+		if line := logs.String(); !strings.Contains(line, "decision=rejected (denyIPs) realIP=203.0.113.1") {
+			t.Errorf("expected rejected decision in debug log, but got: %s", line)
+		}
+	})
+
+	t.Run("Sampled", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.DebugSampleRate = 3
+		})
+
+		for i := 0; i < 7; i++ {
+			serve(plugin, "10.0.0.1:1234", "203.0.113.1")
+		}
+
+		if lines := strings.Count(logs.String(), "debug:"); lines != 3 {
+			t.Errorf("expected 3 sampled debug lines, but got %d: %s", lines, logs.String())
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.Debug = false
+		})
+
+		serve(plugin, "10.0.0.1:1234", "203.0.113.1")
+
+		if logs.Len() != 0 {
+			t.Errorf("expected no debug log, but got: %s", logs.String())
+		}
+	})
+
+	t.Run("NegativeSampleRate", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Debug = true
+		cfg.DebugSampleRate = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for negative debugSampleRate, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// depthOrdinals are the ordinals accepted in "<ordinal>-from-left" and "<ordinal>-from-right" depths
+var depthOrdinals = map[string]int{
+	"first":  1,
+	"second": 2,
+	"third":  3,
+	"fourth": 4,
+	"fifth":  5,
+}
+
+// parseDepth converts a configured depth into the signed index used by selectIndex: 0 is the
+// rightmost entry, n the (n+1)-th from the right, and -n the n-th from the left. Depths can be
+// numbers (also given as strings, as Traefik labels are) or keywords such as "first" (leftmost),
+// "last" (rightmost) and "second-from-left". A missing depth is the rightmost entry.
+func parseDepth(value interface{}) (int, error) {
+	switch depth := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return depth, nil
+	case int32:
+		return int(depth), nil
+	case int64:
+		return int(depth), nil
+	case float64:
+		if depth != math.Trunc(depth) {
+			return 0, fmt.Errorf("depth %v is not an integer", depth)
+		}
+		return int(depth), nil
+	case string:
+		return parseDepthString(depth)
+	default:
+		return 0, fmt.Errorf("depth %v has unsupported type %T", value, value)
+	}
+}
+
+// parseDepthString parses a depth given as a number or keyword
+func parseDepthString(value string) (int, error) {
+	keyword := strings.ToLower(strings.TrimSpace(value))
+	if depth, err := strconv.Atoi(keyword); err == nil {
+		return depth, nil
+	}
+
+	switch keyword {
+	case "first", "leftmost":
+		return -1, nil
+	case "last", "rightmost":
+		return 0, nil
+	}
+
+	if ordinal, side, ok := strings.Cut(keyword, "-from-"); ok {
+		if n, known := depthOrdinals[ordinal]; known {
+			switch side {
+			case "left":
+				return -n, nil
+			case "right":
+				return n - 1, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unknown depth %q (expected a number, \"first\", \"last\" or e.g. \"second-from-left\")", value)
+}
+
+// depthValue returns the depth configured for a processed header, or defaultDepth when it
+// omits one. The synthetic header holds a single address, so it is left alone.
+func depthValue(headerConfig HeaderConfig, defaultDepth interface{}, synthetic string) interface{} {
+	if headerConfig.Depth == nil && !isSynthetic(headerConfig.HeaderName, synthetic) {
+		return defaultDepth
+	}
+	return headerConfig.Depth
+}
+
+// parseDefaultDepth validates the defaultDepth configuration, which takes the same values as depth
+func parseDefaultDepth(name string, value interface{}) error {
+	if _, untrusted, err := parseUntrustedDepth(value); untrusted {
+		if err != nil {
+			return fmt.Errorf("%s: defaultDepth: %w", name, err)
+		}
+		return nil
+	}
+	if _, err := parseDepth(value); err != nil {
+		return fmt.Errorf("%s: defaultDepth: %w", name, err)
+	}
+	return nil
+}
+
+// parseDepths parses the depth of every processed header, defaultDepth standing in for
+// missing ones; "rightmost-untrusted" depths are left at 0 and parsed by parseUntrustedDepths
+func parseDepths(name string, headers []HeaderConfig, defaultDepth interface{}, synthetic string) ([]int, error) {
+	depths := make([]int, len(headers))
+	var problems configErrors
+	for i, headerConfig := range headers {
+		value := depthValue(headerConfig, defaultDepth, synthetic)
+		if _, untrusted, _ := parseUntrustedDepth(value); untrusted {
+			continue
+		}
+		depth, err := parseDepth(value)
+		if err != nil {
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): %w", name, i, headerConfig.HeaderName, err))
+			continue
+		}
+		depths[i] = depth
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return depths, nil
+}
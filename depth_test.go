@@ -0,0 +1,154 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseDepth(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected int
+	}{
+		{"Missing", nil, 0},
+		{"Int", 1, 1},
+		{"NegativeInt", -2, -2},
+		{"JSONNumber", float64(-1), -1},
+		{"NumericString", "2", 2},
+		{"NegativeNumericString", " -3 ", -3},
+		{"First", "first", -1},
+		{"Leftmost", "Leftmost", -1},
+		{"Last", "last", 0},
+		{"Rightmost", "rightmost", 0},
+		{"SecondFromLeft", "second-from-left", -2},
+		{"FirstFromRight", "first-from-right", 0},
+		{"ThirdFromRight", "third-from-right", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			depth, err := parseDepth(tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if depth != tt.expected {
+				t.Errorf("expected depth %d, but got %d", tt.expected, depth)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, value := range []interface{}{"middle", "tenth-from-left", "second-from-top", 1.5, true} {
+			if _, err := parseDepth(value); err == nil {
+				t.Errorf("expected error for depth %v, but got none", value)
+			}
+		}
+	})
+}
+
+func TestDepthSelection(t *testing.T) {
+	tests := []struct {
+		name       string
+		depth      interface{}
+		expectedIP string
+	}{
+		{"Leftmost", -1, "1.1.1.1"},
+		{"SecondFromLeft", -2, "2.2.2.2"},
+		{"SecondFromLeftKeyword", "second-from-left", "2.2.2.2"},
+		{"LastKeyword", "last", "4.4.4.4"},
+		{"LabelString", "1", "3.3.3.3"},
+		{"OutOfBoundsFromLeft", -5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: tt.depth}}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2, 3.3.3.3, 4.4.4.4")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("InvalidDepth", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: "middle"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown depth keyword, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestDefaultDepth(t *testing.T) {
+	tests := []struct {
+		name         string
+		defaultDepth interface{}
+		headers      []HeaderConfig
+		expectedIP   string
+	}{
+		{"Unset", nil, []HeaderConfig{{HeaderName: "X-Forwarded-For"}}, "10.0.0.2"},
+		{"Leftmost", -1, []HeaderConfig{{HeaderName: "X-Forwarded-For"}}, "203.0.113.1"},
+		{"Keyword", "second-from-left", []HeaderConfig{{HeaderName: "X-Forwarded-For"}}, "198.51.100.1"},
+		{"ExplicitDepthWins", "first", []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}, "10.0.0.2"},
+		{"RightmostUntrusted", "rightmost-untrusted", []HeaderConfig{{HeaderName: "X-Forwarded-For"}}, "198.51.100.1"},
+		{"ClientAddressIgnores", "rightmost-untrusted", []HeaderConfig{{HeaderName: "X-Missing"}, {HeaderName: "clientAddress"}}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"10.0.0.0/8"}
+			cfg.DefaultDepth = tt.defaultDepth
+			cfg.ProcessHeaders = tt.headers
+
+			handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.1, 198.51.100.1, 10.0.0.2")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.DefaultDepth = "middle"
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For"}, {HeaderName: "X-Real-IP"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil || strings.Count(err.Error(), "middle") != 1 {
+			t.Errorf("expected a single defaultDepth error, but got %v", err)
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
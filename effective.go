@@ -0,0 +1,102 @@
+package traefik_realip
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// EffectiveConfig returns, as indented JSON, the configuration the instance actually runs
+// with: settings left at zero are replaced by the defaults applied when it was created,
+// and secrets are redacted. It answers "what is this instance doing" at runtime.
+func (r *Resolver) EffectiveConfig() ([]byte, error) {
+	return json.MarshalIndent(r.effectiveConfig(), "", "  ")
+}
+
+// effectiveConfig is the redacted configuration with the defaults NewResolver applies filled in
+func (r *Resolver) effectiveConfig() Config {
+	config := r.redactedConfig()
+
+	config.DenyStatusCode = r.denyStatusCode
+	config.MaxOutputLength = r.maxOutputLength
+	config.MaxChainLength = r.maxChainLength
+	config.MaxHeaderLength = r.maxHeaderLength
+	config.OversizedHeaders = r.oversizedHeaders
+	config.HeaderInstances = r.headerInstances
+	config.Fallback = r.fallback
+	config.ZoneIdentifiers = r.zoneIdentifiers
+	config.ExoticIPv4 = r.exoticIPv4
+	config.AlreadyProcessed = r.alreadyProcessed
+	config.ChainValidation = r.chainValidation
+	config.ConflictPolicy = r.conflictPolicy
+	config.ResolvedProxyCheck = r.resolvedProxyCheck
+	config.RequireTLSAction = r.requireTLSAction
+	config.SyntheticHeaderName = r.syntheticHeaderName
+	if r.countries != nil {
+		config.CountryStatusCode = r.countries.status
+	}
+	if config.FailureMode == "" {
+		config.FailureMode = failureModeOpen
+	}
+	if config.ExpectedHopsAction == "" {
+		config.ExpectedHopsAction = expectedHopsFlag
+	}
+	if config.Consensus == "" {
+		config.Consensus = consensusOff
+	}
+
+	if config.TrustCacheSize == 0 {
+		config.TrustCacheSize = defaultTrustCacheSize
+	}
+	if config.TrustedIPsFileRefreshInterval <= 0 {
+		config.TrustedIPsFileRefreshInterval = int(defaultTrustedIPsFileRefreshInterval.Seconds())
+	}
+	if config.ReplayWindow == 0 {
+		config.ReplayWindow = int(defaultReplayWindow.Seconds())
+	}
+	if config.ReplayThreshold == 0 {
+		config.ReplayThreshold = defaultReplayThreshold
+	}
+	if config.GeoIPLanguage == "" {
+		config.GeoIPLanguage = defaultGeoIPLanguage
+	}
+	if config.IntrospectionTimeout <= 0 {
+		config.IntrospectionTimeout = int(defaultIntrospectionTimeout.Milliseconds())
+	}
+	if config.IntrospectionCacheTTL <= 0 {
+		config.IntrospectionCacheTTL = int(defaultIntrospectionCacheTTL.Seconds())
+	}
+	if config.VersionHeaderSampleRate < 1 {
+		config.VersionHeaderSampleRate = 1
+	}
+	if config.DebugSampleRate < 1 {
+		config.DebugSampleRate = 1
+	}
+	if config.DecisionLogLevel == "" {
+		config.DecisionLogLevel = decisionLogOff
+	}
+	if len(config.DecisionLogFields) == 0 && r.decisionLog != nil {
+		config.DecisionLogFields = defaultDecisionLogFields
+	}
+	if config.DecisionLogSampleRate < 1 {
+		config.DecisionLogSampleRate = 1
+	}
+	if config.AnomalyLogRateLimit == 0 {
+		config.AnomalyLogRateLimit = defaultAnomalyLogRateLimit
+	}
+
+	return config
+}
+
+// statusResponse answers the dump path with the effective configuration
+func (r *Resolver) statusResponse() *Response {
+	body, err := r.EffectiveConfig()
+	if err != nil {
+		logf(r.name, "failed to encode effective configuration: %v", err)
+		return &Response{Status: http.StatusInternalServerError}
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Cache-Control", "no-store")
+	return &Response{Status: http.StatusOK, Header: header, Body: body}
+}
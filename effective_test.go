@@ -0,0 +1,75 @@
+package traefik_realip
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	cfg := &Config{
+		Enabled:                   true,
+		HeaderName:                "X-Real-IP",
+		ProcessHeaders:            []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		TrustAll:                  true,
+		HashedHeaderName:          "X-Real-IP-Hash",
+		HashKey:                   "hash-secret",
+		TrustedSecretHeader:       "X-Edge-Secret",
+		TrustedSecretValue:        "edge-secret",
+		ReplayHeaderName:          "X-Replay",
+		IntrospectionClientSecret: "client-secret",
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	payload, err := handler.(*Plugin).EffectiveConfig()
+	if err != nil {
+		t.Fatalf("failed to encode effective configuration: %v", err)
+	}
+
+	for _, secret := range []string{"hash-secret", "edge-secret", "client-secret"} {
+		if strings.Contains(string(payload), secret) {
+			t.Errorf("expected %q to be redacted, but got: %s", secret, payload)
+		}
+	}
+
+	var effective Config
+	if err := json.Unmarshal(payload, &effective); err != nil {
+		t.Fatalf("failed to decode effective configuration: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"DenyStatusCode", effective.DenyStatusCode, defaultDenyStatusCode},
+		{"MaxOutputLength", effective.MaxOutputLength, defaultMaxOutputLength},
+		{"FailureMode", effective.FailureMode, failureModeOpen},
+		{"TrustCacheSize", effective.TrustCacheSize, defaultTrustCacheSize},
+		{"ReplayWindow", effective.ReplayWindow, 10},
+		{"ReplayThreshold", effective.ReplayThreshold, defaultReplayThreshold},
+		{"GeoIPLanguage", effective.GeoIPLanguage, defaultGeoIPLanguage},
+		{"IntrospectionTimeout", effective.IntrospectionTimeout, 500},
+		{"DebugSampleRate", effective.DebugSampleRate, 1},
+		{"HashKey", effective.HashKey, redactedValue},
+		{"TrustedSecretValue", effective.TrustedSecretValue, redactedValue},
+		{"HeaderName", effective.HeaderName, "X-Real-IP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %v, but got %v", tt.expected, tt.got)
+			}
+		})
+	}
+
+	if cfg.DenyStatusCode != 0 {
+		t.Error("expected the configuration passed to New to be left unchanged")
+	}
+}
@@ -0,0 +1,72 @@
+package traefik_realip
+
+import (
+	"net"
+)
+
+// IPv6 transition prefixes that carry an IPv4 address
+var (
+	sixToFourPrefix = mustParseCIDR("2002::/16")    // 6to4 (RFC 3056): the IPv4 follows the prefix
+	teredoPrefix    = mustParseCIDR("2001::/32")    // Teredo (RFC 4380): the client IPv4 is the last 32 bits, inverted
+	nat64Prefix     = mustParseCIDR("64:ff9b::/96") // NAT64 well-known prefix (RFC 6052): the IPv4 is the last 32 bits
+)
+
+// mustParseCIDR parses a network known to be valid
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// embeddedIPv4 returns the IPv4 address embedded in an IPv6 address by 6to4, Teredo or NAT64,
+// since abuse systems frequently work on IPv4 reputations. It is empty for other addresses,
+// including IPv4 and IPv4-mapped addresses, which are already written in IPv4 form.
+func embeddedIPv4(ip string) string {
+	parsed := parseAddress(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ""
+	}
+
+	switch {
+	case sixToFourPrefix.Contains(parsed):
+		return net.IP(parsed[2:6]).String()
+	case teredoPrefix.Contains(parsed):
+		client := make(net.IP, net.IPv4len)
+		for i := range client {
+			client[i] = parsed[12+i] ^ 0xff
+		}
+		return client.String()
+	case nat64Prefix.Contains(parsed):
+		return net.IP(parsed[12:16]).String()
+	default:
+		return ""
+	}
+}
+
+// ipv4Form returns the IPv4 representation of ip: the address itself for IPv4 and IPv4-mapped
+// addresses, the embedded address for 6to4, Teredo and NAT64, and empty for other IPv6 addresses
+func ipv4Form(ip string) string {
+	parsed := parseAddress(ip)
+	if parsed == nil {
+		return ""
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.String()
+	}
+	return embeddedIPv4(ip)
+}
+
+// setDerivedIP writes a client IP other than the emitted real IP to header, masked like the
+// real IP; with hashOnly it is withheld, since it identifies the client as much as the real IP does
+func (r *Resolver) setDerivedIP(out *outputWriter, header, ip string) {
+	if r.hashOnly {
+		out.req.Header.Del(header)
+		return
+	}
+	if r.anonymizer != nil && ip != "" {
+		ip = r.anonymizer.anonymize(ip)
+	}
+	out.set(header, ip)
+}
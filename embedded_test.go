@@ -0,0 +1,152 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmbeddedIPv4(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"2002:c000:204::1", "192.0.2.4"},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", "192.0.2.45"},
+		{"64:ff9b::192.0.2.33", "192.0.2.33"},
+		{"64:ff9b::c000:221", "192.0.2.33"},
+		{"fe80::1%eth0", ""},
+		{"2001:db8::1", ""},
+		{"::ffff:192.0.2.1", ""},
+		{"192.0.2.1", ""},
+		{"unknown", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if result := embeddedIPv4(tt.ip); result != tt.expected {
+			t.Errorf("embeddedIPv4(%q) = %q, expected %q", tt.ip, result, tt.expected)
+		}
+	}
+}
+
+func TestEmbeddedIPv4Header(t *testing.T) {
+	tests := []struct {
+		name             string
+		xff              string
+		anonymize        bool
+		expectedEmbedded string
+	}{
+		{"SixToFour", "2002:c000:204::1", false, "192.0.2.4"},
+		{"Teredo", "2001:0:4136:e378:8000:63bf:3fff:fdd2", false, "192.0.2.45"},
+		{"NAT64", "64:ff9b::198.51.100.7", false, "198.51.100.7"},
+		{"NativeIPv6", "2001:db8::1", false, ""},
+		{"IPv4", "203.0.113.5", false, ""},
+		{"Anonymized", "64:ff9b::198.51.100.7", true, "198.51.100.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+			cfg.EmbeddedIPv4HeaderName = "X-Real-IP-Embedded-IPv4"
+			cfg.Anonymize = tt.anonymize
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			req.Header.Set("X-Real-IP-Embedded-IPv4", "10.0.0.1")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if embedded := req.Header.Get("X-Real-IP-Embedded-IPv4"); embedded != tt.expectedEmbedded {
+				t.Errorf("expected X-Real-IP-Embedded-IPv4 '%s', but got: '%s'", tt.expectedEmbedded, embedded)
+			}
+		})
+	}
+
+	t.Run("ReservedName", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.EmbeddedIPv4HeaderName = "Host"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a reserved embeddedIPv4HeaderName, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestIPv4Form(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"64:ff9b::192.0.2.33", "192.0.2.33"},
+		{"2001:db8::1", ""},
+		{"unknown", ""},
+	}
+
+	for _, tt := range tests {
+		if result := ipv4Form(tt.ip); result != tt.expected {
+			t.Errorf("ipv4Form(%q) = %q, expected %q", tt.ip, result, tt.expected)
+		}
+	}
+}
+
+func TestIPv4Header(t *testing.T) {
+	tests := []struct {
+		name         string
+		xff          string
+		hashOnly     bool
+		expectedIP   string
+		expectedIPv4 string
+	}{
+		{"IPv4", "203.0.113.5", false, "203.0.113.5", "203.0.113.5"},
+		{"MappedIPv6", "::ffff:203.0.113.5", false, "::ffff:203.0.113.5", "203.0.113.5"},
+		{"EmbeddedIPv6", "2002:c000:204::1", false, "2002:c000:204::1", "192.0.2.4"},
+		{"NativeIPv6", "2001:db8::1", false, "2001:db8::1", ""},
+		{"Unresolved", "", false, "", ""},
+		{"HashOnly", "203.0.113.5", true, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+			cfg.IPv4HeaderName = "X-Real-IP-V4"
+			if tt.hashOnly {
+				cfg.HashOnly = true
+				cfg.HashedHeaderName = "X-Real-IP-Hash"
+				cfg.HashKey = "secret"
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Real-IP-V4", "10.0.0.1")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if ipv4 := req.Header.Get("X-Real-IP-V4"); ipv4 != tt.expectedIPv4 {
+				t.Errorf("expected X-Real-IP-V4 '%s', but got: '%s'", tt.expectedIPv4, ipv4)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultDenyStatusCode is the status returned to requests whose real IP is denied or not allowed
+const defaultDenyStatusCode = http.StatusForbidden
+
+// Reason codes of the rules that reject a request, reported in this order
+const (
+	enforceReasonDenied     = "denyIPs"
+	enforceReasonNotAllowed = "allowOnlyIPs"
+	rejectReasonFailure     = "failureMode"
+)
+
+// Response is how a request stopped by Process is answered instead of being passed on.
+type Response struct {
+	Status  int         // HTTP status code
+	Reasons []string    // Reason codes of every rule that rejected the request, in a fixed order
+	Header  http.Header // Headers set on the response
+	Body    []byte      // Response body; the status text when nil
+}
+
+// write answers the request with the response
+func (resp *Response) write(rw http.ResponseWriter) {
+	for header, values := range resp.Header {
+		rw.Header()[header] = values
+	}
+	if resp.Body == nil {
+		http.Error(rw, http.StatusText(resp.Status), resp.Status)
+		return
+	}
+	rw.WriteHeader(resp.Status)
+	_, _ = rw.Write(resp.Body)
+}
+
+// enforce checks the resolved real IP and the country it geolocates to against every
+// enforcement rule, and returns the rejection carrying the reason codes of all rules that
+// matched, so the reported reasons do not depend on rule order. Exempt paths are never rejected.
+// With allowOnlyIPs, allowedCountries or the reject fallback, requests without a resolved real IP
+// are rejected as well.
+// The IP rules' denyStatusCode takes precedence over the country rules' status and body.
+func (r *Resolver) enforce(req *http.Request, realIP, countryCode string) *Response {
+	if (r.denyIPs == nil && r.allowOnlyIPs == nil && r.countries == nil && r.fallback != fallbackReject) || r.isEnforcementExempt(req) {
+		return nil
+	}
+
+	ip := parseAddress(realIP)
+	var reasons []string
+
+	if r.denyIPs != nil && ip != nil {
+		if denied, _, _ := r.denyIPs.IsContained(ip); denied {
+			reasons = append(reasons, enforceReasonDenied)
+		}
+	}
+
+	if r.allowOnlyIPs != nil {
+		allowed := false
+		if ip != nil {
+			allowed, _, _ = r.allowOnlyIPs.IsContained(ip)
+		}
+		if !allowed {
+			reasons = append(reasons, enforceReasonNotAllowed)
+		}
+	}
+
+	if realIP == "" && r.fallback == fallbackReject {
+		reasons = append(reasons, rejectReasonUnresolved)
+	}
+
+	if len(reasons) > 0 {
+		if r.countries != nil {
+			reasons = append(reasons, r.countries.check(countryCode)...)
+		}
+		return r.reject(r.denyStatusCode, reasons...)
+	}
+
+	if r.countries != nil {
+		if reasons = r.countries.check(countryCode); len(reasons) > 0 {
+			resp := r.reject(r.countries.status, reasons...)
+			r.countries.apply(resp)
+			return resp
+		}
+	}
+
+	return nil
+}
+
+// reject counts a rejected request and returns the response it is answered with,
+// carrying all reason codes in rejectReasonHeaderName when configured
+func (r *Resolver) reject(status int, reasons ...string) *Response {
+	atomic.AddInt64(&r.stats.rejected, 1)
+
+	resp := &Response{Status: status, Reasons: reasons}
+	if r.rejectReasonHeaderName != "" {
+		resp.Header = http.Header{}
+		resp.Header.Set(r.rejectReasonHeaderName, strings.Join(reasons, ","))
+	}
+	return resp
+}
@@ -0,0 +1,244 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDenyIPs(t *testing.T) {
+	newPlugin := func(t *testing.T, statusCode int) (*Plugin, *bool) {
+		nextCalled := false
+		next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+		})
+
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:       true,
+			DenyIPs:        []string{"203.0.113.0/24", "2001:db8::/32"},
+			DenyStatusCode: statusCode,
+		}
+
+		handler, err := New(context.TODO(), next, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin), &nextCalled
+	}
+
+	tests := []struct {
+		name           string
+		statusCode     int
+		path           string
+		xff            string
+		expectedStatus int
+		expectedNext   bool
+	}{
+		{"DeniedIPv4", 0, "/test", "203.0.113.7", http.StatusForbidden, false},
+		{"DeniedIPv6", 0, "/test", "2001:db8::1", http.StatusForbidden, false},
+		{"CustomStatus", http.StatusTooManyRequests, "/test", "203.0.113.7", http.StatusTooManyRequests, false},
+		{"Allowed", 0, "/test", "198.51.100.7", http.StatusOK, true},
+		{"Unresolved", 0, "/test", "", http.StatusOK, true},
+		{"ACMEExempt", 0, "/.well-known/acme-challenge/token", "203.0.113.7", http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin, nextCalled := newPlugin(t, tt.statusCode)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if *nextCalled != tt.expectedNext {
+				t.Errorf("expected next handler called to be %v, but got %v", tt.expectedNext, *nextCalled)
+			}
+
+			expectedRejected := int64(0)
+			if !tt.expectedNext {
+				expectedRejected = 1
+			}
+			if stats := plugin.Stats(); stats.Rejected != expectedRejected {
+				t.Errorf("expected %d rejected requests, but got %d", expectedRejected, stats.Rejected)
+			}
+		})
+	}
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			denyIPs    []string
+			statusCode int
+		}{
+			{"InvalidCIDR", []string{"not-a-cidr"}, 0},
+			{"SuccessStatus", []string{"203.0.113.0/24"}, http.StatusOK},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.DenyIPs = tt.denyIPs
+				cfg.DenyStatusCode = tt.statusCode
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err == nil {
+					t.Error("expected error, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+			})
+		}
+	})
+}
+
+func TestAllowOnlyIPs(t *testing.T) {
+	nextCalled := false
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextCalled = true
+	})
+
+	cfg := &Config{
+		Enabled:        true,
+		HeaderName:     "X-Real-IP",
+		ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		TrustAll:       true,
+		AllowOnlyIPs:   []string{"192.0.2.0/24", "2001:db8::/32"},
+		DenyIPs:        []string{"192.0.2.66/32"},
+	}
+
+	plugin, err := New(context.TODO(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		xff            string
+		expectedStatus int
+	}{
+		{"AllowedIPv4", "/admin", "192.0.2.10", http.StatusOK},
+		{"AllowedIPv6", "/admin", "2001:db8::10", http.StatusOK},
+		{"Outside", "/admin", "198.51.100.10", http.StatusForbidden},
+		{"DenyTakesPrecedence", "/admin", "192.0.2.66", http.StatusForbidden},
+		{"UnresolvedFailsClosed", "/admin", "", http.StatusForbidden},
+		{"ACMEExempt", "/.well-known/acme-challenge/token", "198.51.100.10", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled = false
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if nextCalled != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("expected next handler called to be %v, but got %v", tt.expectedStatus == http.StatusOK, nextCalled)
+			}
+		})
+	}
+
+	t.Run("InvalidCIDR", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.AllowOnlyIPs = []string{"not-a-cidr"}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an invalid CIDR, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestEnforcementReasons(t *testing.T) {
+	newPlugin := func(t *testing.T, reasonHeader string) *Plugin {
+		cfg := &Config{
+			Enabled:                true,
+			HeaderName:             "X-Real-IP",
+			ProcessHeaders:         []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:               true,
+			DenyIPs:                []string{"203.0.113.0/24"},
+			AllowOnlyIPs:           []string{"198.51.100.0/24"},
+			RejectReasonHeaderName: reasonHeader,
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		xff             string
+		expectedStatus  int
+		expectedReasons string
+	}{
+		{"AllRulesMatch", "203.0.113.7", http.StatusForbidden, "denyIPs,allowOnlyIPs"},
+		{"OnlyAllowOnly", "192.0.2.7", http.StatusForbidden, "allowOnlyIPs"},
+		{"Unresolved", "", http.StatusForbidden, "allowOnlyIPs"},
+		{"Allowed", "198.51.100.7", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, "X-Reject-Reason")
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rw := httptest.NewRecorder()
+			plugin.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rw.Code)
+			}
+			if reasons := rw.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+		})
+	}
+
+	t.Run("ResolverResponse", func(t *testing.T) {
+		plugin := newPlugin(t, "")
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		resp := plugin.Process(req)
+		if resp == nil {
+			t.Fatal("expected request to be rejected")
+		}
+		if strings.Join(resp.Reasons, ",") != "denyIPs,allowOnlyIPs" {
+			t.Errorf("expected all reasons, but got: %v", resp.Reasons)
+		}
+		if resp.Header != nil {
+			t.Errorf("expected no response headers without rejectReasonHeaderName, but got: %v", resp.Header)
+		}
+		if rejected := plugin.Stats().Rejected; rejected != 1 {
+			t.Errorf("expected the request to be counted once, but got %d", rejected)
+		}
+	})
+}
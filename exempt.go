@@ -0,0 +1,37 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// acmeChallengePath is always exempt from enforcement so certificate issuance keeps working
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// newExemptPaths validates the configured exempt path prefixes and adds the ACME challenge path
+func newExemptPaths(name string, configured []string) ([]string, error) {
+	paths := []string{acmeChallengePath}
+	for _, path := range configured {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%s: exemptPaths entry %q must start with '/'", name, path)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// isEnforcementExempt reports whether req targets a path that rejecting or enforcing
+// features must let through untouched, or is outside enforceMatch. Header enrichment
+// still applies to these requests.
+func (r *Resolver) isEnforcementExempt(req *http.Request) bool {
+	if !r.enforceMatch.matches(req) {
+		return true
+	}
+	for _, path := range r.exemptPaths {
+		if strings.HasPrefix(req.URL.Path, path) {
+			return true
+		}
+	}
+	return false
+}
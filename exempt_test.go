@@ -0,0 +1,65 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExemptPaths(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.ExemptPaths = []string{"/healthz", "/.well-known/pki-validation/"}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/.well-known/acme-challenge/token123", true},
+		{"/.well-known/pki-validation/file.txt", true},
+		{"/healthz", true},
+		{"/.well-known/acme-challenge", false},
+		{"/.well-known/security.txt", false},
+		{"/api/users", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if exempt := plugin.isEnforcementExempt(req); exempt != tt.expected {
+				t.Errorf("expected exempt %v for %s, but got %v", tt.expected, tt.path, exempt)
+			}
+		})
+	}
+
+	t.Run("ACMEAlwaysExempt", func(t *testing.T) {
+		handler, err := New(context.TODO(), &noopHandler{}, CreateConfig(), pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/token123", nil)
+		if !handler.(*Plugin).isEnforcementExempt(req) {
+			t.Error("expected the ACME challenge path to be exempt by default")
+		}
+	})
+
+	t.Run("RelativePath", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ExemptPaths = []string{"healthz"}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a path not starting with '/', but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
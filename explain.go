@@ -0,0 +1,90 @@
+package traefik_realip
+
+import (
+	"net/http"
+)
+
+// Reasons a processHeaders entry did not produce the real IP
+const (
+	skipReasonUntrusted        = "untrusted source"
+	skipReasonMissing          = "header not present"
+	skipReasonNoCandidates     = "no candidates"
+	skipReasonDepthOutOfBounds = "depth out of bounds"
+	skipReasonNotReached       = "not reached"
+	skipReasonReadFailed       = "read failed"
+	skipReasonTooLong          = "value too long"
+	skipReasonMalformed        = "not an IP at depth"
+)
+
+// Reasons a candidate in a header value was rejected
+const (
+	rejectReasonEmpty = "empty"
+)
+
+// DecisionReport is a structured trace of how the real IP of a request was resolved.
+type DecisionReport struct {
+	Enabled     bool           `json:"enabled"`               // Whether the plugin processes requests at all
+	RemoteAddr  string         `json:"remoteAddr"`            // Connection address the trust verdict is based on
+	Trusted     bool           `json:"trusted"`               // Trust verdict for the source
+	TrustReason string         `json:"trustReason,omitempty"` // Why the source was (or was not) trusted
+	Headers     []HeaderReport `json:"headers,omitempty"`     // Every configured header, in processing order
+	RealIP      string         `json:"realIP"`                // Resolved real IP ("" if none)
+	Source      string         `json:"source,omitempty"`      // Header that produced the real IP
+	Index       int            `json:"index"`                 // Position of the real IP in the source header, counted from the left
+	Fallback    string         `json:"fallback,omitempty"`    // Fallback that produced the real IP because no header yielded one
+
+	debug bool // Whether the trace is written to the debug log
+}
+
+// HeaderReport describes how a single processHeaders entry was evaluated.
+type HeaderReport struct {
+	HeaderName string            `json:"headerName"`           // Configured header name
+	Depth      int               `json:"depth"`                // Configured depth
+	Value      string            `json:"value,omitempty"`      // Raw header value that was read
+	Candidates []CandidateReport `json:"candidates,omitempty"` // Comma-separated entries of the value
+	Selected   bool              `json:"selected"`             // Whether this header produced the real IP
+	Skipped    string            `json:"skipped,omitempty"`    // Why the header did not produce the real IP
+}
+
+// CandidateReport describes a single comma-separated entry of a header value.
+type CandidateReport struct {
+	Raw      string `json:"raw"`                // Entry as found in the header
+	IP       string `json:"ip,omitempty"`       // Entry after whitespace and port removal
+	Port     string `json:"port,omitempty"`     // Port removed from the entry, if any
+	Selected bool   `json:"selected"`           // Whether this entry is the real IP
+	Rejected string `json:"rejected,omitempty"` // Why the entry was discarded
+}
+
+// markSelected flags the header and the candidate at index (counted among non-rejected candidates) as selected.
+func (h *HeaderReport) markSelected(index int) {
+	h.Selected = true
+	for i := range h.Candidates {
+		if h.Candidates[i].Rejected != "" {
+			continue
+		}
+		if index == 0 {
+			h.Candidates[i].Selected = true
+			return
+		}
+		index--
+	}
+}
+
+// Explain returns a structured trace of how the real IP would be resolved for req:
+// the trust verdict, every header considered, every candidate cleaned and why any of
+// them were rejected. The request is not modified.
+func (r *Resolver) Explain(req *http.Request) DecisionReport {
+	report := DecisionReport{
+		Enabled:    r.enabled,
+		RemoteAddr: req.RemoteAddr,
+	}
+	if !r.enabled {
+		return report
+	}
+
+	report.Trusted, report.TrustReason = r.trustVerdict(req)
+
+	r.resolveOutput(req, report.Trusted, &report)
+
+	return report
+}
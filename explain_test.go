@@ -0,0 +1,182 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	cfg := &Config{
+		Enabled:    true,
+		HeaderName: "X-Real-IP",
+		ProcessHeaders: []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP", Depth: -1},
+			{HeaderName: "X-Forwarded-For", Depth: 5},
+			{HeaderName: "X-Real-IP", Depth: 0},
+			{HeaderName: "clientAddress", Depth: -1},
+		},
+		ForceOverwrite: true,
+		TrustAll:       false,
+		TrustedIPs:     []string{"10.0.0.0/8"},
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	p := handler.(*Plugin)
+
+	t.Run("TrustedSource", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.1, 10.0.0.3")
+		req.Header.Set("X-Real-IP", "198.51.100.1, , 198.51.100.2:8080")
+
+		report := p.Explain(req)
+
+		if !report.Trusted || report.TrustReason != trustReasonTrustedIPs {
+			t.Errorf("expected trusted verdict from trustedIPs, but got trusted=%v reason=%q", report.Trusted, report.TrustReason)
+		}
+		if report.RealIP != "198.51.100.2" || report.Source != "X-Real-IP" || report.Index != 1 {
+			t.Errorf("expected 198.51.100.2 from X-Real-IP at index 1, but got %q from %q at %d", report.RealIP, report.Source, report.Index)
+		}
+		if len(report.Headers) != 4 {
+			t.Fatalf("expected 4 header reports, but got %d", len(report.Headers))
+		}
+
+		expectedSkips := []string{skipReasonMissing, skipReasonDepthOutOfBounds, "", skipReasonNotReached}
+		for i, expected := range expectedSkips {
+			if report.Headers[i].Skipped != expected {
+				t.Errorf("expected header %d (%s) skip reason %q, but got %q", i, report.Headers[i].HeaderName, expected, report.Headers[i].Skipped)
+			}
+		}
+
+		realIPReport := report.Headers[2]
+		if !realIPReport.Selected || len(realIPReport.Candidates) != 3 {
+			t.Fatalf("expected selected X-Real-IP report with 3 candidates, but got %+v", realIPReport)
+		}
+		if realIPReport.Candidates[1].Rejected != rejectReasonEmpty {
+			t.Errorf("expected empty candidate to be rejected, but got %+v", realIPReport.Candidates[1])
+		}
+		last := realIPReport.Candidates[2]
+		if !last.Selected || last.IP != "198.51.100.2" || last.Port != "8080" {
+			t.Errorf("expected last candidate to be selected with port 8080, but got %+v", last)
+		}
+
+		// Explain must not modify the request
+		if req.Header.Get("X-Real-IP") != "198.51.100.1, , 198.51.100.2:8080" {
+			t.Errorf("expected request headers to be untouched, but got X-Real-IP: %q", req.Header.Get("X-Real-IP"))
+		}
+	})
+
+	t.Run("UntrustedSource", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "8.8.8.8:1234"
+		req.Header.Set("CF-Connecting-IP", "1.2.3.4")
+
+		report := p.Explain(req)
+
+		if report.Trusted || report.TrustReason != trustReasonNotTrusted {
+			t.Errorf("expected untrusted verdict, but got trusted=%v reason=%q", report.Trusted, report.TrustReason)
+		}
+		for i := 0; i < 3; i++ {
+			if report.Headers[i].Skipped != skipReasonUntrusted {
+				t.Errorf("expected header %d to be skipped as untrusted, but got %q", i, report.Headers[i].Skipped)
+			}
+		}
+		if report.RealIP != "8.8.8.8" || report.Source != "clientAddress" {
+			t.Errorf("expected 8.8.8.8 from clientAddress, but got %q from %q", report.RealIP, report.Source)
+		}
+	})
+
+	t.Run("MatchesServeHTTP", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		req.Header.Set("CF-Connecting-IP", "203.0.113.9")
+
+		report := p.Explain(req)
+		p.ServeHTTP(httptest.NewRecorder(), req)
+
+		if report.RealIP != req.Header.Get("X-Real-IP") {
+			t.Errorf("expected Explain to match ServeHTTP, but got %q and %q", report.RealIP, req.Header.Get("X-Real-IP"))
+		}
+	})
+
+	t.Run("MatchesServeHTTPAfterResolution", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			configure  func(cfg *Config)
+			headers    map[string]string
+			expectedIP string
+		}{
+			{
+				name:       "Hardened",
+				configure:  func(cfg *Config) { cfg.InvalidOutputPlaceholder = "invalid" },
+				headers:    map[string]string{"X-Forwarded-For": "admin"},
+				expectedIP: "invalid",
+			},
+			{
+				name:       "ConflictIgnored",
+				configure:  func(cfg *Config) { cfg.ConflictPolicy = conflictIgnore },
+				headers:    map[string]string{"CF-Connecting-IP": "203.0.113.1", "X-Forwarded-For": "198.51.100.1"},
+				expectedIP: "10.0.0.2",
+			},
+			{
+				name:       "ResolvedProxyCorrected",
+				configure:  func(cfg *Config) { cfg.ResolvedProxyCheck = resolvedProxyCorrect },
+				headers:    map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.3"},
+				expectedIP: "203.0.113.1",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.TrustAll = false
+				cfg.TrustedIPs = []string{"10.0.0.0/8"}
+				cfg.ProcessHeaders = []HeaderConfig{
+					{HeaderName: "CF-Connecting-IP"},
+					{HeaderName: "X-Forwarded-For", Depth: -1},
+					{HeaderName: "clientAddress"},
+				}
+				tt.configure(cfg)
+				handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err != nil {
+					t.Fatalf("failed to create plugin: %v", err)
+				}
+				plugin := handler.(*Plugin)
+
+				req := httptest.NewRequest(http.MethodGet, "/test", nil)
+				req.RemoteAddr = "10.0.0.2:1234"
+				for header, value := range tt.headers {
+					req.Header.Set(header, value)
+				}
+
+				report := plugin.Explain(req)
+				result := plugin.Resolve(req)
+				plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+				if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+					t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+				}
+				if report.RealIP != tt.expectedIP || result.IP != tt.expectedIP {
+					t.Errorf("expected Explain and Resolve to give '%s', but got '%s' and '%s'", tt.expectedIP, report.RealIP, result.IP)
+				}
+			})
+		}
+	})
+
+	t.Run("DisabledPlugin", func(t *testing.T) {
+		handler, err := New(context.TODO(), &noopHandler{}, &Config{Enabled: false, TrustAll: true}, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		report := handler.(*Plugin).Explain(httptest.NewRequest(http.MethodGet, "/test", nil))
+		if report.Enabled || len(report.Headers) != 0 {
+			t.Errorf("expected empty report for disabled plugin, but got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fallbacks applied when no processed header yields an IP
+const (
+	fallbackEmpty         = "empty"
+	fallbackRemoteAddr    = "remoteAddr"
+	fallbackReject        = "reject"
+	fallbackLastHeaderRaw = "lastHeaderRaw"
+)
+
+// rejectReasonUnresolved is the reason code of requests rejected by the reject fallback
+const rejectReasonUnresolved = "fallback"
+
+// parseFallback validates the fallback configuration, defaulting to empty
+func parseFallback(name, fallback string) (string, error) {
+	switch fallback {
+	case "":
+		return fallbackEmpty, nil
+	case fallbackEmpty, fallbackRemoteAddr, fallbackReject, fallbackLastHeaderRaw:
+		return fallback, nil
+	default:
+		return "", fmt.Errorf("%s: fallback must be %q, %q, %q or %q, got %q", name, fallbackEmpty, fallbackRemoteAddr, fallbackReject, fallbackLastHeaderRaw, fallback)
+	}
+}
+
+// fallbackResolution returns the resolution used when no processed header yielded an IP.
+// remoteAddr uses the connection address; lastHeaderRaw passes on the trimmed, unvalidated
+// value of the last processed header that was read. Other fallbacks leave the IP empty.
+func (r *Resolver) fallbackResolution(remoteAddr, lastHeader, lastValue string) (resolution, bool) {
+	switch r.fallback {
+	case fallbackRemoteAddr:
+		ip, port := r.splitIPAddress(remoteAddr)
+		if ip == "" {
+			return resolution{}, false
+		}
+		return resolution{ip: ip, port: port, header: r.syntheticSource(), chain: []string{ip}}, true
+	case fallbackLastHeaderRaw:
+		value := strings.TrimSpace(lastValue)
+		if value == "" {
+			return resolution{}, false
+		}
+		return resolution{ip: value, header: lastHeader, chain: []string{value}}, true
+	default:
+		return resolution{}, false
+	}
+}
@@ -0,0 +1,104 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFallback(t *testing.T) {
+	newPlugin := func(t *testing.T, fallback string) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}, {HeaderName: "X-Client", Depth: 0}}
+		cfg.SourceHeaderName = "X-Real-IP-Source"
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+		cfg.Fallback = fallback
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		fallback        string
+		path            string
+		remoteAddr      string
+		headers         map[string]string
+		expectedStatus  int
+		expectedIP      string
+		expectedSource  string
+		expectedReasons string
+	}{
+		{"DefaultEmpty", "", "/test", "10.0.0.1:1234", nil, http.StatusOK, "", "", ""},
+		{"HeaderWins", fallbackRemoteAddr, "/test", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.2"}, http.StatusOK, "203.0.113.1", "X-Forwarded-For[0]", ""},
+		{"RemoteAddr", fallbackRemoteAddr, "/test", "10.0.0.1:1234", nil, http.StatusOK, "10.0.0.1", "clientAddress[0]", ""},
+		{"RemoteAddrForUntrusted", fallbackRemoteAddr, "/test", "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.2"}, http.StatusOK, "192.0.2.1", "clientAddress[0]", ""},
+		{"Reject", fallbackReject, "/test", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, http.StatusForbidden, "", "", "fallback"},
+		{"RejectExemptPath", fallbackReject, "/.well-known/acme-challenge/token", "10.0.0.1:1234", nil, http.StatusOK, "", "", ""},
+		{"ResolvedNotRejected", fallbackReject, "/test", "10.0.0.1:1234", map[string]string{"X-Client": "198.51.100.1"}, http.StatusOK, "198.51.100.1", "X-Client[0]", ""},
+		{"LastHeaderRaw", fallbackLastHeaderRaw, "/test", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": " 203.0.113.1 "}, http.StatusOK, "203.0.113.1", "X-Forwarded-For[0]", ""},
+		{"LastHeaderRawNotAnIP", fallbackLastHeaderRaw, "/test", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1", "X-Client": " , "}, http.StatusOK, "", "", ""},
+		{"LastHeaderRawNothingRead", fallbackLastHeaderRaw, "/test", "10.0.0.1:1234", nil, http.StatusOK, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.fallback)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if source := req.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected source '%s', but got: '%s'", tt.expectedSource, source)
+			}
+		})
+	}
+
+	t.Run("Explained", func(t *testing.T) {
+		plugin := newPlugin(t, fallbackRemoteAddr)
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+
+		report := plugin.Explain(req)
+		if report.RealIP != "10.0.0.1" || report.Fallback != fallbackRemoteAddr {
+			t.Errorf("expected real IP '10.0.0.1' from the remoteAddr fallback, but got '%s' (fallback '%s')", report.RealIP, report.Fallback)
+		}
+	})
+
+	t.Run("InvalidFallback", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Fallback = "deny"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown fallback, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
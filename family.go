@@ -0,0 +1,53 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IP families a processHeaders entry can be restricted to
+const (
+	familyAny  = "any"
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+)
+
+// rejectReasonFamily marks candidates of a family the header is not restricted to
+const rejectReasonFamily = "wrong family"
+
+// skipReasonNoFamily marks headers whose candidates are all of another family
+const skipReasonNoFamily = "no candidates of family"
+
+// parseFamilies validates the family of every processed header, defaulting to any
+func parseFamilies(name string, headers []HeaderConfig) ([]string, error) {
+	families := make([]string, len(headers))
+	var problems configErrors
+	for i, headerConfig := range headers {
+		switch family := strings.ToLower(headerConfig.Family); family {
+		case "":
+			families[i] = familyAny
+		case familyAny, familyIPv4, familyIPv6:
+			families[i] = family
+		default:
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): family must be %q, %q or %q, got %q",
+				name, i, headerConfig.HeaderName, familyIPv4, familyIPv6, familyAny, headerConfig.Family))
+		}
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return families, nil
+}
+
+// inFamily reports whether a cleaned candidate belongs to family. With a family other than
+// any, candidates that are not IP addresses belong to none; IPv4-mapped IPv6 addresses are IPv4.
+func inFamily(family, ip string) bool {
+	if family == "" || family == familyAny {
+		return true
+	}
+	parsed := parseAddress(ip)
+	if parsed == nil {
+		return false
+	}
+	return (parsed.To4() != nil) == (family == familyIPv4)
+}
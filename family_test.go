@@ -0,0 +1,114 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInFamily(t *testing.T) {
+	tests := []struct {
+		family   string
+		ip       string
+		expected bool
+	}{
+		{familyAny, "unknown", true},
+		{"", "2001:db8::1", true},
+		{familyIPv4, "192.0.2.1", true},
+		{familyIPv4, "::ffff:192.0.2.1", true},
+		{familyIPv4, "2001:db8::1", false},
+		{familyIPv4, "unknown", false},
+		{familyIPv6, "2001:db8::1", true},
+		{familyIPv6, "fe80::1%eth0", true},
+		{familyIPv6, "192.0.2.1", false},
+	}
+
+	for _, tt := range tests {
+		if result := inFamily(tt.family, tt.ip); result != tt.expected {
+			t.Errorf("inFamily(%q, %q) = %v, expected %v", tt.family, tt.ip, result, tt.expected)
+		}
+	}
+}
+
+func TestHeaderFamily(t *testing.T) {
+	tests := []struct {
+		name       string
+		family     string
+		depth      interface{}
+		xff        string
+		expectedIP string
+	}{
+		{"AnyByDefault", "", 0, "192.0.2.1, 2001:db8::1", "2001:db8::1"},
+		{"IPv4SkipsRightmostIPv6", "ipv4", 0, "192.0.2.1, 2001:db8::1", "192.0.2.1"},
+		{"IPv6SkipsRightmostIPv4", "IPv6", 0, "2001:db8::1, 192.0.2.1", "2001:db8::1"},
+		{"DepthCountsFamilyOnly", "ipv4", 1, "192.0.2.1, 2001:db8::1, 198.51.100.1, 2001:db8::2", "192.0.2.1"},
+		{"LeftmostOfFamily", "ipv6", "first", "192.0.2.1, 2001:db8::1, 2001:db8::2", "2001:db8::1"},
+		{"NoEntryOfFamilyFallsThrough", "ipv4", 0, "2001:db8::1", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: tt.depth, Family: tt.family},
+				{HeaderName: "clientAddress"},
+			}
+			cfg.StrictMode = true
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, but got %d", http.StatusOK, rr.Code)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("Explained", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Family: familyIPv4}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "2001:db8::1")
+		report := plugin.(*Plugin).Explain(req)
+
+		if len(report.Headers) != 1 || len(report.Headers[0].Candidates) != 1 {
+			t.Fatalf("expected one header with one candidate, got %+v", report.Headers)
+		}
+		if skipped := report.Headers[0].Skipped; skipped != skipReasonNoFamily {
+			t.Errorf("expected header skipped as %q, but got %q", skipReasonNoFamily, skipped)
+		}
+		if rejected := report.Headers[0].Candidates[0].Rejected; rejected != rejectReasonFamily {
+			t.Errorf("expected candidate rejected as %q, but got %q", rejectReasonFamily, rejected)
+		}
+	})
+
+	t.Run("InvalidFamily", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Family: "inet"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown family, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Failure modes deciding what happens to a request when a processing step fails
+const (
+	failureModeOpen   = "open"   // Continue degraded: the source is untrusted, the header is skipped, outputs are removed
+	failureModeClosed = "closed" // Reject the request with 503 Service Unavailable
+)
+
+// Points in Process where processing can fail
+const (
+	faultPointTrustLookup = "trust lookup"
+	faultPointHeaderRead  = "header read"
+	faultPointOutputWrite = "output write"
+)
+
+// faultInjector returns the error to fail point with, or nil. It is only set by tests,
+// to exercise failure handling for steps that cannot otherwise be made to fail.
+type faultInjector func(point string) error
+
+// fault returns the failure injected at point, if any
+func (r *Resolver) fault(point string) error {
+	if r.faults == nil {
+		return nil
+	}
+	return r.faults(point)
+}
+
+// validateFailureMode checks the failureMode configuration
+func validateFailureMode(name, mode string) error {
+	switch mode {
+	case "", failureModeOpen, failureModeClosed:
+		return nil
+	default:
+		return fmt.Errorf("%s: failureMode must be %q or %q, got %q", name, failureModeOpen, failureModeClosed, mode)
+	}
+}
+
+// handleFailure records a failure at point and applies the failure mode. It returns true
+// when the request must be rejected with 503. Exempt paths are never rejected.
+func (r *Resolver) handleFailure(req *http.Request, point string, err error) bool {
+	atomic.AddInt64(&r.stats.failures, 1)
+	r.requestLogf(req, "%s failed: %v", point, err)
+
+	return r.failClosed && !r.isEnforcementExempt(req)
+}
+
+// trustVerdictChecked is trustVerdict for Process, reporting lookup failures
+func (r *Resolver) trustVerdictChecked(req *http.Request) (bool, string, error) {
+	if err := r.fault(faultPointTrustLookup); err != nil {
+		return false, "", err
+	}
+	trusted, reason := r.trustVerdict(req)
+	return trusted, reason, nil
+}
+
+// removeOutputs deletes every output header, so nothing half-written or client-supplied reaches the backend
+func (r *Resolver) removeOutputs(req *http.Request) {
+	for _, header := range r.outputHeaders {
+		req.Header.Del(header)
+	}
+}
@@ -0,0 +1,208 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// errInjected is the failure injected by the fault tests
+var errInjected = errors.New("injected failure")
+
+// failAt returns a fault injector failing the given points
+func failAt(points ...string) faultInjector {
+	return func(point string) error {
+		for _, failing := range points {
+			if point == failing {
+				return errInjected
+			}
+		}
+		return nil
+	}
+}
+
+func TestFailureMode(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	newPlugin := func(t *testing.T, mode string, faults faultInjector) (*Plugin, *bool) {
+		nextCalled := false
+		next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+		})
+
+		cfg := &Config{
+			Enabled:    true,
+			HeaderName: "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: -1},
+				{HeaderName: "clientAddress", Depth: -1},
+			},
+			ForceOverwrite:   true,
+			TrustedIPs:       []string{"10.0.0.0/8"},
+			TrustedHeader:    "X-Is-Trusted",
+			SourceHeaderName: "X-Real-IP-Source",
+			FailureMode:      mode,
+		}
+
+		handler, err := New(context.TODO(), next, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		plugin := handler.(*Plugin)
+		plugin.faults = faults
+		return plugin, &nextCalled
+	}
+
+	// Expected outcome of a request from the trusted proxy 10.0.0.1 with X-Forwarded-For: 203.0.113.1
+	tests := []struct {
+		name            string
+		mode            string
+		points          []string
+		path            string
+		expectedStatus  int
+		expectedNext    bool
+		expectedRealIP  string
+		expectedTrusted string
+	}{
+		{"NoFailure/Open", failureModeOpen, nil, "/test", http.StatusOK, true, "203.0.113.1", "yes"},
+		{"NoFailure/Closed", failureModeClosed, nil, "/test", http.StatusOK, true, "203.0.113.1", "yes"},
+
+		// Open: the source is treated as untrusted, so only clientAddress is used
+		{"TrustLookup/Open", failureModeOpen, []string{faultPointTrustLookup}, "/test", http.StatusOK, true, "10.0.0.1", "no"},
+		{"TrustLookup/Closed", failureModeClosed, []string{faultPointTrustLookup}, "/test", http.StatusServiceUnavailable, false, "", ""},
+		{"TrustLookup/ClosedExempt", failureModeClosed, []string{faultPointTrustLookup}, "/.well-known/acme-challenge/x", http.StatusOK, true, "10.0.0.1", "no"},
+
+		// Open: the unreadable header is skipped and the next one is used
+		{"HeaderRead/Open", failureModeOpen, []string{faultPointHeaderRead}, "/test", http.StatusOK, true, "10.0.0.1", "yes"},
+		{"HeaderRead/Closed", failureModeClosed, []string{faultPointHeaderRead}, "/test", http.StatusServiceUnavailable, false, "", ""},
+		{"HeaderRead/ClosedExempt", failureModeClosed, []string{faultPointHeaderRead}, "/.well-known/acme-challenge/x", http.StatusOK, true, "10.0.0.1", "yes"},
+
+		// Open: no output header reaches the backend, not even client-supplied ones
+		{"OutputWrite/Open", failureModeOpen, []string{faultPointOutputWrite}, "/test", http.StatusOK, true, "", ""},
+		{"OutputWrite/Closed", failureModeClosed, []string{faultPointOutputWrite}, "/test", http.StatusServiceUnavailable, false, "", ""},
+		{"OutputWrite/ClosedExempt", failureModeClosed, []string{faultPointOutputWrite}, "/.well-known/acme-challenge/x", http.StatusOK, true, "", ""},
+
+		// Every point failing at once
+		{"All/Open", failureModeOpen, []string{faultPointTrustLookup, faultPointHeaderRead, faultPointOutputWrite}, "/test", http.StatusOK, true, "", ""},
+		{"All/Closed", failureModeClosed, []string{faultPointTrustLookup, faultPointHeaderRead, faultPointOutputWrite}, "/test", http.StatusServiceUnavailable, false, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin, nextCalled := newPlugin(t, tt.mode, failAt(tt.points...))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			req.Header.Set("X-Real-IP", "spoofed")
+			req.Header.Set("X-Is-Trusted", "spoofed")
+			rr := httptest.NewRecorder()
+
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if *nextCalled != tt.expectedNext {
+				t.Errorf("expected next handler called to be %v, but got %v", tt.expectedNext, *nextCalled)
+			}
+			if !tt.expectedNext {
+				return
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedRealIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedRealIP, realIP)
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrusted {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTrusted, trusted)
+			}
+
+			expectedFailures := int64(len(tt.points))
+			if tt.name == "All/Open" {
+				// The header read is skipped when the trust lookup already made the source untrusted
+				expectedFailures = 2
+			}
+			if stats := plugin.Stats(); stats.Failures != expectedFailures {
+				t.Errorf("expected %d failures, but got %d", expectedFailures, stats.Failures)
+			}
+		})
+	}
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.FailureMode = "sometimes"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an invalid failureMode, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestNegativePaths(t *testing.T) {
+	cfg := &Config{
+		Enabled:    true,
+		HeaderName: "X-Real-IP",
+		ProcessHeaders: []HeaderConfig{
+			{HeaderName: "X-Forwarded-For", Depth: 1},
+			{HeaderName: "Forwarded", Depth: -1},
+			{HeaderName: "clientAddress", Depth: -1},
+		},
+		ForceOverwrite: true,
+		TrustedIPs:     []string{"10.0.0.0/8"},
+		FailureMode:    failureModeClosed,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	// None of these are failures: malformed input degrades to the next header and is never rejected
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"InvalidRemoteAddr", "garbage", map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.2"}, ""},
+		{"EmptyRemoteAddr", "", nil, ""},
+		{"OnlyCommas", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": ",,,"}, "10.0.0.1"},
+		{"DepthOutOfBounds", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, "10.0.0.1"},
+		{"ForwardedWithoutFor", "10.0.0.1:1234", map[string]string{"Forwarded": "proto=https;by=10.0.0.2"}, "10.0.0.1"},
+		{"UnterminatedQuote", "10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::1`}, ""},
+		{"UntrustedWithHeaders", "198.51.100.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.1, 10.0.0.2"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			rr := httptest.NewRecorder()
+
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected malformed input not to be rejected, but got status %d", rr.Code)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expected {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expected, realIP)
+			}
+		})
+	}
+
+	if stats := plugin.(*Plugin).Stats(); stats.Failures != 0 {
+		t.Errorf("expected no failures for malformed input, but got %d", stats.Failures)
+	}
+}
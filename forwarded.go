@@ -0,0 +1,67 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isForwardedHeader reports whether headerName is the RFC 7239 Forwarded header
+func isForwardedHeader(headerName string) bool {
+	return http.CanonicalHeaderKey(headerName) == "Forwarded"
+}
+
+// splitHeaderValue splits a header value into its comma-separated entries. For the
+// RFC 7239 Forwarded header each element is reduced to its "for" parameter
+// (e.g., `for="[2001:db8::1]:4711";proto=https` -> `[2001:db8::1]:4711`), and
+// elements without one become empty entries.
+func splitHeaderValue(headerName, headerValue string) []string {
+	if !isForwardedHeader(headerName) {
+		return strings.Split(headerValue, ",")
+	}
+
+	elements := splitOutsideQuotes(headerValue, ',')
+	entries := make([]string, 0, len(elements))
+	for _, element := range elements {
+		entries = append(entries, forwardedFor(element))
+	}
+	return entries
+}
+
+// forwardedFor returns the unquoted value of the "for" parameter of a Forwarded element
+func forwardedFor(element string) string {
+	for _, pair := range splitOutsideQuotes(element, ';') {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), "for") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+		return value
+	}
+	return ""
+}
+
+// splitOutsideQuotes splits s on sep, ignoring separators inside quoted strings
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
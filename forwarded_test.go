@@ -0,0 +1,88 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSplitHeaderValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		headerName string
+		value      string
+		expected   []string
+	}{
+		{"PlainList", "X-Forwarded-For", "203.0.113.1, 10.0.0.1", []string{"203.0.113.1", " 10.0.0.1"}},
+		{"ForwardedSingle", "Forwarded", "for=192.0.2.60;proto=http;by=203.0.113.43", []string{"192.0.2.60"}},
+		{"ForwardedQuotedIPv6", "forwarded", `for="[2001:db8:cafe::17]:4711"`, []string{"[2001:db8:cafe::17]:4711"}},
+		{"ForwardedMultiple", "Forwarded", `for=192.0.2.43, for="198.51.100.17:5678";proto=https`, []string{"192.0.2.43", "198.51.100.17:5678"}},
+		{"ForwardedCaseInsensitiveKey", "Forwarded", "proto=https;For=192.0.2.1", []string{"192.0.2.1"}},
+		{"ForwardedQuotedComma", "Forwarded", `for=192.0.2.1;host="a,b", for=192.0.2.2`, []string{"192.0.2.1", "192.0.2.2"}},
+		{"ForwardedWithoutFor", "Forwarded", "proto=https, for=192.0.2.2", []string{"", "192.0.2.2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := splitHeaderValue(tt.headerName, tt.value)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("splitHeaderValue(%q, %q) = %q, expected %q", tt.headerName, tt.value, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPortHeaderName(t *testing.T) {
+	cfg := &Config{
+		Enabled:    true,
+		HeaderName: "X-Real-IP",
+		ProcessHeaders: []HeaderConfig{
+			{HeaderName: "Forwarded", Depth: -1},
+			{HeaderName: "X-Forwarded-For", Depth: -1},
+			{HeaderName: "clientAddress", Depth: -1},
+		},
+		ForceOverwrite: true,
+		PortHeaderName: "X-Real-Port",
+		TrustAll:       true,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		expectedIP   string
+		expectedPort string
+	}{
+		{"ForwardedWithPort", map[string]string{"Forwarded": `for="1.2.3.4:5678";proto=https`}, "1.2.3.4", "5678"},
+		{"ForwardedIPv6WithPort", map[string]string{"Forwarded": `for="[2001:db8::1]:4711"`}, "2001:db8::1", "4711"},
+		{"ForwardedIPv6WithoutPort", map[string]string{"Forwarded": `for="[2001:db8::1]"`}, "2001:db8::1", ""},
+		{"ForwardedForWithPort", map[string]string{"X-Forwarded-For": "203.0.113.1:4000"}, "203.0.113.1", "4000"},
+		{"RemoteAddrPort", map[string]string{}, "192.0.2.1", "1234"},
+		{"SpoofedPortOverwritten", map[string]string{"X-Forwarded-For": "203.0.113.1", "X-Real-Port": "1"}, "203.0.113.1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP to be '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if port := req.Header.Get("X-Real-Port"); port != tt.expectedPort {
+				t.Errorf("expected X-Real-Port to be '%s', but got: '%s'", tt.expectedPort, port)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// defaultGeoIPLanguage is the language used for country and city names
+const defaultGeoIPLanguage = "en"
+
+// geoLocation is the subset of a GeoIP2/GeoLite2 City or Country record written to headers
+type geoLocation struct {
+	countryCode string
+	countryName string
+	city        string
+}
+
+// geoIPEnricher writes geolocation headers for the resolved real IP from a MaxMind DB
+type geoIPEnricher struct {
+	reader   *mmdbReader
+	language string
+
+	countryCodeHeaderName string
+	countryHeaderName     string
+	cityHeaderName        string
+}
+
+// newGeoIPEnricher opens the database at path
+func newGeoIPEnricher(path, language, countryCodeHeaderName, countryHeaderName, cityHeaderName string) (*geoIPEnricher, error) {
+	reader, err := openMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if language == "" {
+		language = defaultGeoIPLanguage
+	}
+
+	return &geoIPEnricher{
+		reader:                reader,
+		language:              language,
+		countryCodeHeaderName: countryCodeHeaderName,
+		countryHeaderName:     countryHeaderName,
+		cityHeaderName:        cityHeaderName,
+	}, nil
+}
+
+// locate looks up ip. The country falls back to the registered country when the
+// database has no physical location for the network.
+func (g *geoIPEnricher) locate(ip net.IP) (geoLocation, bool, error) {
+	record, found, err := g.reader.lookup(ip)
+	if err != nil || !found {
+		return geoLocation{}, false, err
+	}
+
+	country := mmdbPath(record, "country")
+	if country == nil {
+		country = mmdbPath(record, "registered_country")
+	}
+
+	location := geoLocation{}
+	location.countryCode, _ = mmdbPath(country, "iso_code").(string)
+	location.countryName, _ = mmdbPath(country, "names", g.language).(string)
+	location.city, _ = mmdbPath(record, "city", "names", g.language).(string)
+
+	return location, true, nil
+}
+
+// lookup locates realIP, which is looked up once per request for both the country
+// rules and the output headers. Unknown values are empty.
+func (g *geoIPEnricher) lookup(logError func(format string, args ...interface{}), realIP string) geoLocation {
+	var location geoLocation
+	if ip := parseAddress(realIP); ip != nil {
+		var err error
+		location, _, err = g.locate(ip)
+		if err != nil {
+			logError("GeoIP lookup failed for %s: %v", realIP, err)
+		}
+	}
+	return location
+}
+
+// outputs returns the geolocation headers for location. Unknown values are empty, so
+// they are written as empty strings when forceOverwrite is set and clients cannot inject their own.
+func (g *geoIPEnricher) outputs(location geoLocation) []headerOutput {
+	return []headerOutput{
+		{g.countryCodeHeaderName, location.countryCode},
+		{g.countryHeaderName, location.countryName},
+		{g.cityHeaderName, location.city},
+	}
+}
+
+// String describes the loaded database, for logs
+func (g *geoIPEnricher) String() string {
+	return describeMMDB(g.reader)
+}
+
+// asnEnricher writes the autonomous system of the resolved real IP from a GeoLite2/GeoIP2 ASN database
+type asnEnricher struct {
+	reader *mmdbReader
+
+	asnHeaderName   string
+	asOrgHeaderName string
+}
+
+// newASNEnricher opens the database at path
+func newASNEnricher(path, asnHeaderName, asOrgHeaderName string) (*asnEnricher, error) {
+	reader, err := openMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &asnEnricher{
+		reader:          reader,
+		asnHeaderName:   asnHeaderName,
+		asOrgHeaderName: asOrgHeaderName,
+	}, nil
+}
+
+// lookupASN returns the AS number (as a decimal string) and organization of ip
+func (a *asnEnricher) lookupASN(ip net.IP) (string, string, error) {
+	record, found, err := a.reader.lookup(ip)
+	if err != nil || !found {
+		return "", "", err
+	}
+
+	asn := ""
+	if number, ok := mmdbPath(record, "autonomous_system_number").(uint64); ok {
+		asn = strconv.FormatUint(number, 10)
+	}
+	org, _ := mmdbPath(record, "autonomous_system_organization").(string)
+
+	return asn, org, nil
+}
+
+// outputs returns the ASN headers for realIP, empty when unknown like the GeoIP headers
+func (a *asnEnricher) outputs(logError func(format string, args ...interface{}), realIP string) []headerOutput {
+	var asn, org string
+	if ip := parseAddress(realIP); ip != nil {
+		var err error
+		asn, org, err = a.lookupASN(ip)
+		if err != nil {
+			logError("ASN lookup failed for %s: %v", realIP, err)
+		}
+	}
+
+	return []headerOutput{
+		{a.asnHeaderName, asn},
+		{a.asOrgHeaderName, org},
+	}
+}
+
+// String describes the loaded database, for logs
+func (a *asnEnricher) String() string {
+	return describeMMDB(a.reader)
+}
+
+// describeMMDB summarizes a loaded MaxMind DB, for logs
+func describeMMDB(reader *mmdbReader) string {
+	return fmt.Sprintf("%s (IPv%d, %d nodes)", reader.databaseType, reader.ipVersion, reader.nodeCount)
+}
@@ -0,0 +1,233 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// testGeoIPNetworks are City-style records used by the GeoIP tests
+var testGeoIPNetworks = []testMMDBNetwork{
+	{"81.2.69.0/24", map[string]interface{}{
+		"city":    map[string]interface{}{"names": map[string]interface{}{"en": "London", "de": "London"}},
+		"country": map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom", "de": "Vereinigtes Königreich"}},
+	}},
+	{"175.16.199.0/24", map[string]interface{}{
+		"registered_country": map[string]interface{}{"iso_code": "CN", "names": map[string]interface{}{"en": "China"}},
+	}},
+	{"2001:db8::/32", map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "US", "names": map[string]interface{}{"en": "United States"}},
+	}},
+}
+
+func TestGeoIP(t *testing.T) {
+	path := writeTestMMDB(t, buildTestMMDB(t, 6, 28, "GeoLite2-City", testGeoIPNetworks))
+
+	newPlugin := func(t *testing.T, language string) http.Handler {
+		cfg := &Config{
+			Enabled:                  true,
+			HeaderName:               "X-Real-IP",
+			ProcessHeaders:           []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			ForceOverwrite:           true,
+			TrustAll:                 true,
+			GeoIPDatabase:            path,
+			GeoIPLanguage:            language,
+			GeoCountryCodeHeaderName: "X-Real-IP-Country-Code",
+			GeoCountryHeaderName:     "X-Real-IP-Country",
+			GeoCityHeaderName:        "X-Real-IP-City",
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name            string
+		language        string
+		xff             string
+		expectedCode    string
+		expectedCountry string
+		expectedCity    string
+	}{
+		{"CityRecord", "", "81.2.69.10", "GB", "United Kingdom", "London"},
+		{"OtherLanguage", "de", "81.2.69.10", "GB", "Vereinigtes Königreich", "London"},
+		{"RegisteredCountryFallback", "", "175.16.199.1", "CN", "China", ""},
+		{"IPv6", "", "2001:db8::1", "US", "United States", ""},
+		{"NotInDatabase", "", "8.8.8.8", "", "", ""},
+		{"InvalidIP", "", "not-an-ip", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.language)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			req.Header.Set("X-Real-IP-Country-Code", "spoofed")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if code := req.Header.Get("X-Real-IP-Country-Code"); code != tt.expectedCode {
+				t.Errorf("expected country code '%s', but got: '%s'", tt.expectedCode, code)
+			}
+			if country := req.Header.Get("X-Real-IP-Country"); country != tt.expectedCountry {
+				t.Errorf("expected country '%s', but got: '%s'", tt.expectedCountry, country)
+			}
+			if city := req.Header.Get("X-Real-IP-City"); city != tt.expectedCity {
+				t.Errorf("expected city '%s', but got: '%s'", tt.expectedCity, city)
+			}
+		})
+	}
+
+	t.Run("MissingDatabase", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:       true,
+			GeoIPDatabase:  filepath.Join(t.TempDir(), "missing.mmdb"),
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for missing GeoIP database, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestGeoPassthroughHeaders(t *testing.T) {
+	path := writeTestMMDB(t, buildTestMMDB(t, 6, 28, "GeoLite2-City", testGeoIPNetworks))
+
+	newPlugin := func(t *testing.T, database string) http.Handler {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress"}}
+		cfg.GeoIPDatabase = database
+		cfg.GeoPassthroughHeaders = []string{"CF-IPCountry"}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name       string
+		database   string
+		remoteAddr string
+		expected   string
+	}{
+		{"TrustedPassedThrough", path, "10.0.0.1:1234", "XX"},
+		{"UntrustedRecomputed", path, "81.2.69.10:1234", "GB"},
+		{"UntrustedUnknownRemoved", path, "8.8.8.8:1234", ""},
+		{"UntrustedWithoutDatabaseRemoved", "", "81.2.69.10:1234", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.database)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "175.16.199.1")
+			req.Header.Set("CF-IPCountry", "XX")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if country := req.Header.Get("CF-IPCountry"); country != tt.expected {
+				t.Errorf("expected CF-IPCountry '%s', but got: '%s'", tt.expected, country)
+			}
+		})
+	}
+}
+
+func TestASN(t *testing.T) {
+	path := writeTestMMDB(t, buildTestMMDB(t, 6, 24, "GeoLite2-ASN", []testMMDBNetwork{
+		{"1.128.0.0/11", map[string]interface{}{
+			"autonomous_system_number":       uint32(1221),
+			"autonomous_system_organization": "Telstra Pty Ltd",
+		}},
+		{"2600:6000::/20", map[string]interface{}{
+			"autonomous_system_number": uint32(237),
+		}},
+	}))
+
+	newPlugin := func(t *testing.T) http.Handler {
+		cfg := &Config{
+			Enabled:         true,
+			HeaderName:      "X-Real-IP",
+			ProcessHeaders:  []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			ForceOverwrite:  true,
+			TrustAll:        true,
+			ASNDatabase:     path,
+			ASNHeaderName:   "X-Real-IP-ASN",
+			ASOrgHeaderName: "X-Real-IP-AS-Org",
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name        string
+		xff         string
+		expectedASN string
+		expectedOrg string
+	}{
+		{"NumberAndOrganization", "1.128.0.1", "1221", "Telstra Pty Ltd"},
+		{"NumberOnly", "2600:6000::1", "237", ""},
+		{"NotInDatabase", "8.8.8.8", "", ""},
+		{"InvalidIP", "not-an-ip", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			req.Header.Set("X-Real-IP-ASN", "spoofed")
+			req.Header.Set("X-Real-IP-AS-Org", "spoofed")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if asn := req.Header.Get("X-Real-IP-ASN"); asn != tt.expectedASN {
+				t.Errorf("expected ASN '%s', but got: '%s'", tt.expectedASN, asn)
+			}
+			if org := req.Header.Get("X-Real-IP-AS-Org"); org != tt.expectedOrg {
+				t.Errorf("expected AS organization '%s', but got: '%s'", tt.expectedOrg, org)
+			}
+		})
+	}
+
+	t.Run("MissingDatabase", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:       true,
+			ASNDatabase:    filepath.Join(t.TempDir(), "missing.mmdb"),
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for missing ASN database, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package traefik_realip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// redactedValue replaces secrets in diagnostic output
+const redactedValue = "REDACTED"
+
+// ipHasher computes a keyed hash of IP addresses, so backends can correlate clients
+// without receiving the addresses themselves
+type ipHasher struct {
+	key []byte
+}
+
+// newIPHasher returns a hasher for key
+func newIPHasher(key string) *ipHasher {
+	return &ipHasher{key: []byte(key)}
+}
+
+// hash returns the hex-encoded HMAC-SHA256 of ip, or "" when ip is empty
+func (h *ipHasher) hash(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPHasher(t *testing.T) {
+	hasher := newIPHasher("secret")
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("203.0.113.1"))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if hash := hasher.hash("203.0.113.1"); hash != expected {
+		t.Errorf("expected hash '%s', but got: '%s'", expected, hash)
+	}
+	if hash := hasher.hash(""); hash != "" {
+		t.Errorf("expected empty hash for empty IP, but got: '%s'", hash)
+	}
+	if newIPHasher("other").hash("203.0.113.1") == expected {
+		t.Error("expected different keys to produce different hashes")
+	}
+}
+
+func TestHashedHeader(t *testing.T) {
+	expected := newIPHasher("secret").hash("203.0.113.1")
+
+	newPlugin := func(t *testing.T, hashOnly bool) http.Handler {
+		cfg := &Config{
+			Enabled:          true,
+			HeaderName:       "X-Real-IP",
+			ProcessHeaders:   []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			ForceOverwrite:   true,
+			TrustAll:         true,
+			HashedHeaderName: "X-Real-IP-Hash",
+			HashKey:          "secret",
+			HashOnly:         hashOnly,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	t.Run("InAdditionToRawIP", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		newPlugin(t, false).ServeHTTP(httptest.NewRecorder(), req)
+
+		if hash := req.Header.Get("X-Real-IP-Hash"); hash != expected {
+			t.Errorf("expected hash '%s', but got: '%s'", expected, hash)
+		}
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "203.0.113.1" {
+			t.Errorf("expected real IP '203.0.113.1', but got: '%s'", realIP)
+		}
+	})
+
+	t.Run("HashOnly", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		req.Header.Set("X-Real-IP", "spoofed")
+		newPlugin(t, true).ServeHTTP(httptest.NewRecorder(), req)
+
+		if hash := req.Header.Get("X-Real-IP-Hash"); hash != expected {
+			t.Errorf("expected hash '%s', but got: '%s'", expected, hash)
+		}
+		if _, present := req.Header["X-Real-Ip"]; present {
+			t.Errorf("expected raw IP header to be removed, but got: '%s'", req.Header.Get("X-Real-IP"))
+		}
+	})
+
+	t.Run("Unresolved", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Real-IP-Hash", "spoofed")
+		newPlugin(t, false).ServeHTTP(httptest.NewRecorder(), req)
+
+		if hash := req.Header.Get("X-Real-IP-Hash"); hash != "" {
+			t.Errorf("expected empty hash when no IP is resolved, but got: '%s'", hash)
+		}
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		tests := []struct {
+			name             string
+			hashedHeaderName string
+			hashKey          string
+			hashOnly         bool
+		}{
+			{"MissingKey", "X-Real-IP-Hash", "", false},
+			{"HashOnlyWithoutHeader", "", "secret", true},
+			{"ReservedHeader", "Connection", "secret", false},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.HashedHeaderName = tt.hashedHeaderName
+				cfg.HashKey = tt.hashKey
+				cfg.HashOnly = tt.hashOnly
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err == nil {
+					t.Error("expected error, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+			})
+		}
+	})
+
+	t.Run("KeyRedactedInDump", func(t *testing.T) {
+		var logs bytes.Buffer
+		logWriter = &logs
+		defer func() { logWriter = os.Stdout }()
+
+		cfg := CreateConfig()
+		cfg.HashedHeaderName = "X-Real-IP-Hash"
+		cfg.HashKey = "super-secret-key"
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		handler.(*Plugin).dump(time.Now())
+
+		if strings.Contains(logs.String(), "super-secret-key") {
+			t.Errorf("expected hash key to be redacted, but got: %s", logs.String())
+		}
+		if !strings.Contains(logs.String(), `"hashKey":"REDACTED"`) {
+			t.Errorf("expected redacted hash key in dump, but got: %s", logs.String())
+		}
+	})
+}
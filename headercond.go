@@ -0,0 +1,21 @@
+package traefik_realip
+
+import (
+	"net/http"
+)
+
+// skipReasonCondition marks processHeaders entries whose onlyIfHeaderPresent or skipIfHeaderPresent condition did not hold
+const skipReasonCondition = "condition not met"
+
+// headerApplies reports whether the presence conditions of processHeaders[i] hold for req,
+// e.g. X-Forwarded-For is only read when CF-Ray proves the request transited Cloudflare
+func (r *Resolver) headerApplies(i int, req *http.Request) bool {
+	headerConfig := r.processHeaders[i]
+	if headerConfig.OnlyIfHeaderPresent != "" && len(req.Header.Values(headerConfig.OnlyIfHeaderPresent)) == 0 {
+		return false
+	}
+	if headerConfig.SkipIfHeaderPresent != "" && len(req.Header.Values(headerConfig.SkipIfHeaderPresent)) > 0 {
+		return false
+	}
+	return true
+}
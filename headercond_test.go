@@ -0,0 +1,52 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderPresenceConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		expectedIP string
+	}{
+		{"CloudflareTransit", map[string]string{"CF-Ray": "8a1b2c3d4e5f-AMS", "X-Forwarded-For": "203.0.113.5"}, "203.0.113.5"},
+		{"DirectToOrigin", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "192.0.2.1"},
+		{"EmptyConditionHeaderIsPresent", map[string]string{"CF-Ray": "", "X-Forwarded-For": "203.0.113.5"}, "203.0.113.5"},
+		{"SkippedWhenPresent", map[string]string{"X-Internal-Probe": "1", "X-Real-IP": "198.51.100.7"}, "192.0.2.1"},
+		{"ReadWhenAbsent", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: 0, OnlyIfHeaderPresent: "CF-Ray"},
+				{HeaderName: "X-Real-IP", SkipIfHeaderPresent: "x-internal-probe"},
+				{HeaderName: "clientAddress"},
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			report := plugin.(*Plugin).Explain(req)
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if tt.expectedIP == "192.0.2.1" && report.Headers[0].Skipped != skipReasonCondition && report.Headers[1].Skipped != skipReasonCondition {
+				t.Errorf("expected a header skipped as %q, got %+v", skipReasonCondition, report.Headers)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shorthandDepth is the depth of processHeaders entries given as a plain header name
+const shorthandDepth = -1
+
+// defaultProcessHeaders are the headers read when processHeaders is not configured
+func defaultProcessHeaders() []HeaderConfig {
+	return []HeaderConfig{
+		{HeaderName: "X-Forwarded-For", Depth: -1},
+		{HeaderName: "X-Real-IP", Depth: -1},
+		{HeaderName: "CF-Connecting-IP", Depth: -1},
+		{HeaderName: "clientAddress", Depth: -1},
+	}
+}
+
+// parseProcessHeaders converts the processHeaders setting into its entries, which are either
+// objects or plain header names read at their leftmost entry (depth -1). Traefik decodes
+// settings into their Go types, which cannot hold both forms, so the setting is untyped like
+// depth: Traefik and JSON pass lists of strings and maps, whose values are strings when they
+// come from labels, while Go callers can also pass []HeaderConfig or []string. A string is a
+// comma-separated list of names. nil, the default, selects defaultProcessHeaders.
+func parseProcessHeaders(name string, value interface{}) ([]HeaderConfig, error) {
+	switch headers := value.(type) {
+	case nil:
+		return defaultProcessHeaders(), nil
+	case []HeaderConfig:
+		return headers, nil
+	case string:
+		var parsed []HeaderConfig
+		for _, headerName := range strings.Split(headers, ",") {
+			if headerName = strings.TrimSpace(headerName); headerName != "" {
+				parsed = append(parsed, HeaderConfig{HeaderName: headerName, Depth: shorthandDepth})
+			}
+		}
+		return parsed, nil
+	case []string:
+		parsed := make([]HeaderConfig, 0, len(headers))
+		for _, headerName := range headers {
+			parsed = append(parsed, HeaderConfig{HeaderName: strings.TrimSpace(headerName), Depth: shorthandDepth})
+		}
+		return parsed, nil
+	case []interface{}:
+		var problems configErrors
+		parsed := make([]HeaderConfig, 0, len(headers))
+		for i, entry := range headers {
+			headerConfig, err := parseHeaderEntry(entry)
+			if err != nil {
+				problems.add(fmt.Errorf("%s: processHeaders[%d]: %w", name, i, err))
+			}
+			parsed = append(parsed, headerConfig)
+		}
+		if err := problems.err(); err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	default:
+		return nil, fmt.Errorf("%s: processHeaders must be a list of header names or objects, got %T", name, value)
+	}
+}
+
+// parseHeaderEntry converts a processHeaders entry: a header name, an object or a HeaderConfig
+func parseHeaderEntry(entry interface{}) (HeaderConfig, error) {
+	switch headerConfig := entry.(type) {
+	case string:
+		return HeaderConfig{HeaderName: strings.TrimSpace(headerConfig), Depth: shorthandDepth}, nil
+	case HeaderConfig:
+		return headerConfig, nil
+	case map[string]interface{}:
+		return parseHeaderObject(headerConfig)
+	default:
+		return HeaderConfig{}, fmt.Errorf("expected a header name or an object, got %T", entry)
+	}
+}
+
+// parseHeaderObject converts a processHeaders entry in its object form. Keys are matched
+// case-insensitively, as Traefik matches setting names; depth is kept as given, since parseDepth
+// accepts every form of it.
+func parseHeaderObject(object map[string]interface{}) (HeaderConfig, error) {
+	var headerConfig HeaderConfig
+	var problems configErrors
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := object[key]
+		var err error
+		switch strings.ToLower(key) {
+		case "headername":
+			headerConfig.HeaderName, err = settingString(value)
+		case "depth":
+			headerConfig.Depth = value
+		case "trustall":
+			headerConfig.TrustAll, err = settingBool(value)
+		case "trustedips":
+			headerConfig.TrustedIPs, err = settingStrings(value)
+		case "family":
+			headerConfig.Family, err = settingString(value)
+		case "weight":
+			headerConfig.Weight, err = settingFloat(value)
+		case "targetheadername":
+			headerConfig.TargetHeaderName, err = settingString(value)
+		case "onlyifheaderpresent":
+			headerConfig.OnlyIfHeaderPresent, err = settingString(value)
+		case "skipifheaderpresent":
+			headerConfig.SkipIfHeaderPresent, err = settingString(value)
+		default:
+			err = fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			problems.add(fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return headerConfig, problems.err()
+}
+
+// settingString converts a decoded string setting
+func settingString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("expected a string, got %T", value)
+}
+
+// settingBool converts a decoded boolean setting, which labels give as a string
+func settingBool(value interface{}) (bool, error) {
+	switch b := value.(type) {
+	case bool:
+		return b, nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(b))
+	default:
+		return false, fmt.Errorf("expected a boolean, got %T", value)
+	}
+}
+
+// settingFloat converts a decoded number setting, which labels give as a string
+func settingFloat(value interface{}) (float64, error) {
+	switch f := value.(type) {
+	case float64:
+		return f, nil
+	case int:
+		return float64(f), nil
+	case int64:
+		return float64(f), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(f), 64)
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+}
+
+// settingStrings converts a decoded list of strings, which labels give as a comma-separated string
+func settingStrings(value interface{}) ([]string, error) {
+	switch list := value.(type) {
+	case []string:
+		return list, nil
+	case string:
+		var values []string
+		for _, s := range strings.Split(list, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values, nil
+	case []interface{}:
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			s, err := settingString(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("expected a list of strings, got %T", value)
+	}
+}
@@ -0,0 +1,75 @@
+package traefik_realip
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProcessHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected []HeaderConfig
+	}{
+		{"Unset", nil, defaultProcessHeaders()},
+		{"Objects", []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}}, []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}}},
+		{"Names", []string{"X-Forwarded-For", " clientAddress "}, []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}}},
+		{"CommaSeparated", "X-Forwarded-For, clientAddress", []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}}},
+		{"Mixed", []interface{}{"CF-Connecting-IP", map[string]interface{}{"headerName": "X-Forwarded-For", "depth": float64(1), "trustedIPs": []interface{}{"10.0.0.0/8"}}},
+			[]HeaderConfig{{HeaderName: "CF-Connecting-IP", Depth: -1}, {HeaderName: "X-Forwarded-For", Depth: float64(1), TrustedIPs: []string{"10.0.0.0/8"}}}},
+		{"LabelValues", []interface{}{map[string]interface{}{"HeaderName": "X-Forwarded-For", "Depth": "-1", "TrustAll": "true", "Weight": "2", "TrustedIPs": "10.0.0.0/8,192.168.0.0/16"}},
+			[]HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: "-1", TrustAll: true, Weight: 2, TrustedIPs: []string{"10.0.0.0/8", "192.168.0.0/16"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processHeaders, err := parseProcessHeaders(pluginName, tt.value)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if !reflect.DeepEqual(processHeaders, tt.expected) {
+				t.Errorf("expected %+v, but got %+v", tt.expected, processHeaders)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"Type", 42, "processHeaders must be a list of header names or objects, got int"},
+		{"Entry", []interface{}{"X-Forwarded-For", 42}, "processHeaders[1]: expected a header name or an object, got int"},
+		{"UnknownSetting", []interface{}{map[string]interface{}{"headerName": "X-Forwarded-For", "depht": 1}}, `processHeaders[0]: depht: unknown setting "depht"`},
+		{"TrustAll", []interface{}{map[string]interface{}{"headerName": "X-Forwarded-For", "trustAll": "maybe"}}, "processHeaders[0]: trustAll:"},
+	}
+
+	for _, tt := range invalid {
+		t.Run("Invalid"+tt.name, func(t *testing.T) {
+			if _, err := parseProcessHeaders(pluginName, tt.value); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, but got: %v", tt.expected, err)
+			}
+		})
+	}
+
+	t.Run("ResolvesLeftmost", func(t *testing.T) {
+		cfg := CreateConfig()
+		if err := json.Unmarshal([]byte(`{"processHeaders": ["X-Forwarded-For", {"headerName": "clientAddress"}]}`), cfg); err != nil {
+			t.Fatalf("failed to unmarshal: %v", err)
+		}
+		resolver, err := NewResolver(cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create resolver: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1, 198.51.100.1")
+		if report := resolver.Explain(req); report.RealIP != "203.0.113.1" || len(report.Headers) != 2 {
+			t.Errorf("expected the leftmost entry '203.0.113.1' from two headers, but got '%s' from %d", report.RealIP, len(report.Headers))
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// headerTrust is the trust set of a processHeaders entry, replacing the global verdict for
+// that header. It lets e.g. CF-Connecting-IP be honored only from Cloudflare ranges while
+// X-Forwarded-For is honored from the internal load balancers.
+type headerTrust struct {
+	all bool            // Honor the header from any source
+	ips *IpLookupHelper // Sources the header is honored from
+}
+
+// newHeaderTrusts parses the per-header trust overrides. The result is parallel to headers,
+// with nil for entries using the global verdict, or nil altogether when no entry overrides it.
+func newHeaderTrusts(name string, headers []HeaderConfig, synthetic string) ([]*headerTrust, error) {
+	var trusts []*headerTrust
+	for i, headerConfig := range headers {
+		if !headerConfig.TrustAll && len(headerConfig.TrustedIPs) == 0 {
+			continue
+		}
+		if isSynthetic(headerConfig.HeaderName, synthetic) {
+			return nil, fmt.Errorf("%s: processHeaders[%d]: %s is always used and cannot have trustAll or trustedIPs", name, i, synthetic)
+		}
+
+		trust := &headerTrust{all: headerConfig.TrustAll}
+		if !trust.all {
+			ips, err := NewIpLookupHelper(headerConfig.TrustedIPs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: processHeaders[%d]: failed to parse trusted IPs: %w", name, i, err)
+			}
+			trust.ips = ips
+		}
+
+		if trusts == nil {
+			trusts = make([]*headerTrust, len(headers))
+		}
+		trusts[i] = trust
+	}
+	return trusts, nil
+}
+
+// trusts reports whether the header is honored from the source ip
+func (t *headerTrust) trusts(ip net.IP) bool {
+	if t.all {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	contained, _, err := t.ips.IsContained(ip)
+	return err == nil && contained
+}
+
+// headerTrusted reports whether processHeaders[i] is honored for req, given the global verdict.
+// Trusted sources in a trust tier limited to some headers are only honored for those. A
+// per-header trust set replaces the ranges, but requireTrustedChain and requireTLS still
+// apply, so an override can never honor a header the global gates would refuse.
+func (r *Resolver) headerTrusted(i int, req *http.Request, isTrusted bool) bool {
+	if r.headerTrusts == nil || r.headerTrusts[i] == nil {
+		if tier := r.sourceTier(req); isTrusted && tier != nil {
+			return tier.allows(r.processHeaders[i].HeaderName)
+		}
+		return isTrusted
+	}
+	return r.headerTrusts[i].trusts(parseAddress(r.cleanIPAddress(req.RemoteAddr))) && r.trustGate(req) == ""
+}
+
+// headerTrustedByOverride reports whether a processHeaders entry named header has its own
+// trust set that honors the source of req, so the header is expected from it
+func (r *Resolver) headerTrustedByOverride(header string, req *http.Request) bool {
+	if r.headerTrusts == nil {
+		return false
+	}
+	canonical := http.CanonicalHeaderKey(header)
+	for i, headerConfig := range r.processHeaders {
+		if r.headerTrusts[i] != nil && http.CanonicalHeaderKey(headerConfig.HeaderName) == canonical && r.headerTrusted(i, req, false) {
+			return true
+		}
+	}
+	return false
+}
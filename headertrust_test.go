@@ -0,0 +1,175 @@
+package traefik_realip
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPerHeaderTrust(t *testing.T) {
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) http.Handler {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP", Depth: -1, TrustedIPs: []string{"173.245.48.0/20"}},
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.TrustedHeader = "X-Is-Trusted"
+		if modify != nil {
+			modify(cfg)
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		cf            string
+		xff           string
+		expectedIP    string
+		expectedTrust string
+	}{
+		{"CloudflarePeer", "173.245.48.10:443", "203.0.113.1", "198.51.100.9", "203.0.113.1", "no"},
+		{"InternalLBIgnoresCFHeader", "10.0.0.1:1234", "203.0.113.1", "198.51.100.9", "198.51.100.9", "yes"},
+		{"UnknownPeer", "192.0.2.1:1234", "203.0.113.1", "198.51.100.9", "192.0.2.1", "no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("CF-Connecting-IP", tt.cf)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrust {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTrust, trusted)
+			}
+		})
+	}
+
+	t.Run("TrustAllOverride", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Client-IP", Depth: -1, TrustAll: true},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Client-IP", "203.0.113.1")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "203.0.113.1" {
+			t.Errorf("expected header honored from any source, but got: '%s'", realIP)
+		}
+	})
+
+	t.Run("OverrideIsNotSpoofing", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.StripSpoofedHeaders = true
+			cfg.SpoofHeaderName = "X-Spoof-Attempt"
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "173.245.48.10:443"
+		req.Header.Set("CF-Connecting-IP", "203.0.113.1")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if spoof := req.Header.Get("X-Spoof-Attempt"); spoof != "" {
+			t.Errorf("expected no spoof tag, but got: '%s'", spoof)
+		}
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "203.0.113.1" {
+			t.Errorf("expected real IP from CF-Connecting-IP, but got: '%s'", realIP)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("CF-Connecting-IP", "203.0.113.1")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if spoof := req.Header.Get("X-Spoof-Attempt"); spoof != "yes" {
+			t.Errorf("expected spoof tag from unknown peer, but got: '%s'", spoof)
+		}
+	})
+
+	t.Run("OverrideKeepsTrustGates", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "CF-Connecting-IP", Depth: -1, TrustedIPs: []string{"10.0.0.0/8"}},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+			cfg.RequireTLS = true
+			cfg.RequireTrustedChain = true
+		})
+
+		tests := []struct {
+			name       string
+			tls        bool
+			xff        string
+			expectedIP string
+		}{
+			{"PlaintextAndUntrustedHop", false, "203.0.113.1, 192.0.2.1", "10.1.1.1"},
+			{"Plaintext", false, "", "10.1.1.1"},
+			{"UntrustedHop", true, "203.0.113.1, 192.0.2.1", "10.1.1.1"},
+			{"GatesPass", true, "", "6.6.6.6"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/test", nil)
+				req.RemoteAddr = "10.1.1.1:1234"
+				req.Header.Set("CF-Connecting-IP", "6.6.6.6")
+				if tt.xff != "" {
+					req.Header.Set("X-Forwarded-For", tt.xff)
+				}
+				if tt.tls {
+					req.TLS = &tls.ConnectionState{}
+				}
+				plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+				if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+					t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+				}
+			})
+		}
+	})
+
+	invalid := []struct {
+		name    string
+		headers []HeaderConfig
+	}{
+		{"InvalidCIDR", []HeaderConfig{{HeaderName: "CF-Connecting-IP", Depth: -1, TrustedIPs: []string{"not-a-cidr"}}}},
+		{"ClientAddressOverride", []HeaderConfig{{HeaderName: "clientAddress", Depth: -1, TrustAll: true}}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = tt.headers
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for invalid per-header trust, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
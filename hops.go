@@ -0,0 +1,73 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ExpectedHops bounds the number of X-Forwarded-For entries; zero leaves a bound open.
+type ExpectedHops struct {
+	Min int `json:"min,omitempty"` // Fewest entries a request may carry
+	Max int `json:"max,omitempty"` // Most entries a request may carry
+}
+
+// What happens to requests whose X-Forwarded-For has an unexpected number of entries
+const (
+	expectedHopsFlag   = "flag"
+	expectedHopsReject = "reject"
+)
+
+// rejectReasonHopCount is the reason code of requests rejected for their number of hops
+const rejectReasonHopCount = "expectedHops"
+
+// hopCheck validates the number of X-Forwarded-For entries of a known topology
+type hopCheck struct {
+	min, max int
+	action   string
+}
+
+// newHopCheck parses the expectedHops configuration; it returns nil when neither bound is set
+func newHopCheck(name string, hops ExpectedHops, action, hopsValidHeaderName string) (*hopCheck, error) {
+	if hops.Min < 0 || hops.Max < 0 {
+		return nil, fmt.Errorf("%s: expectedHops bounds cannot be negative", name)
+	}
+	if hops.Max > 0 && hops.Min > hops.Max {
+		return nil, fmt.Errorf("%s: expectedHops min (%d) cannot exceed max (%d)", name, hops.Min, hops.Max)
+	}
+
+	switch action {
+	case "":
+		action = expectedHopsFlag
+	case expectedHopsFlag, expectedHopsReject:
+	default:
+		return nil, fmt.Errorf("%s: expectedHopsAction must be %q or %q, got %q", name, expectedHopsFlag, expectedHopsReject, action)
+	}
+
+	if hops.Min == 0 && hops.Max == 0 {
+		return nil, nil
+	}
+	if action == expectedHopsFlag && hopsValidHeaderName == "" {
+		return nil, fmt.Errorf("%s: hopsValidHeaderName cannot be empty when expectedHopsAction is %q", name, expectedHopsFlag)
+	}
+
+	return &hopCheck{min: hops.Min, max: hops.Max, action: action}, nil
+}
+
+// valid reports whether the X-Forwarded-For of req has an expected number of entries. Requests
+// without the header have none; chains cut by maxChainLength count as one entry longer.
+func (c *hopCheck) valid(r *Resolver, req *http.Request) bool {
+	count := 0
+	if value, _ := r.limitHeaderValue(r.headerValue(req, "X-Forwarded-For")); value != "" {
+		entries, exceeded := r.splitCandidates("X-Forwarded-For", value)
+		for _, entry := range entries {
+			if r.cleanIPAddress(entry) != "" {
+				count++
+			}
+		}
+		if exceeded {
+			count++
+		}
+	}
+
+	return count >= c.min && (c.max == 0 || count <= c.max)
+}
@@ -0,0 +1,87 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpectedHops(t *testing.T) {
+	tests := []struct {
+		name              string
+		hops              ExpectedHops
+		action            string
+		xff               string
+		expectedStatus    int
+		expectedHopsValid string
+	}{
+		{"Exact", ExpectedHops{Min: 2, Max: 2}, "", "203.0.113.5, 198.51.100.7", http.StatusOK, "yes"},
+		{"TooFew", ExpectedHops{Min: 2, Max: 2}, "", "203.0.113.5", http.StatusOK, "no"},
+		{"TooMany", ExpectedHops{Min: 2, Max: 2}, expectedHopsFlag, "1.1.1.1, 203.0.113.5, 198.51.100.7", http.StatusOK, "no"},
+		{"EmptyEntriesIgnored", ExpectedHops{Min: 2, Max: 2}, "", "203.0.113.5, , 198.51.100.7", http.StatusOK, "yes"},
+		{"MissingHeader", ExpectedHops{Min: 1}, "", "", http.StatusOK, "no"},
+		{"OpenMaximum", ExpectedHops{Min: 1}, "", "1.1.1.1, 2.2.2.2, 3.3.3.3", http.StatusOK, "yes"},
+		{"OpenMinimum", ExpectedHops{Max: 1}, "", "", http.StatusOK, "yes"},
+		{"Rejected", ExpectedHops{Min: 2, Max: 2}, expectedHopsReject, "1.1.1.1, 203.0.113.5, 198.51.100.7", http.StatusForbidden, ""},
+		{"Disabled", ExpectedHops{}, expectedHopsReject, "1.1.1.1, 203.0.113.5, 198.51.100.7", http.StatusOK, "forged"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ExpectedHops = tt.hops
+			cfg.ExpectedHopsAction = tt.action
+			cfg.RejectReasonHeaderName = "X-Reject-Reason"
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Hops-Valid", "forged")
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				if reason := rr.Header().Get("X-Reject-Reason"); reason != rejectReasonHopCount {
+					t.Errorf("expected reject reason %q, but got %q", rejectReasonHopCount, reason)
+				}
+				return
+			}
+			if hopsValid := req.Header.Get("X-Hops-Valid"); hopsValid != tt.expectedHopsValid {
+				t.Errorf("expected X-Hops-Valid '%s', but got: '%s'", tt.expectedHopsValid, hopsValid)
+			}
+		})
+	}
+
+	t.Run("InvalidConfigurations", func(t *testing.T) {
+		for _, modify := range []func(*Config){
+			func(cfg *Config) { cfg.ExpectedHops = ExpectedHops{Min: -1} },
+			func(cfg *Config) { cfg.ExpectedHops = ExpectedHops{Min: 3, Max: 2} },
+			func(cfg *Config) { cfg.ExpectedHopsAction = "drop" },
+			func(cfg *Config) {
+				cfg.ExpectedHops = ExpectedHops{Min: 2}
+				cfg.HopsValidHeaderName = ""
+			},
+		} {
+			cfg := CreateConfig()
+			modify(cfg)
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package traefik_realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// hostIPLiteral returns the IP of a Host header (or :authority) that is an IP literal such as
+// "203.0.113.5", "203.0.113.5:8080" or "[2001:db8::1]:8443", or nil when it is a name
+func hostIPLiteral(host string) net.IP {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return net.ParseIP(host)
+}
+
+// inTrustedRanges reports whether ip is in trustedIPs, the ranges loaded from trustedIPsFile, a trusted remote IP list or a trust tier
+func (r *Resolver) inTrustedRanges(ip net.IP) bool {
+	if r.trustedIPs != nil {
+		if contained, _, err := r.trustedIPs.IsContained(ip); err == nil && contained {
+			return true
+		}
+	}
+	if r.trustedIPsFile != nil {
+		if contained, _, err := r.trustedIPsFile.Helper().IsContained(ip); err == nil && contained {
+			return true
+		}
+	}
+	for _, list := range r.remoteLists {
+		if list.trusted && list.contains(ip) {
+			return true
+		}
+	}
+	for _, tier := range r.trustTiers {
+		if contained, _, err := tier.ips.IsContained(ip); err == nil && contained {
+			return true
+		}
+	}
+	return false
+}
+
+// detectHostMismatch reports whether req addresses the service by an IP literal that is
+// neither the real IP nor in the trusted ranges. Services meant to be reached by name
+// rarely see such requests from legitimate clients.
+func (r *Resolver) detectHostMismatch(req *http.Request, realIP string) bool {
+	hostIP := hostIPLiteral(req.Host)
+	if hostIP == nil {
+		return false
+	}
+	if realIP != "" && hostIP.Equal(parseAddress(realIP)) {
+		return false
+	}
+	if r.inTrustedRanges(hostIP) {
+		return false
+	}
+
+	atomic.AddInt64(&r.stats.hostMismatches, 1)
+	return true
+}
@@ -0,0 +1,87 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostIPLiteral(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"203.0.113.5", "203.0.113.5"},
+		{"203.0.113.5:8080", "203.0.113.5"},
+		{"[2001:db8::1]:8443", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"example.com", ""},
+		{"example.com:8080", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			ip := hostIPLiteral(tt.host)
+			got := ""
+			if ip != nil {
+				got = ip.String()
+			}
+			if got != tt.expected {
+				t.Errorf("expected '%s', but got: '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHostMismatch(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}}
+	cfg.TrustAll = false
+	cfg.TrustedIPs = []string{"10.0.0.0/8"}
+	cfg.HostMismatchHeaderName = "X-Host-Mismatch"
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		name     string
+		host     string
+		xff      string
+		expected string
+	}{
+		{"Name", "app.example.com", "203.0.113.1", ""},
+		{"NameWithPort", "app.example.com:8443", "203.0.113.1", ""},
+		{"ForeignIPLiteral", "198.51.100.7", "203.0.113.1", "yes"},
+		{"ForeignIPv6Literal", "[2001:db8::7]:8443", "203.0.113.1", "yes"},
+		{"TrustedRangeLiteral", "10.1.2.3:8080", "203.0.113.1", ""},
+		{"RealIPLiteral", "203.0.113.1", "203.0.113.1", ""},
+		{"UnresolvedIPLiteral", "198.51.100.7", "", "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Host = tt.host
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Host-Mismatch", "spoofed")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tag := req.Header.Get("X-Host-Mismatch"); tag != tt.expected {
+				t.Errorf("expected tag '%s', but got: '%s'", tt.expected, tag)
+			}
+		})
+	}
+
+	if mismatches := plugin.Stats().HostMismatches; mismatches != 3 {
+		t.Errorf("expected 3 host mismatches, but got %d", mismatches)
+	}
+}
@@ -0,0 +1,57 @@
+package traefik_realip
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// inspection is the JSON body inspectPath answers with
+type inspection struct {
+	RemoteAddr  string              `json:"remoteAddr"`            // Connection address of the request
+	RealIP      string              `json:"realIP"`                // Resolved real IP ("" if none)
+	Trusted     bool                `json:"trusted"`               // Trust verdict for the source
+	TrustReason string              `json:"trustReason,omitempty"` // Why the source was (or was not) trusted
+	Source      string              `json:"source,omitempty"`      // Header that produced the real IP
+	Chain       string              `json:"chain,omitempty"`       // Candidate chain, as chainHeaderName would carry it
+	Headers     map[string][]string `json:"headers,omitempty"`     // Values of the processed headers as received
+	Decision    DecisionReport      `json:"decision"`              // Full trace of the resolution
+}
+
+// isInspectPath reports whether req targets the configured inspect path
+func (r *Resolver) isInspectPath(req *http.Request) bool {
+	return r.inspectPath != "" && req.URL.Path == r.inspectPath
+}
+
+// inspectResponse answers the inspect path of trusted sources with how req itself is resolved. It runs before
+// any header is modified, so the headers are the ones the client and proxies sent.
+func (r *Resolver) inspectResponse(req *http.Request, isTrusted bool) *Response {
+	report := r.Explain(req)
+	result := inspection{
+		RemoteAddr:  req.RemoteAddr,
+		RealIP:      report.RealIP,
+		Trusted:     report.Trusted,
+		TrustReason: report.TrustReason,
+		Source:      report.Source,
+		Chain:       r.chain(req, isTrusted),
+		Decision:    report,
+	}
+	for _, headerConfig := range r.processHeaders {
+		if values := req.Header.Values(headerConfig.HeaderName); len(values) > 0 {
+			if result.Headers == nil {
+				result.Headers = make(map[string][]string)
+			}
+			result.Headers[http.CanonicalHeaderKey(headerConfig.HeaderName)] = values
+		}
+	}
+
+	body, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		logf(r.name, "failed to encode inspection: %v", err)
+		return &Response{Status: http.StatusInternalServerError}
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Cache-Control", "no-store")
+	return &Response{Status: http.StatusOK, Header: header, Body: body}
+}
@@ -0,0 +1,97 @@
+package traefik_realip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInspectPath(t *testing.T) {
+	newPlugin := func(t *testing.T) http.Handler {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.InspectPath = "/__realip"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		expectedIP     string
+		expectedTrust  bool
+		expectedSource string
+	}{
+		{"TrustedSource", "10.0.0.1:1234", "203.0.113.1", true, "X-Forwarded-For"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/__realip", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			rw := httptest.NewRecorder()
+
+			newPlugin(t).ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK {
+				t.Fatalf("expected status %d, but got: %d", http.StatusOK, rw.Code)
+			}
+			if contentType := rw.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("expected JSON content type, but got: '%s'", contentType)
+			}
+
+			var result inspection
+			if err := json.Unmarshal(rw.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to decode inspection: %v", err)
+			}
+			if result.RealIP != tt.expectedIP || result.Trusted != tt.expectedTrust || result.Source != tt.expectedSource {
+				t.Errorf("expected (%s, %v, %s), but got (%s, %v, %s)", tt.expectedIP, tt.expectedTrust, tt.expectedSource, result.RealIP, result.Trusted, result.Source)
+			}
+			if values := result.Headers["X-Forwarded-For"]; len(values) != 1 || values[0] != "203.0.113.1" {
+				t.Errorf("expected the received X-Forwarded-For, but got: %v", values)
+			}
+			if len(result.Decision.Headers) != 2 {
+				t.Errorf("expected the decision trace of both headers, but got: %d", len(result.Decision.Headers))
+			}
+		})
+	}
+
+	t.Run("UntrustedSourcesAreProxied", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/__realip", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		rw := httptest.NewRecorder()
+
+		newPlugin(t).ServeHTTP(rw, req)
+
+		if rw.Body.Len() != 0 {
+			t.Errorf("expected the request of an untrusted source to be proxied, but got body: %s", rw.Body.String())
+		}
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "192.0.2.1" {
+			t.Errorf("expected the request to be processed, but got X-Real-IP: '%s'", realIP)
+		}
+	})
+
+	t.Run("OtherPathsAreProxied", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/__realip/other", nil)
+		rw := httptest.NewRecorder()
+
+		newPlugin(t).ServeHTTP(rw, req)
+
+		if rw.Body.Len() != 0 {
+			t.Errorf("expected the request to be proxied, but got body: %s", rw.Body.String())
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Ways headerInstances reads a processed header sent several times
+const (
+	headerInstancesJoin  = "join"
+	headerInstancesFirst = "first"
+	headerInstancesLast  = "last"
+)
+
+// parseHeaderInstances validates the headerInstances configuration, defaulting to join
+func parseHeaderInstances(name, mode string) (string, error) {
+	switch mode {
+	case "":
+		return headerInstancesJoin, nil
+	case headerInstancesJoin, headerInstancesFirst, headerInstancesLast:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s: headerInstances must be %q, %q or %q, got %q", name, headerInstancesJoin, headerInstancesFirst, headerInstancesLast, mode)
+	}
+}
+
+// headerValue reads a processed header. By default every instance is joined in order, since
+// RFC 7230 defines repeated list headers as one comma-separated list; reading only the first
+// would let clients hide entries in a second instance.
+func (r *Resolver) headerValue(req *http.Request, headerName string) string {
+	values := req.Header.Values(headerName)
+	switch {
+	case len(values) == 0:
+		return ""
+	case len(values) == 1 || r.headerInstances == headerInstancesFirst:
+		return values[0]
+	case r.headerInstances == headerInstancesLast:
+		return values[len(values)-1]
+	default:
+		return strings.Join(values, ", ")
+	}
+}
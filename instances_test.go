@@ -0,0 +1,61 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderInstances(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		depth      int
+		instances  []string
+		expectedIP string
+	}{
+		{"DefaultJoinsInstances", "", 0, []string{"1.1.1.1", "2.2.2.2, 3.3.3.3"}, "3.3.3.3"},
+		{"JoinLeftmost", headerInstancesJoin, -1, []string{"1.1.1.1", "2.2.2.2"}, "1.1.1.1"},
+		{"First", headerInstancesFirst, 0, []string{"1.1.1.1", "2.2.2.2"}, "1.1.1.1"},
+		{"Last", headerInstancesLast, -1, []string{"1.1.1.1", "2.2.2.2, 3.3.3.3"}, "2.2.2.2"},
+		{"SingleInstance", headerInstancesLast, 0, []string{"1.1.1.1"}, "1.1.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.HeaderInstances = tt.mode
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: tt.depth}}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for _, value := range tt.instances {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.HeaderInstances = "all"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown headerInstances mode, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
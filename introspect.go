@@ -0,0 +1,199 @@
+package traefik_realip
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the token introspection enrichment
+const (
+	defaultIntrospectionTimeout  = 500 * time.Millisecond
+	defaultIntrospectionCacheTTL = 60 * time.Second
+	introspectionBackoff         = 5 * time.Second // Pause of the calls after a failed one
+)
+
+// errIntrospectionUnavailable is returned without calling the endpoint while calls are paused
+var errIntrospectionUnavailable = errors.New("introspection endpoint unavailable, calls paused after a failure")
+
+// maxIntrospectionCacheEntries bounds the memory used by the introspection cache
+const maxIntrospectionCacheEntries = 10000
+
+// maxIntrospectionResponseSize bounds the introspection response body that is read
+const maxIntrospectionResponseSize = 64 * 1024
+
+// introspectionResponse is the subset of an RFC 7662 introspection response the plugin uses
+type introspectionResponse struct {
+	Active   bool   `json:"active"`
+	ClientIP string `json:"client_ip"`
+}
+
+// introspectionEntry is a cached client IP ("" for inactive tokens) and its expiry time
+type introspectionEntry struct {
+	clientIP string
+	expires  time.Time
+}
+
+// tokenIntrospector resolves the client_ip of Bearer tokens through an RFC 7662
+// introspection endpoint. Results are cached by token hash, so raw tokens are never kept.
+// After a failed call the endpoint is left alone for introspectionBackoff, then a single
+// call probes it, so an outage does not add the timeout to every request.
+type tokenIntrospector struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	ttl          time.Duration
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]introspectionEntry
+	paused  time.Time // Calls are not made before then
+}
+
+// newTokenIntrospector creates an introspector for endpoint with the given request timeout and cache TTL
+func newTokenIntrospector(endpoint, clientID, clientSecret string, timeout, ttl time.Duration) (*tokenIntrospector, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("expected an absolute http(s) URL, got %q", endpoint)
+	}
+
+	if timeout <= 0 {
+		timeout = defaultIntrospectionTimeout
+	}
+	if ttl <= 0 {
+		ttl = defaultIntrospectionCacheTTL
+	}
+
+	return &tokenIntrospector{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: timeout},
+		ttl:          ttl,
+		entries:      make(map[[sha256.Size]byte]introspectionEntry),
+	}, nil
+}
+
+// bearerToken returns the Bearer token of req, or ""
+func bearerToken(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(authorization[7:])
+}
+
+// clientIP returns the client_ip of token, from the cache or the introspection endpoint.
+// Inactive tokens and responses without a valid IP yield "" and are cached; errors are not,
+// but pause the calls, during which errIntrospectionUnavailable is returned.
+func (t *tokenIntrospector) clientIP(token string, now time.Time) (string, error) {
+	key := sha256.Sum256([]byte(token))
+
+	t.mu.Lock()
+	entry, ok := t.entries[key]
+	if ok && now.Before(entry.expires) {
+		t.mu.Unlock()
+		return entry.clientIP, nil
+	}
+	if now.Before(t.paused) {
+		t.mu.Unlock()
+		return "", errIntrospectionUnavailable
+	}
+	if !t.paused.IsZero() {
+		// Probe the endpoint after a failure; other requests keep skipping it meanwhile
+		t.paused = now.Add(t.client.Timeout)
+	}
+	t.mu.Unlock()
+
+	clientIP, err := t.introspect(token)
+	if err != nil {
+		t.mu.Lock()
+		t.paused = now.Add(introspectionBackoff)
+		t.mu.Unlock()
+		return "", err
+	}
+
+	t.mu.Lock()
+	t.paused = time.Time{}
+	if len(t.entries) >= maxIntrospectionCacheEntries {
+		for k, entry := range t.entries {
+			if !now.Before(entry.expires) {
+				delete(t.entries, k)
+			}
+		}
+		if len(t.entries) >= maxIntrospectionCacheEntries {
+			t.entries = make(map[[sha256.Size]byte]introspectionEntry)
+		}
+	}
+	t.entries[key] = introspectionEntry{clientIP: clientIP, expires: now.Add(t.ttl)}
+	t.mu.Unlock()
+
+	return clientIP, nil
+}
+
+// introspect calls the endpoint for token
+func (t *tokenIntrospector) introspect(token string) (string, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if t.clientID != "" {
+		req.SetBasicAuth(t.clientID, t.clientSecret)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionResponseSize)).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid introspection response: %w", err)
+	}
+
+	if !result.Active || net.ParseIP(result.ClientIP) == nil {
+		return "", nil
+	}
+	return net.ParseIP(result.ClientIP).String(), nil
+}
+
+// tokenClientIP returns the client_ip of the request's Bearer token, or "" when there is
+// none or the endpoint cannot be reached
+func (r *Resolver) tokenClientIP(req *http.Request) string {
+	token := bearerToken(req)
+	if token == "" {
+		return ""
+	}
+
+	clientIP, err := r.introspector.clientIP(token, time.Now())
+	if err != nil {
+		// Only the failed call is logged, not every request skipped while calls are paused
+		if !errors.Is(err, errIntrospectionUnavailable) {
+			r.requestLogf(req, "token introspection failed: %v", err)
+		}
+		return ""
+	}
+	if clientIP == "" {
+		r.logAnomaly(req, anomalyInvalidToken, "inactive token or no valid client_ip")
+	}
+	return clientIP
+}
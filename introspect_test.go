@@ -0,0 +1,255 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newIntrospectionServer answers RFC 7662 requests from tokens, counting the calls
+func newIntrospectionServer(t *testing.T, tokens map[string]string) (*httptest.Server, *int64) {
+	t.Helper()
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&calls, 1)
+
+		if user, pass, ok := req.BasicAuth(); !ok || user != "realip" || pass != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := req.ParseForm(); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response, ok := tokens[req.PostForm.Get("token")]
+		if !ok {
+			response = `{"active":false}`
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestTokenIntrospector(t *testing.T) {
+	server, calls := newIntrospectionServer(t, map[string]string{
+		"good":    `{"active":true,"client_ip":"203.0.113.9"}`,
+		"no-ip":   `{"active":true}`,
+		"bad-ip":  `{"active":true,"client_ip":"nope"}`,
+		"garbage": `not json`,
+	})
+
+	introspector, err := newTokenIntrospector(server.URL, "realip", "secret", time.Second, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create introspector: %v", err)
+	}
+
+	tests := []struct {
+		token       string
+		expected    string
+		expectedErr bool
+	}{
+		{"good", "203.0.113.9", false},
+		{"no-ip", "", false},
+		{"bad-ip", "", false},
+		{"inactive", "", false},
+		{"garbage", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			clientIP, err := introspector.clientIP(tt.token, time.Now())
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %v, but got: %v", tt.expectedErr, err)
+			}
+			if clientIP != tt.expected {
+				t.Errorf("expected client IP '%s', but got: '%s'", tt.expected, clientIP)
+			}
+		})
+	}
+
+	t.Run("Cached", func(t *testing.T) {
+		now := time.Now()
+		before := atomic.LoadInt64(calls)
+		for i := 0; i < 3; i++ {
+			if _, err := introspector.clientIP("good", now); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if made := atomic.LoadInt64(calls) - before; made != 0 {
+			t.Errorf("expected cached results, but %d calls were made", made)
+		}
+
+		if _, err := introspector.clientIP("good", now.Add(2*time.Minute)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if made := atomic.LoadInt64(calls) - before; made != 1 {
+			t.Errorf("expected one call after expiry, but %d calls were made", made)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer slow.Close()
+
+		introspector, err := newTokenIntrospector(slow.URL, "", "", 20*time.Millisecond, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to create introspector: %v", err)
+		}
+		if _, err := introspector.clientIP("good", time.Now()); err == nil {
+			t.Error("expected timeout error, but got none")
+		}
+	})
+
+	t.Run("FailurePausesCalls", func(t *testing.T) {
+		var failing int64
+		down := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt64(&failing, 1)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer down.Close()
+
+		introspector, err := newTokenIntrospector(down.URL, "", "", time.Second, time.Minute)
+		if err != nil {
+			t.Fatalf("failed to create introspector: %v", err)
+		}
+
+		now := time.Now()
+		if _, err := introspector.clientIP("good", now); err == nil || errors.Is(err, errIntrospectionUnavailable) {
+			t.Fatalf("expected the failed call to be reported, but got: %v", err)
+		}
+		for _, token := range []string{"good", "other"} {
+			if _, err := introspector.clientIP(token, now.Add(time.Second)); !errors.Is(err, errIntrospectionUnavailable) {
+				t.Errorf("expected calls to be paused after a failure, but got: %v", err)
+			}
+		}
+		if calls := atomic.LoadInt64(&failing); calls != 1 {
+			t.Errorf("expected a single call while the endpoint is down, but %d were made", calls)
+		}
+
+		if _, err := introspector.clientIP("good", now.Add(introspectionBackoff)); errors.Is(err, errIntrospectionUnavailable) {
+			t.Errorf("expected the endpoint to be probed again after the pause, but got: %v", err)
+		}
+		if calls := atomic.LoadInt64(&failing); calls != 2 {
+			t.Errorf("expected a probe after the pause, but %d calls were made", calls)
+		}
+	})
+
+	t.Run("InvalidURL", func(t *testing.T) {
+		for _, endpoint := range []string{"introspect", "ftp://example.com/introspect", "http://"} {
+			if _, err := newTokenIntrospector(endpoint, "", "", 0, 0); err == nil {
+				t.Errorf("expected error for %q, but got none", endpoint)
+			}
+		}
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		authorization string
+		expected      string
+	}{
+		{"Bearer abc.def", "abc.def"},
+		{"bearer  abc ", "abc"},
+		{"Basic dXNlcjpwYXNz", ""},
+		{"Bearer", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", tt.authorization)
+		if token := bearerToken(req); token != tt.expected {
+			t.Errorf("bearerToken(%q) = %q, expected %q", tt.authorization, token, tt.expected)
+		}
+	}
+}
+
+func TestTokenClientIPHeader(t *testing.T) {
+	server, _ := newIntrospectionServer(t, map[string]string{
+		"good": `{"active":true,"client_ip":"203.0.113.9"}`,
+	})
+
+	cfg := &Config{
+		Enabled:                   true,
+		HeaderName:                "X-Real-IP",
+		ProcessHeaders:            []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		ForceOverwrite:            true,
+		TrustedIPs:                []string{"10.0.0.0/8"},
+		IntrospectionURL:          server.URL,
+		IntrospectionClientID:     "realip",
+		IntrospectionClientSecret: "secret",
+		TokenClientIPHeaderName:   "X-Token-Client-IP",
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		expected   string
+	}{
+		{"Trusted", "10.0.0.1:1234", "good", "203.0.113.9"},
+		{"TrustedInactiveToken", "10.0.0.1:1234", "revoked", ""},
+		{"TrustedWithoutToken", "10.0.0.1:1234", "", ""},
+		{"Untrusted", "198.51.100.1:1234", "good", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Token-Client-IP", "spoofed")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if clientIP := req.Header.Get("X-Token-Client-IP"); clientIP != tt.expected {
+				t.Errorf("expected token client IP '%s', but got: '%s'", tt.expected, clientIP)
+			}
+		})
+	}
+
+	t.Run("SecretRedactedInDump", func(t *testing.T) {
+		var logs bytes.Buffer
+		logWriter = &logs
+		defer func() { logWriter = os.Stdout }()
+
+		plugin.dump(time.Now())
+
+		if strings.Contains(logs.String(), `"secret"`) {
+			t.Errorf("expected client secret to be redacted, but got: %s", logs.String())
+		}
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.IntrospectionURL = "not a url"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an invalid introspectionURL, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
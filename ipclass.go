@@ -0,0 +1,43 @@
+package traefik_realip
+
+// Classes ipClassHeaderName reports for the real IP
+const (
+	ipClassPublic      = "public"
+	ipClassPrivate     = "private"
+	ipClassLoopback    = "loopback"
+	ipClassLinkLocal   = "link-local"
+	ipClassCGNAT       = "cgnat"
+	ipClassMulticast   = "multicast"
+	ipClassUnspecified = "unspecified"
+	ipClassReserved    = "reserved"
+)
+
+// cgnatPrefix is the shared address space of carrier-grade NAT (RFC 6598)
+var cgnatPrefix = mustParseCIDR("100.64.0.0/10")
+
+// ipClass returns the class of ip, or "" when it is not an IP. Private covers RFC 1918 and
+// unique local IPv6 addresses; IPv4-mapped addresses are classified as the IPv4 they map to.
+// Addresses that fit no other class, such as the IPv4 broadcast address, are reserved.
+func ipClass(ip string) string {
+	parsed := parseAddress(ip)
+	switch {
+	case parsed == nil:
+		return ""
+	case parsed.IsUnspecified():
+		return ipClassUnspecified
+	case parsed.IsLoopback():
+		return ipClassLoopback
+	case parsed.IsMulticast():
+		return ipClassMulticast
+	case parsed.IsLinkLocalUnicast():
+		return ipClassLinkLocal
+	case parsed.IsPrivate():
+		return ipClassPrivate
+	case cgnatPrefix.Contains(parsed):
+		return ipClassCGNAT
+	case parsed.IsGlobalUnicast():
+		return ipClassPublic
+	default:
+		return ipClassReserved
+	}
+}
@@ -0,0 +1,71 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPClass(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"203.0.113.1", ipClassPublic},
+		{"2001:4860:4860::8888", ipClassPublic},
+		{"10.1.2.3", ipClassPrivate},
+		{"172.16.0.1", ipClassPrivate},
+		{"192.168.1.1", ipClassPrivate},
+		{"fd00::1", ipClassPrivate},
+		{"::ffff:192.168.1.1", ipClassPrivate},
+		{"127.0.0.1", ipClassLoopback},
+		{"::1", ipClassLoopback},
+		{"169.254.1.1", ipClassLinkLocal},
+		{"fe80::1", ipClassLinkLocal},
+		{"fe80::1%eth0", ipClassLinkLocal},
+		{"100.64.0.1", ipClassCGNAT},
+		{"100.127.255.254", ipClassCGNAT},
+		{"100.128.0.1", ipClassPublic},
+		{"224.0.0.1", ipClassMulticast},
+		{"ff02::1", ipClassMulticast},
+		{"0.0.0.0", ipClassUnspecified},
+		{"::", ipClassUnspecified},
+		{"255.255.255.255", ipClassReserved},
+		{"not-an-ip", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if class := ipClass(tt.ip); class != tt.expected {
+				t.Errorf("expected class '%s', but got: '%s'", tt.expected, class)
+			}
+		})
+	}
+
+	t.Run("Header", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.IPClassHeaderName = "X-Real-IP-Class"
+		cfg.Anonymize = true
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		for ip, expected := range map[string]string{"100.64.1.2": ipClassCGNAT, "203.0.113.1": ipClassPublic, "": ""} {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "not-an-address"
+			req.Header.Set("X-Real-IP-Class", "private")
+			if ip != "" {
+				req.Header.Set("X-Forwarded-For", ip)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if class := req.Header.Get("X-Real-IP-Class"); class != expected {
+				t.Errorf("expected X-Real-IP-Class '%s' for '%s', but got: '%s'", expected, ip, class)
+			}
+		}
+	})
+}
@@ -3,58 +3,71 @@ package traefik_realip
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"sync"
 )
 
 // radixNode represents a node in the IP radix tree
 type radixNode struct {
-	isEndpoint bool       // true if this node represents the end of a CIDR block
-	prefixLen  int        // the prefix length of the CIDR block (if isEndpoint is true)
-	left       *radixNode // for bit 0
-	right      *radixNode // for bit 1
+	isEndpoint bool         // true if this node represents the end of a CIDR block
+	excluded   bool         // true if the CIDR block is an exclusion ("!10.99.0.0/16") punching a hole in broader blocks
+	cidr       string       // the CIDR block in canonical form (if isEndpoint is true)
+	prefix     netip.Prefix // the CIDR block (if isEndpoint is true)
+	left       *radixNode   // for bit 0
+	right      *radixNode   // for bit 1
 }
 
-// ipRadixTree provides fast O(log k) IP block lookups where k is the IP bit length (32 for IPv4, 128 for IPv6)
+// ipRadixTree provides fast O(k) IP block lookups where k is the IP bit length (32 for IPv4, 128 for IPv6).
+// IPv4 and IPv6 blocks are kept in separate tries, so an IPv4 address never matches an IPv6
+// prefix whose leading bits happen to be equal (e.g. 32.1.13.184 and 2001:db8::/32).
 type ipRadixTree struct {
-	root *radixNode
+	ipv4 *radixNode
+	ipv6 *radixNode
 }
 
 // newIPRadixTree creates a new empty radix tree
 func newIPRadixTree() *ipRadixTree {
 	return &ipRadixTree{
-		root: &radixNode{},
+		ipv4: &radixNode{},
+		ipv6: &radixNode{},
 	}
 }
 
-// insert adds a CIDR block to the radix tree
-func (tree *ipRadixTree) insert(cidr *net.IPNet) {
-	ip := cidr.IP
-	prefixLen, _ := cidr.Mask.Size()
+// trie returns the address bytes of ip (4 for IPv4, including IPv4-mapped IPv6, 16 for IPv6)
+// and the root of the trie for its family
+func (tree *ipRadixTree) trie(ip net.IP) (net.IP, *radixNode) {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4, tree.ipv4
+	}
+	return ip.To16(), tree.ipv6
+}
 
-	// Determine if this is IPv4 or IPv6
-	isIPv4 := ip.To4() != nil
-	var bitStart int
+// locate returns the address bytes, prefix length and trie root a CIDR block is stored under
+func (tree *ipRadixTree) locate(cidr *net.IPNet) (net.IP, int, *radixNode) {
+	prefixLen, bits := cidr.Mask.Size()
+	ip, root := tree.trie(cidr.IP)
 
-	if isIPv4 {
-		// For IPv4, convert to 16-byte representation but note that
-		// IPv4-mapped IPv6 has IPv4 bits at positions 96-127
-		ip = ip.To4().To16()
-		bitStart = 96 // IPv4 starts at bit 96 in IPv4-mapped IPv6
-	} else {
-		// For IPv6, use as-is
-		bitStart = 0
+	// IPv4-mapped IPv6 blocks (e.g. ::ffff:10.0.0.0/104) are stored as the IPv4 block they map
+	// to; shorter prefixes also cover non-mapped addresses and stay in the IPv6 trie
+	if bits == 8*net.IPv6len && len(ip) == net.IPv4len {
+		if prefixLen >= 96 {
+			prefixLen -= 96
+		} else {
+			ip, root = cidr.IP.To16(), tree.ipv6
+		}
 	}
+	return ip, prefixLen, root
+}
 
-	current := tree.root
+// insert adds a CIDR block, or an exclusion, to the radix tree and reports whether the block
+// was not stored yet. A block stored both ways keeps the last one.
+func (tree *ipRadixTree) insert(cidr *net.IPNet, excluded bool) bool {
+	ip, prefixLen, current := tree.locate(cidr)
 
 	// Walk through each bit of the IP up to the prefix length
 	for i := 0; i < prefixLen; i++ {
-		// Calculate actual bit position in the 16-byte array
-		actualBitPos := bitStart + i
-		bytePos := actualBitPos / 8
-		bitPos := 7 - (actualBitPos % 8) // Most significant bit first
-
-		// Extract the bit (0 or 1)
-		bit := (ip[bytePos] >> bitPos) & 1
+		// Extract the bit (0 or 1), most significant bit first
+		bit := (ip[i/8] >> (7 - i%8)) & 1
 
 		// Go left for 0, right for 1
 		if bit == 0 {
@@ -70,50 +83,76 @@ func (tree *ipRadixTree) insert(cidr *net.IPNet) {
 		}
 	}
 
-	// Mark this node as an endpoint with the prefix length
+	// Mark this node as an endpoint with the block in canonical form
+	mask := net.CIDRMask(prefixLen, 8*len(ip))
+	added := !current.isEndpoint
 	current.isEndpoint = true
-	current.prefixLen = prefixLen
+	current.excluded = excluded
+	addr, _ := netip.AddrFromSlice(ip.Mask(mask))
+	current.prefix = netip.PrefixFrom(addr, prefixLen)
+	current.cidr = current.prefix.String()
+	return added
+}
+
+// remove deletes a CIDR block, or an exclusion, from the radix tree and reports whether it was
+// stored that way. Nodes are kept, since they are few compared to lookups and may be reused by a later insert.
+func (tree *ipRadixTree) remove(cidr *net.IPNet, excluded bool) bool {
+	ip, prefixLen, current := tree.locate(cidr)
+	for i := 0; i < prefixLen && current != nil; i++ {
+		if (ip[i/8]>>(7-i%8))&1 == 0 {
+			current = current.left
+		} else {
+			current = current.right
+		}
+	}
+	if current == nil || !current.isEndpoint || current.excluded != excluded {
+		return false
+	}
+	current.isEndpoint = false
+	current.excluded = false
+	current.cidr = ""
+	current.prefix = netip.Prefix{}
+	return true
+}
+
+// prefixes appends the blocks stored under node to list, in address order with shorter prefixes first
+func (node *radixNode) prefixes(list []string) []string {
+	if node == nil {
+		return list
+	}
+	if node.isEndpoint && node.excluded {
+		list = append(list, "!"+node.cidr)
+	} else if node.isEndpoint {
+		list = append(list, node.cidr)
+	}
+	return node.right.prefixes(node.left.prefixes(list))
 }
 
 // contains checks if an IP address is contained in any of the CIDR blocks in the tree
-// Returns (found, prefixLength) where found indicates if a match was found
-// and prefixLength is the length of the matching CIDR block (for priority calculation)
-func (tree *ipRadixTree) contains(ip net.IP) (bool, int) {
-	// Determine if this is IPv4 or IPv6
-	isIPv4 := ip.To4() != nil
-	var bitStart, maxPrefixLen int
-
-	if isIPv4 {
-		// For IPv4, convert to 16-byte representation
-		ip = ip.To4().To16()
-		bitStart = 96     // IPv4 starts at bit 96 in IPv4-mapped IPv6
-		maxPrefixLen = 32 // IPv4 addresses have max 32-bit prefixes
-	} else {
-		// For IPv6, use as-is
-		bitStart = 0
-		maxPrefixLen = 128 // IPv6 addresses have max 128-bit prefixes
-	}
-
-	current := tree.root
-	longestMatch := 0
+// Returns (found, cidr) where found indicates if a match was found
+// and cidr is the most specific matching CIDR block. An address whose most specific
+// match is an exclusion is not found.
+func (tree *ipRadixTree) contains(ip net.IP) (bool, string) {
+	ip, current := tree.trie(ip)
+	if ip == nil {
+		return false, ""
+	}
+	maxPrefixLen := len(ip) * 8
+
+	longestMatch := ""
 	found := false
 
 	// Walk through each bit of the IP
 	for i := 0; i < maxPrefixLen && current != nil; i++ {
 		// Check if current node is an endpoint (represents a CIDR block)
 		if current.isEndpoint {
-			found = true
-			longestMatch = current.prefixLen
+			found = !current.excluded
+			longestMatch = current.cidr
 			// Continue walking to find longest match (most specific CIDR)
 		}
 
-		// Calculate actual bit position in the 16-byte array
-		actualBitPos := bitStart + i
-		bytePos := actualBitPos / 8
-		bitPos := 7 - (actualBitPos % 8) // Most significant bit first
-
-		// Extract the bit (0 or 1)
-		bit := (ip[bytePos] >> bitPos) & 1
+		// Extract the bit (0 or 1), most significant bit first
+		bit := (ip[i/8] >> (7 - i%8)) & 1
 
 		// Move to next node
 		if bit == 0 {
@@ -125,16 +164,48 @@ func (tree *ipRadixTree) contains(ip net.IP) (bool, int) {
 
 	// Check final node
 	if current != nil && current.isEndpoint {
-		found = true
-		longestMatch = current.prefixLen
+		found = !current.excluded
+		longestMatch = current.cidr
 	}
 
+	if !found {
+		return false, ""
+	}
 	return found, longestMatch
 }
 
+// matches returns every CIDR block in the tree containing ip, least specific first. An exclusion
+// drops the broader blocks it punches a hole in; more specific blocks inside it match again.
+func (tree *ipRadixTree) matches(ip net.IP) []netip.Prefix {
+	ip, current := tree.trie(ip)
+	if ip == nil {
+		return nil
+	}
+
+	var prefixes []netip.Prefix
+	for i := 0; current != nil; i++ {
+		if current.isEndpoint && current.excluded {
+			prefixes = nil
+		} else if current.isEndpoint {
+			prefixes = append(prefixes, current.prefix)
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		if (ip[i/8]>>(7-i%8))&1 == 0 {
+			current = current.left
+		} else {
+			current = current.right
+		}
+	}
+	return prefixes
+}
+
 // IpLookupHelper provides fast IP block lookups using radix trees
-// Optimized for O(32) IPv4 and O(128) IPv6 lookups instead of O(n) linear search
+// Optimized for O(32) IPv4 and O(128) IPv6 lookups instead of O(n) linear search.
+// It is safe for concurrent use, so lists can be updated while requests are looked up.
 type IpLookupHelper struct {
+	mu    sync.RWMutex
 	tree  *ipRadixTree
 	count int // Number of CIDR blocks stored
 }
@@ -146,29 +217,77 @@ func NewEmptyIpLookupHelper() *IpLookupHelper {
 	}
 }
 
-// AddCIDR adds a single CIDR block to the helper
-func (helper *IpLookupHelper) AddCIDR(cidr string) error {
-	_, block, err := net.ParseCIDR(cidr)
+// Add adds a CIDR block, a single IP address or an inclusive range "first-last" to the helper.
+// Prefixed with "!", the entry is an exclusion: addresses whose most specific match it is are
+// not contained. Adding a block that is already stored has no effect.
+func (helper *IpLookupHelper) Add(cidr string) error {
+	blocks, excluded, err := parseEntry(cidr)
 	if err != nil {
-		return fmt.Errorf("parse error on CIDR %q: %v", cidr, err)
+		return err
+	}
+	helper.mu.Lock()
+	defer helper.mu.Unlock()
+	for _, block := range blocks {
+		if helper.tree.insert(block, excluded) {
+			helper.count++
+		}
 	}
-	helper.tree.insert(block)
-	helper.count++
 	return nil
 }
 
-// Count returns the number of CIDR blocks stored in the helper
-func (helper *IpLookupHelper) Count() int {
+// AddCIDR is Add, kept for existing callers
+func (helper *IpLookupHelper) AddCIDR(cidr string) error {
+	return helper.Add(cidr)
+}
+
+// Remove removes a CIDR block, single IP address or range, written as for Add, from the helper
+// and reports whether any of its blocks was stored. Only the blocks themselves are removed;
+// blocks they contain or that contain them stay.
+func (helper *IpLookupHelper) Remove(cidr string) (bool, error) {
+	blocks, excluded, err := parseEntry(cidr)
+	if err != nil {
+		return false, err
+	}
+	helper.mu.Lock()
+	defer helper.mu.Unlock()
+	removed := false
+	for _, block := range blocks {
+		if helper.tree.remove(block, excluded) {
+			helper.count--
+			removed = true
+		}
+	}
+	return removed, nil
+}
+
+// Len returns the number of CIDR blocks stored in the helper
+func (helper *IpLookupHelper) Len() int {
+	helper.mu.RLock()
+	defer helper.mu.RUnlock()
 	return helper.count
 }
 
+// Count is Len, kept for existing callers
+func (helper *IpLookupHelper) Count() int {
+	return helper.Len()
+}
+
+// Prefixes returns the CIDR blocks stored in the helper in canonical form, IPv4 blocks first,
+// each family in address order. Exclusions are prefixed with "!". IPv4-mapped IPv6 blocks are listed as the IPv4 block they map to.
+func (helper *IpLookupHelper) Prefixes() []string {
+	helper.mu.RLock()
+	defer helper.mu.RUnlock()
+	list := make([]string, 0, helper.count)
+	return helper.tree.ipv6.prefixes(helper.tree.ipv4.prefixes(list))
+}
+
 // NewIpLookupHelper creates a new IP lookup helper with the given CIDR block list
 func NewIpLookupHelper(cidrBlocks []string) (*IpLookupHelper, error) {
 	helper := NewEmptyIpLookupHelper()
 
 	// Parse and insert CIDR blocks
 	for _, cidr := range cidrBlocks {
-		if err := helper.AddCIDR(cidr); err != nil {
+		if err := helper.Add(cidr); err != nil {
 			return nil, err
 		}
 	}
@@ -177,11 +296,51 @@ func NewIpLookupHelper(cidrBlocks []string) (*IpLookupHelper, error) {
 }
 
 // IsContained checks if an IP is contained in any of the CIDR blocks
-// Returns (isContained, prefixLength, error)
-func (helper *IpLookupHelper) IsContained(ipAddr net.IP) (bool, int, error) {
+// Returns (isContained, matchedCIDR, error), where matchedCIDR is the most specific block containing the IP
+func (helper *IpLookupHelper) IsContained(ipAddr net.IP) (bool, string, error) {
 	if ipAddr == nil {
-		return false, 0, fmt.Errorf("IP address is nil")
+		return false, "", fmt.Errorf("IP address is nil")
+	}
+	helper.mu.RLock()
+	defer helper.mu.RUnlock()
+	found, cidr := helper.tree.contains(ipAddr)
+	return found, cidr, nil
+}
+
+// IsContainedAddress is IsContained for an address in text form. An IPv6 zone identifier
+// (e.g., "fe80::1%eth0") is ignored, since zones do not take part in prefix matching.
+func (helper *IpLookupHelper) IsContainedAddress(addr string) (bool, string, error) {
+	ip := parseAddress(addr)
+	if ip == nil {
+		return false, "", fmt.Errorf("invalid IP address %q", addr)
+	}
+	return helper.IsContained(ip)
+}
+
+// Matches returns every CIDR block containing addr, least specific first, e.g. both 10.0.0.0/8
+// and 10.1.0.0/16 for 10.1.2.3. IPv4-mapped IPv6 addresses match as the IPv4 address they map to.
+func (helper *IpLookupHelper) Matches(addr netip.Addr) []netip.Prefix {
+	if !addr.IsValid() {
+		return nil
+	}
+	helper.mu.RLock()
+	defer helper.mu.RUnlock()
+	return helper.tree.matches(addr.AsSlice())
+}
+
+// ContainsAll reports whether every address in addrs is contained in a CIDR block, e.g. whether
+// all hops of a chain are trusted proxies. The list is checked under a single lock; an empty
+// list is contained, an invalid address is not.
+func (helper *IpLookupHelper) ContainsAll(addrs []netip.Addr) bool {
+	helper.mu.RLock()
+	defer helper.mu.RUnlock()
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			return false
+		}
+		if found, _ := helper.tree.contains(addr.AsSlice()); !found {
+			return false
+		}
 	}
-	found, prefixLen := helper.tree.contains(ipAddr)
-	return found, prefixLen, nil
+	return true
 }
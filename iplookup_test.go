@@ -1,7 +1,11 @@
 package traefik_realip
 
 import (
+	"fmt"
 	"net"
+	"net/netip"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -20,19 +24,19 @@ func TestIpLookupHelper_IPv4(t *testing.T) {
 	}
 
 	tests := []struct {
-		name           string
-		ip             string
-		shouldMatch    bool
-		expectedPrefix int
+		name         string
+		ip           string
+		shouldMatch  bool
+		expectedCIDR string
 	}{
-		{"IP in 192.168.1.0/24", "192.168.1.5", true, 24},
-		{"Specific IP 192.168.1.10/32", "192.168.1.10", true, 32}, // Should match most specific
-		{"IP in 10.0.0.0/8", "10.5.10.15", true, 8},
-		{"IP in test network", "203.0.113.100", true, 24},
-		{"IP not in any range", "8.8.8.8", false, 0},
-		{"IP not in any range", "1.1.1.1", false, 0},
-		{"Edge of range", "192.168.1.255", true, 24},
-		{"Just outside range", "192.168.2.1", false, 0},
+		{"IP in 192.168.1.0/24", "192.168.1.5", true, "192.168.1.0/24"},
+		{"Specific IP 192.168.1.10/32", "192.168.1.10", true, "192.168.1.10/32"}, // Should match most specific
+		{"IP in 10.0.0.0/8", "10.5.10.15", true, "10.0.0.0/8"},
+		{"IP in test network", "203.0.113.100", true, "203.0.113.0/24"},
+		{"IP not in any range", "8.8.8.8", false, ""},
+		{"IP not in any range", "1.1.1.1", false, ""},
+		{"Edge of range", "192.168.1.255", true, "192.168.1.0/24"},
+		{"Just outside range", "192.168.2.1", false, ""},
 	}
 
 	for _, tt := range tests {
@@ -42,7 +46,7 @@ func TestIpLookupHelper_IPv4(t *testing.T) {
 				t.Fatalf("Invalid IP address: %s", tt.ip)
 			}
 
-			found, prefixLen, err := helper.IsContained(ip)
+			found, cidr, err := helper.IsContained(ip)
 			if err != nil {
 				t.Errorf("IsContained returned error: %v", err)
 			}
@@ -51,8 +55,8 @@ func TestIpLookupHelper_IPv4(t *testing.T) {
 				t.Errorf("IsContained(%s) = %v, want %v", tt.ip, found, tt.shouldMatch)
 			}
 
-			if found && prefixLen != tt.expectedPrefix {
-				t.Errorf("IsContained(%s) prefix = %d, want %d", tt.ip, prefixLen, tt.expectedPrefix)
+			if found && cidr != tt.expectedCIDR {
+				t.Errorf("IsContained(%s) CIDR = %s, want %s", tt.ip, cidr, tt.expectedCIDR)
 			}
 		})
 	}
@@ -73,18 +77,18 @@ func TestIpLookupHelper_IPv6(t *testing.T) {
 	}
 
 	tests := []struct {
-		name           string
-		ip             string
-		shouldMatch    bool
-		expectedPrefix int
+		name         string
+		ip           string
+		shouldMatch  bool
+		expectedCIDR string
 	}{
-		{"IPv6 localhost", "::1", true, 128},
-		{"IPv6 in 2001:db8::/32", "2001:db8:1234:5678::1", true, 32},
-		{"IPv6 in more specific subnet", "2001:db8:85a3:1234::1", true, 48},     // Should match /48, not /32
-		{"IPv6 in most specific subnet", "2001:db8:85a3:8d3:1234::1", true, 64}, // Should match /64
-		{"IPv6 link-local", "fe80::1", true, 10},
-		{"IPv6 not in any range", "2001:db9::1", false, 0},
-		{"IPv6 global unicast not in range", "2a00:1450:4001::1", false, 0},
+		{"IPv6 localhost", "::1", true, "::1/128"},
+		{"IPv6 in 2001:db8::/32", "2001:db8:1234:5678::1", true, "2001:db8::/32"},
+		{"IPv6 in more specific subnet", "2001:db8:85a3:1234::1", true, "2001:db8:85a3::/48"},         // Should match /48, not /32
+		{"IPv6 in most specific subnet", "2001:db8:85a3:8d3:1234::1", true, "2001:db8:85a3:8d3::/64"}, // Should match /64
+		{"IPv6 link-local", "fe80::1", true, "fe80::/10"},
+		{"IPv6 not in any range", "2001:db9::1", false, ""},
+		{"IPv6 global unicast not in range", "2a00:1450:4001::1", false, ""},
 	}
 
 	for _, tt := range tests {
@@ -94,7 +98,7 @@ func TestIpLookupHelper_IPv6(t *testing.T) {
 				t.Fatalf("Invalid IP address: %s", tt.ip)
 			}
 
-			found, prefixLen, err := helper.IsContained(ip)
+			found, cidr, err := helper.IsContained(ip)
 			if err != nil {
 				t.Errorf("IsContained returned error: %v", err)
 			}
@@ -103,8 +107,43 @@ func TestIpLookupHelper_IPv6(t *testing.T) {
 				t.Errorf("IsContained(%s) = %v, want %v", tt.ip, found, tt.shouldMatch)
 			}
 
-			if found && prefixLen != tt.expectedPrefix {
-				t.Errorf("IsContained(%s) prefix = %d, want %d (most specific match)", tt.ip, prefixLen, tt.expectedPrefix)
+			if found && cidr != tt.expectedCIDR {
+				t.Errorf("IsContained(%s) CIDR = %s, want %s (most specific match)", tt.ip, cidr, tt.expectedCIDR)
+			}
+		})
+	}
+}
+
+func TestIpLookupHelper_FamiliesAreSeparate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cidrs       []string
+		ip          string
+		shouldMatch bool
+	}{
+		// 32.1.13.184 shares its 32 bits with the 2001:db8:: prefix
+		{"IPv4_does_not_match_IPv6_prefix", []string{"2001:db8::/32"}, "32.1.13.184", false},
+		{"IPv6_does_not_match_IPv4_prefix", []string{"32.0.0.0/8"}, "2001:db8::1", false},
+		{"IPv4_default_route_only_matches_IPv4", []string{"0.0.0.0/0"}, "2001:db8::1", false},
+		{"IPv6_default_route_only_matches_IPv6", []string{"::/0"}, "192.0.2.1", false},
+		{"IPv4_mapped_address_matches_IPv4_prefix", []string{"10.0.0.0/8"}, "::ffff:10.1.2.3", true},
+		{"IPv4_mapped_prefix_matches_IPv4_address", []string{"::ffff:10.0.0.0/104"}, "10.1.2.3", true},
+		{"IPv4_mapped_prefix_excludes_other_IPv4", []string{"::ffff:10.0.0.0/104"}, "11.1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helper, err := NewIpLookupHelper(tt.cidrs)
+			if err != nil {
+				t.Fatalf("Failed to create IpLookupHelper: %v", err)
+			}
+
+			found, _, err := helper.IsContained(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Errorf("IsContained returned error: %v", err)
+			}
+			if found != tt.shouldMatch {
+				t.Errorf("IsContained(%s) = %v, want %v", tt.ip, found, tt.shouldMatch)
 			}
 		})
 	}
@@ -125,13 +164,13 @@ func TestIpLookupHelper_EmptyHelper(t *testing.T) {
 				t.Fatalf("Invalid IP address: %s", ipStr)
 			}
 
-			found, prefixLen, err := helper.IsContained(ip)
+			found, cidr, err := helper.IsContained(ip)
 			if err != nil {
 				t.Errorf("IsContained returned error: %v", err)
 			}
 
 			if found {
-				t.Errorf("Empty helper should not match any IP, but matched %s with prefix %d", ipStr, prefixLen)
+				t.Errorf("Empty helper should not match any IP, but matched %s with %s", ipStr, cidr)
 			}
 		})
 	}
@@ -155,3 +194,306 @@ func TestIpLookupHelper_InvalidCIDR(t *testing.T) {
 		})
 	}
 }
+
+func TestIpLookupHelper_ZoneIdentifiers(t *testing.T) {
+	helper, err := NewIpLookupHelper([]string{"fe80::/10", "192.168.0.0/16"})
+	if err != nil {
+		t.Fatalf("Failed to create IpLookupHelper: %v", err)
+	}
+
+	testCases := []struct {
+		addr     string
+		expected bool
+	}{
+		{"fe80::1%eth0", true},
+		{"fe80::1%25eth0", true},
+		{"fe80::1", true},
+		{"2001:db8::1%eth0", false},
+		{"192.168.1.1", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run("Zone_"+tc.addr, func(t *testing.T) {
+			found, _, err := helper.IsContainedAddress(tc.addr)
+			if err != nil {
+				t.Fatalf("IsContainedAddress returned error: %v", err)
+			}
+			if found != tc.expected {
+				t.Errorf("Expected IsContainedAddress(%s) = %v, but got %v", tc.addr, tc.expected, found)
+			}
+		})
+	}
+
+	if _, _, err := helper.IsContainedAddress("not-an-ip%eth0"); err == nil {
+		t.Error("Expected error for an invalid address, but got none")
+	}
+}
+
+func TestIpLookupHelper_Mutation(t *testing.T) {
+	helper, err := NewIpLookupHelper([]string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.7/24", "10.0.0.0/8", "::ffff:172.16.0.0/108"})
+	if err != nil {
+		t.Fatalf("Failed to create IpLookupHelper: %v", err)
+	}
+
+	expected := []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.1.0/24", "2001:db8::/32"}
+	if prefixes := helper.Prefixes(); !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Prefixes() = %v, want %v", prefixes, expected)
+	}
+	if helper.Len() != len(expected) {
+		t.Errorf("Len() = %d, want %d (duplicates are stored once)", helper.Len(), len(expected))
+	}
+
+	if err := helper.Add("10.1.0.0/16"); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	if _, cidr, _ := helper.IsContainedAddress("10.1.2.3"); cidr != "10.1.0.0/16" {
+		t.Errorf("expected 10.1.2.3 to match 10.1.0.0/16 after Add, but got %q", cidr)
+	}
+
+	removed, err := helper.Remove("10.0.0.0/8")
+	if err != nil || !removed {
+		t.Fatalf("Remove(10.0.0.0/8) = %v, %v, want true", removed, err)
+	}
+	if found, _, _ := helper.IsContainedAddress("10.2.0.1"); found {
+		t.Error("expected 10.2.0.1 not to match after its block was removed")
+	}
+	if _, cidr, _ := helper.IsContainedAddress("10.1.2.3"); cidr != "10.1.0.0/16" {
+		t.Errorf("expected the more specific block to stay, but 10.1.2.3 matched %q", cidr)
+	}
+	if removed, _ := helper.Remove("10.0.0.0/8"); removed {
+		t.Error("expected removing a block twice to report false")
+	}
+	if removed, _ := helper.Remove("2001:db8::/48"); removed {
+		t.Error("expected removing a block that was never added to report false")
+	}
+	if _, err := helper.Remove("not-a-cidr"); err == nil {
+		t.Error("expected error for an invalid CIDR, but got none")
+	}
+
+	expected = []string{"10.1.0.0/16", "172.16.0.0/12", "192.168.1.0/24", "2001:db8::/32"}
+	if prefixes := helper.Prefixes(); !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Prefixes() = %v, want %v", prefixes, expected)
+	}
+	if helper.Len() != len(expected) || helper.Count() != len(expected) {
+		t.Errorf("Len() = %d, want %d", helper.Len(), len(expected))
+	}
+}
+
+func TestIpLookupHelper_ConcurrentUpdates(t *testing.T) {
+	helper := NewEmptyIpLookupHelper()
+	cidrs := benchmarkCIDRs(256, false)
+	ip := net.ParseIP("10.0.1.1")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for _, cidr := range cidrs {
+			_ = helper.Add(cidr)
+		}
+		for _, cidr := range cidrs[:128] {
+			_, _ = helper.Remove(cidr)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			_, _, _ = helper.IsContained(ip)
+			_ = helper.Prefixes()
+		}
+	}()
+	wg.Wait()
+
+	if helper.Len() != 128 {
+		t.Errorf("Len() = %d, want 128", helper.Len())
+	}
+}
+
+func TestIpLookupHelper_Matches(t *testing.T) {
+	helper, err := NewIpLookupHelper([]string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16", "2001:db8::/32", "2001:db8:1::/48"})
+	if err != nil {
+		t.Fatalf("Failed to create IpLookupHelper: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		expected []string
+	}{
+		{"Nested", "10.1.2.3", []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"}},
+		{"Single", "10.3.0.1", []string{"10.0.0.0/8"}},
+		{"IPv6", "2001:db8:1::1", []string{"2001:db8::/32", "2001:db8:1::/48"}},
+		{"IPv4Mapped", "::ffff:10.2.0.1", []string{"10.0.0.0/8", "10.2.0.0/16"}},
+		{"Zone", "2001:db8::1%eth0", []string{"2001:db8::/32"}},
+		{"None", "192.0.2.1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matched []string
+			for _, prefix := range helper.Matches(netip.MustParseAddr(tt.addr)) {
+				matched = append(matched, prefix.String())
+			}
+			if !reflect.DeepEqual(matched, tt.expected) {
+				t.Errorf("Matches(%s) = %v, want %v", tt.addr, matched, tt.expected)
+			}
+		})
+	}
+
+	if matched := helper.Matches(netip.Addr{}); matched != nil {
+		t.Errorf("expected no matches for the zero address, but got %v", matched)
+	}
+}
+
+func TestIpLookupHelper_ContainsAll(t *testing.T) {
+	helper, err := NewIpLookupHelper([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("Failed to create IpLookupHelper: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		addrs    []netip.Addr
+		expected bool
+	}{
+		{"AllContained", []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("10.9.9.9")}, true},
+		{"OneOutside", []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("192.0.2.1")}, false},
+		{"Invalid", []netip.Addr{netip.MustParseAddr("10.0.0.1"), {}}, false},
+		{"Empty", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if contained := helper.ContainsAll(tt.addrs); contained != tt.expected {
+				t.Errorf("ContainsAll(%v) = %v, want %v", tt.addrs, contained, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIpLookupHelper_Exclusions(t *testing.T) {
+	helper, err := NewIpLookupHelper([]string{"10.0.0.0/8", "!10.99.0.0/16", "10.99.1.0/24", "!10.0.0.5", "2001:db8::/32", "!2001:db8:bad::/48"})
+	if err != nil {
+		t.Fatalf("Failed to create IpLookupHelper: %v", err)
+	}
+
+	tests := []struct {
+		addr         string
+		shouldMatch  bool
+		expectedCIDR string
+		expectedAll  []string
+	}{
+		{"10.1.2.3", true, "10.0.0.0/8", []string{"10.0.0.0/8"}},
+		{"10.99.2.3", false, "", nil},
+		{"10.99.1.3", true, "10.99.1.0/24", []string{"10.99.1.0/24"}},
+		{"10.0.0.5", false, "", nil},
+		{"10.0.0.6", true, "10.0.0.0/8", []string{"10.0.0.0/8"}},
+		{"2001:db8:bad::1", false, "", nil},
+		{"2001:db8:cafe::1", true, "2001:db8::/32", []string{"2001:db8::/32"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			found, cidr, err := helper.IsContainedAddress(tt.addr)
+			if err != nil {
+				t.Fatalf("IsContainedAddress returned error: %v", err)
+			}
+			if found != tt.shouldMatch || cidr != tt.expectedCIDR {
+				t.Errorf("IsContainedAddress(%s) = %v, %q, want %v, %q", tt.addr, found, cidr, tt.shouldMatch, tt.expectedCIDR)
+			}
+
+			var matched []string
+			for _, prefix := range helper.Matches(netip.MustParseAddr(tt.addr)) {
+				matched = append(matched, prefix.String())
+			}
+			if !reflect.DeepEqual(matched, tt.expectedAll) {
+				t.Errorf("Matches(%s) = %v, want %v", tt.addr, matched, tt.expectedAll)
+			}
+		})
+	}
+
+	expected := []string{"10.0.0.0/8", "!10.0.0.5/32", "!10.99.0.0/16", "10.99.1.0/24", "2001:db8::/32", "!2001:db8:bad::/48"}
+	if prefixes := helper.Prefixes(); !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Prefixes() = %v, want %v", prefixes, expected)
+	}
+
+	if removed, _ := helper.Remove("10.99.0.0/16"); removed {
+		t.Error("expected removing the exclusion without '!' to report false")
+	}
+	if removed, _ := helper.Remove("!10.99.0.0/16"); !removed {
+		t.Error("expected removing the exclusion to report true")
+	}
+	if found, _, _ := helper.IsContainedAddress("10.99.2.3"); !found {
+		t.Error("expected 10.99.2.3 to match once its exclusion was removed")
+	}
+}
+
+// benchmarkCIDRs generates n distinct /24 (IPv4) or /48 (IPv6) blocks, the size of a full cloud provider range list
+func benchmarkCIDRs(n int, ipv6 bool) []string {
+	cidrs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if ipv6 {
+			cidrs = append(cidrs, fmt.Sprintf("2001:db8:%x::/48", i))
+		} else {
+			cidrs = append(cidrs, fmt.Sprintf("%d.%d.%d.0/24", 10+i/65536, (i/256)%256, i%256))
+		}
+	}
+	return cidrs
+}
+
+// linearLookup is the naive O(n) scan the radix trie replaces, kept as a benchmark baseline
+func linearLookup(blocks []*net.IPNet, ip net.IP) bool {
+	for _, block := range blocks {
+		if block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func BenchmarkIpLookupHelper(b *testing.B) {
+	for _, size := range []int{10, 1000, 50000} {
+		for _, family := range []struct {
+			name string
+			ipv6 bool
+			miss string
+		}{
+			{"IPv4", false, "198.51.100.1"},
+			{"IPv6", true, "2001:db9::1"},
+		} {
+			cidrs := benchmarkCIDRs(size, family.ipv6)
+			helper, err := NewIpLookupHelper(cidrs)
+			if err != nil {
+				b.Fatalf("Failed to create IpLookupHelper: %v", err)
+			}
+			blocks := make([]*net.IPNet, 0, len(cidrs))
+			for _, cidr := range cidrs {
+				_, block, _ := net.ParseCIDR(cidr)
+				blocks = append(blocks, block)
+			}
+			// A miss is the worst case for the linear scan
+			ip := net.ParseIP(family.miss)
+
+			b.Run(fmt.Sprintf("Radix/%s/%d", family.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, _, _ = helper.IsContained(ip)
+				}
+			})
+			b.Run(fmt.Sprintf("Linear/%s/%d", family.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					linearLookup(blocks, ip)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkNewIpLookupHelper(b *testing.B) {
+	cidrs := benchmarkCIDRs(50000, false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewIpLookupHelper(cidrs); err != nil {
+			b.Fatalf("Failed to create IpLookupHelper: %v", err)
+		}
+	}
+}
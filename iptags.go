@@ -0,0 +1,79 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ipTag is an ipTags label with the ranges it applies to
+type ipTag struct {
+	label string
+	ips   *IpLookupHelper
+}
+
+// newIPTags parses the ipTags configuration, ordered by label so the output is stable.
+// Labels end up in a comma-separated header value, so they cannot contain commas or spaces.
+func newIPTags(name string, tags map[string][]string, headerName string) ([]ipTag, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	var problems configErrors
+	if headerName == "" {
+		problems.add(fmt.Errorf("%s: ipTagsHeaderName cannot be empty when ipTags is set", name))
+	}
+
+	labels := make([]string, 0, len(tags))
+	for label := range tags {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	parsed := make([]ipTag, 0, len(labels))
+	for _, label := range labels {
+		if label == "" || strings.ContainsAny(label, ", \t") {
+			problems.add(fmt.Errorf("%s: ipTags label %q must be non-empty and contain no commas or spaces", name, label))
+			continue
+		}
+		ips, err := parseCIDRList(name, fmt.Sprintf("ipTags[%s]", label), tags[label])
+		if err != nil {
+			problems.add(err)
+			continue
+		}
+		parsed = append(parsed, ipTag{label: label, ips: ips})
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// ipTagsOf returns the labels of the ipTags ranges and remote IP lists containing ip,
+// comma-separated in label order, or "" when ip is not an IP or nothing contains it
+func (r *Resolver) ipTagsOf(ip string) string {
+	parsed := parseAddress(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	var labels []string
+	matched := make(map[string]bool)
+	for _, tag := range r.ipTags {
+		if contained, _, err := tag.ips.IsContained(parsed); err == nil && contained {
+			labels = append(labels, tag.label)
+			matched[tag.label] = true
+		}
+	}
+
+	// Lists sharing a label, or sharing it with ipTags, tag the IP once
+	for _, list := range r.remoteLists {
+		if list.label == "" || matched[list.label] || !list.contains(parsed) {
+			continue
+		}
+		labels = append(labels, list.label)
+		matched[list.label] = true
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,90 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPTags(t *testing.T) {
+	newPlugin := func(t *testing.T, tags map[string][]string) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.IPTags = tags
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tags := map[string][]string{
+		"vpn":     {"198.51.100.0/24"},
+		"office":  {"203.0.113.0/24", "2001:db8:1::/48"},
+		"partner": {"203.0.113.128/25", "!203.0.113.200"},
+	}
+
+	tests := []struct {
+		name     string
+		tags     map[string][]string
+		xff      string
+		spoofed  string
+		expected string
+	}{
+		{"SingleLabel", tags, "198.51.100.7", "", "vpn"},
+		{"SeveralLabelsSorted", tags, "203.0.113.130", "", "office,partner"},
+		{"Exclusion", tags, "203.0.113.200", "", "office"},
+		{"IPv6", tags, "2001:db8:1::1", "", "office"},
+		{"NoLabel", tags, "192.0.2.1", "vpn", ""},
+		{"Unresolved", tags, "not-an-ip", "office", ""},
+		{"NoTagsConfigured", nil, "198.51.100.7", "vpn", "vpn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.tags)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			if tt.spoofed != "" {
+				req.Header.Set("X-IP-Tags", tt.spoofed)
+			}
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if values := req.Header.Values("X-IP-Tags"); len(values) != 1 || values[0] != tt.expected {
+				t.Errorf("expected X-IP-Tags '%s', but got: %q", tt.expected, values)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name   string
+		modify func(cfg *Config)
+	}{
+		{"InvalidRange", func(cfg *Config) { cfg.IPTags = map[string][]string{"office": {"203.0.113.0/33"}} }},
+		{"LabelWithComma", func(cfg *Config) { cfg.IPTags = map[string][]string{"office,vpn": {"203.0.113.0/24"}} }},
+		{"EmptyLabel", func(cfg *Config) { cfg.IPTags = map[string][]string{"": {"203.0.113.0/24"}} }},
+		{"NoHeaderName", func(cfg *Config) {
+			cfg.IPTags = map[string][]string{"office": {"203.0.113.0/24"}}
+			cfg.IPTagsHeaderName = ""
+		}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			tt.modify(cfg)
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for an invalid ipTags configuration, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package traefik_realip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Levels of the decision log: info logs every decision, warn only rejections and failures
+const (
+	decisionLogOff  = "off"
+	decisionLogInfo = "info"
+	decisionLogWarn = "warn"
+)
+
+// decisionLogFields are the fields a decision log line can carry, in the order they are written.
+// requestID is always written when the request has one.
+var decisionLogFields = []string{"time", "level", "instance", "requestID", "method", "path", "remoteAddr", "realIP", "source", "trusted", "trustReason", "decision"}
+
+// defaultDecisionLogFields are logged when decisionLogFields is empty
+var defaultDecisionLogFields = []string{"time", "level", "remoteAddr", "realIP", "source", "trusted", "decision"}
+
+// decisionLogger writes one JSON line per decision
+type decisionLogger struct {
+	level   string
+	fields  map[string]bool
+	sampler *sampler
+}
+
+// newDecisionLogger validates the decision log configuration; it returns nil when the log is off
+func newDecisionLogger(name, level string, fields []string, sampleRate int) (*decisionLogger, error) {
+	switch level {
+	case "", decisionLogOff:
+		return nil, nil
+	case decisionLogInfo, decisionLogWarn:
+	default:
+		return nil, fmt.Errorf("%s: decisionLogLevel must be %q, %q or %q, got %q", name, decisionLogOff, decisionLogInfo, decisionLogWarn, level)
+	}
+	if sampleRate < 0 {
+		return nil, fmt.Errorf("%s: decisionLogSampleRate cannot be negative", name)
+	}
+
+	if len(fields) == 0 {
+		fields = defaultDecisionLogFields
+	}
+	logger := &decisionLogger{level: level, fields: make(map[string]bool, len(fields)), sampler: newSampler(sampleRate)}
+	for _, field := range fields {
+		known := false
+		for _, candidate := range decisionLogFields {
+			known = known || candidate == field
+		}
+		if !known {
+			return nil, fmt.Errorf("%s: unknown decisionLogFields entry %q (expected one of %s)", name, field, strings.Join(decisionLogFields, ", "))
+		}
+		logger.fields[field] = true
+	}
+	return logger, nil
+}
+
+// decisionLevel returns the level of a decision: forwarded requests are info, the others warn
+func decisionLevel(decision string) string {
+	if decision == debugDecisionForwarded {
+		return decisionLogInfo
+	}
+	return decisionLogWarn
+}
+
+// log writes the decision on req as a JSON line when its level is enabled and it is sampled
+func (l *decisionLogger) log(r *Resolver, req *http.Request, report *DecisionReport, decision string) {
+	if l == nil || report == nil {
+		return
+	}
+	level := decisionLevel(decision)
+	if l.level == decisionLogWarn && level != decisionLogWarn {
+		return
+	}
+	if !l.sampler.sample() {
+		return
+	}
+
+	values := map[string]interface{}{
+		"time":        time.Now().UTC().Format(time.RFC3339Nano),
+		"level":       level,
+		"instance":    r.name,
+		"requestID":   r.requestID(req),
+		"method":      req.Method,
+		"path":        req.URL.Path,
+		"remoteAddr":  report.RemoteAddr,
+		"realIP":      report.RealIP,
+		"source":      report.Source,
+		"trusted":     report.Trusted,
+		"trustReason": report.TrustReason,
+		"decision":    decision,
+	}
+
+	// Fields are written in a fixed order, which a map would not keep
+	var b strings.Builder
+	b.WriteByte('{')
+	for _, field := range decisionLogFields {
+		if !l.fields[field] && !(field == "requestID" && values[field] != "") {
+			continue
+		}
+		encoded, err := json.Marshal(values[field])
+		if err != nil {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%q:%s", field, encoded)
+	}
+	b.WriteByte('}')
+	fmt.Fprintln(logWriter, b.String())
+}
@@ -0,0 +1,150 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecisionLog(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) http.Handler {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.DenyIPs = []string{"198.51.100.0/24"}
+		cfg.DecisionLogLevel = decisionLogInfo
+		if modify != nil {
+			modify(cfg)
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	serve := func(plugin http.Handler, xff string) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", xff)
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(logs.String()), "\n")
+	}
+
+	t.Run("LogsDecisionAsJSON", func(t *testing.T) {
+		logs.Reset()
+		serve(newPlugin(t, nil), "203.0.113.1")
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatalf("failed to decode log line %q: %v", logs.String(), err)
+		}
+		expected := map[string]interface{}{
+			"level":      "info",
+			"remoteAddr": "10.0.0.1:1234",
+			"realIP":     "203.0.113.1",
+			"source":     "X-Forwarded-For",
+			"trusted":    true,
+			"decision":   "forwarded",
+		}
+		for field, value := range expected {
+			if entry[field] != value {
+				t.Errorf("expected %s %v, but got: %v", field, value, entry[field])
+			}
+		}
+		if _, ok := entry["time"]; !ok {
+			t.Error("expected a time field")
+		}
+		if _, ok := entry["path"]; ok {
+			t.Error("expected no path field by default")
+		}
+	})
+
+	t.Run("SelectedFieldsInFixedOrder", func(t *testing.T) {
+		logs.Reset()
+		serve(newPlugin(t, func(cfg *Config) {
+			cfg.DecisionLogFields = []string{"realIP", "path"}
+		}), "203.0.113.1")
+
+		if line := lines()[0]; line != `{"path":"/test","realIP":"203.0.113.1"}` {
+			t.Errorf("unexpected log line: %s", line)
+		}
+	})
+
+	t.Run("WarnLogsOnlyRejections", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.DecisionLogLevel = decisionLogWarn
+			cfg.DecisionLogFields = []string{"level", "decision"}
+		})
+		serve(plugin, "203.0.113.1")
+		serve(plugin, "198.51.100.1")
+
+		if got := lines(); len(got) != 1 || got[0] != `{"level":"warn","decision":"rejected (denyIPs)"}` {
+			t.Errorf("expected only the rejection, but got: %v", got)
+		}
+	})
+
+	t.Run("Sampling", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, func(cfg *Config) { cfg.DecisionLogSampleRate = 2 })
+		for i := 0; i < 4; i++ {
+			serve(plugin, "203.0.113.1")
+		}
+
+		if got := lines(); len(got) != 2 {
+			t.Errorf("expected 2 sampled lines, but got %d", len(got))
+		}
+	})
+
+	t.Run("Off", func(t *testing.T) {
+		logs.Reset()
+		serve(newPlugin(t, func(cfg *Config) { cfg.DecisionLogLevel = "" }), "203.0.113.1")
+
+		if logs.Len() != 0 {
+			t.Errorf("expected no log lines, but got: %s", logs.String())
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		modify func(cfg *Config)
+	}{
+		{"UnknownLevel", func(cfg *Config) { cfg.DecisionLogLevel = "debug" }},
+		{"UnknownField", func(cfg *Config) { cfg.DecisionLogFields = []string{"cookie"} }},
+		{"NegativeSampleRate", func(cfg *Config) { cfg.DecisionLogSampleRate = -1 }},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.DecisionLogLevel = decisionLogInfo
+			tt.modify(cfg)
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected an error for an invalid decision log configuration")
+			}
+			if plugin != nil {
+				t.Error("expected nil plugin for an invalid decision log configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package traefik_realip
+
+import "net/http"
+
+// knownClientIPHeaders are the headers proxies, CDNs and load balancers commonly use to pass
+// on the client IP. Any of them may be read by a backend, so none should come from a client.
+var knownClientIPHeaders = []string{
+	"X-Real-IP",
+	"X-Forwarded-For",
+	"Forwarded",
+	"X-Forwarded",
+	"Forwarded-For",
+	"X-Original-Forwarded-For",
+	"X-Client-IP",
+	"X-Cluster-Client-IP",
+	"True-Client-IP",
+	"CF-Connecting-IP",
+	"CF-Connecting-IPv6",
+	"Fastly-Client-IP",
+	"Akamai-Client-IP",
+	"Fly-Client-IP",
+	"X-Azure-ClientIP",
+	"X-Appengine-User-IP",
+	"X-ProxyUser-IP",
+}
+
+// stripKnown deletes the knownClientIPHeaders from a request of an untrusted source. Headers
+// whose own trust set honors the source are expected from it and left alone, as are the
+// backups preserveOriginal just wrote, which hold what the source sent.
+func (r *Resolver) stripKnown(req *http.Request) {
+	for _, header := range knownClientIPHeaders {
+		if r.headerTrustedByOverride(header, req) || r.isPreservedBackup(header) {
+			continue
+		}
+		req.Header.Del(header)
+	}
+}
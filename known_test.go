@@ -0,0 +1,105 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripKnownHeaders(t *testing.T) {
+	newPlugin := func(t *testing.T, strip bool) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP", Depth: 0, TrustedIPs: []string{"198.51.100.0/24"}},
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress", Depth: 0},
+		}
+		cfg.StripKnownHeaders = strip
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	forged := []string{"X-Forwarded-For", "Forwarded", "True-Client-IP", "X-Client-IP", "X-Cluster-Client-IP", "fastly-client-ip"}
+
+	tests := []struct {
+		name       string
+		strip      bool
+		remoteAddr string
+		expectKept bool
+		expectCF   bool
+		expectedIP string
+	}{
+		{"Disabled", false, "192.0.2.1:1234", true, true, "192.0.2.1"},
+		{"Untrusted", true, "192.0.2.1:1234", false, false, "192.0.2.1"},
+		{"Trusted", true, "10.0.0.1:1234", true, true, "203.0.113.1"},
+		{"HonoredByOwnTrust", true, "198.51.100.1:1234", false, true, "203.0.113.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.strip)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, header := range forged {
+				req.Header.Set(header, "203.0.113.1")
+			}
+			req.Header.Set("CF-Connecting-IP", "203.0.113.9")
+			req.Header.Set("X-Real-IP", "203.0.113.1")
+			req.Header.Set("Accept", "text/html")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			for _, header := range forged {
+				_, present := req.Header[http.CanonicalHeaderKey(header)]
+				if present != tt.expectKept {
+					t.Errorf("expected %s present=%v, but got %v", header, tt.expectKept, present)
+				}
+			}
+			if _, present := req.Header["Cf-Connecting-Ip"]; present != tt.expectCF {
+				t.Errorf("expected CF-Connecting-IP present=%v, but got %v", tt.expectCF, present)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if req.Header.Get("Accept") != "text/html" {
+				t.Error("expected headers outside the list to be kept")
+			}
+		})
+	}
+
+	t.Run("KeepsPreservedBackup", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.HeaderName = "Forwarded-For"
+		cfg.PreserveOriginal = true
+		cfg.StripKnownHeaders = true
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Forwarded-For", "203.0.113.1")
+		req.Header.Set("X-Original-Forwarded-For", "198.51.100.1")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if backup := req.Header.Get("X-Original-Forwarded-For"); backup != "203.0.113.1" {
+			t.Errorf("expected the backup of what the client sent '203.0.113.1', but got: '%s'", backup)
+		}
+		if realIP := req.Header.Get("Forwarded-For"); realIP != "192.0.2.1" {
+			t.Errorf("expected Forwarded-For '192.0.2.1', but got: '%s'", realIP)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package traefik_realip
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// legacyWarningInterval rate-limits the warning logged for legacy writes past their expiry
+const legacyWarningInterval = time.Hour
+
+// writeLegacyHeaders writes value to every legacy header name, with the same rules as headerName.
+// Past the configured expiry, writes are counted as overdue and a warning is logged at most
+// once per legacyWarningInterval, so forgotten migrations show up in logs and Stats().
+func (r *Resolver) writeLegacyHeaders(out *outputWriter, value string, now time.Time) {
+	for _, legacyHeaderName := range r.legacyHeaderNames {
+		if r.hashOnly {
+			out.req.Header.Del(legacyHeaderName)
+		} else {
+			out.set(legacyHeaderName, value)
+		}
+	}
+	atomic.AddInt64(&r.stats.legacyWrites, 1)
+
+	if r.legacyExpiry.IsZero() || now.Before(r.legacyExpiry) {
+		return
+	}
+	atomic.AddInt64(&r.stats.legacyOverdue, 1)
+
+	last := atomic.LoadInt64(&r.lastLegacyWarning)
+	if last != 0 && now.Sub(time.Unix(0, last)) < legacyWarningInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&r.lastLegacyWarning, last, now.UnixNano()) {
+		return
+	}
+	logf(r.name, "warning: legacyHeaderNames %s expired on %s and are still written (%d overdue writes); remove them once backends have migrated",
+		strings.Join(r.legacyHeaderNames, ", "), r.legacyExpiry.Format("2006-01-02"), atomic.LoadInt64(&r.stats.legacyOverdue))
+}
@@ -0,0 +1,129 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacyHeaderNames(t *testing.T) {
+	newPlugin := func(t *testing.T, expiry string) *Plugin {
+		cfg := &Config{
+			Enabled:                 true,
+			HeaderName:              "X-Real-IP",
+			ProcessHeaders:          []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			ForceOverwrite:          true,
+			TrustAll:                true,
+			LegacyHeaderNames:       []string{"X-Client-IP", "X-Original-Client-IP"},
+			LegacyHeaderNamesExpiry: expiry,
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	t.Run("DualWrite", func(t *testing.T) {
+		plugin := newPlugin(t, "")
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		req.Header.Set("X-Client-IP", "spoofed")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		for _, header := range []string{"X-Real-IP", "X-Client-IP", "X-Original-Client-IP"} {
+			if value := req.Header.Get(header); value != "203.0.113.1" {
+				t.Errorf("expected %s to be '203.0.113.1', but got: '%s'", header, value)
+			}
+		}
+
+		stats := plugin.Stats()
+		if stats.LegacyWrites != 1 || stats.LegacyOverdue != 0 {
+			t.Errorf("expected 1 legacy write and none overdue, but got %d and %d", stats.LegacyWrites, stats.LegacyOverdue)
+		}
+	})
+
+	t.Run("ForceOverwriteWhenUnresolved", func(t *testing.T) {
+		plugin := newPlugin(t, "")
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Client-IP", "spoofed")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if value := req.Header.Get("X-Client-IP"); value != "" {
+			t.Errorf("expected legacy header to be overwritten, but got: '%s'", value)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		var logs bytes.Buffer
+		logWriter = &logs
+		defer func() { logWriter = os.Stdout }()
+
+		plugin := newPlugin(t, "2020-01-01")
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			plugin.writeLegacyHeaders(&outputWriter{r: plugin.Resolver, req: req, state: stateTrusted}, "203.0.113.1", now.Add(time.Duration(i)*time.Minute))
+			if value := req.Header.Get("X-Client-IP"); value != "203.0.113.1" {
+				t.Errorf("expected legacy header to still be written after expiry, but got: '%s'", value)
+			}
+		}
+
+		if stats := plugin.Stats(); stats.LegacyOverdue != 3 {
+			t.Errorf("expected 3 overdue writes, but got %d", stats.LegacyOverdue)
+		}
+		if count := strings.Count(logs.String(), "expired on 2020-01-01"); count != 1 {
+			t.Errorf("expected one rate-limited warning, but got %d: %s", count, logs.String())
+		}
+
+		plugin.writeLegacyHeaders(&outputWriter{r: plugin.Resolver, req: httptest.NewRequest(http.MethodGet, "/test", nil), state: stateTrusted}, "203.0.113.1", now.Add(legacyWarningInterval))
+		if count := strings.Count(logs.String(), "expired on 2020-01-01"); count != 2 {
+			t.Errorf("expected a second warning after the interval, but got %d", count)
+		}
+	})
+
+	t.Run("NotYetExpired", func(t *testing.T) {
+		plugin := newPlugin(t, "2999-01-01")
+		plugin.writeLegacyHeaders(&outputWriter{r: plugin.Resolver, req: httptest.NewRequest(http.MethodGet, "/test", nil), state: stateTrusted}, "203.0.113.1", time.Now())
+
+		if stats := plugin.Stats(); stats.LegacyOverdue != 0 {
+			t.Errorf("expected no overdue writes before expiry, but got %d", stats.LegacyOverdue)
+		}
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			headers []string
+			expiry  string
+		}{
+			{"InvalidExpiry", []string{"X-Client-IP"}, "next year"},
+			{"ReservedHeader", []string{"Connection"}, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.LegacyHeaderNames = tt.headers
+				cfg.LegacyHeaderNamesExpiry = tt.expiry
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err == nil {
+					t.Error("expected error, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+			})
+		}
+	})
+}
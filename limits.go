@@ -0,0 +1,96 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultMaxChainLength bounds the entries parsed per header well above real proxy chains
+const defaultMaxChainLength = 32
+
+// defaultMaxHeaderLength bounds processed header values, leaving room for a full chain of IPv6 entries with ports
+const defaultMaxHeaderLength = 2048
+
+// What happens to a processed header value longer than maxHeaderLength
+const (
+	oversizedHeaderSkip     = "skip"
+	oversizedHeaderTruncate = "truncate"
+)
+
+// Reason codes of requests rejected in strict mode for malformed or oversized headers
+const (
+	rejectReasonChainLength  = "maxChainLength"
+	rejectReasonHeaderLength = "maxHeaderLength"
+	rejectReasonMalformed    = "strictMode"
+)
+
+// parseOversizedHeaders validates the oversizedHeaders configuration, defaulting to skip
+func parseOversizedHeaders(name, action string) (string, error) {
+	switch action {
+	case "":
+		return oversizedHeaderSkip, nil
+	case oversizedHeaderSkip, oversizedHeaderTruncate:
+		return action, nil
+	default:
+		return "", fmt.Errorf("%s: oversizedHeaders must be %q or %q, got %q", name, oversizedHeaderSkip, oversizedHeaderTruncate, action)
+	}
+}
+
+// limitHeaderValue applies maxHeaderLength to a processed header value. An oversized value is
+// skipped (returned empty) or truncated to its last maxHeaderLength bytes, from which the
+// partial leftmost entry is dropped, since depth counts from the right.
+// oversized reports whether the value was longer than the limit.
+func (r *Resolver) limitHeaderValue(value string) (limited string, oversized bool) {
+	if r.maxHeaderLength <= 0 || len(value) <= r.maxHeaderLength {
+		return value, false
+	}
+	if r.oversizedHeaders != oversizedHeaderTruncate {
+		return "", true
+	}
+
+	cut := len(value) - r.maxHeaderLength
+	if value[cut-1] == ',' {
+		return value[cut:], true
+	}
+	value = value[cut:]
+	if comma := strings.IndexByte(value, ','); comma >= 0 {
+		return value[comma+1:], true
+	}
+	return "", true
+}
+
+// splitCandidates splits a processed header value into its entries, keeping only the rightmost
+// maxChainLength of them. The entries closest to this proxy are the ones depth counts from and
+// the ones added by trusted proxies, while a client can prepend any number of its own; plain
+// headers are cut before splitting, so thousands of tokens are never parsed.
+// exceeded reports whether entries were ignored.
+func (r *Resolver) splitCandidates(headerName, headerValue string) (entries []string, exceeded bool) {
+	if r.maxChainLength <= 0 {
+		return splitHeaderValue(headerName, headerValue), false
+	}
+
+	if !isForwardedHeader(headerName) {
+		headerValue, exceeded = lastEntries(headerValue, r.maxChainLength)
+		return splitHeaderValue(headerName, headerValue), exceeded
+	}
+
+	// Forwarded elements may contain quoted commas, so they are only capped after splitting
+	entries = splitHeaderValue(headerName, headerValue)
+	if len(entries) > r.maxChainLength {
+		return entries[len(entries)-r.maxChainLength:], true
+	}
+	return entries, false
+}
+
+// lastEntries returns the suffix of a comma-separated value holding its last max entries
+func lastEntries(value string, max int) (string, bool) {
+	end := len(value)
+	for n := 0; n < max; n++ {
+		comma := strings.LastIndexByte(value[:end], ',')
+		if comma < 0 {
+			return value, false
+		}
+		end = comma
+	}
+	return value[end+1:], true
+}
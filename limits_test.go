@@ -0,0 +1,270 @@
+package traefik_realip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLastEntries(t *testing.T) {
+	tests := []struct {
+		value            string
+		max              int
+		expected         string
+		expectedExceeded bool
+	}{
+		{"a, b, c", 3, "a, b, c", false},
+		{"a, b, c", 2, " b, c", true},
+		{"a, b, c", 1, " c", true},
+		{"a", 1, "a", false},
+		{"", 1, "", false},
+		{",,,", 2, ",", true},
+	}
+
+	for _, tt := range tests {
+		result, exceeded := lastEntries(tt.value, tt.max)
+		if result != tt.expected || exceeded != tt.expectedExceeded {
+			t.Errorf("lastEntries(%q, %d) = (%q, %v), expected (%q, %v)", tt.value, tt.max, result, exceeded, tt.expected, tt.expectedExceeded)
+		}
+	}
+}
+
+func TestMaxChainLength(t *testing.T) {
+	// longChain returns n comma-separated addresses 10.1.0.1, 10.1.0.2, ... from left to right
+	longChain := func(n int) string {
+		entries := make([]string, n)
+		for i := range entries {
+			entries[i] = fmt.Sprintf("10.1.%d.%d", (i+1)/256, (i+1)%256)
+		}
+		return strings.Join(entries, ", ")
+	}
+
+	newPlugin := func(t *testing.T, maxChainLength int, strict bool) *Plugin {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "Forwarded", Depth: -1}}
+		cfg.MaxChainLength = maxChainLength
+		cfg.StrictMode = strict
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		maxChainLength  int
+		strict          bool
+		path            string
+		headers         map[string]string
+		expectedStatus  int
+		expectedIP      string
+		expectedReasons string
+	}{
+		{"WithinDefault", 0, false, "/test", map[string]string{"X-Forwarded-For": longChain(32)}, http.StatusOK, "10.1.0.1", ""},
+		{"LeftmostEntriesIgnored", 0, false, "/test", map[string]string{"X-Forwarded-For": longChain(40)}, http.StatusOK, "10.1.0.9", ""},
+		{"CustomLimit", 3, false, "/test", map[string]string{"X-Forwarded-For": longChain(5)}, http.StatusOK, "10.1.0.3", ""},
+		{"ForwardedCapped", 2, false, "/test", map[string]string{"Forwarded": "for=10.1.0.1, for=10.1.0.2, for=10.1.0.3"}, http.StatusOK, "10.1.0.2", ""},
+		{"StrictRejects", 3, true, "/test", map[string]string{"X-Forwarded-For": longChain(5)}, http.StatusBadRequest, "", "maxChainLength"},
+		{"StrictWithinLimit", 3, true, "/test", map[string]string{"X-Forwarded-For": longChain(3)}, http.StatusOK, "10.1.0.1", ""},
+		{"StrictExemptPath", 3, true, "/.well-known/acme-challenge/token", map[string]string{"X-Forwarded-For": longChain(5)}, http.StatusOK, "10.1.0.3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.maxChainLength, tt.strict)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); tt.expectedStatus == http.StatusOK && realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("NegativeLimit", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.MaxChainLength = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a negative maxChainLength, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestLimitHeaderValue(t *testing.T) {
+	tests := []struct {
+		name              string
+		action            string
+		value             string
+		expected          string
+		expectedOversized bool
+	}{
+		{"WithinLimit", oversizedHeaderSkip, "1.1.1.1, 2.2.2.2", "1.1.1.1, 2.2.2.2", false},
+		{"Skipped", oversizedHeaderSkip, "1.1.1.1, 2.2.2.2, 3.3.3.3", "", true},
+		{"TruncatedDropsPartialEntry", oversizedHeaderTruncate, "1.1.1.1, 2.2.2.2, 3.3.3.3", " 3.3.3.3", true},
+		{"TruncatedAtEntryBoundary", oversizedHeaderTruncate, "11.1.1.1,2.2.2.2,3.3.3.3", "2.2.2.2,3.3.3.3", true},
+		{"TruncatedSingleEntry", oversizedHeaderTruncate, strings.Repeat("a", 20), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &Resolver{maxHeaderLength: 16, oversizedHeaders: tt.action}
+
+			limited, oversized := resolver.limitHeaderValue(tt.value)
+			if limited != tt.expected || oversized != tt.expectedOversized {
+				t.Errorf("limitHeaderValue(%q) = (%q, %v), expected (%q, %v)", tt.value, limited, oversized, tt.expected, tt.expectedOversized)
+			}
+		})
+	}
+}
+
+func TestMaxHeaderLength(t *testing.T) {
+	newPlugin := func(t *testing.T, action string, strict bool) *Plugin {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "X-Real-IP", Depth: 0}}
+		cfg.MaxHeaderLength = 32
+		cfg.OversizedHeaders = action
+		cfg.StrictMode = strict
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		action          string
+		strict          bool
+		realIPHeader    string
+		xff             string
+		expectedStatus  int
+		expectedIP      string
+		expectedReasons string
+	}{
+		{"WithinLimit", "", false, "", "203.0.113.1", http.StatusOK, "203.0.113.1", ""},
+		{"SkippedToNextHeader", "", false, strings.Repeat("a", 100), strings.Repeat("a", 100), http.StatusOK, "", ""},
+		{"SkippedXFFFallsThrough", oversizedHeaderSkip, false, "198.51.100.1", "1.1.1.1, 2.2.2.2, 3.3.3.3, 4.4.4.4, 5.5.5.5", http.StatusOK, "198.51.100.1", ""},
+		{"Truncated", oversizedHeaderTruncate, false, "", "1.1.1.1, 2.2.2.2, 3.3.3.3, 4.4.4.4, 5.5.5.5", http.StatusOK, "3.3.3.3", ""},
+		{"StrictRejects", "", true, "", strings.Repeat("a", 100), http.StatusBadRequest, "", "maxHeaderLength"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.action, tt.strict)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			if tt.realIPHeader != "" {
+				req.Header.Set("X-Real-IP", tt.realIPHeader)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); tt.expectedStatus == http.StatusOK && realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{Enabled: true, HeaderName: "X-Real-IP", ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For"}}, TrustAll: true, MaxHeaderLength: -1},
+			{Enabled: true, HeaderName: "X-Real-IP", ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For"}}, TrustAll: true, OversizedHeaders: "reject"},
+		} {
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Errorf("expected error for maxHeaderLength %d / oversizedHeaders %q, but got none", cfg.MaxHeaderLength, cfg.OversizedHeaders)
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		}
+	})
+}
+
+func TestStrictMode(t *testing.T) {
+	newPlugin := func(t *testing.T, strict bool) *Plugin {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}, {HeaderName: "clientAddress"}}
+		cfg.StrictMode = strict
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		strict          bool
+		path            string
+		xff             string
+		expectedStatus  int
+		expectedIP      string
+		expectedReasons string
+	}{
+		{"ValidIP", true, "/test", "203.0.113.1, 10.0.0.2", http.StatusOK, "203.0.113.1", ""},
+		{"GarbageAtDepth", true, "/test", "unknown, 10.0.0.2", http.StatusBadRequest, "", "strictMode"},
+		{"NoCandidates", true, "/test", " , ", http.StatusBadRequest, "", "strictMode"},
+		{"MissingHeader", true, "/test", "", http.StatusOK, "192.0.2.1", ""},
+		{"DepthOutOfBounds", true, "/test", "203.0.113.1", http.StatusOK, "192.0.2.1", ""},
+		{"ExemptPath", true, "/.well-known/acme-challenge/token", "unknown, 10.0.0.2", http.StatusOK, "192.0.2.1", ""},
+		{"LenientDropsGarbage", false, "/test", "unknown, 10.0.0.2", http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.strict)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); tt.expectedStatus == http.StatusOK && realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+}
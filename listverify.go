@@ -0,0 +1,208 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// maxListVerificationSize bounds the checksum and signature files that are read
+const maxListVerificationSize = 64 * 1024
+
+// Signature algorithms of minisign: "Ed" signs the file itself, "ED" its BLAKE2b-512
+const (
+	minisignAlgorithm          = "Ed"
+	minisignPrehashedAlgorithm = "ED"
+)
+
+// minisign key and signature layouts: a 2-byte algorithm and an 8-byte key ID, followed by
+// the Ed25519 public key or signature
+const (
+	minisignKeyIDSize     = 8
+	minisignPublicKeySize = 2 + minisignKeyIDSize + ed25519.PublicKeySize
+	minisignSignatureSize = 2 + minisignKeyIDSize + ed25519.SignatureSize
+)
+
+// listVerifier checks a downloaded remote IP list against a published SHA-256 checksum,
+// a signature or both before it is swapped in, so a compromised mirror cannot change it
+type listVerifier struct {
+	checksumURL  string
+	signatureURL string
+	publicKey    ed25519.PublicKey
+	keyID        []byte // minisign key ID, nil for bare Ed25519 keys
+}
+
+// newListVerifier parses the verification settings of list; it returns nil when the list
+// is not verified. publicKey is either a minisign public key, optionally with its
+// "untrusted comment" line, or a base64 Ed25519 key. The signature is looked up next to
+// the list by default, with minisign's ".minisig" suffix or ".sig" for bare keys.
+func newListVerifier(list RemoteIPList) (*listVerifier, error) {
+	if list.SignatureURL != "" && list.PublicKey == "" {
+		return nil, errors.New("signatureURL requires publicKey")
+	}
+	if list.ChecksumURL == "" && list.PublicKey == "" {
+		return nil, nil
+	}
+
+	verifier := &listVerifier{checksumURL: list.ChecksumURL, signatureURL: list.SignatureURL}
+	if list.ChecksumURL != "" {
+		if err := validateListURL(list.ChecksumURL); err != nil {
+			return nil, fmt.Errorf("checksumURL: %w", err)
+		}
+	}
+	if list.PublicKey == "" {
+		return verifier, nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(list.PublicKey), "\n")
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("publicKey: %w", err)
+	}
+	switch {
+	case len(key) == minisignPublicKeySize && string(key[:2]) == minisignAlgorithm:
+		verifier.keyID = key[2 : 2+minisignKeyIDSize]
+		verifier.publicKey = ed25519.PublicKey(key[2+minisignKeyIDSize:])
+		if verifier.signatureURL == "" {
+			verifier.signatureURL = list.URL + ".minisig"
+		}
+	case len(key) == ed25519.PublicKeySize:
+		verifier.publicKey = ed25519.PublicKey(key)
+		if verifier.signatureURL == "" {
+			verifier.signatureURL = list.URL + ".sig"
+		}
+	default:
+		return nil, errors.New("publicKey must be a minisign public key or a base64 Ed25519 key")
+	}
+	if err := validateListURL(verifier.signatureURL); err != nil {
+		return nil, fmt.Errorf("signatureURL: %w", err)
+	}
+
+	return verifier, nil
+}
+
+// verify checks body, the list downloaded from listURL, fetching its checksum and signature with client
+func (v *listVerifier) verify(client *http.Client, listURL string, body []byte) error {
+	if v.checksumURL != "" {
+		content, err := fetchLimited(client, v.checksumURL, maxListVerificationSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch checksum: %w", err)
+		}
+		expected, err := parseChecksum(content, listFileName(listURL))
+		if err != nil {
+			return err
+		}
+		if sum := sha256.Sum256(body); !bytes.Equal(sum[:], expected) {
+			return fmt.Errorf("checksum mismatch: expected %x, got %x", expected, sum)
+		}
+	}
+
+	if v.publicKey != nil {
+		signature, err := fetchLimited(client, v.signatureURL, maxListVerificationSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature: %w", err)
+		}
+		if v.keyID != nil {
+			return verifyMinisign(v.publicKey, v.keyID, body, signature)
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || len(raw) != ed25519.SignatureSize {
+			return errors.New("malformed Ed25519 signature")
+		}
+		if !ed25519.Verify(v.publicKey, body, raw) {
+			return errors.New("signature mismatch")
+		}
+	}
+
+	return nil
+}
+
+// listFileName is the last path segment of listURL, which names the list in sha256sum output
+func listFileName(listURL string) string {
+	parsed, err := url.Parse(listURL)
+	if err != nil {
+		return ""
+	}
+	return path.Base(parsed.Path)
+}
+
+// parseChecksum returns the SHA-256 of the file name in content, which is either a bare hex
+// digest or sha256sum output. Output listing a single file is used whatever its name.
+func parseChecksum(content []byte, name string) ([]byte, error) {
+	var lines [][]string
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	for _, fields := range lines {
+		if len(lines) > 1 && (len(fields) < 2 || strings.TrimPrefix(fields[1], "*") != name) {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("malformed SHA-256 checksum %q", fields[0])
+		}
+		return sum, nil
+	}
+	return nil, fmt.Errorf("no checksum listed for %q", name)
+}
+
+// verifyMinisign checks a minisign signature file of body: the signature of the file (or of
+// its BLAKE2b-512 for prehashed signatures) and the global signature covering the trusted comment
+func verifyMinisign(publicKey ed25519.PublicKey, keyID, body, signatureFile []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(signatureFile)), "\n")
+	if len(lines) < 4 {
+		return errors.New("malformed minisign signature")
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(signature) != minisignSignatureSize {
+		return errors.New("malformed minisign signature")
+	}
+	if id := signature[2 : 2+minisignKeyIDSize]; !bytes.Equal(id, keyID) {
+		return fmt.Errorf("signed with key %X, expected key %X", id, keyID)
+	}
+
+	message := body
+	switch string(signature[:2]) {
+	case minisignAlgorithm:
+	case minisignPrehashedAlgorithm:
+		digest := blake2b512(body)
+		message = digest[:]
+	default:
+		return fmt.Errorf("unsupported minisign algorithm %q", signature[:2])
+	}
+	sig := signature[2+minisignKeyIDSize:]
+	if !ed25519.Verify(publicKey, message, sig) {
+		return errors.New("signature mismatch")
+	}
+
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return errors.New("malformed minisign signature: missing trusted comment")
+	}
+	globalSignature, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSignature) != ed25519.SignatureSize {
+		return errors.New("malformed minisign global signature")
+	}
+	signed := make([]byte, 0, len(sig)+len(trustedComment))
+	signed = append(append(signed, sig...), trustedComment...)
+	if !ed25519.Verify(publicKey, signed, globalSignature) {
+		return errors.New("trusted comment signature mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// minisignFixture signs lists like minisign does, with a fixed key
+type minisignFixture struct {
+	key   ed25519.PrivateKey
+	keyID []byte
+}
+
+func newMinisignFixture(seed byte) *minisignFixture {
+	return &minisignFixture{
+		key:   ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize)),
+		keyID: []byte{seed, 1, 2, 3, 4, 5, 6, 7},
+	}
+}
+
+// publicKey returns the public key file, with its untrusted comment
+func (f *minisignFixture) publicKey() string {
+	key := append(append([]byte(minisignAlgorithm), f.keyID...), f.key.Public().(ed25519.PublicKey)...)
+	return fmt.Sprintf("untrusted comment: minisign public key %X\n%s\n", f.keyID, base64.StdEncoding.EncodeToString(key))
+}
+
+// sign returns the signature file of body, prehashed like minisign does by default
+func (f *minisignFixture) sign(body string, prehashed bool) string {
+	algorithm, message := minisignAlgorithm, []byte(body)
+	if prehashed {
+		digest := blake2b512(message)
+		algorithm, message = minisignPrehashedAlgorithm, digest[:]
+	}
+	signature := ed25519.Sign(f.key, message)
+	trustedComment := "timestamp:1700000000\tfile:edge.txt"
+	global := ed25519.Sign(f.key, append(append([]byte{}, signature...), trustedComment...))
+
+	encoded := base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), f.keyID...), signature...))
+	return fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		encoded, trustedComment, base64.StdEncoding.EncodeToString(global))
+}
+
+func TestListVerification(t *testing.T) {
+	const list = "# edge\n192.0.2.0/24\n"
+	const tampered = "192.0.2.0/24\n0.0.0.0/0\n"
+	sum := sha256.Sum256([]byte(list))
+	signer := newMinisignFixture(1)
+	other := newMinisignFixture(2)
+	raw := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{3}, ed25519.SeedSize))
+
+	lists := &listServer{lists: map[string]string{
+		"/edge.txt":             list,
+		"/edge.txt.sha256":      fmt.Sprintf("%x  edge.txt\n", sum),
+		"/SHA256SUMS":           fmt.Sprintf("%x  other.txt\n%x *edge.txt\n", sha256.Sum256([]byte("other")), sum),
+		"/bare.sha256":          fmt.Sprintf("%x\n", sum),
+		"/wrong.sha256":         fmt.Sprintf("%x  edge.txt\n", sha256.Sum256([]byte(tampered))),
+		"/edge.txt.minisig":     signer.sign(list, true),
+		"/legacy.minisig":       signer.sign(list, false),
+		"/tampered.minisig":     signer.sign(tampered, true),
+		"/other-key.minisig":    other.sign(list, true),
+		"/edge.txt.sig":         base64.StdEncoding.EncodeToString(ed25519.Sign(raw, []byte(list))),
+		"/tampered-comment.sig": strings.Replace(signer.sign(list, true), "file:edge.txt", "file:other.txt", 1),
+	}}
+	server := httptest.NewServer(lists)
+	defer server.Close()
+
+	var logs lockedBuffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	rawKey := base64.StdEncoding.EncodeToString(raw.Public().(ed25519.PublicKey))
+	tests := []struct {
+		name     string
+		list     RemoteIPList
+		verified bool
+	}{
+		{"Checksum", RemoteIPList{ChecksumURL: server.URL + "/edge.txt.sha256"}, true},
+		{"ChecksumFromSums", RemoteIPList{ChecksumURL: server.URL + "/SHA256SUMS"}, true},
+		{"BareChecksum", RemoteIPList{ChecksumURL: server.URL + "/bare.sha256"}, true},
+		{"ChecksumMismatch", RemoteIPList{ChecksumURL: server.URL + "/wrong.sha256"}, false},
+		{"ChecksumMissing", RemoteIPList{ChecksumURL: server.URL + "/missing.sha256"}, false},
+		{"Minisign", RemoteIPList{PublicKey: signer.publicKey()}, true},
+		{"MinisignLegacy", RemoteIPList{PublicKey: signer.publicKey(), SignatureURL: server.URL + "/legacy.minisig"}, true},
+		{"MinisignTampered", RemoteIPList{PublicKey: signer.publicKey(), SignatureURL: server.URL + "/tampered.minisig"}, false},
+		{"MinisignOtherKey", RemoteIPList{PublicKey: signer.publicKey(), SignatureURL: server.URL + "/other-key.minisig"}, false},
+		{"MinisignTrustedCommentTampered", RemoteIPList{PublicKey: signer.publicKey(), SignatureURL: server.URL + "/tampered-comment.sig"}, false},
+		{"Ed25519", RemoteIPList{PublicKey: rawKey}, true},
+		{"Ed25519WrongKey", RemoteIPList{PublicKey: base64.StdEncoding.EncodeToString(other.key.Public().(ed25519.PublicKey))}, false},
+		{"ChecksumAndSignature", RemoteIPList{ChecksumURL: server.URL + "/edge.txt.sha256", PublicKey: signer.publicKey()}, true},
+		{"ChecksumPassesSignatureFails", RemoteIPList{ChecksumURL: server.URL + "/edge.txt.sha256", PublicKey: other.publicKey()}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.list.Label = "edge"
+			tt.list.URL = server.URL + "/edge.txt"
+			parsed, err := newRemoteLists(pluginName, []RemoteIPList{tt.list}, "X-IP-Tags", "")
+			if err != nil {
+				t.Fatalf("failed to create remote list: %v", err)
+			}
+
+			_, err = parsed[0].download(time.Now())
+			if tt.verified && err != nil {
+				t.Errorf("expected the list to be verified, but got: %v", err)
+			}
+			if !tt.verified && (err == nil || !strings.Contains(err.Error(), "verification failed")) {
+				t.Errorf("expected the verification to fail, but got: %v", err)
+			}
+			if contained := parsed[0].helper.Len() > 0; contained != tt.verified {
+				t.Errorf("expected the list to be swapped in: %t, but got: %t", tt.verified, contained)
+			}
+		})
+	}
+
+	t.Run("UnverifiedTrustedListIsNotTrusted", func(t *testing.T) {
+		lists.set("/edge.txt", tampered)
+		defer lists.set("/edge.txt", list)
+
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.RemoteIPLists = []RemoteIPList{{URL: server.URL + "/edge.txt", Trusted: true, PublicKey: signer.publicKey()}}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		waitForDownloads(t, handler.(*Plugin).remoteLists)
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		if trusted, _ := handler.(*Plugin).trustVerdict(req); trusted {
+			t.Error("expected a list failing verification not to trust its sources")
+		}
+		if !strings.Contains(logs.String(), "signature mismatch") {
+			t.Errorf("expected the failed verification to be logged, but got: %s", logs.String())
+		}
+	})
+
+	invalid := []struct {
+		name string
+		list RemoteIPList
+	}{
+		{"RelativeChecksumURL", RemoteIPList{ChecksumURL: "/edge.txt.sha256"}},
+		{"MalformedPublicKey", RemoteIPList{PublicKey: "not base64!"}},
+		{"ShortPublicKey", RemoteIPList{PublicKey: base64.StdEncoding.EncodeToString([]byte("short"))}},
+		{"SignatureURLWithoutKey", RemoteIPList{SignatureURL: server.URL + "/edge.txt.minisig"}},
+		{"RelativeSignatureURL", RemoteIPList{PublicKey: rawKey, SignatureURL: "edge.txt.sig"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.list.Label = "edge"
+			tt.list.URL = server.URL + "/edge.txt"
+			cfg := CreateConfig()
+			cfg.RemoteIPLists = []RemoteIPList{tt.list}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for an invalid list verification configuration, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// logWriter is where plugin log lines are written. Traefik captures the stdout of Yaegi plugins.
+var logWriter io.Writer = os.Stdout
+
+// logf writes a single log line prefixed with the middleware name.
+func logf(name, format string, args ...interface{}) {
+	fmt.Fprintf(logWriter, "realip %s: %s\n", name, fmt.Sprintf(format, args...))
+}
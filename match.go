@@ -0,0 +1,104 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Match selects requests by host, path and method. Each non-empty list must have an
+// entry matching the request; an empty Match selects every request.
+type Match struct {
+	Hosts   []string `json:"hosts,omitempty"`   // Host names, also matching their subdomains (e.g., "example.com" matches "api.example.com")
+	Paths   []string `json:"paths,omitempty"`   // Path prefixes, starting with '/'
+	Methods []string `json:"methods,omitempty"` // HTTP methods (e.g., "POST")
+}
+
+// requestMatcher is a validated, normalized Match
+type requestMatcher struct {
+	hosts   []string
+	paths   []string
+	methods []string
+}
+
+// newRequestMatcher validates a Match; it returns nil for an empty one, which matches everything
+func newRequestMatcher(name, field string, match Match) (*requestMatcher, error) {
+	if len(match.Hosts) == 0 && len(match.Paths) == 0 && len(match.Methods) == 0 {
+		return nil, nil
+	}
+
+	matcher := &requestMatcher{}
+	for _, host := range match.Hosts {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if host == "" {
+			return nil, fmt.Errorf("%s: %s.hosts cannot contain empty entries", name, field)
+		}
+		matcher.hosts = append(matcher.hosts, strings.TrimPrefix(host, "."))
+	}
+	for _, path := range match.Paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%s: %s.paths entry %q must start with '/'", name, field, path)
+		}
+		matcher.paths = append(matcher.paths, path)
+	}
+	for _, method := range match.Methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			return nil, fmt.Errorf("%s: %s.methods cannot contain empty entries", name, field)
+		}
+		matcher.methods = append(matcher.methods, method)
+	}
+	return matcher, nil
+}
+
+// matches reports whether req is selected; a nil matcher selects every request
+func (m *requestMatcher) matches(req *http.Request) bool {
+	if m == nil {
+		return true
+	}
+	return m.matchesHost(req.Host) && m.matchesPath(req.URL.Path) && m.matchesMethod(req.Method)
+}
+
+// matchesHost matches the host, without port or trailing dot, against the hosts and their subdomains
+func (m *requestMatcher) matchesHost(host string) bool {
+	if len(m.hosts) == 0 {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, suffix := range m.hosts {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPath matches the path against the prefixes
+func (m *requestMatcher) matchesPath(path string) bool {
+	if len(m.paths) == 0 {
+		return true
+	}
+	for _, prefix := range m.paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMethod matches the method against the methods
+func (m *requestMatcher) matchesMethod(method string) bool {
+	if len(m.methods) == 0 {
+		return true
+	}
+	for _, candidate := range m.methods {
+		if method == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestMatcher(t *testing.T) {
+	matcher, err := newRequestMatcher(pluginName, "match", Match{
+		Hosts:   []string{"Example.com", ".internal"},
+		Paths:   []string{"/admin", "/api/"},
+		Methods: []string{"get", "POST"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create matcher: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		expected bool
+	}{
+		{"ExactHost", http.MethodGet, "http://example.com/admin", true},
+		{"Subdomain", http.MethodPost, "http://api.example.com:8443/api/users", true},
+		{"HostWithTrailingDot", http.MethodGet, "http://example.com./admin", true},
+		{"DotPrefixedEntry", http.MethodGet, "http://db.internal/admin/users", true},
+		{"LookalikeHost", http.MethodGet, "http://badexample.com/admin", false},
+		{"OtherPath", http.MethodGet, "http://example.com/public", false},
+		{"OtherMethod", http.MethodDelete, "http://example.com/admin", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if result := matcher.matches(req); result != tt.expected {
+				t.Errorf("expected matches to be %v, but got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("EmptyMatchesAll", func(t *testing.T) {
+		empty, err := newRequestMatcher(pluginName, "match", Match{})
+		if err != nil {
+			t.Fatalf("failed to create matcher: %v", err)
+		}
+		if !empty.matches(httptest.NewRequest(http.MethodPut, "/anything", nil)) {
+			t.Error("expected an empty match to select every request")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, match := range []Match{
+			{Paths: []string{"admin"}},
+			{Hosts: []string{" "}},
+			{Methods: []string{""}},
+		} {
+			if _, err := newRequestMatcher(pluginName, "match", match); err == nil {
+				t.Errorf("expected error for %+v, but got none", match)
+			}
+		}
+	})
+}
+
+func TestMatchScoping(t *testing.T) {
+	t.Run("Match", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Match = Match{Paths: []string{"/app"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		for path, expectedIP := range map[string]string{"/app/home": "203.0.113.5", "/other": "forged"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("X-Forwarded-For", "203.0.113.5")
+			req.Header.Set("X-Real-IP", "forged")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != expectedIP {
+				t.Errorf("%s: expected X-Real-IP '%s', but got: '%s'", path, expectedIP, realIP)
+			}
+		}
+	})
+
+	t.Run("EnforceMatch", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+		cfg.DenyIPs = []string{"203.0.113.0/24"}
+		cfg.EnforceMatch = Match{Paths: []string{"/admin"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		tests := []struct {
+			path           string
+			expectedStatus int
+		}{
+			{"/admin/users", http.StatusForbidden},
+			{"/public", http.StatusOK},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Forwarded-For", "203.0.113.5")
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("%s: expected status %d, but got %d", tt.path, tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && req.Header.Get("X-Real-IP") != "203.0.113.5" {
+				t.Errorf("%s: expected the request to be enriched, but got X-Real-IP '%s'", tt.path, req.Header.Get("X-Real-IP"))
+			}
+		}
+	})
+
+	t.Run("InvalidMatch", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.EnforceMatch = Match{Paths: []string{"admin"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a path without leading '/', but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
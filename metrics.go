@@ -0,0 +1,63 @@
+package traefik_realip
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// metricsLogger decides when Stats() is flushed as a metrics log line. Plugins cannot run
+// timers reliably, so flushes are triggered by incoming requests: every requests requests
+// and, when interval has passed since the last flush, on the next request.
+type metricsLogger struct {
+	interval  time.Duration // Time between flushes, 0 for none
+	requests  int64         // Requests between flushes, 0 for none
+	count     int64         // Requests seen, accessed atomically
+	lastFlush int64         // Unix nanoseconds of the last flush, accessed atomically
+}
+
+// newMetricsLogger returns nil when neither an interval nor a request count is configured
+func newMetricsLogger(interval time.Duration, requests int, now time.Time) *metricsLogger {
+	if interval <= 0 && requests <= 0 {
+		return nil
+	}
+	return &metricsLogger{interval: interval, requests: int64(requests), lastFlush: now.UnixNano()}
+}
+
+// due counts a request and reports whether it triggers a flush
+func (m *metricsLogger) due(now time.Time) bool {
+	if m == nil {
+		return false
+	}
+
+	count := atomic.AddInt64(&m.count, 1)
+	if m.requests > 0 && count%m.requests == 0 {
+		atomic.StoreInt64(&m.lastFlush, now.UnixNano())
+		return true
+	}
+
+	if m.interval > 0 {
+		last := atomic.LoadInt64(&m.lastFlush)
+		if now.Sub(time.Unix(0, last)) >= m.interval {
+			return atomic.CompareAndSwapInt64(&m.lastFlush, last, now.UnixNano())
+		}
+	}
+	return false
+}
+
+// logMetrics writes the counters as a single JSON log line for log-based metrics pipelines
+func (r *Resolver) logMetrics(now time.Time) {
+	payload, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Stats Stats  `json:"stats"`
+	}{
+		Time:  now.UTC().Format(time.RFC3339),
+		Stats: r.Stats(),
+	})
+	if err != nil {
+		logf(r.name, "failed to encode metrics: %v", err)
+		return
+	}
+
+	logf(r.name, "metrics: %s", payload)
+}
@@ -0,0 +1,109 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsLoggerDue(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	t.Run("Disabled", func(t *testing.T) {
+		if m := newMetricsLogger(0, 0, start); m != nil || m.due(start) {
+			t.Error("expected no metrics logger")
+		}
+	})
+
+	t.Run("EveryNRequests", func(t *testing.T) {
+		m := newMetricsLogger(0, 3, start)
+		var flushes []bool
+		for i := 0; i < 6; i++ {
+			flushes = append(flushes, m.due(start))
+		}
+		expected := []bool{false, false, true, false, false, true}
+		for i := range expected {
+			if flushes[i] != expected[i] {
+				t.Fatalf("expected flushes %v, but got %v", expected, flushes)
+			}
+		}
+	})
+
+	t.Run("Interval", func(t *testing.T) {
+		m := newMetricsLogger(time.Minute, 0, start)
+		if m.due(start.Add(30 * time.Second)) {
+			t.Error("expected no flush before the interval")
+		}
+		if !m.due(start.Add(61 * time.Second)) {
+			t.Error("expected a flush after the interval")
+		}
+		if m.due(start.Add(62 * time.Second)) {
+			t.Error("expected the interval to restart after a flush")
+		}
+	})
+}
+
+func TestMetricsLog(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	cfg := CreateConfig()
+	cfg.TrustAll = false
+	cfg.TrustedIPs = []string{"10.0.0.0/8"}
+	cfg.Fallback = fallbackRemoteAddr
+	cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+	cfg.MetricsLogRequests = 2
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	for _, remoteAddr := range []string{"10.0.0.1:1234", "192.0.2.1:1234"} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	line := strings.TrimSpace(logs.String())
+	payload := strings.TrimPrefix(line, "realip "+pluginName+": metrics: ")
+	if payload == line {
+		t.Fatalf("expected a metrics line, but got: %s", line)
+	}
+
+	var metrics struct {
+		Stats Stats `json:"stats"`
+	}
+	if err := json.Unmarshal([]byte(payload), &metrics); err != nil {
+		t.Fatalf("failed to decode metrics: %v", err)
+	}
+	if metrics.Stats.Requests != 2 || metrics.Stats.Trusted != 1 || metrics.Stats.Untrusted != 1 {
+		t.Errorf("unexpected counters: %+v", metrics.Stats)
+	}
+
+	// The second request's fallback is counted after the flush it triggered
+	if fallbacks := plugin.(*Plugin).Stats().Fallbacks; fallbacks != 1 {
+		t.Errorf("expected 1 fallback, but got %d", fallbacks)
+	}
+}
+
+func TestMetricsLogNegative(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.MetricsLogInterval = -1
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Error("expected an error for a negative metricsLogInterval")
+	}
+	if plugin != nil {
+		t.Error("expected nil plugin for a negative metricsLogInterval")
+	}
+}
@@ -0,0 +1,99 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+)
+
+// Option configures the middleware NewMiddleware creates. Options mirror the Config fields
+// of the same name; WithConfig reaches every other field.
+type Option func(*middlewareOptions)
+
+// middlewareOptions is what the options of NewMiddleware build up
+type middlewareOptions struct {
+	cfg  *Config
+	name string
+}
+
+// NewMiddleware creates the middleware for plain net/http servers (stdlib, chi, gorilla), starting
+// from the defaults of CreateConfig. The options are applied in order, so later ones win:
+//
+//	handler, err := traefik_realip.NewMiddleware(mux,
+//		traefik_realip.WithTrustedIPs("10.0.0.0/8"),
+//		traefik_realip.WithRewriteRemoteAddr(),
+//	)
+func NewMiddleware(next http.Handler, opts ...Option) (http.Handler, error) {
+	options := &middlewareOptions{cfg: CreateConfig(), name: resolveName}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return New(context.Background(), next, options.cfg, options.name)
+}
+
+// WithName sets the name configuration errors and log lines are prefixed with ("realip" by default)
+func WithName(name string) Option {
+	return func(o *middlewareOptions) { o.name = name }
+}
+
+// WithConfig changes any Config field, for settings without an option of their own
+func WithConfig(modify func(cfg *Config)) Option {
+	return func(o *middlewareOptions) { modify(o.cfg) }
+}
+
+// WithProfile applies the defaults of a profile, like profile
+func WithProfile(profile string) Option {
+	return func(o *middlewareOptions) { o.cfg.Profile = profile }
+}
+
+// WithHeaderName sets the header the real IP is written to, like headerName
+func WithHeaderName(headerName string) Option {
+	return func(o *middlewareOptions) { o.cfg.HeaderName = headerName }
+}
+
+// WithProcessHeaders replaces the headers the real IP is read from, like processHeaders
+func WithProcessHeaders(headers ...HeaderConfig) Option {
+	return func(o *middlewareOptions) { o.cfg.ProcessHeaders = headers }
+}
+
+// WithTrustedIPs trusts only sources in the given CIDR blocks, like trustedIPs with trustAll disabled
+func WithTrustedIPs(cidrs ...string) Option {
+	return func(o *middlewareOptions) {
+		o.cfg.TrustAll = false
+		o.cfg.TrustedIPs = cidrs
+	}
+}
+
+// WithTrustAll trusts every source, like trustAll
+func WithTrustAll() Option {
+	return func(o *middlewareOptions) { o.cfg.TrustAll = true }
+}
+
+// WithTrustedHeader sets the header receiving the trust verdict, like trustedHeader
+func WithTrustedHeader(headerName string) Option {
+	return func(o *middlewareOptions) { o.cfg.TrustedHeader = headerName }
+}
+
+// WithFallback sets what happens when no header yields an IP, like fallback
+func WithFallback(fallback string) Option {
+	return func(o *middlewareOptions) { o.cfg.Fallback = fallback }
+}
+
+// WithDenyIPs rejects real IPs in the given CIDR blocks, like denyIPs
+func WithDenyIPs(cidrs ...string) Option {
+	return func(o *middlewareOptions) { o.cfg.DenyIPs = cidrs }
+}
+
+// WithAllowOnlyIPs rejects real IPs outside the given CIDR blocks, like allowOnlyIPs
+func WithAllowOnlyIPs(cidrs ...string) Option {
+	return func(o *middlewareOptions) { o.cfg.AllowOnlyIPs = cidrs }
+}
+
+// WithRewriteRemoteAddr sets req.RemoteAddr to the real IP, like rewriteRemoteAddr
+func WithRewriteRemoteAddr() Option {
+	return func(o *middlewareOptions) { o.cfg.RewriteRemoteAddr = true }
+}
+
+// WithAnonymize masks the low bits of the emitted IP, like anonymize
+func WithAnonymize() Option {
+	return func(o *middlewareOptions) { o.cfg.Anonymize = true }
+}
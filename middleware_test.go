@@ -0,0 +1,72 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []Option
+		remoteAddr     string
+		xff            string
+		expectedStatus int
+		expectedIP     string
+		expectedRemote string
+	}{
+		{"Defaults", nil, "192.0.2.1:1234", "203.0.113.1", http.StatusOK, "203.0.113.1", "192.0.2.1:1234"},
+		{"TrustedIPs", []Option{WithTrustedIPs("10.0.0.0/8")}, "192.0.2.1:1234", "203.0.113.1", http.StatusOK, "192.0.2.1", "192.0.2.1:1234"},
+		{"TrustedSource", []Option{WithTrustedIPs("10.0.0.0/8")}, "10.0.0.1:1234", "203.0.113.1", http.StatusOK, "203.0.113.1", "10.0.0.1:1234"},
+		{"HeaderNameAndRewrite", []Option{WithHeaderName("X-Client-IP"), WithRewriteRemoteAddr()}, "10.0.0.1:1234", "203.0.113.1", http.StatusOK, "", "203.0.113.1:1234"},
+		{"ProcessHeaders", []Option{WithProcessHeaders(HeaderConfig{HeaderName: "clientAddress"})}, "10.0.0.1:1234", "203.0.113.1", http.StatusOK, "10.0.0.1", "10.0.0.1:1234"},
+		{"DenyIPs", []Option{WithDenyIPs("203.0.113.0/24")}, "10.0.0.1:1234", "203.0.113.1", http.StatusForbidden, "", ""},
+		{"LaterOptionsWin", []Option{WithTrustedIPs("10.0.0.0/8"), WithTrustAll()}, "192.0.2.1:1234", "203.0.113.1", http.StatusOK, "203.0.113.1", "192.0.2.1:1234"},
+		{"WithConfig", []Option{WithConfig(func(cfg *Config) { cfg.Enabled = false })}, "10.0.0.1:1234", "203.0.113.1", http.StatusOK, "", "10.0.0.1:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var captured *http.Request
+			next := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { captured = req })
+			handler, err := NewMiddleware(next, tt.opts...)
+			if err != nil {
+				t.Fatalf("failed to create middleware: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if realIP := captured.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if captured.RemoteAddr != tt.expectedRemote {
+				t.Errorf("expected RemoteAddr '%s', but got: '%s'", tt.expectedRemote, captured.RemoteAddr)
+			}
+		})
+	}
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		handler, err := NewMiddleware(http.NotFoundHandler(), WithName("edge"), WithTrustedIPs("not-a-cidr"))
+		if err == nil {
+			t.Fatal("expected error for an invalid CIDR, but got none")
+		}
+		if !strings.HasPrefix(err.Error(), "edge: ") {
+			t.Errorf("expected the error to be prefixed with the name, but got: %v", err)
+		}
+		if handler != nil {
+			t.Error("expected handler to be nil, but got instance")
+		}
+	})
+}
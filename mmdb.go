@@ -0,0 +1,390 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// mmdbMetadataMarker precedes the metadata section at the end of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMaxMetadataSize is how far from the end of the file the metadata marker is searched
+const mmdbMaxMetadataSize = 128 * 1024
+
+// mmdbDataSectionSeparatorSize is the number of zero bytes between the search tree and the data section
+const mmdbDataSectionSeparatorSize = 16
+
+// mmdbMaxDecodeDepth bounds nesting while decoding, protecting against corrupt files
+const mmdbMaxDecodeDepth = 32
+
+// MaxMind DB data section types
+const (
+	mmdbTypeExtended  = 0
+	mmdbTypePointer   = 1
+	mmdbTypeString    = 2
+	mmdbTypeDouble    = 3
+	mmdbTypeBytes     = 4
+	mmdbTypeUint16    = 5
+	mmdbTypeUint32    = 6
+	mmdbTypeMap       = 7
+	mmdbTypeInt32     = 8
+	mmdbTypeUint64    = 9
+	mmdbTypeUint128   = 10
+	mmdbTypeArray     = 11
+	mmdbTypeContainer = 12
+	mmdbTypeEndMarker = 13
+	mmdbTypeBool      = 14
+	mmdbTypeFloat     = 15
+)
+
+// errMMDBCorrupt is returned when the database does not follow the MaxMind DB format
+var errMMDBCorrupt = errors.New("corrupt MaxMind DB file")
+
+// mmdbReader is a minimal pure-Go reader for MaxMind DB (.mmdb) files, such as the
+// GeoLite2/GeoIP2 databases. It has no dependencies outside the standard library so
+// it runs under Yaegi. The whole file is kept in memory.
+//
+// Decoded values are map[string]interface{}, []interface{}, string, float64, uint64,
+// int64, bool or []byte (bytes and uint128).
+type mmdbReader struct {
+	buffer       []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	treeSize     uint
+	dataStart    uint
+	ipv4Start    uint
+}
+
+// openMMDB reads and validates a MaxMind DB file
+func openMMDB(path string) (*mmdbReader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newMMDBReader(buffer)
+}
+
+// newMMDBReader parses the metadata of an in-memory MaxMind DB file
+func newMMDBReader(buffer []byte) (*mmdbReader, error) {
+	searchStart := 0
+	if len(buffer) > mmdbMaxMetadataSize {
+		searchStart = len(buffer) - mmdbMaxMetadataSize
+	}
+	markerIndex := bytes.LastIndex(buffer[searchStart:], mmdbMetadataMarker)
+	if markerIndex < 0 {
+		return nil, fmt.Errorf("%w: metadata marker not found", errMMDBCorrupt)
+	}
+	metadataStart := uint(searchStart + markerIndex + len(mmdbMetadataMarker))
+
+	// Metadata is encoded like the data section, with offsets relative to its start
+	metadataDecoder := mmdbDecoder{buffer: buffer[metadataStart:]}
+	value, _, err := metadataDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errMMDBCorrupt)
+	}
+
+	reader := &mmdbReader{buffer: buffer}
+	reader.nodeCount = uint(mmdbUint(metadata["node_count"]))
+	reader.recordSize = uint(mmdbUint(metadata["record_size"]))
+	reader.ipVersion = uint(mmdbUint(metadata["ip_version"]))
+	reader.databaseType, _ = metadata["database_type"].(string)
+
+	if reader.recordSize != 24 && reader.recordSize != 28 && reader.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errMMDBCorrupt, reader.recordSize)
+	}
+	if reader.ipVersion != 4 && reader.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", errMMDBCorrupt, reader.ipVersion)
+	}
+
+	reader.treeSize = reader.nodeCount * reader.recordSize / 4
+	reader.dataStart = reader.treeSize + mmdbDataSectionSeparatorSize
+	if reader.dataStart > uint(searchStart+markerIndex) {
+		return nil, fmt.Errorf("%w: search tree exceeds file size", errMMDBCorrupt)
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if reader.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node = reader.readRecord(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+
+	return reader, nil
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of a search tree node
+func (r *mmdbReader) readRecord(node uint, bit byte) uint {
+	offset := node * r.recordSize / 4
+	b := r.buffer[offset : offset+r.recordSize/4]
+
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// lookup returns the data record for ip and whether the IP was found in the database
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, bool, error) {
+	if ip == nil {
+		return nil, false, fmt.Errorf("IP address is nil")
+	}
+
+	node := uint(0)
+	bitCount := 128
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+		bitCount = 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, false, fmt.Errorf("cannot look up IPv6 address %s in an IPv4-only database", ip)
+	}
+
+	for i := 0; i < bitCount && node < r.nodeCount; i++ {
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+		node = r.readRecord(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, false, nil
+	}
+	if node < r.nodeCount {
+		return nil, false, fmt.Errorf("%w: search tree deeper than the address", errMMDBCorrupt)
+	}
+
+	offset := node - r.nodeCount - mmdbDataSectionSeparatorSize
+	decoder := mmdbDecoder{buffer: r.buffer[r.dataStart:]}
+	value, _, err := decoder.decode(offset, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// mmdbDecoder decodes values of a MaxMind DB data section
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+// decode decodes the value at offset, returning it and the offset following it
+func (d *mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDecodeDepth {
+		return nil, 0, fmt.Errorf("%w: data nested too deeply", errMMDBCorrupt)
+	}
+
+	typeNum, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == mmdbTypePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	return d.decodeValue(typeNum, size, offset, depth)
+}
+
+// decodeControl reads a control byte (and any extended type and size bytes)
+func (d *mmdbDecoder) decodeControl(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buffer)) {
+		return 0, 0, 0, fmt.Errorf("%w: offset out of range", errMMDBCorrupt)
+	}
+	control := d.buffer[offset]
+	offset++
+
+	typeNum := int(control >> 5)
+	if typeNum == mmdbTypeExtended {
+		if offset >= uint(len(d.buffer)) {
+			return 0, 0, 0, fmt.Errorf("%w: truncated extended type", errMMDBCorrupt)
+		}
+		typeNum = 7 + int(d.buffer[offset])
+		offset++
+	}
+
+	// Pointers encode their size differently; the raw control bits are returned
+	if typeNum == mmdbTypePointer {
+		return typeNum, uint(control & 0x1F), offset, nil
+	}
+
+	size := uint(control & 0x1F)
+	if size >= 29 {
+		extraBytes := size - 28
+		if offset+extraBytes > uint(len(d.buffer)) {
+			return 0, 0, 0, fmt.Errorf("%w: truncated size", errMMDBCorrupt)
+		}
+		extra := uint(0)
+		for _, b := range d.buffer[offset : offset+extraBytes] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += extraBytes
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	return typeNum, size, offset, nil
+}
+
+// decodePointer resolves a pointer whose control bits are ctrl
+func (d *mmdbDecoder) decodePointer(ctrl, offset uint) (uint, uint, error) {
+	pointerSize := ((ctrl >> 3) & 0x3) + 1
+	if offset+pointerSize > uint(len(d.buffer)) {
+		return 0, 0, fmt.Errorf("%w: truncated pointer", errMMDBCorrupt)
+	}
+
+	prefix := ctrl & 0x7
+	if pointerSize == 4 {
+		prefix = 0
+	}
+	pointer := prefix
+	for _, b := range d.buffer[offset : offset+pointerSize] {
+		pointer = pointer<<8 | uint(b)
+	}
+
+	switch pointerSize {
+	case 2:
+		pointer += 2048
+	case 3:
+		pointer += 526336
+	}
+
+	return pointer, offset + pointerSize, nil
+}
+
+// decodeValue decodes a non-pointer value of the given type and size
+func (d *mmdbDecoder) decodeValue(typeNum int, size, offset uint, depth int) (interface{}, uint, error) {
+	switch typeNum {
+	case mmdbTypeMap:
+		result := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errMMDBCorrupt)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[keyString] = value
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeArray:
+		result := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+	case mmdbTypeContainer, mmdbTypeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buffer)) {
+		return nil, 0, fmt.Errorf("%w: value exceeds data section", errMMDBCorrupt)
+	}
+	raw := d.buffer[offset : offset+size]
+	next := offset + size
+
+	switch typeNum {
+	case mmdbTypeString:
+		return string(raw), next, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: invalid double size %d", errMMDBCorrupt, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: invalid float size %d", errMMDBCorrupt, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), next, nil
+	case mmdbTypeBytes, mmdbTypeUint128:
+		return append([]byte(nil), raw...), next, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: invalid integer size %d", errMMDBCorrupt, size)
+		}
+		value := uint64(0)
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		return value, next, nil
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: invalid int32 size %d", errMMDBCorrupt, size)
+		}
+		value := uint32(0)
+		for _, b := range raw {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: unknown data type %d", errMMDBCorrupt, typeNum)
+}
+
+// mmdbUint converts a decoded unsigned integer to uint64 (0 for other types)
+func mmdbUint(value interface{}) uint64 {
+	number, _ := value.(uint64)
+	return number
+}
+
+// mmdbPath walks nested maps along keys and returns the value found, if any
+func mmdbPath(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
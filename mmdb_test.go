@@ -0,0 +1,354 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testMMDBNetwork is a network and the record stored for it in a generated test database
+type testMMDBNetwork struct {
+	cidr   string
+	record interface{}
+}
+
+// testMMDBRecord is a search tree record of a generated test database
+type testMMDBRecord struct {
+	kind  int // 0 = empty, 1 = node, 2 = data
+	value int // node index or network index
+}
+
+// buildTestMMDB generates a MaxMind DB file in memory. IPv4 networks are stored under
+// ::/96 in IPv6 databases, like the real GeoLite2 files. Broader networks must be
+// listed before the more specific networks they contain.
+func buildTestMMDB(t *testing.T, ipVersion, recordSize int, databaseType string, networks []testMMDBNetwork) []byte {
+	t.Helper()
+
+	nodes := [][2]testMMDBRecord{{}}
+	for index, network := range networks {
+		_, block, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			t.Fatalf("invalid test network %q: %v", network.cidr, err)
+		}
+		prefixLen, _ := block.Mask.Size()
+		ip := block.IP
+		if ipv4 := ip.To4(); ipv4 != nil && ipVersion == 6 {
+			ip = append(make(net.IP, 12), ipv4...)
+			prefixLen += 96
+		}
+
+		node := 0
+		for i := 0; i < prefixLen; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == prefixLen-1 {
+				nodes[node][bit] = testMMDBRecord{kind: 2, value: index}
+				break
+			}
+			record := nodes[node][bit]
+			if record.kind != 1 {
+				// Push any broader data record down to both children of the new node
+				nodes = append(nodes, [2]testMMDBRecord{record, record})
+				nodes[node][bit] = testMMDBRecord{kind: 1, value: len(nodes) - 1}
+			}
+			node = nodes[node][bit].value
+		}
+	}
+
+	var data bytes.Buffer
+	offsets := make([]int, len(networks))
+	for index, network := range networks {
+		offsets[index] = data.Len()
+		encodeTestMMDBValue(&data, network.record)
+	}
+
+	nodeCount := len(nodes)
+	recordValue := func(record testMMDBRecord) uint32 {
+		switch record.kind {
+		case 1:
+			return uint32(record.value)
+		case 2:
+			return uint32(nodeCount + mmdbDataSectionSeparatorSize + offsets[record.value])
+		default:
+			return uint32(nodeCount)
+		}
+	}
+
+	var file bytes.Buffer
+	for _, node := range nodes {
+		left, right := recordValue(node[0]), recordValue(node[1])
+		switch recordSize {
+		case 24:
+			file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte((left>>24)&0x0F)<<4 | byte((right>>24)&0x0F), byte(right >> 16), byte(right >> 8), byte(right)})
+		default:
+			var b [8]byte
+			binary.BigEndian.PutUint32(b[0:4], left)
+			binary.BigEndian.PutUint32(b[4:8], right)
+			file.Write(b[:])
+		}
+	}
+	file.Write(make([]byte, mmdbDataSectionSeparatorSize))
+	file.Write(data.Bytes())
+
+	file.Write(mmdbMetadataMarker)
+	encodeTestMMDBValue(&file, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(ipVersion),
+		"database_type":               databaseType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"description":                 map[string]interface{}{"en": "test database"},
+	})
+
+	return file.Bytes()
+}
+
+// writeTestMMDB writes a generated test database to a temporary file and returns its path
+func writeTestMMDB(t *testing.T, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("failed to write test database: %v", err)
+	}
+	return path
+}
+
+// encodeTestMMDBControl writes a control byte, extended type byte and size bytes
+func encodeTestMMDBControl(buf *bytes.Buffer, typeNum, size int) {
+	control := byte(0)
+	if typeNum <= 7 {
+		control = byte(typeNum) << 5
+	}
+
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		control |= byte(size)
+	case size < 285:
+		control |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		control |= 30
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	default:
+		control |= 31
+		sizeBytes = []byte{byte((size - 65821) >> 16), byte((size - 65821) >> 8), byte(size - 65821)}
+	}
+
+	buf.WriteByte(control)
+	if typeNum > 7 {
+		buf.WriteByte(byte(typeNum - 7))
+	}
+	buf.Write(sizeBytes)
+}
+
+// encodeTestMMDBUint writes an unsigned integer using the minimum number of bytes
+func encodeTestMMDBUint(buf *bytes.Buffer, typeNum int, value uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], value)
+	raw := bytes.TrimLeft(b[:], "\x00")
+	encodeTestMMDBControl(buf, typeNum, len(raw))
+	buf.Write(raw)
+}
+
+// encodeTestMMDBValue writes a value in the MaxMind DB data section format
+func encodeTestMMDBValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		encodeTestMMDBControl(buf, mmdbTypeString, len(v))
+		buf.WriteString(v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encodeTestMMDBControl(buf, mmdbTypeMap, len(v))
+		for _, key := range keys {
+			encodeTestMMDBValue(buf, key)
+			encodeTestMMDBValue(buf, v[key])
+		}
+	case []interface{}:
+		encodeTestMMDBControl(buf, mmdbTypeArray, len(v))
+		for _, item := range v {
+			encodeTestMMDBValue(buf, item)
+		}
+	case uint16:
+		encodeTestMMDBUint(buf, mmdbTypeUint16, uint64(v))
+	case uint32:
+		encodeTestMMDBUint(buf, mmdbTypeUint32, uint64(v))
+	case uint64:
+		encodeTestMMDBUint(buf, mmdbTypeUint64, v)
+	case float64:
+		encodeTestMMDBControl(buf, mmdbTypeDouble, 8)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:])
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		encodeTestMMDBControl(buf, mmdbTypeBool, size)
+	default:
+		panic("unsupported test MMDB value")
+	}
+}
+
+func TestMMDBDecoder(t *testing.T) {
+	t.Run("Values", func(t *testing.T) {
+		longString := strings.Repeat("a", 300)
+		value := map[string]interface{}{
+			"string":  "hello",
+			"long":    longString,
+			"uint16":  uint16(443),
+			"uint32":  uint32(4200000000),
+			"uint64":  uint64(1 << 40),
+			"double":  51.5142,
+			"bool":    true,
+			"array":   []interface{}{"a", uint32(1)},
+			"nested":  map[string]interface{}{"en": "London"},
+			"zero":    uint32(0),
+			"boolean": false,
+		}
+
+		var buf bytes.Buffer
+		encodeTestMMDBValue(&buf, value)
+
+		decoder := mmdbDecoder{buffer: buf.Bytes()}
+		decoded, next, err := decoder.decode(0, 0)
+		if err != nil {
+			t.Fatalf("decode returned error: %v", err)
+		}
+		if next != uint(buf.Len()) {
+			t.Errorf("expected decoding to end at %d, but got %d", buf.Len(), next)
+		}
+
+		expected := map[string]interface{}{
+			"string":  "hello",
+			"long":    longString,
+			"uint16":  uint64(443),
+			"uint32":  uint64(4200000000),
+			"uint64":  uint64(1 << 40),
+			"double":  51.5142,
+			"bool":    true,
+			"array":   []interface{}{"a", uint64(1)},
+			"nested":  map[string]interface{}{"en": "London"},
+			"zero":    uint64(0),
+			"boolean": false,
+		}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("decoded %#v, expected %#v", decoded, expected)
+		}
+	})
+
+	t.Run("Pointer", func(t *testing.T) {
+		var buf bytes.Buffer
+		encodeTestMMDBValue(&buf, "shared")
+		pointerOffset := uint(buf.Len())
+		buf.Write([]byte{mmdbTypePointer << 5, 0x00})
+
+		decoder := mmdbDecoder{buffer: buf.Bytes()}
+		decoded, next, err := decoder.decode(pointerOffset, 0)
+		if err != nil {
+			t.Fatalf("decode returned error: %v", err)
+		}
+		if decoded != "shared" {
+			t.Errorf("expected pointer to resolve to %q, but got %#v", "shared", decoded)
+		}
+		if next != pointerOffset+2 {
+			t.Errorf("expected decoding to continue after the pointer at %d, but got %d", pointerOffset+2, next)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		var buf bytes.Buffer
+		encodeTestMMDBValue(&buf, "truncated string")
+
+		decoder := mmdbDecoder{buffer: buf.Bytes()[:5]}
+		if _, _, err := decoder.decode(0, 0); err == nil {
+			t.Error("expected error for truncated data, but got none")
+		}
+	})
+}
+
+func TestMMDBReader(t *testing.T) {
+	networks := []testMMDBNetwork{
+		{"81.2.69.0/24", map[string]interface{}{"name": "v4-network"}},
+		{"81.2.69.128/25", map[string]interface{}{"name": "v4-specific"}},
+		{"2001:db8::/32", map[string]interface{}{"name": "v6-network"}},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		t.Run("RecordSize"+strconv.Itoa(recordSize), func(t *testing.T) {
+			reader, err := newMMDBReader(buildTestMMDB(t, 6, recordSize, "Test-DB", networks))
+			if err != nil {
+				t.Fatalf("failed to open database: %v", err)
+			}
+			if reader.databaseType != "Test-DB" {
+				t.Errorf("expected database type %q, but got %q", "Test-DB", reader.databaseType)
+			}
+
+			tests := []struct {
+				ip       string
+				expected string
+			}{
+				{"81.2.69.1", "v4-network"},
+				{"81.2.69.200", "v4-specific"},
+				{"2001:db8::1", "v6-network"},
+				{"8.8.8.8", ""},
+				{"2001:db9::1", ""},
+			}
+
+			for _, tt := range tests {
+				record, found, err := reader.lookup(net.ParseIP(tt.ip))
+				if err != nil {
+					t.Errorf("lookup(%s) returned error: %v", tt.ip, err)
+					continue
+				}
+				if tt.expected == "" {
+					if found {
+						t.Errorf("expected %s not to be found, but got %#v", tt.ip, record)
+					}
+					continue
+				}
+				if name, _ := mmdbPath(record, "name").(string); !found || name != tt.expected {
+					t.Errorf("lookup(%s) = %#v (found=%v), expected %q", tt.ip, record, found, tt.expected)
+				}
+			}
+		})
+	}
+
+	t.Run("IPv4Database", func(t *testing.T) {
+		reader, err := newMMDBReader(buildTestMMDB(t, 4, 24, "Test-DB", networks[:2]))
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+
+		record, found, err := reader.lookup(net.ParseIP("81.2.69.1"))
+		if err != nil || !found || mmdbPath(record, "name") != "v4-network" {
+			t.Errorf("expected IPv4 lookup to succeed, but got %#v (found=%v, err=%v)", record, found, err)
+		}
+		if _, _, err := reader.lookup(net.ParseIP("2001:db8::1")); err == nil {
+			t.Error("expected error when looking up IPv6 in an IPv4 database, but got none")
+		}
+	})
+
+	t.Run("NotADatabase", func(t *testing.T) {
+		if _, err := newMMDBReader([]byte("definitely not a MaxMind database")); err == nil {
+			t.Error("expected error for invalid database, but got none")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// What happens to candidates in exotic IPv4 notations such as "0x7f000001"
+const (
+	exoticIPv4Allow     = "allow"
+	exoticIPv4Reject    = "reject"
+	exoticIPv4Normalize = "normalize"
+)
+
+// rejectReasonExoticIPv4 marks candidates discarded for an exotic IPv4 notation
+const rejectReasonExoticIPv4 = "exotic IPv4 notation"
+
+// parseExoticIPv4Mode validates the exoticIPv4 configuration, defaulting to allow
+func parseExoticIPv4Mode(name, mode string) (string, error) {
+	switch mode {
+	case "":
+		return exoticIPv4Allow, nil
+	case exoticIPv4Allow, exoticIPv4Reject, exoticIPv4Normalize:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s: exoticIPv4 must be %q, %q or %q, got %q", name, exoticIPv4Allow, exoticIPv4Reject, exoticIPv4Normalize, mode)
+	}
+}
+
+// parseExoticIPv4 parses the IPv4 notations inet_aton accepts but net.ParseIP does not:
+// hexadecimal ("0x7f.1"), octal ("0177.0.0.1", "010.0.0.1") and integer ("3232235777")
+// parts, and fewer than four parts, the last of which fills the remaining bytes ("127.1").
+// Parsers disagree on these forms, so an ACL downstream may read another address than ours.
+func parseExoticIPv4(s string) (net.IP, bool) {
+	if s == "" || net.ParseIP(s) != nil {
+		return nil, false
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 4 {
+		return nil, false
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		base := 10
+		switch {
+		case len(part) > 2 && (part[:2] == "0x" || part[:2] == "0X"):
+			base, part = 16, part[2:]
+		case len(part) > 1 && part[0] == '0':
+			base, part = 8, part[1:]
+		}
+		value, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = value
+	}
+
+	// Every part but the last is a single byte; the last fills the remaining bytes
+	var addr uint64
+	for i, value := range values[:len(values)-1] {
+		if value > 0xff {
+			return nil, false
+		}
+		addr |= value << (8 * (3 - uint(i)))
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-uint(len(values)))) {
+		return nil, false
+	}
+	addr |= last
+
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr)), true
+}
+
+// checkNotation applies exoticIPv4 to a cleaned candidate. exotic reports whether the
+// candidate was in an exotic IPv4 notation; it is then passed on unchanged, discarded
+// (returned empty) or converted to dotted-quad form.
+func (r *Resolver) checkNotation(ip string) (string, bool) {
+	if r.exoticIPv4 == "" || r.exoticIPv4 == exoticIPv4Allow {
+		return ip, false
+	}
+
+	parsed, exotic := parseExoticIPv4(ip)
+	if !exotic {
+		return ip, false
+	}
+	if r.exoticIPv4 == exoticIPv4Normalize {
+		return parsed.String(), true
+	}
+	return "", true
+}
@@ -0,0 +1,142 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseExoticIPv4(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"0x7f000001", "127.0.0.1"},
+		{"017700000001", "127.0.0.1"},
+		{"3232235777", "192.168.1.1"},
+		{"0x7f.1", "127.0.0.1"},
+		{"127.1", "127.0.0.1"},
+		{"10.0x1.1", "10.1.0.1"},
+		{"0177.0.0.01", "127.0.0.1"},
+		{"010.0.0.1", "8.0.0.1"},
+		{"0", "0.0.0.0"},
+		{"192.168.1.1", ""},
+		{"2001:db8::1", ""},
+		{"unknown", ""},
+		{"256.1.1.1", ""},
+		{"1.2.3.4.5", ""},
+		{"1.2.65536", ""},
+		{"4294967296", ""},
+		{"08.1.1.1", ""},
+		{"0x", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		ip, ok := parseExoticIPv4(tt.addr)
+		result := ""
+		if ok {
+			result = ip.String()
+		}
+		if result != tt.expected {
+			t.Errorf("parseExoticIPv4(%q) = %q, expected %q", tt.addr, result, tt.expected)
+		}
+	}
+}
+
+func TestExoticIPv4(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		xff        string
+		expectedIP string
+	}{
+		{"AllowedByDefaultNotEmitted", "", "0x7f000001", ""},
+		{"AllowedNotEmitted", exoticIPv4Allow, "3232235777", ""},
+		{"RejectedFallsThrough", exoticIPv4Reject, "0x7f000001", "192.0.2.1"},
+		{"RejectedKeepsDottedQuad", exoticIPv4Reject, "203.0.113.5", "203.0.113.5"},
+		{"NormalizedHex", exoticIPv4Normalize, "0x7f000001", "127.0.0.1"},
+		{"NormalizedOctal", exoticIPv4Normalize, "017700000001", "127.0.0.1"},
+		{"NormalizedIntegerWithPort", exoticIPv4Normalize, "3232235777:8080", "192.168.1.1"},
+		{"NormalizedLeadingZeros", exoticIPv4Normalize, "010.0.0.1", "8.0.0.1"},
+		{"IPv6Untouched", exoticIPv4Normalize, "2001:db8::1", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}, {HeaderName: "clientAddress"}}
+			cfg.ExoticIPv4 = tt.mode
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("DenyIPsCannotBeBypassed", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+		cfg.ExoticIPv4 = exoticIPv4Normalize
+		cfg.DenyIPs = []string{"127.0.0.0/8"}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "0x7f000001")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("RejectionExplained", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+		cfg.ExoticIPv4 = exoticIPv4Reject
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "0x7f000001")
+		report := plugin.(*Plugin).Explain(req)
+
+		if len(report.Headers) == 0 || len(report.Headers[0].Candidates) != 1 {
+			t.Fatalf("expected one candidate, got %+v", report.Headers)
+		}
+		if rejected := report.Headers[0].Candidates[0].Rejected; rejected != rejectReasonExoticIPv4 {
+			t.Errorf("expected candidate rejected as %q, but got %q", rejectReasonExoticIPv4, rejected)
+		}
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ExoticIPv4 = "drop"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown exoticIPv4 mode, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
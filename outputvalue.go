@@ -0,0 +1,107 @@
+package traefik_realip
+
+import (
+	"fmt"
+)
+
+// maxOutputIPLength bounds IP-valued outputs: the longest IPv6 address with a zone
+// identifier fits comfortably
+const maxOutputIPLength = 64
+
+// validOutputIP reports whether value is an IP address, with an optional zone identifier.
+// Arbitrary tokens such as "admin" are refused along with CR, LF, separators, quotes,
+// whitespace and control characters, so only addresses reach IP-valued output headers.
+func validOutputIP(value string) bool {
+	return validOutputToken(value) && parseAddress(value) != nil
+}
+
+// validOutputToken reports whether value only has the characters of an IP address, with an
+// optional zone identifier or brackets, or of a token such as "unknown"
+func validOutputToken(value string) bool {
+	if value == "" || len(value) > maxOutputIPLength {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c == '.', c == ':', c == '[', c == ']', c == '%', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validOutputPort reports whether port is a decimal port number
+func validOutputPort(port string) bool {
+	if port == "" || len(port) > 5 {
+		return false
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePlaceholder checks that invalidOutputPlaceholder is a token safe to write to headers
+func validatePlaceholder(name, placeholder string) error {
+	if placeholder != "" && !validOutputToken(placeholder) {
+		return fmt.Errorf("%s: invalidOutputPlaceholder %q can only contain letters, digits and . : [ ] %% - _", name, placeholder)
+	}
+	return nil
+}
+
+// validOutput reports whether value can be written to an IP-valued output header: an IP
+// address or, exactly, the configured invalidOutputPlaceholder
+func (r *Resolver) validOutput(value string) bool {
+	return validOutputIP(value) || (value != "" && value == r.invalidOutputPlaceholder)
+}
+
+// outputIP returns value when it is fit for an IP-valued output header, and
+// invalidOutputPlaceholder otherwise
+func (r *Resolver) outputIP(value string) string {
+	if value == "" || r.validOutput(value) {
+		return value
+	}
+	return r.invalidOutputPlaceholder
+}
+
+// hardenResolution replaces a resolved value that is unfit for the output headers, such as
+// a raw lastHeaderRaw value or a non-IP entry, with invalidOutputPlaceholder, does the same
+// for the other chain entries and drops ports that are not numbers
+func (r *Resolver) hardenResolution(resolved resolution) resolution {
+	if resolved.ip != "" && !r.validOutput(resolved.ip) {
+		resolved.ip = r.invalidOutputPlaceholder
+		resolved.port = ""
+		resolved.chain = []string{resolved.ip}
+		resolved.index = 0
+	}
+	if resolved.port != "" && !validOutputPort(resolved.port) {
+		resolved.port = ""
+	}
+	resolved.chain, resolved.index = r.hardenChain(resolved.chain, resolved.index)
+	return resolved
+}
+
+// hardenChain replaces the entries of chain unfit for the output headers with
+// invalidOutputPlaceholder, or drops them when there is none, keeping index on its entry
+func (r *Resolver) hardenChain(chain []string, index int) ([]string, int) {
+	hardened := chain[:0:0]
+	hardenedIndex := index
+	for i, entry := range chain {
+		if !r.validOutput(entry) {
+			if r.invalidOutputPlaceholder == "" {
+				if i < index {
+					hardenedIndex--
+				}
+				continue
+			}
+			entry = r.invalidOutputPlaceholder
+		}
+		hardened = append(hardened, entry)
+	}
+	return hardened, hardenedIndex
+}
@@ -0,0 +1,105 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidOutputIP(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"203.0.113.1", true},
+		{"2001:db8::1", true},
+		{"[2001:db8::1]", false},
+		{"fe80::1%eth0", true},
+		{"unknown", false},
+		{"_hidden", false},
+		{"admin", false},
+		{"", false},
+		{"203.0.113.1\r\nX-Admin: true", false},
+		{"203.0.113.1, 10.0.0.1", false},
+		{"a;b", false},
+		{`"[2001:db8::1`, false},
+		{"203.0.113.1\x00", false},
+		{strings.Repeat("a", maxOutputIPLength+1), false},
+	}
+
+	for _, tt := range tests {
+		if valid := validOutputIP(tt.value); valid != tt.expected {
+			t.Errorf("validOutputIP(%q): expected %v, but got %v", tt.value, tt.expected, valid)
+		}
+	}
+}
+
+func TestValidOutputPort(t *testing.T) {
+	for port, expected := range map[string]bool{"8080": true, "0": true, "": false, "80a": false, "123456": false} {
+		if valid := validOutputPort(port); valid != expected {
+			t.Errorf("validOutputPort(%q): expected %v, but got %v", port, expected, valid)
+		}
+	}
+}
+
+func TestOutputValueHardening(t *testing.T) {
+	tests := []struct {
+		name          string
+		placeholder   string
+		xff           string
+		expectedIP    string
+		expectedPort  string
+		expectedChain string
+	}{
+		{"ValidIP", "", "203.0.113.1:8080", "203.0.113.1", "8080", "203.0.113.1"},
+		{"InvalidPortDropped", "", "203.0.113.1:80a", "203.0.113.1", "", "203.0.113.1"},
+		{"SeparatorUnresolved", "", "a;b", "", "", ""},
+		{"Placeholder", "invalid", "a;b", "invalid", "", "invalid"},
+		{"TokenUnresolved", "", "admin", "", "", ""},
+		{"TokenPlaceholder", "invalid", "admin", "invalid", "", "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+			cfg.PortHeaderName = "X-Real-Port"
+			cfg.ChainHeaderName = "X-Real-IP-Chain"
+			cfg.InvalidOutputPlaceholder = tt.placeholder
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if port := req.Header.Get("X-Real-Port"); port != tt.expectedPort {
+				t.Errorf("expected port '%s', but got: '%s'", tt.expectedPort, port)
+			}
+			if chain := req.Header.Get("X-Real-IP-Chain"); chain != tt.expectedChain {
+				t.Errorf("expected chain '%s', but got: '%s'", tt.expectedChain, chain)
+			}
+		})
+	}
+
+	t.Run("InvalidPlaceholder", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.InvalidOutputPlaceholder = "in valid"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected an error for an invalid placeholder")
+		}
+		if plugin != nil {
+			t.Error("expected nil plugin for an invalid placeholder")
+		}
+	})
+}
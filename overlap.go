@@ -0,0 +1,116 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// rangeProblems reports the entries of a CIDR list that are duplicated, shadowed by a broader
+// entry, or written with host bits set, so "10.0.0.1/8" is not mistaken for a single host, and
+// exclusions that contradict an entry or exclude nothing. Entries that do not parse are left to
+// the list's own validation.
+func rangeProblems(field string, cidrs []string) []string {
+	var problems []string
+	blocks := make([]*net.IPNet, len(cidrs))
+	covered := make([][]*net.IPNet, len(cidrs))
+	excluded := make([]bool, len(cidrs))
+	for i, cidr := range cidrs {
+		parsed, isExcluded, err := parseEntry(strings.TrimSpace(cidr))
+		if err != nil {
+			continue
+		}
+		covered[i], excluded[i] = parsed, isExcluded
+		// Ranges spanning several blocks take no part in the comparison
+		if len(parsed) == 1 {
+			blocks[i] = parsed[0]
+		}
+		if ip, block, err := net.ParseCIDR(strings.TrimPrefix(strings.TrimSpace(cidr), "!")); err == nil && !ip.Equal(block.IP) {
+			problems = append(problems, fmt.Sprintf("%s[%d] %q has host bits set and covers %s", field, i, cidr, block))
+		}
+	}
+
+	// within reports whether block lies in an entry of the given kind
+	within := func(block *net.IPNet, exclusion bool) bool {
+		for j := range covered {
+			if excluded[j] != exclusion {
+				continue
+			}
+			for _, other := range covered[j] {
+				if blockContains(other, block) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for i, block := range blocks {
+		if block == nil {
+			continue
+		}
+		if excluded[i] && !within(block, false) {
+			problems = append(problems, fmt.Sprintf("%s[%d] %q excludes nothing", field, i, cidrs[i]))
+			continue
+		}
+		// Entries inside an entry of the other kind punch holes or fill them, so they are not shadowed
+		holes := within(block, !excluded[i])
+		for j, other := range blocks {
+			if j == i || other == nil || !blockContains(other, block) {
+				continue
+			}
+			if sameBlock(block, other) {
+				// Report each duplicate once, against its first occurrence
+				if j < i && excluded[j] == excluded[i] {
+					problems = append(problems, fmt.Sprintf("%s[%d] %q duplicates %s[%d] %q", field, i, cidrs[i], field, j, cidrs[j]))
+					break
+				}
+				if j < i {
+					problems = append(problems, fmt.Sprintf("%s[%d] %q contradicts %s[%d] %q", field, i, cidrs[i], field, j, cidrs[j]))
+					break
+				}
+				continue
+			}
+			if excluded[j] == excluded[i] && !holes {
+				problems = append(problems, fmt.Sprintf("%s[%d] %q is shadowed by %s[%d] %q", field, i, cidrs[i], field, j, cidrs[j]))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// blockContains reports whether block outer contains block inner
+func blockContains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// sameBlock reports whether a and b are the same block
+func sameBlock(a, b *net.IPNet) bool {
+	return blockContains(a, b) && blockContains(b, a)
+}
+
+// checkRangeLists analyzes every configured CIDR list for duplicated and shadowed entries.
+// The problems of all lists are logged as warnings, or returned as a single error with
+// strictRanges, so a single start-up reveals every copy-paste mistake.
+func checkRangeLists(name string, cfg *Config) error {
+	problems := rangeProblems("trustedIPs", cfg.TrustedIPs)
+	for i, tier := range cfg.TrustTiers {
+		problems = append(problems, rangeProblems(fmt.Sprintf("trustTiers[%d].trustedIPs", i), tier.TrustedIPs)...)
+	}
+	problems = append(problems, rangeProblems("denyIPs", cfg.DenyIPs)...)
+	problems = append(problems, rangeProblems("allowOnlyIPs", cfg.AllowOnlyIPs)...)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if cfg.StrictRanges {
+		return fmt.Errorf("%s: %d problems in the configured ranges: %s", name, len(problems), strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		logf(name, "warning: %s", problem)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRangeProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		cidrs    []string
+		expected []string
+	}{
+		{"Clean", []string{"10.0.0.0/8", "192.168.0.0/16", "2001:db8::/32"}, nil},
+		{"Duplicate", []string{"10.0.0.0/8", "192.168.0.0/16", "10.0.0.0/8"}, []string{`list[2] "10.0.0.0/8" duplicates list[0] "10.0.0.0/8"`}},
+		{"DuplicateSpelledDifferently", []string{"2001:db8::/32", "2001:0db8::/32"}, []string{`list[1] "2001:0db8::/32" duplicates list[0] "2001:db8::/32"`}},
+		{"Shadowed", []string{"10.1.0.0/16", "10.0.0.0/8"}, []string{`list[0] "10.1.0.0/16" is shadowed by list[1] "10.0.0.0/8"`}},
+		{"HostBits", []string{"10.0.0.1/8"}, []string{`list[0] "10.0.0.1/8" has host bits set and covers 10.0.0.0/8`}},
+		{"FamiliesApart", []string{"0.0.0.0/0", "::/0"}, nil},
+		{"UnparseableSkipped", []string{"not-a-cidr", "10.0.0.0/8"}, nil},
+		{"SingleIPDuplicate", []string{"10.0.0.1/32", "10.0.0.1"}, []string{`list[1] "10.0.0.1" duplicates list[0] "10.0.0.1/32"`}},
+		{"SingleBlockRangeShadowed", []string{"10.0.0.0-10.0.0.255", "10.0.0.0/8"}, []string{`list[0] "10.0.0.0-10.0.0.255" is shadowed by list[1] "10.0.0.0/8"`}},
+		{"MultiBlockRangeSkipped", []string{"10.0.0.5-10.0.0.20", "10.0.0.0/8"}, nil},
+		{"Exclusion", []string{"10.0.0.0/8", "!10.99.0.0/16", "10.99.1.0/24"}, nil},
+		{"ExclusionInRange", []string{"10.0.0.5-10.0.0.20", "!10.0.0.8/30"}, nil},
+		{"ExclusionOfNothing", []string{"10.0.0.0/8", "!192.168.0.0/16"}, []string{`list[1] "!192.168.0.0/16" excludes nothing`}},
+		{"ExclusionContradicts", []string{"10.0.0.0/8", "!10.0.0.0/8"}, []string{`list[1] "!10.0.0.0/8" contradicts list[0] "10.0.0.0/8"`}},
+		{"ExclusionDuplicate", []string{"10.0.0.0/8", "!10.1.0.0/16", "!10.1.0.0/16"}, []string{`list[2] "!10.1.0.0/16" duplicates list[1] "!10.1.0.0/16"`}},
+		{"ExclusionHostBits", []string{"10.0.0.0/8", "!10.1.0.1/16"}, []string{`list[1] "!10.1.0.1/16" has host bits set and covers 10.1.0.0/16`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if problems := rangeProblems("list", tt.cidrs); !reflect.DeepEqual(problems, tt.expected) {
+				t.Errorf("expected problems %q, but got %q", tt.expected, problems)
+			}
+		})
+	}
+}
+
+func TestRangeChecks(t *testing.T) {
+	newConfig := func(strict bool) *Config {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8", "10.1.0.0/16"}
+		cfg.TrustTiers = []TrustTier{{Name: "cdn", TrustedIPs: []string{"198.51.100.0/24", "198.51.100.0/24"}}}
+		cfg.DenyIPs = []string{"192.0.2.0/24"}
+		cfg.StrictRanges = strict
+		return cfg
+	}
+
+	t.Run("Warnings", func(t *testing.T) {
+		var logs bytes.Buffer
+		logWriter = &logs
+		defer func() { logWriter = os.Stdout }()
+
+		if _, err := New(context.TODO(), &noopHandler{}, newConfig(false), pluginName); err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		for _, expected := range []string{`trustedIPs[1] "10.1.0.0/16" is shadowed`, `trustTiers[0].trustedIPs[1] "198.51.100.0/24" duplicates`} {
+			if !strings.Contains(logs.String(), expected) {
+				t.Errorf("expected warning containing %q, but got logs: %s", expected, logs.String())
+			}
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		plugin, err := New(context.TODO(), &noopHandler{}, newConfig(true), pluginName)
+		if err == nil || !strings.Contains(err.Error(), "2 problems") {
+			t.Errorf("expected an error listing both problems, but got %v", err)
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -6,249 +6,2195 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // HeaderConfig defines a header to process with optional depth specification.
 type HeaderConfig struct {
-	HeaderName string `json:"headerName"` // Name of the header to check
-	Depth      int    `json:"depth"`      // Depth for IP extraction: -1 = leftmost, 0 = rightmost, 1 = second from right, etc.
+	HeaderName string      `json:"headerName"`           // Name of the header to check
+	Depth      interface{} `json:"depth"`                // Depth for IP extraction: 0 = rightmost, 1 = second from right, -1 = leftmost, -2 = second from left, or a keyword ("first", "last", "second-from-left", "rightmost-untrusted+1", ...)
+	TrustAll   bool        `json:"trustAll,omitempty"`   // Honor this header from any source, overriding the global trust settings
+	TrustedIPs []string    `json:"trustedIPs,omitempty"` // CIDR blocks this header is honored from, overriding the global trust settings
+	Family     string      `json:"family,omitempty"`     // IP family selected from this header: "any" (default), "ipv4" or "ipv6"; other entries are skipped
+	Weight     float64     `json:"weight,omitempty"`     // How far this header is relied on, from 0 (exclusive) to 1 (default), scoring confidenceHeaderName
+
+	TargetHeaderName string `json:"targetHeaderName,omitempty"` // Header receiving the IP this entry yields, resolved apart from headerName (e.g., "X-CDN-Client-IP")
+
+	OnlyIfHeaderPresent string `json:"onlyIfHeaderPresent,omitempty"` // Only read this header when the request carries the named one (e.g., "CF-Ray")
+	SkipIfHeaderPresent string `json:"skipIfHeaderPresent,omitempty"` // Skip this header when the request carries the named one
+}
+
+// Config defines the plugin configuration.
+type Config struct {
+	// Core settings
+	Enabled bool  `json:"enabled,omitempty"` // Enable/disable the plugin
+	Match   Match `json:"match,omitempty"`   // Requests the plugin processes (default: all); others are passed on untouched
+
+	Profile string `json:"profile,omitempty"` // Coherent defaults for a deployment: "strict-security", "behind-cdn", "lan-only" or "permissive"; configured settings override them
+
+	// Header configuration
+	HeaderName     string      `json:"headerName,omitempty"`     // Header name where IP will be populated
+	ProcessHeaders interface{} `json:"processHeaders,omitempty"` // Headers to process: HeaderConfig objects or plain header names, read at their leftmost entry (default: X-Forwarded-For, X-Real-IP, CF-Connecting-IP, clientAddress)
+	DefaultDepth   interface{} `json:"defaultDepth,omitempty"`   // Depth of processHeaders entries that omit one, in any form depth takes (default: 0, the rightmost entry)
+	ForceOverwrite bool        `json:"forceOverwrite,omitempty"` // Always set the header, even if empty (to prevent header spoofing)
+
+	SyntheticHeaderName    string `json:"syntheticHeaderName,omitempty"`    // processHeaders name mapped to the connection address instead of a header (default: "clientAddress")
+	DisableSyntheticHeader bool   `json:"disableSyntheticHeader,omitempty"` // Read processHeaders entries named like the synthetic header from real headers
+
+	HeaderInstances string `json:"headerInstances,omitempty"` // How a processed header sent several times is read: "join" (default), "first" or "last"
+	Fallback        string `json:"fallback,omitempty"`        // What happens when no processed header yields an IP: "empty" (default), "remoteAddr", "reject" or "lastHeaderRaw"
+	ZoneIdentifiers string `json:"zoneIdentifiers,omitempty"` // IPv6 zone identifiers of candidates (e.g., "fe80::1%eth0"): "strip" (default) or "preserve"
+	ExoticIPv4      string `json:"exoticIPv4,omitempty"`      // Candidates in hex, octal or integer IPv4 notation (e.g., "0x7f000001"): "allow" (default), "reject" or "normalize"
+
+	AlreadyProcessed      string `json:"alreadyProcessed,omitempty"`      // What happens to requests an earlier instance processed: "reprocess" (default), "skip" or "merge"
+	ProcessedMarkerHeader string `json:"processedMarkerHeader,omitempty"` // Header marking processed requests for instances in other proxies (e.g., "X-Real-IP-Processed")
+
+	SourceHeaderName string `json:"sourceHeaderName,omitempty"` // Header recording which header and position produced the IP (e.g., "X-Real-IP-Source")
+	PortHeaderName   string `json:"portHeaderName,omitempty"`   // Header receiving the client port that accompanied the IP (e.g., "X-Real-Port")
+	ChainHeaderName  string `json:"chainHeaderName,omitempty"`  // Header receiving every cleaned candidate IP, marked when trusted (e.g., "X-Real-IP-Chain")
+
+	EmbeddedIPv4HeaderName string `json:"embeddedIPv4HeaderName,omitempty"` // Header receiving the IPv4 embedded in a 6to4, Teredo or NAT64 real IP (e.g., "X-Real-IP-Embedded-IPv4")
+	IPv4HeaderName         string `json:"ipv4HeaderName,omitempty"`         // Header receiving the real IP in IPv4 form when it has one, mapped or embedded (e.g., "X-Real-IP-V4")
+	IPClassHeaderName      string `json:"ipClassHeaderName,omitempty"`      // Header receiving the class of the real IP: public, private, loopback, link-local, cgnat, multicast, unspecified or reserved (e.g., "X-Real-IP-Class")
+	ConfidenceHeaderName   string `json:"confidenceHeaderName,omitempty"`   // Header receiving a 0-1 score of the source and validity of the real IP (e.g., "X-Real-IP-Confidence")
+
+	AuditHeaderName string `json:"auditHeaderName,omitempty"` // Header receiving a compact trace of the processing steps (e.g., "X-Real-IP-Audit")
+
+	RewriteForwardedFor bool `json:"rewriteForwardedFor,omitempty"` // Replace X-Forwarded-For with the resolved client IP and the hops to its right
+	AppendForwardedFor  bool `json:"appendForwardedFor,omitempty"`  // Append the connection's IP to X-Forwarded-For unless it already is the last hop
+	RewriteRemoteAddr   bool `json:"rewriteRemoteAddr,omitempty"`   // Set req.RemoteAddr to the resolved IP (keeping or synthesizing a port)
+	PreserveOriginal    bool `json:"preserveOriginal,omitempty"`    // Copy the inbound output header and X-Forwarded-For to X-Original-* headers before modifying them
+
+	// Trust configuration
+	TrustAll      bool     `json:"trustAll,omitempty"`      // Trust all sources (default: false)
+	TrustedIPs    []string `json:"trustedIPs,omitempty"`    // CIDR blocks of trusted proxy IPs (required if trustAll is false)
+	TrustedHeader string   `json:"trustedHeader,omitempty"` // Header name for trust indication (e.g., "X-Is-Trusted")
+
+	TrustedHeaderValues map[string]string `json:"trustedHeaderValues,omitempty"` // Values of trustedHeader per state: trusted (default "yes"), untrusted (default "no") and unknown (default: the untrusted value)
+
+	AllowReservedHeaderNames bool `json:"allowReservedHeaderNames,omitempty"` // Allow output headers named like hop-by-hop or protocol-critical headers (logged as a warning)
+	StrictRanges             bool `json:"strictRanges,omitempty"`             // Fail on duplicate or shadowed CIDRs in trustedIPs, trustTiers, denyIPs and allowOnlyIPs instead of logging warnings
+
+	TrustLoopbackAlways bool `json:"trustLoopbackAlways,omitempty"` // Always trust loopback sources (127.0.0.0/8 and ::1) regardless of other trust settings
+	RequireTrustedChain bool `json:"requireTrustedChain,omitempty"` // Only trust requests whose X-Forwarded-For hops, all but the leftmost, are in the trusted ranges
+
+	RequireTLS       bool   `json:"requireTLS,omitempty"`       // Only honor forwarded headers of requests that arrived over TLS or carry X-Forwarded-Proto "https" from a trusted hop
+	RequireTLSAction string `json:"requireTLSAction,omitempty"` // What happens to plaintext requests of trusted sources: "untrust" (default) or "reject"
+
+	TrustTiers []TrustTier `json:"trustTiers,omitempty"` // Named sets of trusted sources, each written to trustedHeader and optionally limited to some processHeaders
+
+	TrustedIPsFile                string `json:"trustedIPsFile,omitempty"`                // Path to a newline-delimited CIDR file, reloaded when it changes
+	TrustedIPsFileRefreshInterval int    `json:"trustedIPsFileRefreshInterval,omitempty"` // Seconds between checks of trustedIPsFile for changes (default: 10)
+	TrustedIPsFileGracePeriod     int    `json:"trustedIPsFileGracePeriod,omitempty"`     // Seconds prefixes removed from trustedIPsFile stay trusted (0 = none)
+
+	TrustedSecretHeader string `json:"trustedSecretHeader,omitempty"` // Header carrying a pre-shared secret that makes a request trusted regardless of its source IP
+	TrustedSecretValue  string `json:"trustedSecretValue,omitempty"`  // The pre-shared secret (redacted in diagnostic dumps)
+
+	TrustedClientCertNames       []string `json:"trustedClientCertNames,omitempty"`       // Patterns (e.g., "*.edge.example.com") of client certificate CNs and DNS SANs that make a request trusted
+	TrustedClientCertInfoHeader  string   `json:"trustedClientCertInfoHeader,omitempty"`  // passTLSClientCert info header to read the certificate from when TLS is not terminated here
+	TrustedClientCertInfoSources []string `json:"trustedClientCertInfoSources,omitempty"` // CIDR blocks of the TLS terminators trustedClientCertInfoHeader is read from
+
+	TrustCacheTTL  int `json:"trustCacheTTL,omitempty"`  // Seconds to cache the trust verdict per source IP (0 = evaluate every request)
+	TrustCacheSize int `json:"trustCacheSize,omitempty"` // Maximum number of source IPs in the trust cache; least recently used are evicted (default: 10000)
+
+	// Replay detection
+	ReplayHeaderName string `json:"replayHeaderName,omitempty"` // Header set to "yes" when the same (client IP, chain, URL) repeats at anomalous rates
+	ReplayWindow     int    `json:"replayWindow,omitempty"`     // Seconds of the replay detection window (default: 10)
+	ReplayThreshold  int    `json:"replayThreshold,omitempty"`  // Occurrences within the window that tag a request (default: 3)
+
+	// GeoIP enrichment
+	GeoIPDatabase            string `json:"geoIPDatabase,omitempty"`            // Path to a MaxMind DB (GeoLite2/GeoIP2 City or Country) file
+	GeoIPLanguage            string `json:"geoIPLanguage,omitempty"`            // Language of country and city names (default: "en")
+	GeoCountryCodeHeaderName string `json:"geoCountryCodeHeaderName,omitempty"` // Header receiving the ISO country code
+	GeoCountryHeaderName     string `json:"geoCountryHeaderName,omitempty"`     // Header receiving the country name
+	GeoCityHeaderName        string `json:"geoCityHeaderName,omitempty"`        // Header receiving the city name
+
+	GeoPassthroughHeaders []string `json:"geoPassthroughHeaders,omitempty"` // Third-party country code headers (e.g., "CF-IPCountry") kept only from trusted sources, otherwise recomputed from geoIPDatabase or removed
+
+	// ASN enrichment
+	ASNDatabase     string `json:"asnDatabase,omitempty"`     // Path to a MaxMind DB (GeoLite2/GeoIP2 ASN) file
+	ASNHeaderName   string `json:"asnHeaderName,omitempty"`   // Header receiving the autonomous system number
+	ASOrgHeaderName string `json:"asOrgHeaderName,omitempty"` // Header receiving the autonomous system organization
+
+	// Input limits
+	MaxChainLength   int    `json:"maxChainLength,omitempty"`   // Entries parsed per processed header, the leftmost extra entries are ignored (default: 32)
+	MaxHeaderLength  int    `json:"maxHeaderLength,omitempty"`  // Maximum length of a processed header value (default: 2048)
+	OversizedHeaders string `json:"oversizedHeaders,omitempty"` // What happens to longer values: "skip" the header (default) or "truncate" to the rightmost entries
+	StrictMode       bool   `json:"strictMode,omitempty"`       // Reject malformed processed headers with 400 instead of tolerating them
+
+	// Output limits
+	MaxOutputLength     int    `json:"maxOutputLength,omitempty"`     // Maximum length of an output header value, longer values are truncated (default: 256)
+	TruncatedHeaderName string `json:"truncatedHeaderName,omitempty"` // Header set to "yes" when an output value was truncated (e.g., "X-Real-IP-Truncated")
+
+	InvalidOutputPlaceholder string `json:"invalidOutputPlaceholder,omitempty"` // Written instead of resolved values with characters an IP cannot have (default: none, the IP is unresolved)
+
+	// Failure handling
+	FailureMode string `json:"failureMode,omitempty"` // What happens when processing fails: "open" (continue degraded, default) or "closed" (reject with 503)
+
+	// Diagnostics
+	DumpPath string `json:"dumpPath,omitempty"` // Request path that, from trusted sources, logs Stats() and the effective configuration
+
+	InspectPath string `json:"inspectPath,omitempty"` // Request path answered with a JSON description of how the request itself is resolved (e.g., "/__realip")
+
+	VersionHeaderName       string `json:"versionHeaderName,omitempty"`       // Header receiving the version stamp on requests of trusted sources (e.g., "X-RealIP-Version")
+	VersionHeaderSampleRate int    `json:"versionHeaderSampleRate,omitempty"` // Stamp the version on one request in versionHeaderSampleRate (default: 1 = every request)
+
+	Debug           bool `json:"debug,omitempty"`           // Log the evaluated headers, candidates, depth selection, trust verdict and decision of each request
+	DebugSampleRate int  `json:"debugSampleRate,omitempty"` // Log one request in debugSampleRate (default: 1 = every request)
+
+	DecisionLogLevel      string   `json:"decisionLogLevel,omitempty"`      // Write a JSON line per decision: "off" (default), "info" for every decision or "warn" for rejections and failures
+	DecisionLogFields     []string `json:"decisionLogFields,omitempty"`     // Fields of decision log lines (default: time, level, remoteAddr, realIP, source, trusted, decision)
+	DecisionLogSampleRate int      `json:"decisionLogSampleRate,omitempty"` // Log one decision in decisionLogSampleRate (default: 1 = every decision)
+
+	AnomalyLog          bool `json:"anomalyLog,omitempty"`          // Log spoof attempts, invalid tokens, out-of-bounds depths, unparseable RemoteAddr and trust lookup failures
+	AnomalyLogRateLimit int  `json:"anomalyLogRateLimit,omitempty"` // Anomaly lines logged per minute at most (default: 60)
+
+	MetricsLogInterval int `json:"metricsLogInterval,omitempty"` // Seconds between metrics log lines carrying Stats() (0 = none)
+	MetricsLogRequests int `json:"metricsLogRequests,omitempty"` // Requests between metrics log lines (0 = none)
+
+	RequestIDHeaders []string `json:"requestIDHeaders,omitempty"` // Headers carrying a request ID included in log lines, first present wins (e.g., "X-Request-ID", "Cf-Ray", "traceparent")
+
+	ResponseDebugHeader string `json:"responseDebugHeader,omitempty"` // Response header echoing the resolved IP, trust verdict and source to the client (e.g., "X-RealIP-Debug")
+
+	// Hashed output
+	HashedHeaderName string `json:"hashedHeaderName,omitempty"` // Header receiving the HMAC-SHA256 of the real IP (e.g., "X-Real-IP-Hash")
+	HashKey          string `json:"hashKey,omitempty"`          // Secret HMAC key (redacted in diagnostic dumps)
+	HashOnly         bool   `json:"hashOnly,omitempty"`         // Emit only the hash; the raw IP header is removed from the request
+
+	// Signed output
+	SignatureHeaderName string `json:"signatureHeaderName,omitempty"` // Header receiving a timestamped HMAC-SHA256 signature of headerName's value (e.g., "X-Real-IP-Signature")
+	SignatureKey        string `json:"signatureKey,omitempty"`        // Secret HMAC key shared with downstream services (redacted in diagnostic dumps)
+
+	// Token introspection
+	IntrospectionURL          string `json:"introspectionURL,omitempty"`          // RFC 7662 endpoint resolving Bearer tokens of trusted requests
+	IntrospectionClientID     string `json:"introspectionClientID,omitempty"`     // Client ID for HTTP basic authentication at the endpoint
+	IntrospectionClientSecret string `json:"introspectionClientSecret,omitempty"` // Client secret (redacted in diagnostic dumps)
+	IntrospectionTimeout      int    `json:"introspectionTimeout,omitempty"`      // Milliseconds before an introspection call is abandoned (default: 500)
+	IntrospectionCacheTTL     int    `json:"introspectionCacheTTL,omitempty"`     // Seconds to cache introspection results per token (default: 60)
+	TokenClientIPHeaderName   string `json:"tokenClientIPHeaderName,omitempty"`   // Header receiving the token's client_ip (e.g., "X-Token-Client-IP")
+
+	// Spoofing detection
+	StripSpoofedHeaders bool   `json:"stripSpoofedHeaders,omitempty"` // Delete headerName and processed headers sent by untrusted sources
+	SpoofHeaderName     string `json:"spoofHeaderName,omitempty"`     // Header set to "yes" when an untrusted source sends them (e.g., "X-Spoof-Attempt")
+
+	SanitizeHeaders   []string `json:"sanitizeHeaders,omitempty"`   // Headers deleted from requests of untrusted sources (e.g., "CF-IPCountry", "True-Client-IP")
+	StripKnownHeaders bool     `json:"stripKnownHeaders,omitempty"` // Delete every well-known client-IP header (X-Real-IP, CF-Connecting-IP, Forwarded, ...) from requests of untrusted sources
+
+	// Cross-checking headers
+	Consensus            string   `json:"consensus,omitempty"`            // What happens when processed headers disagree on the client IP: "off" (default), "flag" or "reject"
+	ConsensusHeaders     []string `json:"consensusHeaders,omitempty"`     // processHeaders entries compared (default: all but clientAddress)
+	ConsistentHeaderName string   `json:"consistentHeaderName,omitempty"` // Header set to "yes" or "no" by the comparison (default: "X-Real-IP-Consistent")
+
+	ResolvedProxyCheck      string `json:"resolvedProxyCheck,omitempty"`      // What happens when the resolved IP is in the trusted ranges: "off" (default), "flag" (log) or "correct" (keep walking left)
+	ResolvedProxyHeaderName string `json:"resolvedProxyHeaderName,omitempty"` // Header set to "yes" or "no" by the resolved proxy check (e.g., "X-Real-IP-Is-Proxy")
+
+	ConflictPolicy string `json:"conflictPolicy,omitempty"` // What happens when source headers resolve to different IPs: "prefer-first" (default), "ignore" them all or "reject"
+
+	ChainValidation      string `json:"chainValidation,omitempty"`      // What happens when X-Forwarded-For does not end with the connecting address: "off" (default), "flag" or "reject"
+	ChainValidHeaderName string `json:"chainValidHeaderName,omitempty"` // Header set to "yes" or "no" by chain validation (default: "X-Chain-Valid")
+
+	ExpectedHops        ExpectedHops `json:"expectedHops,omitempty"`        // Bounds on the number of X-Forwarded-For entries of a known topology (e.g., min 2, max 2 for CDN + LB)
+	ExpectedHopsAction  string       `json:"expectedHopsAction,omitempty"`  // What happens to requests outside the bounds: "flag" (default) or "reject"
+	HopsValidHeaderName string       `json:"hopsValidHeaderName,omitempty"` // Header set to "yes" or "no" by the hop count check (default: "X-Hops-Valid")
+
+	// Host consistency
+	HostMismatchHeaderName string `json:"hostMismatchHeaderName,omitempty"` // Header set to "yes" when the Host is an IP literal other than the real IP and outside the trusted ranges (e.g., "X-Host-Mismatch")
+
+	// Header rename migration
+	LegacyHeaderNames       []string `json:"legacyHeaderNames,omitempty"`       // Headers receiving the same value as headerName while backends migrate
+	LegacyHeaderNamesExpiry string   `json:"legacyHeaderNamesExpiry,omitempty"` // Date (YYYY-MM-DD) after which legacy writes are logged and counted as overdue
+
+	// Anonymization
+	Anonymize           bool `json:"anonymize,omitempty"`           // Mask the low bits of the emitted IP (headerName, rewritten X-Forwarded-For and RemoteAddr)
+	AnonymizeIPv4Prefix int  `json:"anonymizeIPv4Prefix,omitempty"` // Leading bits kept for IPv4 addresses (default: 24)
+	AnonymizeIPv6Prefix int  `json:"anonymizeIPv6Prefix,omitempty"` // Leading bits kept for IPv6 addresses (default: 48)
+
+	// Enforcement
+	DenyIPs        []string `json:"denyIPs,omitempty"`        // CIDR blocks whose real IPs are rejected
+	AllowOnlyIPs   []string `json:"allowOnlyIPs,omitempty"`   // CIDR blocks outside of which real IPs are rejected
+	DenyStatusCode int      `json:"denyStatusCode,omitempty"` // Status returned to requests rejected by denyIPs or allowOnlyIPs (default: 403)
+
+	BlockedCountries  []string `json:"blockedCountries,omitempty"`  // ISO country codes whose real IPs are rejected (requires geoIPDatabase)
+	AllowedCountries  []string `json:"allowedCountries,omitempty"`  // ISO country codes outside of which real IPs are rejected (requires geoIPDatabase)
+	CountryStatusCode int      `json:"countryStatusCode,omitempty"` // Status returned to requests rejected only by the country rules (default: 403)
+	CountryRejectBody string   `json:"countryRejectBody,omitempty"` // Body returned to requests rejected only by the country rules (default: the status text)
+
+	RejectReasonHeaderName string `json:"rejectReasonHeaderName,omitempty"` // Response header listing the reason codes of every rule that rejected the request (e.g., "X-Reject-Reason")
+
+	// Enforcement exemptions
+	ExemptPaths  []string `json:"exemptPaths,omitempty"`  // Path prefixes never rejected by enforcement features (the ACME challenge path is always exempt)
+	EnforceMatch Match    `json:"enforceMatch,omitempty"` // Requests enforcement features apply to (default: all); others are only enriched
+
+	// Sharding hint
+	ShardHeaderName string `json:"shardHeaderName,omitempty"` // Header receiving a stable shard number derived from the real IP (e.g., "X-Client-Shard")
+	ShardCount      int    `json:"shardCount,omitempty"`      // Number of shards (required with shardHeaderName)
+
+	// IP tags
+	IPTags           map[string][]string `json:"ipTags,omitempty"`           // Label -> CIDR blocks, single IPs or ranges; the labels whose ranges contain the real IP are written to ipTagsHeaderName
+	IPTagsHeaderName string              `json:"ipTagsHeaderName,omitempty"` // Header receiving the matching labels, comma-separated in alphabetical order (default: "X-IP-Tags")
+
+	// Remote IP lists
+	RemoteIPLists         []RemoteIPList `json:"remoteIPLists,omitempty"`         // Lists downloaded and refreshed periodically, tagging the real IPs they contain in ipTagsHeaderName or trusting their sources
+	RemoteIPListsCacheDir string         `json:"remoteIPListsCacheDir,omitempty"` // Directory keeping the last successful download of each list, loaded at startup when the download fails ("" = no cache)
+
+	// Conditional outputs
+	OutputConditions map[string]string `json:"outputConditions,omitempty"` // Output header name -> comma-separated conditions (trusted, untrusted, resolved, conflict)
+}
+
+// CreateConfig creates the default plugin configuration.
+func CreateConfig() *Config {
+	return &Config{
+		Enabled:                true,
+		HeaderName:             "X-Real-IP",
+		SyntheticHeaderName:    defaultSyntheticHeaderName,
+		DisableSyntheticHeader: false,
+
+		DefaultDepth:        0,
+		ForceOverwrite:      true,
+		HeaderInstances:     headerInstancesJoin,
+		Fallback:            fallbackEmpty,
+		ZoneIdentifiers:     zoneIdentifiersStrip,
+		ExoticIPv4:          exoticIPv4Allow,
+		AlreadyProcessed:    alreadyProcessedReprocess,
+		RewriteForwardedFor: false,
+		AppendForwardedFor:  false,
+		RewriteRemoteAddr:   false,
+		PreserveOriginal:    false,
+		TrustAll:            true,       // Default: trust all (backward compatibility)
+		TrustedIPs:          []string{}, // Empty by default
+		TrustedHeader:       "",         // Empty by default (no trust header)
+
+		TrustedHeaderValues: map[string]string{},
+
+		AllowReservedHeaderNames: false,
+		StrictRanges:             false,
+
+		TrustLoopbackAlways: false,
+		RequireTrustedChain: false,
+
+		RequireTLS:       false,
+		RequireTLSAction: requireTLSUntrust,
+
+		TrustTiers: []TrustTier{},
+
+		TrustedIPsFile:                "",
+		TrustedIPsFileRefreshInterval: 10,
+		TrustedIPsFileGracePeriod:     0,
+
+		TrustCacheTTL:  0,
+		TrustCacheSize: defaultTrustCacheSize,
+
+		ReplayHeaderName: "",
+		ReplayWindow:     10,
+		ReplayThreshold:  3,
+
+		GeoIPDatabase:            "",
+		GeoIPLanguage:            "en",
+		GeoCountryCodeHeaderName: "X-Real-IP-Country-Code",
+		GeoCountryHeaderName:     "X-Real-IP-Country",
+		GeoCityHeaderName:        "X-Real-IP-City",
+
+		GeoPassthroughHeaders: []string{},
+
+		ASNDatabase:     "",
+		ASNHeaderName:   "X-Real-IP-ASN",
+		ASOrgHeaderName: "X-Real-IP-AS-Org",
+
+		MaxChainLength:   defaultMaxChainLength,
+		MaxHeaderLength:  defaultMaxHeaderLength,
+		OversizedHeaders: oversizedHeaderSkip,
+		StrictMode:       false,
+
+		MaxOutputLength:     defaultMaxOutputLength,
+		TruncatedHeaderName: "",
+
+		InvalidOutputPlaceholder: "",
+
+		FailureMode: failureModeOpen,
+
+		DumpPath: "",
+
+		InspectPath: "",
+
+		VersionHeaderName:       "",
+		VersionHeaderSampleRate: 1,
+
+		Debug:           false,
+		DebugSampleRate: 1,
+
+		DecisionLogLevel:      decisionLogOff,
+		DecisionLogFields:     []string{},
+		DecisionLogSampleRate: 1,
+
+		AnomalyLog:          false,
+		AnomalyLogRateLimit: defaultAnomalyLogRateLimit,
+
+		MetricsLogInterval: 0,
+		MetricsLogRequests: 0,
+
+		RequestIDHeaders: []string{},
+
+		ResponseDebugHeader: "",
+
+		HashedHeaderName: "",
+		HashKey:          "",
+		HashOnly:         false,
+
+		SignatureHeaderName: "",
+		SignatureKey:        "",
+
+		IntrospectionURL:          "",
+		IntrospectionClientID:     "",
+		IntrospectionClientSecret: "",
+		IntrospectionTimeout:      500,
+		IntrospectionCacheTTL:     60,
+		TokenClientIPHeaderName:   "X-Token-Client-IP",
+
+		StripSpoofedHeaders: false,
+		SpoofHeaderName:     "",
+
+		SanitizeHeaders: []string{},
+
+		Consensus:            consensusOff,
+		ConsensusHeaders:     []string{},
+		ConsistentHeaderName: "X-Real-IP-Consistent",
+
+		ResolvedProxyCheck:      resolvedProxyOff,
+		ResolvedProxyHeaderName: "",
+
+		ConflictPolicy: conflictPreferFirst,
+
+		ChainValidation:      chainValidationOff,
+		ChainValidHeaderName: "X-Chain-Valid",
+
+		ExpectedHops:        ExpectedHops{},
+		ExpectedHopsAction:  expectedHopsFlag,
+		HopsValidHeaderName: "X-Hops-Valid",
+
+		LegacyHeaderNames:       []string{},
+		LegacyHeaderNamesExpiry: "",
+
+		Anonymize:           false,
+		AnonymizeIPv4Prefix: 24,
+		AnonymizeIPv6Prefix: 48,
+
+		DenyIPs:        []string{},
+		AllowOnlyIPs:   []string{},
+		DenyStatusCode: http.StatusForbidden,
+
+		BlockedCountries:  []string{},
+		AllowedCountries:  []string{},
+		CountryStatusCode: http.StatusForbidden,
+		CountryRejectBody: "",
+
+		ExemptPaths: []string{},
+
+		ShardHeaderName: "",
+		ShardCount:      0,
+
+		IPTags:           map[string][]string{},
+		IPTagsHeaderName: "X-IP-Tags",
+
+		RemoteIPLists:         []RemoteIPList{},
+		RemoteIPListsCacheDir: "",
+
+		OutputConditions: map[string]string{},
+	}
+}
+
+// Resolver is the resolution core: it decides whether a request comes from a trusted source,
+// resolves its real IP and writes the output headers. It does not depend on http.Handler
+// chaining, so provider-style plugins and forwardAuth services can use it directly;
+// Plugin adapts it to the middleware interface.
+type Resolver struct {
+	name                string
+	enabled             bool
+	match               *requestMatcher // Requests processed, nil for all
+	headerName          string
+	processHeaders      []HeaderConfig
+	depths              []int     // Parsed depth of each processed header
+	untrustedDepths     []int     // Offset left of the rightmost untrusted entry per processed header (-1 = by depth), nil when unused
+	families            []string  // IP family of each processed header
+	weights             []float64 // Weight of each processed header
+	forceOverwrite      bool
+	headerInstances     string
+	fallback            string
+	zoneIdentifiers     string
+	exoticIPv4          string
+	sourceHeaderName    string
+	portHeaderName      string
+	chainHeaderName     string
+	rewriteForwardedFor bool
+	appendForwardedFor  bool
+	rewriteRemoteAddr   bool
+	preserveOriginal    bool
+	trustAll            bool
+	trustedIPs          *IpLookupHelper
+	trustedHeader       string
+	trustedValues       trustedHeaderValues
+
+	syntheticHeaderName string // processHeaders name mapped to the connection address, "" when disabled
+
+	trustLoopbackAlways bool
+	requireTrustedChain bool
+
+	requireTLS       bool
+	requireTLSAction string
+
+	trustTiers     []*trustTier
+	trustedIPsFile *cidrFileWatcher
+	trustCache     *trustCache
+	headerTrusts   []*headerTrust // Per-header trust overrides, parallel to processHeaders (nil when none)
+	sharedSecret   *sharedSecret
+	certTrust      *certTrust
+
+	replayHeaderName string
+	replayDetector   *replayDetector
+
+	geoIP                 *geoIPEnricher
+	geoPassthroughHeaders []string
+	asn                   *asnEnricher
+
+	hashedHeaderName string
+	hasher           *ipHasher
+	hashOnly         bool
+
+	signatureHeaderName string
+	signer              *ipSigner
+
+	introspector            *tokenIntrospector
+	tokenClientIPHeaderName string
+
+	stripSpoofedHeaders bool
+	spoofHeaderName     string
+	spoofHeaders        []string // Inbound headers checked for spoofing, computed once in NewResolver
+	sanitizeHeaders     []string
+	stripKnownHeaders   bool
+
+	consensus            *consensusCheck // nil when consensus is off
+	consistentHeaderName string
+
+	resolvedProxyCheck      string
+	resolvedProxyHeaderName string
+	resolvedProxyLog        *anomalyLogger
+
+	conflictPolicy string
+
+	collectCandidates bool // Whether resolution records the entry of every header, for conflicts, consensus and target headers
+
+	chainValidation      string
+	chainValidHeaderName string
+
+	hopCheck            *hopCheck // nil unless expectedHops is set
+	hopsValidHeaderName string
+
+	hostMismatchHeaderName string
+
+	alreadyProcessed      string
+	processedMarkerHeader string
+
+	embeddedIPv4HeaderName string
+	ipv4HeaderName         string
+	ipClassHeaderName      string
+	confidenceHeaderName   string
+
+	auditHeaderName string
+
+	legacyHeaderNames []string
+	legacyExpiry      time.Time // Zero when no expiry is configured
+	lastLegacyWarning int64     // Unix nanoseconds of the last overdue warning, accessed atomically
+
+	anonymizer *ipAnonymizer
+
+	denyIPs        *IpLookupHelper
+	allowOnlyIPs   *IpLookupHelper
+	denyStatusCode int
+	countries      *countryRules
+
+	rejectReasonHeaderName string
+
+	exemptPaths  []string
+	enforceMatch *requestMatcher // Requests enforcement applies to, nil for all
+
+	shardHeaderName string
+	shardCount      int
+
+	ipTags           []ipTag // Labels of ipTags in alphabetical order
+	ipTagsHeaderName string
+	remoteLists      []*remoteList
+
+	outputConditions *outputConditions
+	outputHeaders    []string // Every configured output header name
+
+	maxChainLength   int
+	maxHeaderLength  int
+	oversizedHeaders string
+	strictMode       bool
+
+	maxOutputLength     int
+	truncatedHeaderName string
+
+	invalidOutputPlaceholder string
+
+	failClosed bool
+	faults     faultInjector
+
+	config   Config // Configuration the instance was created with, for diagnostics
+	dumpPath string
+
+	inspectPath string
+
+	versionHeaderName string
+	versionSampler    *sampler
+
+	responseDebugHeader string
+	requestIDHeaders    []string
+
+	debugSampler *sampler        // nil unless debug is enabled
+	decisionLog  *decisionLogger // nil unless the decision log is enabled
+	metricsLog   *metricsLogger  // nil unless metrics log lines are enabled
+	anomalyLog   *anomalyLogger  // nil unless anomalies are logged
+	stats        statsCounters
+	lastDump     int64 // Unix nanoseconds of the last diagnostic dump, accessed atomically
+}
+
+// Plugin is the middleware adapter of Resolver.
+type Plugin struct {
+	*Resolver
+	next http.Handler
+}
+
+// New creates a new plugin instance.
+func New(ctx context.Context, next http.Handler, cfg *Config, name string) (http.Handler, error) {
+	if next == nil {
+		return nil, fmt.Errorf("%s: no next handler provided", name)
+	}
+
+	resolver, err := NewResolver(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plugin{Resolver: resolver, next: next}, nil
+}
+
+// NewResolver creates the resolution core for cfg, validating it as New does. The resolver
+// downloads its remote IP lists in the background and keeps refreshing them, so create it
+// once and reuse it.
+func NewResolver(cfg *Config, name string) (*Resolver, error) {
+	resolver, err := newResolver(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start downloading the remote IP lists in the background; they are then refreshed periodically
+	for _, list := range resolver.remoteLists {
+		list.start(time.Now())
+	}
+	return resolver, nil
+}
+
+// newResolver is NewResolver without starting any background work: remote IP lists are
+// left empty until start or startOffline is called on them
+func newResolver(cfg *Config, name string) (*Resolver, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("%s: no config provided", name)
+	}
+
+	// Validate the settings that do not depend on each other, reporting all their problems at once
+	var problems configErrors
+
+	// A profile fills in the settings left at their defaults
+	cfg, err := applyProfile(name, cfg)
+	problems.add(err)
+	if cfg.Enabled && cfg.HeaderName == "" {
+		problems.add(fmt.Errorf("%s: headerName cannot be empty when plugin is enabled", name))
+	}
+
+	// processHeaders entries are objects or plain header names; the parsed list replaces them
+	processHeaders, err := parseProcessHeaders(name, cfg.ProcessHeaders)
+	problems.add(err)
+	if err == nil {
+		parsed := *cfg
+		parsed.ProcessHeaders = processHeaders
+		cfg = &parsed
+		if cfg.Enabled && len(processHeaders) == 0 {
+			problems.add(fmt.Errorf("%s: processHeaders cannot be empty when plugin is enabled", name))
+		}
+	}
+
+	syntheticHeaderName, err := parseSyntheticHeaderName(name, cfg.SyntheticHeaderName, cfg.DisableSyntheticHeader)
+	problems.add(err)
+
+	// An invalid defaultDepth is reported once rather than for every header omitting its depth
+	defaultDepth := cfg.DefaultDepth
+	if err := parseDefaultDepth(name, defaultDepth); err != nil {
+		problems.add(err)
+		defaultDepth = nil
+	}
+
+	depths, err := parseDepths(name, processHeaders, defaultDepth, syntheticHeaderName)
+	problems.add(err)
+
+	untrustedDepths, err := parseUntrustedDepths(name, processHeaders, defaultDepth, syntheticHeaderName)
+	problems.add(err)
+
+	families, err := parseFamilies(name, processHeaders)
+	problems.add(err)
+
+	weights, err := parseWeights(name, processHeaders)
+	problems.add(err)
+
+	problems.add(validateTargets(name, cfg.HeaderName, processHeaders))
+	problems.add(validateSyntheticSources(name, processHeaders, syntheticHeaderName))
+
+	headerInstances, err := parseHeaderInstances(name, cfg.HeaderInstances)
+	problems.add(err)
+
+	fallback, err := parseFallback(name, cfg.Fallback)
+	problems.add(err)
+
+	zoneIdentifiers, err := parseZoneIdentifiers(name, cfg.ZoneIdentifiers)
+	problems.add(err)
+
+	exoticIPv4, err := parseExoticIPv4Mode(name, cfg.ExoticIPv4)
+	problems.add(err)
+
+	alreadyProcessed, err := parseAlreadyProcessed(name, cfg.AlreadyProcessed)
+	problems.add(err)
+
+	// Refuse output headers that would corrupt proxying
+	outputs := []struct{ field, value string }{
+		{"headerName", cfg.HeaderName},
+		{"trustedHeader", cfg.TrustedHeader},
+		{"sourceHeaderName", cfg.SourceHeaderName},
+		{"portHeaderName", cfg.PortHeaderName},
+		{"chainHeaderName", cfg.ChainHeaderName},
+		{"embeddedIPv4HeaderName", cfg.EmbeddedIPv4HeaderName},
+		{"processedMarkerHeader", cfg.ProcessedMarkerHeader},
+		{"consistentHeaderName", cfg.ConsistentHeaderName},
+		{"resolvedProxyHeaderName", cfg.ResolvedProxyHeaderName},
+		{"chainValidHeaderName", cfg.ChainValidHeaderName},
+		{"hopsValidHeaderName", cfg.HopsValidHeaderName},
+		{"ipv4HeaderName", cfg.IPv4HeaderName},
+		{"ipClassHeaderName", cfg.IPClassHeaderName},
+		{"confidenceHeaderName", cfg.ConfidenceHeaderName},
+		{"auditHeaderName", cfg.AuditHeaderName},
+		{"replayHeaderName", cfg.ReplayHeaderName},
+		{"geoCountryCodeHeaderName", cfg.GeoCountryCodeHeaderName},
+		{"geoCountryHeaderName", cfg.GeoCountryHeaderName},
+		{"geoCityHeaderName", cfg.GeoCityHeaderName},
+		{"asnHeaderName", cfg.ASNHeaderName},
+		{"asOrgHeaderName", cfg.ASOrgHeaderName},
+		{"hashedHeaderName", cfg.HashedHeaderName},
+		{"signatureHeaderName", cfg.SignatureHeaderName},
+		{"spoofHeaderName", cfg.SpoofHeaderName},
+		{"hostMismatchHeaderName", cfg.HostMismatchHeaderName},
+		{"tokenClientIPHeaderName", cfg.TokenClientIPHeaderName},
+		{"shardHeaderName", cfg.ShardHeaderName},
+		{"ipTagsHeaderName", cfg.IPTagsHeaderName},
+		{"truncatedHeaderName", cfg.TruncatedHeaderName},
+		{"versionHeaderName", cfg.VersionHeaderName},
+	}
+	for i, legacyHeaderName := range cfg.LegacyHeaderNames {
+		outputs = append(outputs, struct{ field, value string }{fmt.Sprintf("legacyHeaderNames[%d]", i), legacyHeaderName})
+	}
+	for i, headerConfig := range processHeaders {
+		if headerConfig.TargetHeaderName != "" {
+			outputs = append(outputs, struct{ field, value string }{fmt.Sprintf("processHeaders[%d].targetHeaderName", i), headerConfig.TargetHeaderName})
+		}
+	}
+	if cfg.Enabled {
+		for _, output := range outputs {
+			problems.add(validateOutputHeaderName(name, output.field, output.value, cfg.AllowReservedHeaderNames))
+		}
+	}
+
+	// The hash is only meaningful with a secret key, and hashOnly needs somewhere to put the hash
+	if cfg.HashedHeaderName != "" && cfg.HashKey == "" {
+		problems.add(fmt.Errorf("%s: hashKey cannot be empty when hashedHeaderName is set", name))
+	}
+	if cfg.HashOnly && cfg.HashedHeaderName == "" {
+		problems.add(fmt.Errorf("%s: hashedHeaderName cannot be empty when hashOnly is enabled", name))
+	}
+
+	var signer *ipSigner
+	if cfg.SignatureHeaderName != "" {
+		if cfg.SignatureKey == "" {
+			problems.add(fmt.Errorf("%s: signatureKey cannot be empty when signatureHeaderName is set", name))
+		}
+		if cfg.HashOnly {
+			problems.add(fmt.Errorf("%s: signatureHeaderName cannot be used with hashOnly, which removes the signed header", name))
+		}
+		signer = newIPSigner(cfg.SignatureKey)
+	}
+
+	if cfg.ShardHeaderName != "" && cfg.ShardCount <= 0 {
+		problems.add(fmt.Errorf("%s: shardCount must be positive when shardHeaderName is set", name))
+	}
+
+	var hasher *ipHasher
+	if cfg.HashedHeaderName != "" {
+		hasher = newIPHasher(cfg.HashKey)
+	}
+
+	// Real IPs in the deny list are rejected
+	var denyIPs *IpLookupHelper
+	if cfg.Enabled && len(cfg.DenyIPs) > 0 {
+		denyIPs, err = parseCIDRList(name, "denyIPs", cfg.DenyIPs)
+		problems.add(err)
+	}
+
+	// Only real IPs in the allow list are let through
+	var allowOnlyIPs *IpLookupHelper
+	if cfg.Enabled && len(cfg.AllowOnlyIPs) > 0 {
+		allowOnlyIPs, err = parseCIDRList(name, "allowOnlyIPs", cfg.AllowOnlyIPs)
+		problems.add(err)
+	}
+
+	// Initialize trusted IPs lookup helper
+	var trustedIPs *IpLookupHelper
+	if !cfg.TrustAll && len(cfg.TrustedIPs) > 0 {
+		trustedIPs, err = parseCIDRList(name, "trustedIPs", cfg.TrustedIPs)
+		problems.add(err)
+	}
+
+	// Real IPs are labeled with the ipTags ranges containing them
+	var ipTags []ipTag
+	if cfg.Enabled {
+		ipTags, err = newIPTags(name, cfg.IPTags, cfg.IPTagsHeaderName)
+		problems.add(err)
+	}
+
+	// Remote IP lists are validated here and downloaded once the rest of the configuration is
+	var remoteLists []*remoteList
+	if cfg.Enabled {
+		remoteLists, err = newRemoteLists(name, cfg.RemoteIPLists, cfg.IPTagsHeaderName, cfg.RemoteIPListsCacheDir)
+		problems.add(err)
+	}
+
+	denyStatusCode := cfg.DenyStatusCode
+	if denyStatusCode == 0 {
+		denyStatusCode = defaultDenyStatusCode
+	}
+	if denyStatusCode < 400 || denyStatusCode > 599 {
+		problems.add(fmt.Errorf("%s: denyStatusCode must be a 4xx or 5xx status, got %d", name, denyStatusCode))
+	}
+
+	// Paths that enforcement features must never reject
+	exemptPaths, err := newExemptPaths(name, cfg.ExemptPaths)
+	problems.add(err)
+
+	// Requests the plugin, and its enforcement features, are limited to
+	match, err := newRequestMatcher(name, "match", cfg.Match)
+	problems.add(err)
+	enforceMatch, err := newRequestMatcher(name, "enforceMatch", cfg.EnforceMatch)
+	problems.add(err)
+
+	// Legacy header names are dual-written until their expiry date
+	var legacyExpiry time.Time
+	if cfg.LegacyHeaderNamesExpiry != "" {
+		legacyExpiry, err = time.Parse("2006-01-02", cfg.LegacyHeaderNamesExpiry)
+		if err != nil {
+			problems.add(fmt.Errorf("%s: legacyHeaderNamesExpiry must be a date in YYYY-MM-DD format: %w", name, err))
+		}
+	}
+
+	// Anonymization masks the emitted IP down to the configured prefixes
+	var anonymizer *ipAnonymizer
+	if cfg.Anonymize {
+		anonymizer, err = newIPAnonymizer(name, cfg.AnonymizeIPv4Prefix, cfg.AnonymizeIPv6Prefix)
+		problems.add(err)
+	}
+
+	// Token introspection resolves the end-user IP machine-to-machine callers act for
+	var introspector *tokenIntrospector
+	if cfg.Enabled && cfg.IntrospectionURL != "" {
+		if cfg.TokenClientIPHeaderName == "" {
+			problems.add(fmt.Errorf("%s: tokenClientIPHeaderName cannot be empty when introspectionURL is set", name))
+		}
+		introspector, err = newTokenIntrospector(cfg.IntrospectionURL, cfg.IntrospectionClientID, cfg.IntrospectionClientSecret,
+			time.Duration(cfg.IntrospectionTimeout)*time.Millisecond, time.Duration(cfg.IntrospectionCacheTTL)*time.Second)
+		if err != nil {
+			problems.add(fmt.Errorf("%s: invalid introspectionURL: %w", name, err))
+		}
+	}
+
+	// Parse the conditions restricting when output headers are emitted
+	outputHeaders := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		if output.value != "" {
+			outputHeaders = append(outputHeaders, output.value)
+		}
+	}
+	var conditions *outputConditions
+	if cfg.Enabled {
+		var err error
+		conditions, err = newOutputConditions(name, cfg.OutputConditions, outputHeaders)
+		problems.add(err)
+	}
+
+	if cfg.MaxChainLength < 0 {
+		problems.add(fmt.Errorf("%s: maxChainLength cannot be negative", name))
+	}
+	maxChainLength := cfg.MaxChainLength
+	if maxChainLength == 0 {
+		maxChainLength = defaultMaxChainLength
+	}
+
+	if cfg.MaxHeaderLength < 0 {
+		problems.add(fmt.Errorf("%s: maxHeaderLength cannot be negative", name))
+	}
+	maxHeaderLength := cfg.MaxHeaderLength
+	if maxHeaderLength == 0 {
+		maxHeaderLength = defaultMaxHeaderLength
+	}
+	oversizedHeaders, err := parseOversizedHeaders(name, cfg.OversizedHeaders)
+	problems.add(err)
+
+	if cfg.MaxOutputLength < 0 {
+		problems.add(fmt.Errorf("%s: maxOutputLength cannot be negative", name))
+	}
+	maxOutputLength := cfg.MaxOutputLength
+	if maxOutputLength == 0 {
+		maxOutputLength = defaultMaxOutputLength
+	}
+
+	problems.add(validatePlaceholder(name, cfg.InvalidOutputPlaceholder))
+
+	problems.add(validateFailureMode(name, cfg.FailureMode))
+
+	if cfg.TrustedIPsFileGracePeriod < 0 {
+		problems.add(fmt.Errorf("%s: trustedIPsFileGracePeriod cannot be negative", name))
+	}
+
+	if cfg.TrustCacheTTL < 0 {
+		problems.add(fmt.Errorf("%s: trustCacheTTL cannot be negative", name))
+	}
+
+	if cfg.TrustCacheSize < 0 {
+		problems.add(fmt.Errorf("%s: trustCacheSize cannot be negative", name))
+	}
+
+	if cfg.VersionHeaderSampleRate < 0 {
+		problems.add(fmt.Errorf("%s: versionHeaderSampleRate cannot be negative", name))
+	}
+
+	decisionLog, err := newDecisionLogger(name, cfg.DecisionLogLevel, cfg.DecisionLogFields, cfg.DecisionLogSampleRate)
+	problems.add(err)
+
+	anomalyLog, err := newAnomalyLogger(name, cfg.AnomalyLogRateLimit)
+	problems.add(err)
+
+	if cfg.MetricsLogInterval < 0 || cfg.MetricsLogRequests < 0 {
+		problems.add(fmt.Errorf("%s: metricsLogInterval and metricsLogRequests cannot be negative", name))
+	}
+
+	if cfg.DebugSampleRate < 0 {
+		problems.add(fmt.Errorf("%s: debugSampleRate cannot be negative", name))
+	}
+
+	if cfg.ReplayHeaderName != "" && (cfg.ReplayWindow < 0 || cfg.ReplayThreshold < 0) {
+		problems.add(fmt.Errorf("%s: replayWindow and replayThreshold cannot be negative", name))
+	}
+
+	// Requests carrying the pre-shared secret are trusted whatever their source IP
+	secret, err := newSharedSecret(name, cfg.TrustedSecretHeader, cfg.TrustedSecretValue)
+	problems.add(err)
+
+	// Requests presenting a client certificate with a trusted name are trusted whatever their source IP
+	clientCertTrust, err := newCertTrust(name, cfg.TrustedClientCertNames, cfg.TrustedClientCertInfoHeader, cfg.TrustedClientCertInfoSources)
+	problems.add(err)
+
+	// Named tiers of trusted sources
+	trustTiers, err := newTrustTiers(name, cfg.TrustTiers, processHeaders)
+	problems.add(err)
+
+	// Validate trust configuration - if trustAll is false, trustedIPs (or trustedIPsFile) must be provided
+	// (unless loopback sources are always trusted, a shared secret or client certificates are trusted, tiers are configured
+	// or a remote IP list is trusted). The settings are checked rather than what was parsed from them, so a
+	// setting that failed to parse above is not reported a second time here.
+	trustSources := cfg.TrustedSecretHeader != "" || cfg.TrustedSecretValue != "" || len(cfg.TrustedClientCertNames) > 0 || len(cfg.TrustTiers) > 0 || anyTrusted(remoteLists)
+	if cfg.Enabled && !cfg.TrustAll && len(cfg.TrustedIPs) == 0 && cfg.TrustedIPsFile == "" && !cfg.TrustLoopbackAlways && !trustSources {
+		problems.add(fmt.Errorf("%s: trustedIPs cannot be empty when trustAll is false", name))
+	}
+
+	requireTLSAction, err := parseRequireTLSAction(name, cfg.RequireTLSAction)
+	problems.add(err)
+
+	// With trustAll there are no trusted ranges for the hops to be in
+	if cfg.Enabled && cfg.TrustAll && cfg.RequireTrustedChain {
+		problems.add(fmt.Errorf("%s: requireTrustedChain cannot be used with trustAll", name))
+	}
+
+	// Duplicated and shadowed ranges are usually copy-paste mistakes
+	if cfg.Enabled {
+		problems.add(checkRangeLists(name, cfg))
+	}
+
+	// Values written to trustedHeader for each trust state
+	trustedValues, err := newTrustedHeaderValues(name, cfg.TrustedHeaderValues)
+	problems.add(err)
+
+	// Per-header trust sets replace the global verdict for their header
+	headerTrusts, err := newHeaderTrusts(name, processHeaders, syntheticHeaderName)
+	problems.add(err)
+
+	// Cross-check the IPs several headers yield
+	var consensus *consensusCheck
+	if cfg.Enabled {
+		consensus, err = newConsensusCheck(name, cfg.Consensus, cfg.ConsensusHeaders, processHeaders, syntheticHeaderName, cfg.ConsistentHeaderName)
+		problems.add(err)
+	}
+
+	resolvedProxyCheck, err := parseResolvedProxyCheck(name, cfg.ResolvedProxyCheck, cfg.ResolvedProxyHeaderName)
+	problems.add(err)
+
+	conflictPolicy, err := parseConflictPolicy(name, cfg.ConflictPolicy)
+	problems.add(err)
+
+	chainValidation, err := parseChainValidation(name, cfg.ChainValidation, cfg.ChainValidHeaderName)
+	problems.add(err)
+
+	hopCheck, err := newHopCheck(name, cfg.ExpectedHops, cfg.ExpectedHopsAction, cfg.HopsValidHeaderName)
+	problems.add(err)
+
+	// The echo reveals how the plugin sees every client, so it must be asked for explicitly
+	if cfg.Enabled && cfg.ResponseDebugHeader != "" {
+		problems.add(validateOutputHeaderName(name, "responseDebugHeader", cfg.ResponseDebugHeader, cfg.AllowReservedHeaderNames))
+	}
+
+	// Reject requests by the country of the real IP, looked up in the GeoIP database opened below
+	var countries *countryRules
+	if cfg.Enabled {
+		countries, err = newCountryRules(name, cfg.BlockedCountries, cfg.AllowedCountries, cfg.CountryStatusCode, cfg.CountryRejectBody, cfg.GeoIPDatabase)
+		problems.add(err)
+	}
+
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+
+	// Load the trusted IPs file, which is then polled for changes
+	var trustedIPsFile *cidrFileWatcher
+	if !cfg.TrustAll && cfg.TrustedIPsFile != "" {
+		var err error
+		interval := time.Duration(cfg.TrustedIPsFileRefreshInterval) * time.Second
+		grace := time.Duration(cfg.TrustedIPsFileGracePeriod) * time.Second
+		trustedIPsFile, err = newCIDRFileWatcher(name, cfg.TrustedIPsFile, interval, grace)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to load trusted IPs file: %w", name, err)
+		}
+	}
+
+	// Trust verdicts are only worth caching when they come from a lookup
+	var verdictCache *trustCache
+	if !cfg.TrustAll && cfg.TrustCacheTTL > 0 {
+		verdictCache = newTrustCache(time.Duration(cfg.TrustCacheTTL)*time.Second, cfg.TrustCacheSize)
+	}
+
+	// Replay detection counts identical request tuples in a short window
+	var replay *replayDetector
+	if cfg.ReplayHeaderName != "" {
+		window := time.Duration(cfg.ReplayWindow) * time.Second
+		if window == 0 {
+			window = defaultReplayWindow
+		}
+		threshold := cfg.ReplayThreshold
+		if threshold == 0 {
+			threshold = defaultReplayThreshold
+		}
+		replay = newReplayDetector(window, threshold)
+	}
+
+	// Open the GeoIP database used to enrich requests with the location of the real IP
+	var geoIP *geoIPEnricher
+	if cfg.Enabled && cfg.GeoIPDatabase != "" {
+		var err error
+		geoIP, err = newGeoIPEnricher(cfg.GeoIPDatabase, cfg.GeoIPLanguage, cfg.GeoCountryCodeHeaderName, cfg.GeoCountryHeaderName, cfg.GeoCityHeaderName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to open GeoIP database: %w", name, err)
+		}
+		logf(name, "loaded GeoIP database %s", geoIP)
+	}
+
+	// Open the ASN database used to enrich requests with the network operator of the real IP
+	var asn *asnEnricher
+	if cfg.Enabled && cfg.ASNDatabase != "" {
+		var err error
+		asn, err = newASNEnricher(cfg.ASNDatabase, cfg.ASNHeaderName, cfg.ASOrgHeaderName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to open ASN database: %w", name, err)
+		}
+		logf(name, "loaded ASN database %s", asn)
+	}
+
+	resolver := &Resolver{
+		name:                name,
+		enabled:             cfg.Enabled,
+		match:               match,
+		headerName:          cfg.HeaderName,
+		processHeaders:      processHeaders,
+		depths:              depths,
+		untrustedDepths:     untrustedDepths,
+		families:            families,
+		weights:             weights,
+		forceOverwrite:      cfg.ForceOverwrite,
+		headerInstances:     headerInstances,
+		fallback:            fallback,
+		zoneIdentifiers:     zoneIdentifiers,
+		exoticIPv4:          exoticIPv4,
+		sourceHeaderName:    cfg.SourceHeaderName,
+		portHeaderName:      cfg.PortHeaderName,
+		chainHeaderName:     cfg.ChainHeaderName,
+		rewriteForwardedFor: cfg.RewriteForwardedFor,
+		appendForwardedFor:  cfg.AppendForwardedFor,
+		rewriteRemoteAddr:   cfg.RewriteRemoteAddr,
+		preserveOriginal:    cfg.PreserveOriginal,
+		trustAll:            cfg.TrustAll,
+		trustedIPs:          trustedIPs,
+		trustedHeader:       cfg.TrustedHeader,
+		trustedValues:       trustedValues,
+
+		syntheticHeaderName: syntheticHeaderName,
+
+		trustLoopbackAlways: cfg.TrustLoopbackAlways,
+		requireTrustedChain: cfg.RequireTrustedChain,
+
+		requireTLS:       cfg.RequireTLS,
+		requireTLSAction: requireTLSAction,
+
+		trustTiers:     trustTiers,
+		trustedIPsFile: trustedIPsFile,
+		trustCache:     verdictCache,
+		headerTrusts:   headerTrusts,
+		sharedSecret:   secret,
+		certTrust:      clientCertTrust,
+
+		replayHeaderName: cfg.ReplayHeaderName,
+		replayDetector:   replay,
+
+		geoIP:                 geoIP,
+		geoPassthroughHeaders: cfg.GeoPassthroughHeaders,
+		asn:                   asn,
+
+		hashedHeaderName: cfg.HashedHeaderName,
+		hasher:           hasher,
+		hashOnly:         cfg.HashOnly,
+
+		signatureHeaderName: cfg.SignatureHeaderName,
+		signer:              signer,
+
+		introspector:            introspector,
+		tokenClientIPHeaderName: cfg.TokenClientIPHeaderName,
+
+		stripSpoofedHeaders: cfg.StripSpoofedHeaders,
+		spoofHeaderName:     cfg.SpoofHeaderName,
+		sanitizeHeaders:     cfg.SanitizeHeaders,
+		stripKnownHeaders:   cfg.StripKnownHeaders,
+
+		consensus:            consensus,
+		consistentHeaderName: cfg.ConsistentHeaderName,
+
+		resolvedProxyCheck:      resolvedProxyCheck,
+		resolvedProxyHeaderName: cfg.ResolvedProxyHeaderName,
+		resolvedProxyLog:        &anomalyLogger{limit: defaultAnomalyLogRateLimit},
+
+		conflictPolicy: conflictPolicy,
+
+		chainValidation:      chainValidation,
+		chainValidHeaderName: cfg.ChainValidHeaderName,
+
+		hopCheck:            hopCheck,
+		hopsValidHeaderName: cfg.HopsValidHeaderName,
+
+		hostMismatchHeaderName: cfg.HostMismatchHeaderName,
+
+		alreadyProcessed:      alreadyProcessed,
+		processedMarkerHeader: cfg.ProcessedMarkerHeader,
+
+		embeddedIPv4HeaderName: cfg.EmbeddedIPv4HeaderName,
+		ipv4HeaderName:         cfg.IPv4HeaderName,
+		ipClassHeaderName:      cfg.IPClassHeaderName,
+		confidenceHeaderName:   cfg.ConfidenceHeaderName,
+
+		auditHeaderName: cfg.AuditHeaderName,
+
+		legacyHeaderNames: cfg.LegacyHeaderNames,
+		legacyExpiry:      legacyExpiry,
+
+		anonymizer: anonymizer,
+
+		denyIPs:        denyIPs,
+		allowOnlyIPs:   allowOnlyIPs,
+		denyStatusCode: denyStatusCode,
+		countries:      countries,
+
+		rejectReasonHeaderName: cfg.RejectReasonHeaderName,
+
+		exemptPaths:  exemptPaths,
+		enforceMatch: enforceMatch,
+
+		shardHeaderName: cfg.ShardHeaderName,
+		shardCount:      cfg.ShardCount,
+
+		ipTags:           ipTags,
+		ipTagsHeaderName: cfg.IPTagsHeaderName,
+		remoteLists:      remoteLists,
+
+		outputConditions: conditions,
+		outputHeaders:    outputHeaders,
+
+		maxChainLength:   maxChainLength,
+		maxHeaderLength:  maxHeaderLength,
+		oversizedHeaders: oversizedHeaders,
+		strictMode:       cfg.StrictMode,
+
+		maxOutputLength:     maxOutputLength,
+		truncatedHeaderName: cfg.TruncatedHeaderName,
+
+		invalidOutputPlaceholder: cfg.InvalidOutputPlaceholder,
+
+		failClosed: cfg.FailureMode == failureModeClosed,
+
+		config:   *cfg,
+		dumpPath: cfg.DumpPath,
+
+		inspectPath: cfg.InspectPath,
+	}
+
+	resolver.spoofHeaders = resolver.spoofableHeaders()
+	resolver.collectCandidates = resolver.needsCandidates()
+
+	if cfg.VersionHeaderName != "" {
+		resolver.versionHeaderName = cfg.VersionHeaderName
+		resolver.versionSampler = newSampler(cfg.VersionHeaderSampleRate)
+	}
+
+	if cfg.Debug {
+		resolver.debugSampler = newSampler(cfg.DebugSampleRate)
+	}
+	resolver.decisionLog = decisionLog
+	resolver.requestIDHeaders = cfg.RequestIDHeaders
+	if cfg.AnomalyLog {
+		resolver.anomalyLog = anomalyLog
+	}
+	resolver.metricsLog = newMetricsLogger(time.Duration(cfg.MetricsLogInterval)*time.Second, cfg.MetricsLogRequests, time.Now())
+
+	if cfg.Enabled && cfg.ResponseDebugHeader != "" {
+		logf(name, "warning: responseDebugHeader %q echoes the resolution of every request to clients", cfg.ResponseDebugHeader)
+		resolver.responseDebugHeader = cfg.ResponseDebugHeader
+	}
+
+	return resolver, nil
+}
+
+// reservedHeaderNames are hop-by-hop or protocol-critical headers that must never be used as output headers
+var reservedHeaderNames = map[string]bool{
+	"Connection":          true,
+	"Content-Length":      true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// validateOutputHeaderName rejects output header names that collide with reserved headers,
+// unless allowReserved is set, in which case a warning is logged instead.
+func validateOutputHeaderName(name, field, headerName string, allowReserved bool) error {
+	if headerName == "" || !reservedHeaderNames[http.CanonicalHeaderKey(headerName)] {
+		return nil
+	}
+
+	if !allowReserved {
+		return fmt.Errorf("%s: %s cannot be the reserved header %q (set allowReservedHeaderNames to override)", name, field, headerName)
+	}
+
+	logf(name, "warning: %s is the reserved header %q, which can corrupt proxying", field, headerName)
+	return nil
 }
 
-// Config defines the plugin configuration.
-type Config struct {
-	// Core settings
-	Enabled bool `json:"enabled,omitempty"` // Enable/disable the plugin
+// ServeHTTP implements the http.Handler interface.
+func (p *Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	resp, result, written := p.process(req, rw.Header())
+	if resp != nil {
+		resp.write(rw)
+		return
+	}
+
+	if result != nil {
+		req = markProcessed(req, written)
+		req = req.WithContext(NewContext(req.Context(), *result))
+	}
+	p.next.ServeHTTP(rw, req)
+}
+
+// Process runs the resolution core on req: it evaluates trust, resolves the real IP,
+// applies enforcement and writes the output headers. It returns nil when the request should
+// be passed on, or the response the request must be answered with instead.
+func (r *Resolver) Process(req *http.Request) *Response {
+	resp, _, _ := r.process(req, nil)
+	return resp
+}
+
+// process is Process, also returning what was resolved for requests passed on with outputs
+// and the output headers written for them. respHeader, when not nil, receives
+// responseDebugHeader once the real IP is resolved.
+func (r *Resolver) process(req *http.Request, respHeader http.Header) (*Response, *Result, map[string]bool) {
+	if !r.enabled || !r.match.matches(req) {
+		return nil, nil, nil
+	}
+
+	// Check if the request comes from a trusted source; a source that cannot be checked is untrusted
+	isTrusted, trustReason, err := r.trustVerdictChecked(req)
+	if err != nil {
+		r.logAnomaly(req, anomalyTrustLookup, err.Error())
+		if r.handleFailure(req, faultPointTrustLookup, err) {
+			return r.reject(http.StatusServiceUnavailable, rejectReasonFailure), nil, nil
+		}
+	}
+	if trustReason == trustReasonInvalidRemoteAddr {
+		r.logAnomaly(req, anomalyInvalidRemoteAddr, "RemoteAddr is not an IP address")
+	}
+	if trustReason == trustReasonPlaintext && r.requireTLSAction == requireTLSReject && !r.isEnforcementExempt(req) {
+		return r.reject(r.denyStatusCode, rejectReasonPlaintext), nil, nil
+	}
+	trustKnown := err == nil && trustReason != trustReasonInvalidRemoteAddr
+
+	// A request an earlier instance processed is passed on as it is, or only completed
+	merge := false
+	processed, earlier := r.processedBefore(req, isTrusted)
+	if r.alreadyProcessed != alreadyProcessedReprocess && processed {
+		if r.alreadyProcessed == alreadyProcessedSkip {
+			return nil, nil, nil
+		}
+		merge = true
+	}
+	if !isTrusted && r.processedMarkerHeader != "" {
+		req.Header.Del(r.processedMarkerHeader)
+	}
+
+	// Keep what the client sent before any header is modified; a merged request keeps the earlier backups
+	if r.preserveOriginal && !merge {
+		r.preserveOriginals(req)
+	}
+
+	// The shared secret is never forwarded
+	if r.sharedSecret != nil {
+		r.sharedSecret.strip(req)
+	}
+
+	// Nor is a client certificate info header untrusted sources could have forged
+	if !isTrusted && r.certTrust != nil && r.certTrust.infoHeader != "" {
+		req.Header.Del(r.certTrust.infoHeader)
+	}
+
+	atomic.AddInt64(&r.stats.requests, 1)
+	if isTrusted {
+		atomic.AddInt64(&r.stats.trusted, 1)
+	} else {
+		atomic.AddInt64(&r.stats.untrusted, 1)
+	}
+
+	// Counters are flushed to the log periodically, driven by the requests themselves
+	if now := time.Now(); r.metricsLog.due(now) {
+		r.logMetrics(now)
+	}
+
+	// The dump path is answered directly for trusted sources with the effective configuration;
+	// embedders can also request a dump through the request context
+	if isTrusted && r.isDumpPath(req) {
+		r.dump(time.Now())
+		return r.statusResponse(), nil, nil
+	}
+	if dumpRequested(req.Context()) {
+		r.dump(time.Now())
+	}
+
+	// The inspect path is answered directly for trusted sources with how the request itself is resolved
+	if isTrusted && r.isInspectPath(req) {
+		return r.inspectResponse(req, isTrusted), nil, nil
+	}
+
+	// Untrusted sources sending the headers we produce or trust are attempting to spoof their IP
+	spoofed := false
+	if !isTrusted && (r.stripSpoofedHeaders || r.spoofHeaderName != "" || r.anomalyLog != nil) {
+		spoofed = r.detectSpoofing(req)
+		if spoofed {
+			r.logAnomaly(req, anomalySpoofAttempt, "untrusted source sent headers it cannot be trusted for")
+		}
+	}
+
+	// Untrusted sources cannot supply CDN-style metadata that backends trust blindly
+	if !isTrusted && len(r.sanitizeHeaders) > 0 {
+		r.sanitize(req)
+	}
+	if !isTrusted && r.stripKnownHeaders {
+		r.stripKnown(req)
+	}
+
+	// Third-party geo headers of untrusted sources are forgeable; they are recomputed below when the real IP is located
+	if !isTrusted {
+		for _, header := range r.geoPassthroughHeaders {
+			req.Header.Del(header)
+		}
+	}
+
+	// Trace the resolution of sampled requests in debug mode
+	report := r.decisionReport(req, isTrusted, trustReason)
+
+	// Extract the first valid IP address from the configured headers; conflicting sources fail the request below
+	resolved, conflict := r.resolveOutput(req, isTrusted, report)
+
+	// A trusted proxy resolved as the client means the depth is off; it is reported
+	resolvedProxy := resolved.proxy != ""
+	if resolvedProxy {
+		r.reportResolvedProxy(req, resolved)
+	}
+
+	// Echo the resolution to the client, whether the request is passed on or rejected below
+	if respHeader != nil && r.responseDebugHeader != "" {
+		respHeader.Set(r.responseDebugHeader, r.responseDebugValue(resolved, isTrusted, trustReason))
+	}
+
+	realIP := resolved.ip
+
+	if realIP != "" {
+		atomic.AddInt64(&r.stats.resolved, 1)
+	} else {
+		atomic.AddInt64(&r.stats.unresolved, 1)
+	}
+	if resolved.fallback {
+		atomic.AddInt64(&r.stats.fallbacks, 1)
+	}
+	if resolved.outOfBounds != "" {
+		r.logAnomaly(req, anomalyDepthOutOfBounds, resolved.outOfBounds+" has fewer entries than its depth")
+	}
 
-	// Header configuration
-	HeaderName     string         `json:"headerName,omitempty"`     // Header name where IP will be populated
-	ProcessHeaders []HeaderConfig `json:"processHeaders,omitempty"` // List of headers to process with depth configuration
-	ForceOverwrite bool           `json:"forceOverwrite,omitempty"` // Always set the header, even if empty (to prevent header spoofing)
+	if resolved.failure != nil && r.handleFailure(req, faultPointHeaderRead, resolved.failure) {
+		r.logDecision(req, report, debugDecisionFailed)
+		return r.reject(http.StatusServiceUnavailable, rejectReasonFailure), nil, nil
+	}
 
-	// Trust configuration
-	TrustAll      bool     `json:"trustAll,omitempty"`      // Trust all sources (default: false)
-	TrustedIPs    []string `json:"trustedIPs,omitempty"`    // CIDR blocks of trusted proxy IPs (required if trustAll is false)
-	TrustedHeader string   `json:"trustedHeader,omitempty"` // Header name for trust indication (e.g., "X-Is-Trusted")
-}
+	// In strict mode malformed and oversized headers fail the request instead of being tolerated
+	if r.strictMode && (resolved.headerTooLong || resolved.chainExceeded || resolved.malformed) && !r.isEnforcementExempt(req) {
+		var reasons []string
+		if resolved.headerTooLong {
+			reasons = append(reasons, rejectReasonHeaderLength)
+		}
+		if resolved.chainExceeded {
+			reasons = append(reasons, rejectReasonChainLength)
+		}
+		if resolved.malformed {
+			reasons = append(reasons, rejectReasonMalformed)
+		}
+		r.logDecision(req, report, debugDecisionRejected+" ("+strings.Join(reasons, ",")+")")
+		return r.reject(http.StatusBadRequest, reasons...), nil, nil
+	}
 
-// CreateConfig creates the default plugin configuration.
-func CreateConfig() *Config {
-	return &Config{
-		Enabled:    true,
-		HeaderName: "X-Real-IP",
-		ProcessHeaders: []HeaderConfig{
-			{HeaderName: "X-Forwarded-For", Depth: -1},
-			{HeaderName: "X-Real-IP", Depth: -1},
-			{HeaderName: "CF-Connecting-IP", Depth: -1},
-			{HeaderName: "clientAddress", Depth: -1},
-		},
-		ForceOverwrite: true,
-		TrustAll:       true,       // Default: trust all (backward compatibility)
-		TrustedIPs:     []string{}, // Empty by default
-		TrustedHeader:  "",         // Empty by default (no trust header)
-	}
-}
-
-// Plugin holds the plugin instance data.
-type Plugin struct {
-	next           http.Handler
-	name           string
-	enabled        bool
-	headerName     string
-	processHeaders []HeaderConfig
-	forceOverwrite bool
-	trustAll       bool
-	trustedIPs     *IpLookupHelper
-	trustedHeader  string
-}
+	// Headers disagreeing on the client IP indicate that one of them was forged
+	consistent := true
+	if r.consensus != nil {
+		consistent = r.consensus.consistent(resolved)
+		if !consistent && r.consensus.mode == consensusReject && !r.isEnforcementExempt(req) {
+			r.logDecision(req, report, debugDecisionRejected+" ("+rejectReasonInconsistent+")")
+			return r.reject(r.denyStatusCode, rejectReasonInconsistent), nil, nil
+		}
+	}
+	if conflict && r.conflictPolicy == conflictReject && !r.isEnforcementExempt(req) {
+		r.logDecision(req, report, debugDecisionRejected+" ("+rejectReasonConflict+")")
+		return r.reject(r.denyStatusCode, rejectReasonConflict), nil, nil
+	}
 
-// New creates a new plugin instance.
-func New(ctx context.Context, next http.Handler, cfg *Config, name string) (http.Handler, error) {
-	if next == nil {
-		return nil, fmt.Errorf("%s: no next handler provided", name)
+	// Proxies appending themselves leave the connecting address as the last hop
+	chainValid := true
+	if r.chainValidation != chainValidationOff {
+		chainValid = r.chainValid(req)
+		if !chainValid && r.chainValidation == chainValidationReject && !r.isEnforcementExempt(req) {
+			r.logDecision(req, report, debugDecisionRejected+" ("+rejectReasonInvalidChain+")")
+			return r.reject(r.denyStatusCode, rejectReasonInvalidChain), nil, nil
+		}
 	}
 
-	if cfg == nil {
-		return nil, fmt.Errorf("%s: no config provided", name)
+	// Topologies with a known number of proxies have a known number of hops
+	hopsValid := true
+	if r.hopCheck != nil {
+		hopsValid = r.hopCheck.valid(r, req)
+		if !hopsValid && r.hopCheck.action == expectedHopsReject && !r.isEnforcementExempt(req) {
+			r.logDecision(req, report, debugDecisionRejected+" ("+rejectReasonHopCount+")")
+			return r.reject(r.denyStatusCode, rejectReasonHopCount), nil, nil
+		}
 	}
 
-	// Validate configuration
-	if cfg.Enabled && cfg.HeaderName == "" {
-		return nil, fmt.Errorf("%s: headerName cannot be empty when plugin is enabled", name)
+	// Locate the real IP once, for both the country rules and the location headers
+	var location geoLocation
+	if r.geoIP != nil {
+		location = r.geoIP.lookup(r.requestLogger(req), realIP)
 	}
 
-	if cfg.Enabled && len(cfg.ProcessHeaders) == 0 {
-		return nil, fmt.Errorf("%s: processHeaders cannot be empty when plugin is enabled", name)
+	// Reject requests whose real IP is not allowed through
+	if resp := r.enforce(req, realIP, location.countryCode); resp != nil {
+		r.logDecision(req, report, debugDecisionRejected+" ("+strings.Join(resp.Reasons, ",")+")")
+		return resp, nil, nil
 	}
 
-	// Validate trust configuration - if trustAll is false, trustedIPs must be provided
-	if cfg.Enabled && !cfg.TrustAll && len(cfg.TrustedIPs) == 0 {
-		return nil, fmt.Errorf("%s: trustedIPs cannot be empty when trustAll is false", name)
+	// Outputs are either written completely or not at all
+	if err := r.fault(faultPointOutputWrite); err != nil {
+		if r.handleFailure(req, faultPointOutputWrite, err) {
+			r.logDecision(req, report, debugDecisionFailed)
+			return r.reject(http.StatusServiceUnavailable, rejectReasonFailure), nil, nil
+		}
+		r.logDecision(req, report, debugDecisionOutputsRemoved)
+		r.removeOutputs(req)
+		return nil, nil, nil
 	}
 
-	// Initialize trusted IPs lookup helper
-	var trustedIPs *IpLookupHelper
-	if !cfg.TrustAll && len(cfg.TrustedIPs) > 0 {
-		var err error
-		trustedIPs, err = NewIpLookupHelper(cfg.TrustedIPs)
-		if err != nil {
-			return nil, fmt.Errorf("%s: failed to parse trusted IPs: %w", name, err)
+	// Conditions of the request that outputConditions can restrict headers to
+	state := r.requestState(isTrusted, resolved)
+	out := &outputWriter{r: r, req: req, state: state, merge: merge, earlier: earlier}
+
+	// Tag spoofing attempts; clients cannot set the tag themselves
+	if r.spoofHeaderName != "" {
+		req.Header.Del(r.spoofHeaderName)
+		if spoofed && r.outputConditions.allows(r.spoofHeaderName, state) {
+			req.Header.Set(r.spoofHeaderName, "yes")
 		}
 	}
 
-	plugin := &Plugin{
-		next:           next,
-		name:           name,
-		enabled:        cfg.Enabled,
-		headerName:     cfg.HeaderName,
-		processHeaders: cfg.ProcessHeaders,
-		forceOverwrite: cfg.ForceOverwrite,
-		trustAll:       cfg.TrustAll,
-		trustedIPs:     trustedIPs,
-		trustedHeader:  cfg.TrustedHeader,
+	// Tag requests addressing the service by an unexpected IP literal; clients cannot set the tag themselves
+	if r.hostMismatchHeaderName != "" {
+		req.Header.Del(r.hostMismatchHeaderName)
+		if r.detectHostMismatch(req, realIP) && r.outputConditions.allows(r.hostMismatchHeaderName, state) {
+			req.Header.Set(r.hostMismatchHeaderName, "yes")
+		}
 	}
 
-	return plugin, nil
-}
+	// Report whether the cross-checked headers agree; clients cannot set the result themselves
+	if r.consensus != nil {
+		consistentValue := "yes"
+		if !consistent {
+			consistentValue = "no"
+		}
+		out.set(r.consistentHeaderName, consistentValue)
+	}
 
-// ServeHTTP implements the http.Handler interface.
-func (p *Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	if !p.enabled {
-		p.next.ServeHTTP(rw, req)
-		return
+	// Report whether a trusted proxy was resolved as the client; clients cannot set the result themselves
+	if r.resolvedProxyHeaderName != "" {
+		resolvedProxyValue := "no"
+		if resolvedProxy {
+			resolvedProxyValue = "yes"
+		}
+		out.set(r.resolvedProxyHeaderName, resolvedProxyValue)
+	}
+
+	// Report whether the chain ends with the connecting address; clients cannot set the result themselves
+	if r.chainValidation != chainValidationOff {
+		chainValidValue := "yes"
+		if !chainValid {
+			chainValidValue = "no"
+		}
+		out.set(r.chainValidHeaderName, chainValidValue)
 	}
 
-	// Check if the request comes from a trusted source
-	isTrusted := p.isRequestTrusted(req)
+	// Report whether the chain has the expected number of hops; clients cannot set the result themselves
+	if r.hopCheck != nil {
+		hopsValidValue := "yes"
+		if !hopsValid {
+			hopsValidValue = "no"
+		}
+		out.set(r.hopsValidHeaderName, hopsValidValue)
+	}
 
 	// Set trust header if configured
-	if p.trustedHeader != "" {
-		if isTrusted {
-			req.Header.Set(p.trustedHeader, "yes")
+	if r.trustedHeader != "" {
+		if !r.outputConditions.allows(r.trustedHeader, state) {
+			req.Header.Del(r.trustedHeader)
 		} else {
-			req.Header.Set(p.trustedHeader, "no")
+			trustedValue := r.trustedValues.value(isTrusted, trustKnown)
+			if tier := r.sourceTier(req); isTrusted && tier != nil {
+				trustedValue = tier.name
+			}
+			req.Header.Set(r.trustedHeader, trustedValue)
 		}
 	}
 
-	// Extract the first valid IP address from the configured headers
-	realIP := p.extractRealIP(req, isTrusted)
-
 	// Always set the header if forceOverwrite is true, even if empty
 	// This prevents clients from spoofing the header
-	if p.forceOverwrite || realIP != "" {
-		req.Header.Set(p.headerName, realIP)
+	// The emitted IP is masked when anonymization is enabled; with hashOnly it is withheld entirely
+	emitted := resolved
+	if r.anonymizer != nil {
+		emitted = r.anonymizer.resolution(resolved)
+	}
+	if r.hashOnly {
+		req.Header.Del(r.headerName)
+	} else {
+		out.set(r.headerName, emitted.ip)
 	}
 
-	p.next.ServeHTTP(rw, req)
+	// Write the IPs of entries with their own target header
+	r.writeTargets(out, req, resolved)
+
+	// Dual-write the same value to legacy header names during a rename
+	if len(r.legacyHeaderNames) > 0 {
+		r.writeLegacyHeaders(out, emitted.ip, time.Now())
+	}
+
+	// Sign the IP written to headerName, so downstream services can verify its origin;
+	// values this middleware did not write (e.g. kept client values) are never signed
+	if r.signer != nil {
+		signature := ""
+		if emitted.ip != "" && req.Header.Get(r.headerName) == emitted.ip {
+			signature = r.signer.sign(emitted.ip, time.Now())
+		}
+		if signature == "" {
+			req.Header.Del(r.signatureHeaderName)
+		} else {
+			out.set(r.signatureHeaderName, signature)
+		}
+	}
+
+	// Emit a keyed hash of the IP for backends that must not store the address
+	if r.hasher != nil {
+		out.set(r.hashedHeaderName, r.hasher.hash(realIP))
+	}
+
+	// Record which header and position produced the IP, e.g. "CF-Connecting-IP[0]"
+	if r.sourceHeaderName != "" {
+		source := ""
+		if realIP != "" {
+			source = fmt.Sprintf("%s[%d]", resolved.header, resolved.index)
+		}
+		out.set(r.sourceHeaderName, source)
+	}
+
+	// Emit a stable shard of the IP for affinity routing and per-shard rate limits
+	if r.shardHeaderName != "" {
+		out.set(r.shardHeaderName, shardOf(realIP, r.shardCount))
+	}
+
+	// Emit the port that came with the IP (from RemoteAddr, an "ip:port" entry or a Forwarded element)
+	out.set(r.portHeaderName, resolved.port)
+
+	// Grade the resolution for fraud systems that want more than a bare IP
+	if r.confidenceHeaderName != "" {
+		out.set(r.confidenceHeaderName, formatConfidence(r.confidence(resolved)))
+	}
+
+	// List every candidate across the processed headers, for audits of the whole chain
+	if r.chainHeaderName != "" {
+		out.set(r.chainHeaderName, r.chain(req, isTrusted))
+	}
+
+	// Emit the IPv4 a 6to4, Teredo or NAT64 address carries
+	if r.embeddedIPv4HeaderName != "" {
+		r.setDerivedIP(out, r.embeddedIPv4HeaderName, embeddedIPv4(realIP))
+	}
+
+	// Emit the IPv4 form of the real IP for backends that only understand IPv4
+	if r.ipv4HeaderName != "" {
+		r.setDerivedIP(out, r.ipv4HeaderName, ipv4Form(realIP))
+	}
+
+	// Classify the real IP, so backends can branch on internal and external traffic
+	if r.ipClassHeaderName != "" {
+		out.set(r.ipClassHeaderName, ipClass(realIP))
+	}
+
+	// Label the real IP with the ipTags ranges and remote IP lists containing it
+	if len(r.ipTags) > 0 || len(r.remoteLists) > 0 {
+		out.set(r.ipTagsHeaderName, r.ipTagsOf(realIP))
+	}
+
+	// Add the location of the real IP
+	if r.geoIP != nil {
+		for _, output := range r.geoIP.outputs(location) {
+			out.set(output.header, output.value)
+		}
+
+		if !isTrusted && location.countryCode != "" {
+			for _, header := range r.geoPassthroughHeaders {
+				req.Header.Set(header, location.countryCode)
+			}
+		}
+	}
+
+	// Add the autonomous system of the real IP
+	if r.asn != nil {
+		for _, output := range r.asn.outputs(r.requestLogger(req), realIP) {
+			out.set(output.header, output.value)
+		}
+	}
+
+	// Identify the end user a trusted machine-to-machine caller acts for
+	if r.introspector != nil {
+		tokenClientIP := ""
+		if isTrusted {
+			tokenClientIP = r.tokenClientIP(req)
+		}
+		out.set(r.tokenClientIPHeaderName, tokenClientIP)
+	}
+
+	// Stamp the plugin version on sampled requests of trusted sources; clients cannot set the stamp themselves
+	if r.versionHeaderName != "" {
+		if isTrusted && r.versionSampler.sample() {
+			out.set(r.versionHeaderName, r.versionStamp())
+		} else {
+			req.Header.Del(r.versionHeaderName)
+		}
+	}
+
+	// Flag requests whose output values were cut to maxOutputLength
+	if r.truncatedHeaderName != "" {
+		req.Header.Del(r.truncatedHeaderName)
+		if out.truncated && r.outputConditions.allows(r.truncatedHeaderName, state) {
+			req.Header.Set(r.truncatedHeaderName, "yes")
+		}
+	}
+
+	// Tag requests whose exact tuple repeats at anomalous rates; clients cannot set the tag themselves
+	if r.replayDetector != nil {
+		req.Header.Del(r.replayHeaderName)
+		if r.replayDetector.observe(replayKey(req, realIP), time.Now()) {
+			atomic.AddInt64(&r.stats.replaySuspected, 1)
+			if r.outputConditions.allows(r.replayHeaderName, state) {
+				req.Header.Set(r.replayHeaderName, "yes")
+			}
+		}
+	}
+
+	// Replace X-Forwarded-For with the validated part of the chain
+	if r.rewriteForwardedFor {
+		r.rewriteForwardedForHeader(req, emitted)
+	}
+
+	// Record the connection as the last hop like a standard proxy, before RemoteAddr is rewritten
+	if r.appendForwardedFor {
+		r.appendForwardedForHeader(req)
+	}
+
+	// Expose the real IP to downstream middlewares and backends reading RemoteAddr
+	if r.rewriteRemoteAddr {
+		r.rewriteRemoteAddress(req, emitted)
+	}
+
+	// Mark the request for instances in proxies further down the line
+	if r.processedMarkerHeader != "" {
+		req.Header.Set(r.processedMarkerHeader, r.name)
+	}
+
+	// Record how the decision was reached, for support engineers reproducing it from the backend
+	if r.auditHeaderName != "" {
+		req.Header.Set(r.auditHeaderName, auditTrace(report, debugDecisionForwarded))
+	}
+
+	r.logDecision(req, report, debugDecisionForwarded)
+	return nil, r.emittedResult(emitted, isTrusted, trustReason), out.written
 }
 
+// Trust reasons reported by trustVerdict
+const (
+	trustReasonTrustAll          = "trustAll"
+	trustReasonLoopback          = "loopback"
+	trustReasonTrustedIPs        = "trustedIPs"
+	trustReasonTrustedIPsFile    = "trustedIPsFile"
+	trustReasonGracePeriod       = "trustedIPsFileGracePeriod"
+	trustReasonSharedSecret      = "trustedSecret"
+	trustReasonClientCert        = "trustedClientCert"
+	trustReasonNotTrusted        = "notTrusted"
+	trustReasonInvalidRemoteAddr = "invalidRemoteAddr"
+	trustReasonUntrustedHop      = "untrustedHop"
+	trustReasonTrustTier         = "trustTier"
+)
+
 // isRequestTrusted checks if the request comes from a trusted source based on RemoteAddr
-func (p *Plugin) isRequestTrusted(req *http.Request) bool {
+func (r *Resolver) isRequestTrusted(req *http.Request) bool {
+	trusted, _ := r.trustVerdict(req)
+	return trusted
+}
+
+// trustVerdict is isRequestTrusted, additionally reporting why the verdict was reached.
+// With requireTrustedChain a trusted source is only trusted when every hop it forwards is,
+// and with requireTLS only when the request used TLS.
+func (r *Resolver) trustVerdict(req *http.Request) (bool, string) {
+	trusted, reason := r.sourceVerdict(req)
+	if !trusted {
+		return false, reason
+	}
+	if gate := r.trustGate(req); gate != "" {
+		return false, gate
+	}
+	return true, reason
+}
+
+// trustGate returns why requireTrustedChain or requireTLS withdraw the trust of a trusted
+// source of req, or "" when they do not. Every way of trusting a source goes through it.
+func (r *Resolver) trustGate(req *http.Request) string {
+	if r.requireTrustedChain && !r.chainTrusted(req) {
+		return trustReasonUntrustedHop
+	}
+	if r.requireTLS && !secureTransport(req) {
+		return trustReasonPlaintext
+	}
+	return ""
+}
+
+// sourceVerdict is the trust verdict for the source of req, which is cached per RemoteAddr
+func (r *Resolver) sourceVerdict(req *http.Request) (bool, string) {
 	// If trustAll is enabled, trust all requests
-	if p.trustAll {
-		return true
+	if r.trustAll {
+		return true, trustReasonTrustAll
+	}
+
+	// The shared secret is checked per request, as it does not depend on the source IP
+	if r.sharedSecret != nil && r.sharedSecret.matches(req) {
+		return true, trustReasonSharedSecret
 	}
 
-	// If no trusted IPs configured (and trustAll is false), don't trust any requests
-	if p.trustedIPs == nil {
-		return false
+	// So is the client certificate, which proxies keep when their IPs rotate
+	if r.certTrust != nil && r.certTrust.matches(req, parseAddress(r.cleanIPAddress(req.RemoteAddr))) {
+		return true, trustReasonClientCert
 	}
 
+	// Reuse the verdict for this source IP if it is still fresh
+	if r.trustCache == nil {
+		return r.evaluateTrust(req)
+	}
+
+	now := time.Now()
+	key := trustCacheKey(req.RemoteAddr)
+	if trusted, reason, ok := r.trustCache.get(key, now); ok {
+		return trusted, reason
+	}
+
+	trusted, reason := r.evaluateTrust(req)
+	r.trustCache.set(key, trusted, reason, now)
+	return trusted, reason
+}
+
+// evaluateTrust checks RemoteAddr against the loopback shortcut and the trusted ranges
+func (r *Resolver) evaluateTrust(req *http.Request) (bool, string) {
 	// Extract IP from RemoteAddr
-	clientIP := p.cleanIPAddress(req.RemoteAddr)
+	clientIP := r.cleanIPAddress(req.RemoteAddr)
 	if clientIP == "" {
-		return false
+		return false, trustReasonInvalidRemoteAddr
 	}
 
 	// Parse the IP address
-	ip := net.ParseIP(clientIP)
+	ip := parseAddress(clientIP)
 	if ip == nil {
-		return false
+		return false, trustReasonInvalidRemoteAddr
 	}
 
-	// Check if IP is in trusted ranges
-	isTrusted, _, err := p.trustedIPs.IsContained(ip)
-	if err != nil {
-		return false
+	// Loopback sources (health checks, local sidecars) bypass the trusted ranges
+	if r.trustLoopbackAlways && ip.IsLoopback() {
+		return true, trustReasonLoopback
+	}
+
+	// Check if IP is in the static trusted ranges
+	if r.trustedIPs != nil {
+		isTrusted, _, err := r.trustedIPs.IsContained(ip)
+		if err == nil && isTrusted {
+			return true, trustReasonTrustedIPs
+		}
+	}
+
+	// Check if IP is in the ranges loaded from the trusted IPs file
+	if r.trustedIPsFile != nil {
+		isTrusted, _, err := r.trustedIPsFile.Helper().IsContained(ip)
+		if err == nil && isTrusted {
+			return true, trustReasonTrustedIPsFile
+		}
+
+		// Prefixes recently removed from the file are still honored, but tagged
+		if r.trustedIPsFile.InGracePeriod(ip, time.Now()) {
+			atomic.AddInt64(&r.stats.graceMatches, 1)
+			return true, trustReasonGracePeriod
+		}
+	}
+
+	// Check if IP is in a trusted remote IP list
+	for _, list := range r.remoteLists {
+		if list.trusted && list.contains(ip) {
+			return true, trustReasonRemoteList
+		}
+	}
+
+	// Check if IP is in a trust tier
+	for _, tier := range r.trustTiers {
+		if contained, _, err := tier.ips.IsContained(ip); err == nil && contained {
+			return true, trustReasonTrustTier
+		}
 	}
 
-	return isTrusted
+	// If no trusted range matched (and trustAll is false), don't trust the request
+	return false, trustReasonNotTrusted
+}
+
+// resolution describes the real IP selected from the configured headers and where it was found.
+type resolution struct {
+	ip     string   // Selected IP address ("" if no header yielded one)
+	header string   // Name of the processHeaders entry that produced the IP
+	port   string   // Port that accompanied the selected IP, if any
+	index  int      // Position of the selected IP in chain, counted from the left
+	chain  []string // Cleaned IP list of the header that produced the IP
+
+	fallback    bool   // Whether the IP was produced by the fallback
+	outOfBounds string // First header whose depth was out of bounds, if any
+
+	failure error // First header that could not be read (and was skipped), if any
+
+	chainExceeded bool // Whether a header that was read had entries beyond maxChainLength
+	headerTooLong bool // Whether a header that was read was longer than maxHeaderLength
+	malformed     bool // Whether a header that was read had no parseable IP at its depth (strict mode only)
+
+	proxy string // Trusted proxy a header resolved to, found by resolvedProxyCheck, if any
+
+	candidates []string // Entry each processHeaders entry yields, by index, when collectCandidates
 }
 
 // extractRealIP processes the configured headers in order and returns the first valid IP address found.
 // Special synthetic header "clientAddress" maps to req.RemoteAddr for direct access to the connection's remote address.
 // If isTrusted is false, only the clientAddress synthetic header will be processed.
-func (p *Plugin) extractRealIP(req *http.Request, isTrusted bool) string {
-	for _, headerConfig := range p.processHeaders {
-		var headerValue string
+func (r *Resolver) extractRealIP(req *http.Request, isTrusted bool) string {
+	return r.resolveRealIP(req, isTrusted, nil).ip
+}
 
-		// Handle synthetic "clientAddress" header
-		if headerConfig.HeaderName == "clientAddress" {
-			headerValue = req.RemoteAddr
-		} else {
-			// If request is not trusted and trustedIPs is configured, skip non-synthetic headers
-			if !isTrusted && p.trustedIPs != nil {
-				continue
-			}
-			headerValue = req.Header.Get(headerConfig.HeaderName)
+// resolveRealIP is extractRealIP, additionally reporting which header and position produced the IP.
+// When report is not nil, every header considered and every candidate is recorded in it. When
+// conflicts, consensus or target headers compare the entries of every header, the entry each
+// one yields is recorded in the resolution's candidates, the unreached ones included.
+func (r *Resolver) resolveRealIP(req *http.Request, isTrusted bool, report *DecisionReport) resolution {
+	var resolved resolution
+	var lastHeader, lastValue string // Last header that was read, for the lastHeaderRaw fallback
+	chainExceeded := false           // Whether a header read had more than maxChainLength entries
+	headerTooLong := false           // Whether a header read was longer than maxHeaderLength
+	malformed := false               // Whether a header read had no IP at its depth, in strict mode
+	outOfBounds := ""                // First header whose depth was out of bounds
+
+	var candidates []string
+	if r.collectCandidates {
+		candidates = make([]string, len(r.processHeaders))
+	}
+
+	for i, headerConfig := range r.processHeaders {
+		var headerReport *HeaderReport
+		if report != nil {
+			report.Headers = append(report.Headers, HeaderReport{HeaderName: headerConfig.HeaderName, Depth: r.depths[i]})
+			headerReport = &report.Headers[len(report.Headers)-1]
 		}
 
-		if headerValue == "" {
+		// Entries with their own target header are resolved separately, and once an IP is selected
+		// the remaining headers are only listed in the report; both still yield their candidate
+		if headerConfig.TargetHeaderName != "" || resolved.ip != "" {
+			if headerReport == nil && candidates == nil && resolved.ip != "" {
+				break
+			}
+			if headerReport != nil {
+				headerReport.Skipped = skipReasonNotReached
+				if headerConfig.TargetHeaderName != "" {
+					headerReport.Skipped = skipReasonOwnTarget
+				}
+			}
+			if candidates != nil {
+				candidates[i] = r.evaluateHeader(i, req, isTrusted, nil).candidate()
+			}
 			continue
 		}
 
-		// Process comma-separated IPs in the header with depth logic
-		ips := strings.Split(headerValue, ",")
+		outcome := r.evaluateHeader(i, req, isTrusted, headerReport)
+		if outcome.failure != nil && resolved.failure == nil {
+			resolved.failure = outcome.failure
+		}
+		if outcome.value != "" {
+			lastHeader, lastValue = headerConfig.HeaderName, outcome.value
+		}
+		chainExceeded = chainExceeded || outcome.exceeded
+		headerTooLong = headerTooLong || outcome.tooLong
+		malformed = malformed || outcome.malformed
+		if outcome.outOfBounds && outOfBounds == "" {
+			outOfBounds = headerConfig.HeaderName
+		}
+		if candidates != nil {
+			candidates[i] = outcome.candidate()
+		}
+
+		if outcome.selected {
+			resolved = resolution{
+				ip:     outcome.chain[outcome.index],
+				port:   outcome.ports[outcome.index],
+				header: headerConfig.HeaderName,
+				index:  outcome.index,
+				chain:  outcome.chain,
 
-		// Clean all IPs first
-		var cleanIPs []string
-		for _, ip := range ips {
-			cleanIP := p.cleanIPAddress(ip)
-			if cleanIP != "" {
-				cleanIPs = append(cleanIPs, cleanIP)
+				failure: resolved.failure,
 			}
 		}
+	}
 
-		if len(cleanIPs) == 0 {
-			continue
+	// No header yielded an IP: apply the configured fallback
+	if resolved.ip == "" {
+		if fallback, ok := r.fallbackResolution(req.RemoteAddr, lastHeader, lastValue); ok {
+			fallback.failure = resolved.failure
+			resolved = fallback
+			resolved.fallback = true
+			if report != nil {
+				report.Fallback = r.fallback
+			}
 		}
+	}
 
-		// Apply depth logic
-		var selectedIP string
-		if headerConfig.Depth < 0 {
-			// Any negative depth means leftmost (first) IP
-			selectedIP = cleanIPs[0]
-		} else {
-			// Depth from rightmost: 0 = rightmost, 1 = second from right, etc.
-			rightIndex := len(cleanIPs) - 1 - headerConfig.Depth
-			if rightIndex >= 0 && rightIndex < len(cleanIPs) {
-				selectedIP = cleanIPs[rightIndex]
-			} else {
-				// Depth out of bounds, skip this header
-				continue
-			}
+	resolved.chainExceeded = chainExceeded
+	resolved.outOfBounds = outOfBounds
+	resolved.headerTooLong = headerTooLong
+	resolved.malformed = malformed
+	resolved.candidates = candidates
+
+	return resolved
+}
+
+// headerOutcome is what a single processHeaders entry yields for a request
+type headerOutcome struct {
+	value    string   // Value that was read, "" when the header was skipped or missing
+	chain    []string // Cleaned entries of the header's family
+	ports    []string // Ports that accompanied the entries of chain
+	index    int      // Position of the selected entry in chain
+	selected bool     // Whether an entry was selected
+
+	failure     error // Why the header could not be read, if it could not
+	exceeded    bool  // Whether the header had entries beyond maxChainLength
+	tooLong     bool  // Whether the header was longer than maxHeaderLength
+	malformed   bool  // Whether the header had no IP at its depth (strict mode only)
+	outOfBounds bool  // Whether the depth was out of bounds
+}
+
+// candidate returns the selected entry, or "" when none was
+func (o headerOutcome) candidate() string {
+	if !o.selected {
+		return ""
+	}
+	return o.chain[o.index]
+}
+
+// evaluateHeader reads processHeaders[i] for req and selects its entry with the conditions,
+// trust, limits, cleaning, family and depth rules of resolution. When headerReport is not
+// nil, the value, every candidate and why the header was skipped are recorded in it.
+func (r *Resolver) evaluateHeader(i int, req *http.Request, isTrusted bool, headerReport *HeaderReport) headerOutcome {
+	headerConfig := r.processHeaders[i]
+	var outcome headerOutcome
+	skip := func(reason string) headerOutcome {
+		if headerReport != nil {
+			headerReport.Skipped = reason
 		}
+		return outcome
+	}
+
+	// Entries can depend on the presence of another header
+	if !r.headerApplies(i, req) {
+		return skip(skipReasonCondition)
+	}
+
+	var headerValue string
 
-		if selectedIP != "" {
-			return selectedIP
+	// Handle the synthetic header, "clientAddress" by default
+	if r.isSynthetic(headerConfig.HeaderName) {
+		headerValue = r.syntheticValue(headerConfig.HeaderName, req)
+	} else {
+		// If request is not trusted for this header, skip non-synthetic headers
+		if !r.headerTrusted(i, req, isTrusted) {
+			return skip(skipReasonUntrusted)
+		}
+		if err := r.fault(faultPointHeaderRead); err != nil {
+			outcome.failure = fmt.Errorf("%s: %w", headerConfig.HeaderName, err)
+			return skip(skipReasonReadFailed)
+		}
+		headerValue, outcome.tooLong = r.limitHeaderValue(r.headerValue(req, headerConfig.HeaderName))
+		if outcome.tooLong && headerValue == "" {
+			return skip(skipReasonTooLong)
 		}
 	}
 
-	return ""
+	outcome.value = headerValue
+	if headerReport != nil {
+		headerReport.Value = headerValue
+	}
+	if headerValue == "" {
+		return skip(skipReasonMissing)
+	}
+
+	// Process comma-separated IPs in the header with depth logic
+	var ips []string
+	ips, outcome.exceeded = r.splitCandidates(headerConfig.HeaderName, headerValue)
+
+	// Clean all IPs first, remembering their ports; entries of another family are skipped
+	var cleanIPs, ports []string
+	otherFamily := false
+	for _, ip := range ips {
+		cleanIP, port := r.splitIPAddress(ip)
+		checkedIP, exotic := r.checkNotation(cleanIP)
+		wrongFamily := checkedIP != "" && !inFamily(r.families[i], checkedIP)
+		if wrongFamily {
+			otherFamily = true
+		}
+		if headerReport != nil {
+			candidate := CandidateReport{Raw: ip, IP: checkedIP, Port: port}
+			if checkedIP == "" {
+				candidate.Rejected = rejectReasonEmpty
+				if exotic {
+					candidate.Rejected = rejectReasonExoticIPv4
+				}
+			} else if wrongFamily {
+				candidate.Rejected = rejectReasonFamily
+			}
+			headerReport.Candidates = append(headerReport.Candidates, candidate)
+		}
+		if checkedIP != "" && !wrongFamily {
+			cleanIPs = append(cleanIPs, checkedIP)
+			ports = append(ports, port)
+		}
+	}
+
+	// A header only offering the other family is not malformed
+	if len(cleanIPs) == 0 && otherFamily {
+		return skip(skipReasonNoFamily)
+	}
+	if len(cleanIPs) == 0 {
+		outcome.malformed = r.strictMode
+		return skip(skipReasonNoCandidates)
+	}
+
+	// Apply depth logic
+	selectedIndex, ok := r.selectCandidate(i, cleanIPs)
+	if !ok {
+		// Depth out of bounds, skip this header
+		outcome.outOfBounds = true
+		return skip(skipReasonDepthOutOfBounds)
+	}
+
+	// Strict mode does not pass on selected entries that are not IP addresses
+	if r.strictMode && parseAddress(cleanIPs[selectedIndex]) == nil {
+		outcome.malformed = true
+		return skip(skipReasonMalformed)
+	}
+
+	outcome.chain, outcome.ports, outcome.index, outcome.selected = cleanIPs, ports, selectedIndex, true
+	if headerReport != nil {
+		headerReport.markSelected(selectedIndex)
+	}
+	return outcome
+}
+
+// selectIndex applies depth to a list of count IPs and returns the selected position, counted
+// from the left. A negative depth counts from the left (-1 = leftmost, -2 = second from left);
+// otherwise depth counts from the rightmost: 0 = rightmost, 1 = second from right, etc.
+// ok is false when depth is out of bounds.
+func selectIndex(count, depth int) (int, bool) {
+	index := count - 1 - depth
+	if depth < 0 {
+		index = -depth - 1
+	}
+	if index < 0 || index >= count {
+		return 0, false
+	}
+	return index, true
+}
+
+// rewriteForwardedForHeader regenerates X-Forwarded-For so it only contains the resolved client IP
+// followed by the hops to its right, which the depth configuration treats as trusted proxies.
+// Anything to the left of the client IP (e.g., spoofed prefixes injected by the client) is dropped.
+func (r *Resolver) rewriteForwardedForHeader(req *http.Request, resolved resolution) {
+	if resolved.ip == "" {
+		req.Header.Del("X-Forwarded-For")
+		return
+	}
+
+	chain := []string{resolved.ip}
+	if http.CanonicalHeaderKey(resolved.header) == "X-Forwarded-For" {
+		chain = resolved.chain[resolved.index:]
+	}
+
+	req.Header.Set("X-Forwarded-For", strings.Join(chain, ", "))
+}
+
+// cleanIPAddress removes whitespace and port numbers from IP addresses and applies exoticIPv4.
+func (r *Resolver) cleanIPAddress(ip string) string {
+	host, _ := r.splitIPAddress(ip)
+	host, _ = r.checkNotation(host)
+	return host
 }
 
-// cleanIPAddress removes whitespace and port numbers from IP addresses.
-func (p *Plugin) cleanIPAddress(ip string) string {
+// splitIPAddress removes whitespace and splits an IP address from its port, if present.
+func (r *Resolver) splitIPAddress(ip string) (string, string) {
 	ip = strings.TrimSpace(ip)
 	if ip == "" {
-		return ""
+		return "", ""
 	}
 
-	// Remove port if present (e.g., "192.168.1.1:8080" -> "192.168.1.1")
-	host, _, err := net.SplitHostPort(ip)
+	// Remove port if present (e.g., "192.168.1.1:8080" -> "192.168.1.1", "8080")
+	host, port, err := net.SplitHostPort(ip)
 	if err == nil {
-		return host
+		return r.zone(host), port
+	}
+
+	// Bracketed IPv6 without a port (e.g., "[2001:db8::1]" from a Forwarded header)
+	if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
+		return r.zone(ip[1 : len(ip)-1]), ""
 	}
 
 	// If SplitHostPort fails, it means there's no port, return the original IP
-	return ip
+	return r.zone(ip), ""
+}
+
+// zone applies zoneIdentifiers to a cleaned candidate
+func (r *Resolver) zone(ip string) string {
+	if r.zoneIdentifiers == zoneIdentifiersPreserve {
+		return ip
+	}
+	return stripZone(ip)
+}
+
+// appendForwardedForHeader appends the IP of the connection to X-Forwarded-For, as a standard
+// proxy does, unless it already is the last hop. Multiple header instances are joined into one.
+func (r *Resolver) appendForwardedForHeader(req *http.Request) {
+	peer := r.cleanIPAddress(req.RemoteAddr)
+	if peer == "" {
+		return
+	}
+
+	values := req.Header.Values("X-Forwarded-For")
+	chain := strings.Join(values, ", ")
+	if hops := strings.Split(chain, ","); r.cleanIPAddress(hops[len(hops)-1]) == peer {
+		return
+	}
+
+	if strings.TrimSpace(chain) == "" {
+		req.Header.Set("X-Forwarded-For", peer)
+		return
+	}
+	req.Header.Set("X-Forwarded-For", chain+", "+peer)
+}
+
+// rewriteRemoteAddress sets req.RemoteAddr to the resolved IP. The port that came with the
+// IP is kept; otherwise the original connection port is preserved, or "0" is synthesized.
+// RemoteAddr is left alone unless the resolved value is an IP address, and never gets
+// invalidOutputPlaceholder.
+func (r *Resolver) rewriteRemoteAddress(req *http.Request, resolved resolution) {
+	if resolved.ip == "" || resolved.ip == r.invalidOutputPlaceholder || parseAddress(resolved.ip) == nil {
+		return
+	}
+
+	port := resolved.port
+	if port == "" {
+		_, port = r.splitIPAddress(req.RemoteAddr)
+	}
+	if port == "" {
+		port = "0"
+	}
+
+	req.RemoteAddr = net.JoinHostPort(resolved.ip, port)
 }
@@ -1,9 +1,11 @@
 package traefik_realip
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 )
@@ -417,8 +419,8 @@ func TestServeHTTP(t *testing.T) {
 		plugin.ServeHTTP(rr, req)
 
 		realIP := req.Header.Get("X-Real-IP")
-		if realIP != "invalid-ip" {
-			t.Errorf("expected X-Real-IP to be 'invalid-ip' (first value after cleaning), but got: '%s'", realIP)
+		if realIP != "" {
+			t.Errorf("expected X-Real-IP to be empty for a non-IP first value, but got: '%s'", realIP)
 		}
 	})
 
@@ -800,10 +802,10 @@ func TestServeHTTP(t *testing.T) {
 		// This should not panic with very long strings
 		plugin.ServeHTTP(rr, req)
 
-		// Should pass through the long string (no validation)
+		// Values longer than any IP never reach the output header
 		realIP := req.Header.Get("X-Real-IP")
-		if realIP != longString {
-			t.Errorf("expected X-Real-IP to be the long string, but got: '%s'", realIP[:50]+"...")
+		if realIP != "" {
+			t.Errorf("expected X-Real-IP to be empty, but got %d characters", len(realIP))
 		}
 	})
 
@@ -829,10 +831,10 @@ func TestServeHTTP(t *testing.T) {
 		// This should not panic with extreme negative depth
 		plugin.ServeHTTP(rr, req)
 
-		// Should still get leftmost IP since any negative depth means leftmost
+		// Negative depths count from the left, so this one is out of bounds like an extreme positive depth
 		realIP := req.Header.Get("X-Real-IP")
-		if realIP != "203.0.113.1" {
-			t.Errorf("expected X-Real-IP to be '203.0.113.1' (leftmost for negative depth), but got: '%s'", realIP)
+		if realIP != "" {
+			t.Errorf("expected X-Real-IP to be empty (depth out of bounds), but got: '%s'", realIP)
 		}
 	})
 
@@ -1041,7 +1043,7 @@ func TestServeHTTP(t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
 				req := httptest.NewRequest(http.MethodGet, "/test", nil)
 				req.RemoteAddr = tc.remoteAddr
-				req.Header.Set("X-Forwarded-For", "spoofed-ip")
+				req.Header.Set("X-Forwarded-For", "203.0.113.66")
 
 				rr := httptest.NewRecorder()
 				plugin.ServeHTTP(rr, req)
@@ -1056,8 +1058,8 @@ func TestServeHTTP(t *testing.T) {
 				realIP := req.Header.Get("X-Real-IP")
 				if tc.shouldProcess {
 					// Trusted source should process X-Forwarded-For
-					if realIP != "spoofed-ip" {
-						t.Errorf("trusted source should process headers, expected 'spoofed-ip', got: '%s'", realIP)
+					if realIP != "203.0.113.66" {
+						t.Errorf("trusted source should process headers, expected '203.0.113.66', got: '%s'", realIP)
 					}
 				} else {
 					// Untrusted source should use RemoteAddr (cleaned)
@@ -1127,6 +1129,438 @@ func TestServeHTTP(t *testing.T) {
 	})
 }
 
+func TestTrustLoopbackAlways(t *testing.T) {
+	t.Run("LoopbackOnlyConfigIsValid", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:             true,
+			HeaderName:          "X-Real-IP",
+			ProcessHeaders:      []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:            false,
+			TrustLoopbackAlways: true,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Errorf("expected no error when trustLoopbackAlways replaces trustedIPs, but got: %v", err)
+		}
+		if plugin == nil {
+			t.Error("expected plugin to be created, but got nil")
+		}
+	})
+
+	cfg := &Config{
+		Enabled:             true,
+		HeaderName:          "X-Real-IP",
+		ProcessHeaders:      []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}},
+		ForceOverwrite:      true,
+		TrustAll:            false,
+		TrustedIPs:          []string{"10.0.0.0/8"},
+		TrustedHeader:       "X-Is-Trusted",
+		TrustLoopbackAlways: true,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		remoteAddr    string
+		expectedTrust string
+		expectedIP    string
+	}{
+		{"IPv4 loopback", "127.0.0.1:8080", "yes", "203.0.113.1"},
+		{"IPv4 loopback range", "127.10.20.30:8080", "yes", "203.0.113.1"},
+		{"IPv6 loopback", "[::1]:8080", "yes", "203.0.113.1"},
+		{"Configured trusted range", "10.1.2.3:8080", "yes", "203.0.113.1"},
+		{"Public IPv4", "8.8.8.8:8080", "no", "8.8.8.8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tc.expectedTrust {
+				t.Errorf("expected X-Is-Trusted to be '%s', but got: '%s'", tc.expectedTrust, trusted)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tc.expectedIP {
+				t.Errorf("expected X-Real-IP to be '%s', but got: '%s'", tc.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("DisabledDoesNotTrustLoopback", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}},
+			TrustAll:       false,
+			TrustedIPs:     []string{"10.0.0.0/8"},
+			TrustedHeader:  "X-Is-Trusted",
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "127.0.0.1:8080"
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+
+		if trusted := req.Header.Get("X-Is-Trusted"); trusted != "no" {
+			t.Errorf("expected X-Is-Trusted to be 'no', but got: '%s'", trusted)
+		}
+	})
+}
+
+func TestRewriteForwardedFor(t *testing.T) {
+	newPlugin := func(t *testing.T, processHeaders []HeaderConfig) http.Handler {
+		cfg := &Config{
+			Enabled:             true,
+			HeaderName:          "X-Real-IP",
+			ProcessHeaders:      processHeaders,
+			ForceOverwrite:      true,
+			RewriteForwardedFor: true,
+			TrustAll:            false,
+			TrustedIPs:          []string{"10.0.0.0/8"},
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name           string
+		processHeaders []HeaderConfig
+		remoteAddr     string
+		headers        map[string]string
+		expectedXFF    string
+	}{
+		{
+			name:           "SpoofedPrefixRemoved",
+			processHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}},
+			remoteAddr:     "10.0.0.3:1234",
+			headers:        map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.1, 10.0.0.2"},
+			expectedXFF:    "203.0.113.1, 10.0.0.2",
+		},
+		{
+			name:           "LeftmostKeepsWholeChain",
+			processHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			remoteAddr:     "10.0.0.3:1234",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.1:4000, 10.0.0.2"},
+			expectedXFF:    "203.0.113.1, 10.0.0.2",
+		},
+		{
+			name:           "ResolvedFromOtherHeader",
+			processHeaders: []HeaderConfig{{HeaderName: "CF-Connecting-IP", Depth: -1}, {HeaderName: "X-Forwarded-For", Depth: -1}},
+			remoteAddr:     "10.0.0.3:1234",
+			headers:        map[string]string{"CF-Connecting-IP": "198.51.100.7", "X-Forwarded-For": "1.2.3.4, 198.51.100.7"},
+			expectedXFF:    "198.51.100.7",
+		},
+		{
+			name:           "UntrustedSourceUsesRemoteAddr",
+			processHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}},
+			remoteAddr:     "8.8.8.8:1234",
+			headers:        map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expectedXFF:    "8.8.8.8",
+		},
+		{
+			name:           "NothingResolvedRemovesHeader",
+			processHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			remoteAddr:     "8.8.8.8:1234",
+			headers:        map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			expectedXFF:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.processHeaders)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if xff := req.Header.Get("X-Forwarded-For"); xff != tt.expectedXFF {
+				t.Errorf("expected X-Forwarded-For to be '%s', but got: '%s'", tt.expectedXFF, xff)
+			}
+			if tt.expectedXFF == "" && len(req.Header.Values("X-Forwarded-For")) != 0 {
+				t.Error("expected X-Forwarded-For to be removed")
+			}
+		})
+	}
+
+	t.Run("DisabledLeavesHeaderUntouched", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}},
+			TrustAll:       true,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.1")
+
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if xff := req.Header.Get("X-Forwarded-For"); xff != "1.2.3.4, 203.0.113.1" {
+			t.Errorf("expected X-Forwarded-For to be unchanged, but got: '%s'", xff)
+		}
+	})
+}
+
+func TestAppendForwardedFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		rewrite     bool
+		remoteAddr  string
+		xff         []string
+		expectedXFF string
+	}{
+		{"MissingHeader", false, "10.0.0.2:1234", nil, "10.0.0.2"},
+		{"Appended", false, "10.0.0.2:1234", []string{"203.0.113.1"}, "203.0.113.1, 10.0.0.2"},
+		{"AlreadyLastHop", false, "10.0.0.2:1234", []string{"203.0.113.1, 10.0.0.2"}, "203.0.113.1, 10.0.0.2"},
+		{"AlreadyLastHopWithPort", false, "10.0.0.2:1234", []string{"203.0.113.1, 10.0.0.2:1234"}, "203.0.113.1, 10.0.0.2:1234"},
+		{"IPv6Peer", false, "[2001:db8::2]:1234", []string{"203.0.113.1"}, "203.0.113.1, 2001:db8::2"},
+		{"MultipleInstancesJoined", false, "10.0.0.2:1234", []string{"203.0.113.1", "198.51.100.1"}, "203.0.113.1, 198.51.100.1, 10.0.0.2"},
+		{"AfterRewrite", true, "10.0.0.2:1234", []string{"1.2.3.4, 203.0.113.1"}, "203.0.113.1, 10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Enabled:             true,
+				HeaderName:          "X-Real-IP",
+				ProcessHeaders:      []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}},
+				ForceOverwrite:      true,
+				RewriteForwardedFor: tt.rewrite,
+				AppendForwardedFor:  true,
+				RewriteRemoteAddr:   true,
+				TrustAll:            true,
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.xff {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if values := req.Header.Values("X-Forwarded-For"); len(values) != 1 || values[0] != tt.expectedXFF {
+				t.Errorf("expected X-Forwarded-For to be '%s', but got: %q", tt.expectedXFF, values)
+			}
+		})
+	}
+}
+
+func TestRewriteRemoteAddr(t *testing.T) {
+	tests := []struct {
+		name               string
+		remoteAddr         string
+		xff                string
+		placeholder        string
+		expectedRemoteAddr string
+	}{
+		{"PortFromHeader", "10.0.0.2:1234", "203.0.113.1:5678", "", "203.0.113.1:5678"},
+		{"PreservesConnectionPort", "10.0.0.2:1234", "203.0.113.1", "", "203.0.113.1:1234"},
+		{"IPv6Client", "10.0.0.2:1234", "2001:db8::1", "", "[2001:db8::1]:1234"},
+		{"SynthesizedPort", "10.0.0.2", "203.0.113.1", "", "203.0.113.1:0"},
+		{"NothingResolved", "10.0.0.2:1234", "", "", "10.0.0.2:1234"},
+		{"NotAnIP", "10.0.0.2:1234", "admin:1234", "", "10.0.0.2:1234"},
+		{"NeverPlaceholder", "10.0.0.2:1234", "unknown", "unknown", "10.0.0.2:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Enabled:           true,
+				HeaderName:        "X-Real-IP",
+				ProcessHeaders:    []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+				ForceOverwrite:    true,
+				RewriteRemoteAddr: true,
+				TrustAll:          true,
+			}
+			cfg.InvalidOutputPlaceholder = tt.placeholder
+
+			var seenRemoteAddr string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				seenRemoteAddr = req.RemoteAddr
+			})
+
+			plugin, err := New(context.TODO(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if seenRemoteAddr != tt.expectedRemoteAddr {
+				t.Errorf("expected next handler to see RemoteAddr '%s', but got: '%s'", tt.expectedRemoteAddr, seenRemoteAddr)
+			}
+		})
+	}
+}
+
+func TestReservedHeaderNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		headerName    string
+		trustedHeader string
+		allowReserved bool
+		expectError   bool
+	}{
+		{"HeaderNameHost", "Host", "", false, true},
+		{"HeaderNameContentLength", "content-length", "", false, true},
+		{"TrustedHeaderConnection", "X-Real-IP", "Connection", false, true},
+		{"TrustedHeaderTransferEncoding", "X-Real-IP", "Transfer-Encoding", false, true},
+		{"RegularHeaders", "X-Real-IP", "X-Is-Trusted", false, false},
+		{"OverrideFlag", "Host", "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logWriter = &logs
+			defer func() { logWriter = os.Stdout }()
+
+			cfg := &Config{
+				Enabled:                  true,
+				HeaderName:               tt.headerName,
+				ProcessHeaders:           []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+				TrustAll:                 true,
+				TrustedHeader:            tt.trustedHeader,
+				AllowReservedHeaderNames: tt.allowReserved,
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error for reserved header name, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("expected no error, but got: %v", err)
+			}
+			if tt.allowReserved && !strings.Contains(logs.String(), "reserved header") {
+				t.Errorf("expected a warning to be logged, but got: %q", logs.String())
+			}
+		})
+	}
+}
+
+func TestSourceHeaderName(t *testing.T) {
+	cfg := &Config{
+		Enabled:    true,
+		HeaderName: "X-Real-IP",
+		ProcessHeaders: []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP", Depth: -1},
+			{HeaderName: "X-Forwarded-For", Depth: 1},
+			{HeaderName: "clientAddress", Depth: -1},
+		},
+		ForceOverwrite:   true,
+		SourceHeaderName: "X-Real-IP-Source",
+		TrustAll:         false,
+		TrustedIPs:       []string{"10.0.0.0/8"},
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		headers        map[string]string
+		expectedSource string
+	}{
+		{"FromCDNHeader", "10.0.0.2:1234", map[string]string{"CF-Connecting-IP": "203.0.113.1"}, "CF-Connecting-IP[0]"},
+		{"FromForwardedForPosition", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.1, 10.0.0.3"}, "X-Forwarded-For[1]"},
+		{"FromClientAddress", "8.8.8.8:1234", map[string]string{"CF-Connecting-IP": "203.0.113.1"}, "clientAddress[0]"},
+		{"SpoofedSourceOverwritten", "10.0.0.2:1234", map[string]string{"X-Real-IP-Source": "spoofed", "CF-Connecting-IP": "203.0.113.1"}, "CF-Connecting-IP[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if source := req.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected X-Real-IP-Source to be '%s', but got: '%s'", tt.expectedSource, source)
+			}
+		})
+	}
+
+	t.Run("NothingResolved", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:          true,
+			HeaderName:       "X-Real-IP",
+			ProcessHeaders:   []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			ForceOverwrite:   true,
+			SourceHeaderName: "X-Real-IP-Source",
+			TrustAll:         true,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Real-IP-Source", "spoofed")
+
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if source := req.Header.Get("X-Real-IP-Source"); source != "" {
+			t.Errorf("expected X-Real-IP-Source to be empty, but got: '%s'", source)
+		}
+	})
+}
+
 func TestExtractRealIP(t *testing.T) {
 	cfg := &Config{
 		Enabled:        true,
@@ -1230,6 +1664,7 @@ func TestCleanIPAddress(t *testing.T) {
 		{"  203.0.113.1:8080  ", "203.0.113.1"},
 		{"2001:db8::1", "2001:db8::1"},
 		{"[2001:db8::1]:8080", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
 		{"", ""},
 		{"   ", ""},
 	}
@@ -1269,13 +1704,17 @@ func TestCreateConfig(t *testing.T) {
 		{HeaderName: "CF-Connecting-IP", Depth: -1},
 		{HeaderName: "clientAddress", Depth: -1},
 	}
-	if len(config.ProcessHeaders) != len(expectedHeaders) {
-		t.Errorf("expected %d process headers, but got %d", len(expectedHeaders), len(config.ProcessHeaders))
+	processHeaders, err := parseProcessHeaders(pluginName, config.ProcessHeaders)
+	if err != nil {
+		t.Fatalf("expected default ProcessHeaders to be valid, but got: %v", err)
+	}
+	if len(processHeaders) != len(expectedHeaders) {
+		t.Errorf("expected %d process headers, but got %d", len(expectedHeaders), len(processHeaders))
 	}
 
 	for i, expected := range expectedHeaders {
-		if i >= len(config.ProcessHeaders) || config.ProcessHeaders[i].HeaderName != expected.HeaderName || config.ProcessHeaders[i].Depth != expected.Depth {
-			t.Errorf("expected ProcessHeaders[%d] to be %+v, but got %+v", i, expected, config.ProcessHeaders[i])
+		if i >= len(processHeaders) || processHeaders[i].HeaderName != expected.HeaderName || processHeaders[i].Depth != expected.Depth {
+			t.Errorf("expected ProcessHeaders[%d] to be %+v, but got %+v", i, expected, processHeaders[i])
 		}
 	}
 }
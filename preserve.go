@@ -0,0 +1,44 @@
+package traefik_realip
+
+import (
+	"net/http"
+)
+
+// originalHeaderPrefix names the backups of the headers preserveOriginal keeps
+const originalHeaderPrefix = "X-Original-"
+
+// preservedHeaders returns the headers whose inbound values preserveOriginal keeps: the
+// output header and X-Forwarded-For
+func (r *Resolver) preservedHeaders() []string {
+	headers := []string{http.CanonicalHeaderKey(r.headerName)}
+	if headers[0] != "X-Forwarded-For" {
+		headers = append(headers, "X-Forwarded-For")
+	}
+	return headers
+}
+
+// isPreservedBackup reports whether header is one of the X-Original-* backups preserveOriginal writes
+func (r *Resolver) isPreservedBackup(header string) bool {
+	if !r.preserveOriginal {
+		return false
+	}
+	for _, preserved := range r.preservedHeaders() {
+		if http.CanonicalHeaderKey(header) == originalHeaderPrefix+preserved {
+			return true
+		}
+	}
+	return false
+}
+
+// preserveOriginals copies the inbound values of the preserved headers to their
+// X-Original-* backups before anything is modified. Backups the client sent are removed
+// first, so a backup always holds what reached this instance.
+func (r *Resolver) preserveOriginals(req *http.Request) {
+	for _, header := range r.preservedHeaders() {
+		backup := originalHeaderPrefix + header
+		req.Header.Del(backup)
+		if values := req.Header.Values(header); len(values) > 0 {
+			req.Header[backup] = append([]string(nil), values...)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreserveOriginal(t *testing.T) {
+	tests := []struct {
+		name        string
+		preserve    bool
+		realIP      []string
+		xff         []string
+		forgedXFF   string
+		expectedIP  string
+		expectedXFF string
+	}{
+		{"Disabled", false, []string{"1.2.3.4"}, []string{"1.2.3.4, 203.0.113.9"}, "", "", ""},
+		{"CopiesBothHeaders", true, []string{"1.2.3.4"}, []string{"1.2.3.4, 203.0.113.9"}, "", "1.2.3.4", "1.2.3.4, 203.0.113.9"},
+		{"KeepsRepeatedLines", true, nil, []string{"1.2.3.4", "203.0.113.9"}, "", "", "1.2.3.4|203.0.113.9"},
+		{"RemovesForgedBackup", true, nil, nil, "198.51.100.1", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.PreserveOriginal = tt.preserve
+			cfg.RewriteForwardedFor = true
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: 0},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for _, value := range tt.realIP {
+				req.Header.Add("X-Real-IP", value)
+			}
+			for _, value := range tt.xff {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.forgedXFF != "" {
+				req.Header.Set("X-Original-X-Forwarded-For", tt.forgedXFF)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if ip := strings.Join(req.Header.Values("X-Original-X-Real-IP"), "|"); ip != tt.expectedIP {
+				t.Errorf("expected original X-Real-IP '%s', but got: '%s'", tt.expectedIP, ip)
+			}
+			if xff := strings.Join(req.Header.Values("X-Original-X-Forwarded-For"), "|"); xff != tt.expectedXFF {
+				t.Errorf("expected original X-Forwarded-For '%s', but got: '%s'", tt.expectedXFF, xff)
+			}
+		})
+	}
+}
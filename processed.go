@@ -0,0 +1,58 @@
+package traefik_realip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// What an instance does with a request an earlier instance already processed
+const (
+	alreadyProcessedReprocess = "reprocess"
+	alreadyProcessedSkip      = "skip"
+	alreadyProcessedMerge     = "merge"
+)
+
+// processedContextKey marks request contexts an instance of the plugin has processed; the
+// value is the set of output headers the instances wrote, by canonical name
+type processedContextKey struct{}
+
+// parseAlreadyProcessed validates the alreadyProcessed configuration, defaulting to reprocess
+func parseAlreadyProcessed(name, mode string) (string, error) {
+	switch mode {
+	case "":
+		return alreadyProcessedReprocess, nil
+	case alreadyProcessedReprocess, alreadyProcessedSkip, alreadyProcessedMerge:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s: alreadyProcessed must be %q, %q or %q, got %q", name, alreadyProcessedReprocess, alreadyProcessedSkip, alreadyProcessedMerge, mode)
+	}
+}
+
+// markProcessed returns req with a context recording that an instance processed it and
+// wrote the output headers in written, along with those of earlier instances. Instances
+// further down the middleware chain of the same Traefik detect it.
+func markProcessed(req *http.Request, written map[string]bool) *http.Request {
+	outputs := make(map[string]bool, len(written))
+	if earlier, ok := req.Context().Value(processedContextKey{}).(map[string]bool); ok {
+		for header := range earlier {
+			outputs[header] = true
+		}
+	}
+	for header := range written {
+		outputs[header] = true
+	}
+	return req.WithContext(context.WithValue(req.Context(), processedContextKey{}, outputs))
+}
+
+// processedBefore reports whether an earlier instance processed req: in this process, as
+// recorded in its context, or in another one, as recorded by processedMarkerHeader. The
+// marker header is only honored from trusted sources, since clients could send it.
+// written holds the output headers instances in this process wrote; it is nil when only
+// the marker header of a trusted proxy is known, whose headers are all its own.
+func (r *Resolver) processedBefore(req *http.Request, isTrusted bool) (processed bool, written map[string]bool) {
+	if written, ok := req.Context().Value(processedContextKey{}).(map[string]bool); ok {
+		return true, written
+	}
+	return isTrusted && r.processedMarkerHeader != "" && req.Header.Get(r.processedMarkerHeader) != "", nil
+}
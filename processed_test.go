@@ -0,0 +1,139 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlreadyProcessed(t *testing.T) {
+	// newChain nests two instances: the outer resolves X-Forwarded-For into X-Real-IP,
+	// the inner resolves clientAddress and applies alreadyProcessed. configure, when not nil,
+	// adjusts the outer configuration.
+	newChain := func(t *testing.T, mode string, configure func(cfg *Config), captured **http.Request) http.Handler {
+		inner := CreateConfig()
+		inner.ProcessHeaders = []HeaderConfig{{HeaderName: "clientAddress"}}
+		inner.SourceHeaderName = "X-Real-IP-Source"
+		inner.AlreadyProcessed = mode
+
+		last := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { *captured = req })
+		innerPlugin, err := New(context.TODO(), last, inner, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		outer := CreateConfig()
+		outer.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}}
+		if configure != nil {
+			configure(outer)
+		}
+		outerPlugin, err := New(context.TODO(), innerPlugin, outer, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return outerPlugin
+	}
+
+	disabled := func(cfg *Config) { cfg.Enabled = false }
+	unmatched := func(cfg *Config) { cfg.Match = Match{Paths: []string{"/api"}} }
+
+	tests := []struct {
+		name           string
+		mode           string
+		configure      func(cfg *Config)
+		clientSource   string
+		expectedIP     string
+		expectedSource string
+	}{
+		{"Reprocessed", "", nil, "", "192.0.2.1", "clientAddress[0]"},
+		{"Skipped", alreadyProcessedSkip, nil, "", "203.0.113.5", ""},
+		{"Merged", alreadyProcessedMerge, nil, "", "203.0.113.5", "clientAddress[0]"},
+		{"MergeReplacesClientValue", alreadyProcessedMerge, nil, "spoofed", "203.0.113.5", "clientAddress[0]"},
+		{"DisabledOuterNotSkipped", alreadyProcessedSkip, disabled, "", "192.0.2.1", "clientAddress[0]"},
+		{"UnmatchedOuterNotSkipped", alreadyProcessedSkip, unmatched, "", "192.0.2.1", "clientAddress[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var captured *http.Request
+			chain := newChain(t, tt.mode, tt.configure, &captured)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", "203.0.113.5")
+			if tt.clientSource != "" {
+				req.Header.Set("X-Real-IP-Source", tt.clientSource)
+			}
+			chain.ServeHTTP(httptest.NewRecorder(), req)
+
+			if captured == nil {
+				t.Fatal("expected the request to reach the last handler")
+			}
+			if realIP := captured.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if source := captured.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected X-Real-IP-Source '%s', but got: '%s'", tt.expectedSource, source)
+			}
+		})
+	}
+
+	t.Run("MarkerHeader", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			remoteAddr string
+			marker     string
+			expectedIP string
+		}{
+			{"TrustedMarkerSkips", "10.0.0.1:1234", "edge", "203.0.113.5"},
+			{"UntrustedMarkerIgnored", "192.0.2.1:1234", "edge", "192.0.2.1"},
+			{"NoMarker", "10.0.0.1:1234", "", "10.0.0.1"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.TrustAll = false
+				cfg.TrustedIPs = []string{"10.0.0.0/8"}
+				cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "clientAddress"}}
+				cfg.AlreadyProcessed = alreadyProcessedSkip
+				cfg.ProcessedMarkerHeader = "X-Real-IP-Processed"
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, "inner")
+				if err != nil {
+					t.Fatalf("failed to create plugin: %v", err)
+				}
+
+				req := httptest.NewRequest(http.MethodGet, "/test", nil)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Real-IP", "203.0.113.5")
+				if tt.marker != "" {
+					req.Header.Set("X-Real-IP-Processed", tt.marker)
+				}
+				plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+				if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+					t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+				}
+				if tt.expectedIP != "203.0.113.5" {
+					if marker := req.Header.Get("X-Real-IP-Processed"); marker != "inner" {
+						t.Errorf("expected X-Real-IP-Processed 'inner', but got: '%s'", marker)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.AlreadyProcessed = "ignore"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown alreadyProcessed mode, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Profiles combining coherent defaults for common deployments
+const (
+	profileStrictSecurity = "strict-security"
+	profileBehindCDN      = "behind-cdn"
+	profileLANOnly        = "lan-only"
+	profilePermissive     = "permissive"
+)
+
+// privateRanges are the RFC 1918 and unique local ranges trusted by the lan-only profile
+var privateRanges = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// profiles set the defaults of each profile on a configuration created by CreateConfig
+var profiles = map[string]func(cfg *Config){
+	profileStrictSecurity: func(cfg *Config) {
+		cfg.TrustAll = false
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: untrustedDepthKeyword}, {HeaderName: "clientAddress", Depth: -1}}
+		cfg.ForceOverwrite = true
+		cfg.Fallback = fallbackRemoteAddr
+		cfg.StrictMode = true
+		cfg.ExoticIPv4 = exoticIPv4Reject
+		cfg.ConflictPolicy = conflictIgnore
+		cfg.StripSpoofedHeaders = true
+		cfg.StripKnownHeaders = true
+	},
+	profileBehindCDN: func(cfg *Config) {
+		cfg.TrustAll = false
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: untrustedDepthKeyword}, {HeaderName: "clientAddress", Depth: -1}}
+		cfg.ForceOverwrite = true
+		cfg.Fallback = fallbackRemoteAddr
+		cfg.StripKnownHeaders = true
+	},
+	profileLANOnly: func(cfg *Config) {
+		cfg.TrustAll = false
+		cfg.TrustedIPs = append([]string(nil), privateRanges...)
+		cfg.TrustLoopbackAlways = true
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: untrustedDepthKeyword}, {HeaderName: "X-Real-IP", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}}
+		cfg.ForceOverwrite = true
+		cfg.Fallback = fallbackRemoteAddr
+		cfg.StripKnownHeaders = true
+	},
+	profilePermissive: func(cfg *Config) {
+		cfg.TrustAll = true
+		cfg.ForceOverwrite = false
+		cfg.Fallback = fallbackRemoteAddr
+		cfg.ExoticIPv4 = exoticIPv4Normalize
+	},
+}
+
+// applyProfile returns cfg with the defaults of its profile filled in. Only settings still at
+// their CreateConfig default take the profile's value, so any setting the user configured
+// overrides it. cfg itself is left untouched; it is returned as is when the profile is unknown.
+func applyProfile(name string, cfg *Config) (*Config, error) {
+	if cfg.Profile == "" {
+		return cfg, nil
+	}
+	profile, known := profiles[cfg.Profile]
+	if !known {
+		return cfg, fmt.Errorf("%s: profile must be %q, %q, %q or %q, got %q", name, profileStrictSecurity, profileBehindCDN, profileLANOnly, profilePermissive, cfg.Profile)
+	}
+
+	defaults, profiled := CreateConfig(), CreateConfig()
+	profile(profiled)
+
+	applied := *cfg
+	target := reflect.ValueOf(&applied).Elem()
+	defaultValues, profiledValues := reflect.ValueOf(defaults).Elem(), reflect.ValueOf(profiled).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		defaultValue := defaultValues.Field(i).Interface()
+		if reflect.DeepEqual(profiledValues.Field(i).Interface(), defaultValue) || !reflect.DeepEqual(target.Field(i).Interface(), defaultValue) {
+			continue
+		}
+		target.Field(i).Set(profiledValues.Field(i))
+	}
+	return &applied, nil
+}
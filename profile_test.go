@@ -0,0 +1,96 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    string
+		configure  func(cfg *Config)
+		remoteAddr string
+		xff        string
+		expectedIP string
+	}{
+		{"NoProfile", "", nil, "192.0.2.1:1234", "203.0.113.1", "203.0.113.1"},
+		{"PermissiveTrustsAll", profilePermissive, nil, "192.0.2.1:1234", "203.0.113.1", "203.0.113.1"},
+		{"LANOnlyTrustsPrivate", profileLANOnly, nil, "10.0.0.1:1234", "203.0.113.1, 192.168.1.1", "203.0.113.1"},
+		{"LANOnlyUntrustsPublic", profileLANOnly, nil, "192.0.2.1:1234", "203.0.113.1", "192.0.2.1"},
+		{"LANOnlyLoopback", profileLANOnly, nil, "127.0.0.1:1234", "203.0.113.1", "203.0.113.1"},
+		{"BehindCDN", profileBehindCDN, func(cfg *Config) { cfg.TrustedIPs = []string{"198.51.100.0/24"} }, "198.51.100.1:1234", "192.0.2.9, 203.0.113.1, 198.51.100.2", "203.0.113.1"},
+		{"StrictSecurityFallsBackToRemoteAddr", profileStrictSecurity, func(cfg *Config) { cfg.TrustedIPs = []string{"10.0.0.0/8"} }, "192.0.2.1:1234", "203.0.113.1", "192.0.2.1"},
+		{"OverriddenSetting", profileLANOnly, func(cfg *Config) { cfg.TrustedIPs = []string{"192.0.2.0/24"} }, "10.0.0.1:1234", "203.0.113.1", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Profile = tt.profile
+			if tt.configure != nil {
+				tt.configure(cfg)
+			}
+
+			handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("OverridesWin", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Profile = profileStrictSecurity
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ExoticIPv4 = exoticIPv4Normalize
+
+		applied, err := applyProfile(pluginName, cfg)
+		if err != nil {
+			t.Fatalf("failed to apply profile: %v", err)
+		}
+		if applied.ExoticIPv4 != exoticIPv4Normalize || applied.StrictMode != true || applied.TrustAll {
+			t.Errorf("expected the configured exoticIPv4 to override the profile, but got %+v", applied)
+		}
+		if cfg.StrictMode {
+			t.Error("expected the original configuration to be left untouched")
+		}
+	})
+
+	t.Run("VersionStamp", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Profile = profilePermissive
+
+		resolver, err := NewResolver(cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create resolver: %v", err)
+		}
+		if version := resolver.versionStamp(); version != pluginVersion+"+compat.1.permissive" {
+			t.Errorf("expected version '%s+compat.1.permissive', but got '%s'", pluginVersion, version)
+		}
+	})
+
+	t.Run("UnknownProfile", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.Profile = "paranoid"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown profile, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
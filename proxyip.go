@@ -0,0 +1,75 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// What happens when the resolved IP is itself in the trusted ranges
+const (
+	resolvedProxyOff     = "off"
+	resolvedProxyFlag    = "flag"
+	resolvedProxyCorrect = "correct"
+)
+
+// parseResolvedProxyCheck validates the resolvedProxyCheck configuration, defaulting to off
+func parseResolvedProxyCheck(name, mode, resolvedProxyHeaderName string) (string, error) {
+	switch mode {
+	case "":
+		mode = resolvedProxyOff
+	case resolvedProxyOff, resolvedProxyFlag, resolvedProxyCorrect:
+	default:
+		return "", fmt.Errorf("%s: resolvedProxyCheck must be %q, %q or %q, got %q", name, resolvedProxyOff, resolvedProxyFlag, resolvedProxyCorrect, mode)
+	}
+	if mode == resolvedProxyOff && resolvedProxyHeaderName != "" {
+		return "", fmt.Errorf("%s: resolvedProxyHeaderName requires resolvedProxyCheck", name)
+	}
+	return mode, nil
+}
+
+// checkResolvedProxy records in resolved.proxy whether a header resolved to an IP in the
+// trusted ranges, i.e. one of our own proxies rather than the client: the depth is most
+// likely off by one. In correct mode the walk continues leftwards to the first untrusted
+// entry, or the leftmost one when all are trusted.
+func (r *Resolver) checkResolvedProxy(resolved resolution) resolution {
+	if resolved.ip == "" || resolved.fallback || r.isSynthetic(resolved.header) {
+		return resolved
+	}
+	ip := parseAddress(resolved.ip)
+	if ip == nil || !r.inTrustedRanges(ip) {
+		return resolved
+	}
+
+	resolved.proxy = resolved.ip
+	if r.resolvedProxyCheck == resolvedProxyCorrect && resolved.index > 0 && resolved.index < len(resolved.chain) {
+		index := 0
+		for i := resolved.index - 1; i > 0; i-- {
+			if entry := parseAddress(resolved.chain[i]); entry == nil || !r.inTrustedRanges(entry) {
+				index = i
+				break
+			}
+		}
+		resolved.ip, resolved.port, resolved.index = resolved.chain[index], "", index
+		resolved = r.hardenResolution(resolved)
+	}
+	return resolved
+}
+
+// reportResolvedProxy counts and logs, rate-limited, a request the resolved proxy check caught
+func (r *Resolver) reportResolvedProxy(req *http.Request, resolved resolution) {
+	atomic.AddInt64(&r.stats.resolvedProxies, 1)
+
+	ok, suppressed := r.resolvedProxyLog.allow(time.Now())
+	if suppressed > 0 {
+		logf(r.name, "warning: %d resolved proxy warnings suppressed by the rate limit", suppressed)
+	}
+	if ok {
+		if resolved.ip != resolved.proxy {
+			r.requestLogf(req, "warning: %s resolved to the trusted proxy %s, corrected to %s; its depth is likely off by one", resolved.header, resolved.proxy, resolved.ip)
+		} else {
+			r.requestLogf(req, "warning: %s resolved to the trusted proxy %s; its depth is likely off by one", resolved.header, resolved.proxy)
+		}
+	}
+}
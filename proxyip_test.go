@@ -0,0 +1,104 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestResolvedProxyCheck(t *testing.T) {
+	newPlugin := func(t *testing.T, mode string, depth interface{}) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: depth}, {HeaderName: "clientAddress", Depth: 0}}
+		cfg.SourceHeaderName = "X-Real-IP-Source"
+		cfg.ResolvedProxyCheck = mode
+		if mode != resolvedProxyOff {
+			cfg.ResolvedProxyHeaderName = "X-Real-IP-Is-Proxy"
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name           string
+		mode           string
+		depth          interface{}
+		xff            string
+		expectedIP     string
+		expectedSource string
+		expectedProxy  string
+		expectWarning  bool
+	}{
+		{"Off", resolvedProxyOff, 0, "203.0.113.5, 10.0.0.2", "10.0.0.2", "X-Forwarded-For[1]", "", false},
+		{"FlagKeepsIP", resolvedProxyFlag, 0, "203.0.113.5, 10.0.0.2", "10.0.0.2", "X-Forwarded-For[1]", "yes", true},
+		{"FlagClientIP", resolvedProxyFlag, 0, "203.0.113.5", "203.0.113.5", "X-Forwarded-For[0]", "no", false},
+		{"CorrectWalksLeft", resolvedProxyCorrect, 0, "198.51.100.1, 203.0.113.5, 10.0.0.3, 10.0.0.2", "203.0.113.5", "X-Forwarded-For[1]", "yes", true},
+		{"CorrectAllTrusted", resolvedProxyCorrect, 0, "10.0.0.4, 10.0.0.3, 10.0.0.2", "10.0.0.4", "X-Forwarded-For[0]", "yes", true},
+		{"CorrectLeftmostStays", resolvedProxyCorrect, -1, "10.0.0.4, 203.0.113.5", "10.0.0.4", "X-Forwarded-For[0]", "yes", true},
+		{"ClientAddressNotChecked", resolvedProxyCorrect, 0, "", "10.0.0.1", "clientAddress[0]", "no", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logWriter = &logs
+			defer func() { logWriter = os.Stdout }()
+
+			plugin := newPlugin(t, tt.mode, tt.depth)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-Real-IP-Is-Proxy", "forged")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if source := req.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected source '%s', but got: '%s'", tt.expectedSource, source)
+			}
+			if tt.mode != resolvedProxyOff {
+				if proxy := req.Header.Get("X-Real-IP-Is-Proxy"); proxy != tt.expectedProxy {
+					t.Errorf("expected proxy header '%s', but got: '%s'", tt.expectedProxy, proxy)
+				}
+			}
+			if warned := strings.Contains(logs.String(), "resolved to the trusted proxy"); warned != tt.expectWarning {
+				t.Errorf("expected warning=%v, but got logs: %s", tt.expectWarning, logs.String())
+			}
+			if counted := plugin.Stats().ResolvedProxies; (counted == 1) != tt.expectWarning {
+				t.Errorf("expected resolvedProxies counted=%v, but got %d", tt.expectWarning, counted)
+			}
+		})
+	}
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		for _, cfg := range []*Config{
+			{ResolvedProxyCheck: "fix"},
+			{ResolvedProxyHeaderName: "X-Real-IP-Is-Proxy"},
+		} {
+			base := CreateConfig()
+			base.ResolvedProxyCheck, base.ResolvedProxyHeaderName = cfg.ResolvedProxyCheck, cfg.ResolvedProxyHeaderName
+
+			plugin, err := New(context.TODO(), &noopHandler{}, base, pluginName)
+			if err == nil {
+				t.Errorf("expected error for resolvedProxyCheck %q with header %q, but got none", cfg.ResolvedProxyCheck, cfg.ResolvedProxyHeaderName)
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// parseEntry parses an entry of a range list, which is an exclusion when prefixed with "!"
+func parseEntry(entry string) ([]*net.IPNet, bool, error) {
+	excluded := strings.HasPrefix(entry, "!")
+	blocks, err := parseBlocks(strings.TrimPrefix(entry, "!"))
+	return blocks, excluded, err
+}
+
+// parseBlocks parses an entry of a range list: a CIDR block, a single IP address, which is a
+// /32 or /128 block, or an inclusive range "first-last", split into the fewest blocks covering it
+func parseBlocks(entry string) ([]*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, block, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("parse error on CIDR %q: %v", entry, err)
+		}
+		return []*net.IPNet{block}, nil
+	}
+	if first, last, ok := strings.Cut(entry, "-"); ok && net.ParseIP(strings.TrimSpace(first)) != nil {
+		return rangeBlocks(entry, first, last)
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil || addr.Zone() != "" {
+		_, _, err = net.ParseCIDR(entry)
+		return nil, fmt.Errorf("parse error on CIDR %q: %v", entry, err)
+	}
+	addr = addr.Unmap()
+	return []*net.IPNet{blockOf(netip.PrefixFrom(addr, addr.BitLen()))}, nil
+}
+
+// rangeBlocks splits the inclusive range from first to last into the fewest CIDR blocks
+// covering it, e.g. 10.0.0.5-10.0.0.20 into 10.0.0.5/32, 10.0.0.6/31, 10.0.0.8/29 and 10.0.0.16/30
+func rangeBlocks(entry, first, last string) ([]*net.IPNet, error) {
+	start, err := netip.ParseAddr(strings.TrimSpace(first))
+	if err != nil || start.Zone() != "" {
+		return nil, fmt.Errorf("parse error on range %q: invalid first address %q", entry, first)
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(last))
+	if err != nil || end.Zone() != "" {
+		return nil, fmt.Errorf("parse error on range %q: invalid last address %q", entry, last)
+	}
+	start, end = start.Unmap(), end.Unmap()
+	if start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("parse error on range %q: mixes IPv4 and IPv6", entry)
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("parse error on range %q: first address is after the last", entry)
+	}
+
+	var blocks []*net.IPNet
+	for {
+		// The largest block starting at start that ends within the range
+		bits := start.BitLen()
+		for bits > 0 {
+			prefix := netip.PrefixFrom(start, bits-1).Masked()
+			if prefix.Addr() != start || end.Less(lastAddr(prefix)) {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		blocks = append(blocks, blockOf(prefix))
+
+		next := lastAddr(prefix).Next()
+		if !next.IsValid() || end.Less(next) {
+			return blocks, nil
+		}
+		start = next
+	}
+}
+
+// lastAddr returns the highest address of prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	ip := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < 8*len(ip); i++ {
+		ip[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr
+}
+
+// blockOf converts prefix to the net.IPNet form the radix tree stores
+func blockOf(prefix netip.Prefix) *net.IPNet {
+	addr := prefix.Masked().Addr()
+	return &net.IPNet{IP: addr.AsSlice(), Mask: net.CIDRMask(prefix.Bits(), addr.BitLen())}
+}
@@ -0,0 +1,108 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		expected []string
+		wantErr  bool
+	}{
+		{"CIDR", "10.0.0.0/8", []string{"10.0.0.0/8"}, false},
+		{"CIDRWithHostBits", "10.0.0.1/8", []string{"10.0.0.0/8"}, false},
+		{"SingleIPv4", "192.168.1.10", []string{"192.168.1.10/32"}, false},
+		{"SingleIPv6", "2001:db8::1", []string{"2001:db8::1/128"}, false},
+		{"SingleIPv4Mapped", "::ffff:192.0.2.1", []string{"192.0.2.1/32"}, false},
+		{"Range", "10.0.0.5-10.0.0.20", []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/29", "10.0.0.16/30", "10.0.0.20/32"}, false},
+		{"RangeWithSpaces", "10.0.0.0 - 10.0.0.255", []string{"10.0.0.0/24"}, false},
+		{"RangeSingleAddress", "10.0.0.7-10.0.0.7", []string{"10.0.0.7/32"}, false},
+		{"RangeWholeFamily", "0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}, false},
+		{"RangeIPv6", "2001:db8::-2001:db8::3", []string{"2001:db8::/126"}, false},
+		{"RangeIPv6Top", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"}, false},
+		{"RangeReversed", "10.0.0.20-10.0.0.5", nil, true},
+		{"RangeMixedFamilies", "10.0.0.1-2001:db8::1", nil, true},
+		{"RangeInvalidLast", "10.0.0.1-10.0.0.300", nil, true},
+		{"Zone", "fe80::1%eth0", nil, true},
+		{"Invalid", "not-a-cidr", nil, true},
+		{"MissingPrefix", "192.168.1", nil, true},
+		{"Empty", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseBlocks(tt.entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error for %q, but got %v", tt.entry, blocks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", tt.entry, err)
+			}
+			var got []string
+			for _, block := range blocks {
+				got = append(got, block.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseBlocks(%q) = %v, want %v", tt.entry, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRangeAndExclusionEntries(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.TrustAll = false
+	cfg.TrustedIPs = []string{"10.0.0.5", "10.0.1.5-10.0.1.20", "!10.0.1.10"}
+	cfg.DenyIPs = []string{"203.0.113.7", "198.51.100.10-198.51.100.12", "192.0.2.0/24", "!192.0.2.128/25"}
+	cfg.TrustedHeader = "X-Is-Trusted"
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		xff            string
+		expectedStatus int
+		expectedTrust  string
+	}{
+		{"SingleIPTrusted", "10.0.0.5:1234", "198.51.100.1", http.StatusOK, "yes"},
+		{"NeighborNotTrusted", "10.0.0.6:1234", "198.51.100.1", http.StatusOK, "no"},
+		{"RangeTrusted", "10.0.1.12:1234", "198.51.100.1", http.StatusOK, "yes"},
+		{"AfterRangeNotTrusted", "10.0.1.21:1234", "198.51.100.1", http.StatusOK, "no"},
+		{"SingleIPDenied", "10.0.0.5:1234", "203.0.113.7", http.StatusForbidden, ""},
+		{"RangeDenied", "10.0.0.5:1234", "198.51.100.12", http.StatusForbidden, ""},
+		{"AfterDeniedRange", "10.0.0.5:1234", "198.51.100.13", http.StatusOK, "yes"},
+		{"ExcludedFromTrust", "10.0.1.10:1234", "198.51.100.1", http.StatusOK, "no"},
+		{"DeniedOutsideHole", "10.0.0.5:1234", "192.0.2.1", http.StatusForbidden, ""},
+		{"HoleInDenied", "10.0.0.5:1234", "192.0.2.200", http.StatusOK, "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && req.Header.Get("X-Is-Trusted") != tt.expectedTrust {
+				t.Errorf("expected X-Is-Trusted '%s', but got: '%s'", tt.expectedTrust, req.Header.Get("X-Is-Trusted"))
+			}
+		})
+	}
+}
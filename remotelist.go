@@ -0,0 +1,409 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the remote IP lists
+const (
+	defaultRemoteListRefreshInterval = time.Hour
+	defaultRemoteListRetryInterval   = time.Minute // Delay before the first retry of a failed download, doubled per failure
+	remoteListTimeout                = 10 * time.Second
+)
+
+// maxRemoteListSize bounds the body of a remote IP list that is read
+const maxRemoteListSize = 8 << 20
+
+// trustReasonRemoteList is the trust reason of sources in a trusted remote IP list
+const trustReasonRemoteList = "remoteIPList"
+
+// RemoteIPList is a list of IP ranges downloaded from a URL and refreshed periodically,
+// such as the exit nodes of a VPN provider or the prefixes of a scraper's ASN.
+type RemoteIPList struct {
+	Label           string `json:"label,omitempty"`           // Label written to ipTagsHeaderName for real IPs in the list (e.g., "vpn")
+	URL             string `json:"url"`                       // http(s) URL serving one CIDR block, IP or range per line, with '#' comments
+	RefreshInterval int    `json:"refreshInterval,omitempty"` // Seconds between downloads (default: 3600)
+	Trusted         bool   `json:"trusted,omitempty"`         // Whether sources in the list are trusted, like trustedIPs
+
+	// Verification of downloaded lists, which are rejected unless every configured check passes
+	ChecksumURL  string `json:"checksumURL,omitempty"`  // URL of the list's SHA-256, as a hex digest or sha256sum output
+	PublicKey    string `json:"publicKey,omitempty"`    // minisign public key, or base64 Ed25519 key, the list must be signed with
+	SignatureURL string `json:"signatureURL,omitempty"` // URL of the list's signature (default: url + ".minisig" for minisign keys, url + ".sig" for Ed25519 keys)
+}
+
+// remoteList keeps an IpLookupHelper in sync with a RemoteIPList. As with cidrFileWatcher,
+// refreshes are driven by lookups; downloads, the first one included, run in a goroutine
+// bounded by the client timeout, so neither loading the plugin nor lookups wait on the network.
+type remoteList struct {
+	name     string
+	label    string
+	url      string
+	trusted  bool
+	interval time.Duration
+	client   *http.Client
+	cache    string        // Path of the on-disk copy of the last successful download, "" when not cached
+	verifier *listVerifier // Checks of downloaded lists, nil when they are not verified
+
+	mu           sync.RWMutex
+	helper       *IpLookupHelper
+	updated      time.Time // When the list was last downloaded or confirmed unchanged, zero until the first success
+	etag         string    // Validators of the current list, sent to only download it again when it changed
+	lastModified string
+	failures     int // Consecutive failed downloads
+
+	nextCheck int64         // Unix nanoseconds of the next allowed download, accessed atomically
+	attempted chan struct{} // Closed once the download started by start completed, successfully or not
+}
+
+// newRemoteLists validates the remote IP lists. Nothing is downloaded until start is called.
+// A list must have a label, be trusted or both; several lists may share a label, and real
+// IPs in any of them are tagged with it. With a cacheDir, which is created if missing, the
+// last successful download of each list is kept there.
+func newRemoteLists(name string, lists []RemoteIPList, tagsHeaderName, cacheDir string) ([]*remoteList, error) {
+	var problems configErrors
+	if cacheDir != "" && len(lists) > 0 {
+		if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+			problems.add(fmt.Errorf("%s: remoteIPListsCacheDir: %w", name, err))
+		}
+	}
+
+	var parsed []*remoteList
+	for i, list := range lists {
+		field := fmt.Sprintf("remoteIPLists[%d]", i)
+		if err := validateListURL(list.URL); err != nil {
+			problems.add(fmt.Errorf("%s: %s: %w", name, field, err))
+		}
+		if list.Label == "" && !list.Trusted {
+			problems.add(fmt.Errorf("%s: %s: label cannot be empty unless the list is trusted", name, field))
+		}
+		if strings.ContainsAny(list.Label, ", \t") {
+			problems.add(fmt.Errorf("%s: %s: label %q cannot contain commas or spaces", name, field, list.Label))
+		}
+		if list.Label != "" && tagsHeaderName == "" {
+			problems.add(fmt.Errorf("%s: %s: ipTagsHeaderName cannot be empty when the list has a label", name, field))
+		}
+		if list.RefreshInterval < 0 {
+			problems.add(fmt.Errorf("%s: %s: refreshInterval cannot be negative", name, field))
+		}
+		verifier, err := newListVerifier(list)
+		if err != nil {
+			problems.add(fmt.Errorf("%s: %s: %w", name, field, err))
+		}
+
+		interval := time.Duration(list.RefreshInterval) * time.Second
+		if interval == 0 {
+			interval = defaultRemoteListRefreshInterval
+		}
+		parsed = append(parsed, &remoteList{
+			name:      name,
+			label:     list.Label,
+			url:       list.URL,
+			trusted:   list.Trusted,
+			interval:  interval,
+			client:    &http.Client{Timeout: remoteListTimeout},
+			cache:     remoteListCachePath(cacheDir, list.URL),
+			verifier:  verifier,
+			helper:    NewEmptyIpLookupHelper(),
+			attempted: make(chan struct{}),
+		})
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// validateListURL accepts absolute http(s) URLs
+func validateListURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("expected an absolute http(s) URL, got %q", rawURL)
+	}
+	return nil
+}
+
+// remoteListCachePath names the cached copy of the list at rawURL after the URL's SHA-256,
+// so lists never collide and URLs need no escaping. It returns "" without a cacheDir.
+func remoteListCachePath(cacheDir, rawURL string) string {
+	if cacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".txt")
+}
+
+// anyTrusted reports whether any of lists is trusted
+func anyTrusted(lists []*remoteList) bool {
+	for _, list := range lists {
+		if list.trusted {
+			return true
+		}
+	}
+	return false
+}
+
+// start loads the cached copy of the list, if there is one, and downloads the list in the
+// background, so a slow or unreachable provider never delays loading the plugin or a
+// configuration reload. Until the download completes the list is the cached copy, or
+// empty; a failed download is logged and retried with backoff.
+func (l *remoteList) start(now time.Time) {
+	l.startCached()
+
+	atomic.StoreInt64(&l.nextCheck, now.Add(l.interval).UnixNano())
+	go func() {
+		defer close(l.attempted)
+		l.refresh(now)
+	}()
+}
+
+// startOffline loads the cached copy of the list, if there is one, and never downloads it,
+// for resolvers that must not start background work
+func (l *remoteList) startOffline() {
+	l.startCached()
+	atomic.StoreInt64(&l.nextCheck, math.MaxInt64)
+}
+
+// startCached loads the cached copy of the list, if there is one, logging which copy is used
+func (l *remoteList) startCached() {
+	if l.cache == "" {
+		return
+	}
+	if cached, err := l.loadCache(); err == nil {
+		logf(l.name, "starting remote IP list %q with the copy cached at %s", l.url, cached.Format(time.RFC3339))
+	} else if !os.IsNotExist(err) {
+		logf(l.name, "failed to load the cached copy of remote IP list %q, starting with an empty list: %v", l.url, err)
+	}
+}
+
+// Helper returns the current lookup helper, starting a download first if the refresh
+// interval has elapsed. The download does not delay the caller.
+func (l *remoteList) Helper() *IpLookupHelper {
+	l.poll(time.Now())
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.helper
+}
+
+// poll starts a download at most once per interval. Only one caller starts it; the
+// others, and the caller itself, keep using the current helper until it completes.
+func (l *remoteList) poll(now time.Time) {
+	next := atomic.LoadInt64(&l.nextCheck)
+	if now.UnixNano() < next {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&l.nextCheck, next, now.Add(l.interval).UnixNano()) {
+		return
+	}
+
+	go l.refresh(now)
+}
+
+// refresh downloads the list, keeping the previous one and retrying with backoff on failure.
+// Failures are logged with the age of the list still in use; unchanged lists are not logged.
+func (l *remoteList) refresh(now time.Time) {
+	changed, err := l.download(now)
+	if err != nil {
+		delay := l.failed()
+		atomic.StoreInt64(&l.nextCheck, now.Add(delay).UnixNano())
+		logf(l.name, "failed to refresh remote IP list %q, keeping previous list (%s), retrying in %s: %v", l.url, l.staleness(now), delay.Round(time.Second), err)
+		return
+	}
+	if !changed {
+		return
+	}
+	l.mu.RLock()
+	prefixes := l.helper.Len()
+	l.mu.RUnlock()
+	logf(l.name, "refreshed remote IP list %q: %d prefixes", l.url, prefixes)
+}
+
+// failed records a failed download and returns the delay before the next attempt:
+// defaultRemoteListRetryInterval doubled per consecutive failure and capped at the refresh
+// interval, of which up to half is random so instances sharing a provider spread their retries
+func (l *remoteList) failed() time.Duration {
+	l.mu.Lock()
+	l.failures++
+	failures := l.failures
+	l.mu.Unlock()
+
+	delay := defaultRemoteListRetryInterval
+	for i := 1; i < failures && delay < l.interval; i++ {
+		delay *= 2
+	}
+	if delay > l.interval {
+		delay = l.interval
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// staleness describes the age of the list in use, for logs
+func (l *remoteList) staleness(now time.Time) string {
+	l.mu.RLock()
+	updated := l.updated
+	l.mu.RUnlock()
+	if updated.IsZero() {
+		return "never downloaded"
+	}
+	return fmt.Sprintf("last downloaded %s ago", now.Sub(updated).Round(time.Second))
+}
+
+// download fetches the list and swaps in the new helper, reporting whether it changed.
+// The request is conditional on the validators of the current list, and a 304 response
+// only marks it as fresh. Failed requests, error statuses, oversized bodies, failed
+// verifications and invalid entries leave the current helper in place.
+func (l *remoteList) download(now time.Time) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, l.url, nil)
+	if err != nil {
+		return false, err
+	}
+	l.mu.RLock()
+	etag, lastModified := l.etag, l.lastModified
+	l.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != "") {
+		l.mu.Lock()
+		l.updated = now
+		l.failures = 0
+		l.mu.Unlock()
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := readLimited(resp.Body, maxRemoteListSize)
+	if err != nil {
+		return false, err
+	}
+	if l.verifier != nil {
+		if err := l.verifier.verify(l.client, l.url, body); err != nil {
+			return false, fmt.Errorf("verification failed: %w", err)
+		}
+	}
+
+	if err := l.load(body, now); err != nil {
+		return false, err
+	}
+	l.mu.Lock()
+	l.etag = resp.Header.Get("ETag")
+	l.lastModified = resp.Header.Get("Last-Modified")
+	l.failures = 0
+	l.mu.Unlock()
+	l.writeCache(body)
+	return true, nil
+}
+
+// fetchLimited downloads rawURL, which must answer 200 with at most limit bytes
+func fetchLimited(client *http.Client, rawURL string, limit int) ([]byte, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return readLimited(resp.Body, limit)
+}
+
+// readLimited reads r, failing when it holds more than limit bytes
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return body, nil
+}
+
+// load parses body in the trusted IPs file format and atomically swaps in the new helper
+func (l *remoteList) load(body []byte, now time.Time) error {
+	cidrs, err := readCIDRs(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	helper, err := NewIpLookupHelper(cidrs)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.helper = helper
+	l.updated = now
+	l.mu.Unlock()
+
+	return nil
+}
+
+// contains reports whether ip is in the current list
+func (l *remoteList) contains(ip net.IP) bool {
+	contained, _, err := l.Helper().IsContained(ip)
+	return err == nil && contained
+}
+
+// writeCache stores body as the cached copy of the list. It is written to a temporary file
+// renamed over the previous copy, so a crash never leaves a truncated list behind. Failures
+// are logged: the download itself succeeded.
+func (l *remoteList) writeCache(body []byte) {
+	if l.cache == "" {
+		return
+	}
+	tmp := l.cache + ".tmp"
+	err := os.WriteFile(tmp, body, 0o600)
+	if err == nil {
+		err = os.Rename(tmp, l.cache)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		logf(l.name, "failed to cache remote IP list %q: %v", l.url, err)
+	}
+}
+
+// loadCache loads the cached copy of the list, returning when it was downloaded
+func (l *remoteList) loadCache() (time.Time, error) {
+	info, err := os.Stat(l.cache)
+	if err != nil {
+		return time.Time{}, err
+	}
+	body, err := os.ReadFile(l.cache)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := l.load(body, info.ModTime()); err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
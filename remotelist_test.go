@@ -0,0 +1,377 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listServer serves remote IP lists by path; missing paths are served as 404
+type listServer struct {
+	mu    sync.Mutex
+	lists map[string]string
+}
+
+func (s *listServer) set(path, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists[path] = body
+}
+
+func (s *listServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	body, ok := s.lists[req.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	_, _ = rw.Write([]byte(body))
+}
+
+// lockedBuffer collects the log lines of downloads running in the background
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// waitForDownloads waits for the first download of every list, which start runs in the background
+func waitForDownloads(t *testing.T, lists []*remoteList) {
+	t.Helper()
+	for _, list := range lists {
+		select {
+		case <-list.attempted:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the download of %q", list.url)
+		}
+	}
+}
+
+func TestRemoteIPLists(t *testing.T) {
+	lists := &listServer{lists: map[string]string{
+		"/vpn-a.txt":   "# provider A\n198.51.100.0/25\n",
+		"/vpn-b.txt":   "198.51.100.128/25\n2001:db8:2::/48\n",
+		"/scraper.txt": "203.0.113.0/24\n!203.0.113.9\n",
+		"/edge.txt":    "192.0.2.0/24\n",
+		"/invalid.txt": "203.0.113.0/33\n",
+	}}
+	server := httptest.NewServer(lists)
+	defer server.Close()
+
+	var logs lockedBuffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	newPlugin := func(t *testing.T, remote []RemoteIPList, tags map[string][]string) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.IPTags = tags
+		cfg.RemoteIPLists = remote
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		waitForDownloads(t, handler.(*Plugin).remoteLists)
+		return handler.(*Plugin)
+	}
+
+	remote := []RemoteIPList{
+		{Label: "vpn", URL: server.URL + "/vpn-a.txt"},
+		{Label: "vpn", URL: server.URL + "/vpn-b.txt"},
+		{Label: "scraper", URL: server.URL + "/scraper.txt"},
+	}
+
+	tests := []struct {
+		name     string
+		remote   []RemoteIPList
+		tags     map[string][]string
+		xff      string
+		spoofed  string
+		expected string
+	}{
+		{"FirstList", remote, nil, "198.51.100.7", "", "vpn"},
+		{"UnionOfLists", remote, nil, "198.51.100.200", "", "vpn"},
+		{"IPv6", remote, nil, "2001:db8:2::1", "", "vpn"},
+		{"Exclusion", remote, nil, "203.0.113.9", "vpn", ""},
+		{"MergedWithIPTags", remote, map[string][]string{"office": {"203.0.113.0/24"}, "vpn": {"203.0.113.5"}}, "203.0.113.5", "", "office,scraper,vpn"},
+		{"NoLabel", remote, nil, "192.0.2.1", "vpn", ""},
+		{"FailedDownloadStartsEmpty", []RemoteIPList{{Label: "vpn", URL: server.URL + "/missing.txt"}}, nil, "198.51.100.7", "", ""},
+		{"InvalidListStartsEmpty", []RemoteIPList{{Label: "vpn", URL: server.URL + "/invalid.txt"}}, nil, "203.0.113.1", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.remote, tt.tags)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			if tt.spoofed != "" {
+				req.Header.Set("X-IP-Tags", tt.spoofed)
+			}
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if values := req.Header.Values("X-IP-Tags"); len(values) != 1 || values[0] != tt.expected {
+				t.Errorf("expected X-IP-Tags '%s', but got: %q", tt.expected, values)
+			}
+		})
+	}
+
+	t.Run("TrustedList", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.RemoteIPLists = []RemoteIPList{{URL: server.URL + "/edge.txt", Trusted: true}}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		plugin := handler.(*Plugin)
+		waitForDownloads(t, plugin.remoteLists)
+
+		for remoteAddr, expectedReason := range map[string]string{"192.0.2.1:1234": trustReasonRemoteList, "10.0.0.1:1234": trustReasonNotTrusted} {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = remoteAddr
+			if _, reason := plugin.trustVerdict(req); reason != expectedReason {
+				t.Errorf("expected trust reason '%s' for %s, but got: '%s'", expectedReason, remoteAddr, reason)
+			}
+		}
+	})
+
+	t.Run("DownloadInBackground", func(t *testing.T) {
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			<-release
+			_, _ = rw.Write([]byte("198.51.100.0/24\n"))
+		}))
+		defer slow.Close()
+
+		cfg := CreateConfig()
+		cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn", URL: slow.URL}}
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		list := handler.(*Plugin).remoteLists[0]
+		if list.contains(net.ParseIP("198.51.100.1")) {
+			t.Error("expected the list to be empty until its download completes")
+		}
+
+		close(release)
+		waitForDownloads(t, handler.(*Plugin).remoteLists)
+		if !list.contains(net.ParseIP("198.51.100.1")) {
+			t.Error("expected the list to be loaded once its download completes")
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		lists.set("/refreshed.txt", "198.51.100.0/24\n")
+		parsed, err := newRemoteLists(pluginName, []RemoteIPList{{Label: "vpn", URL: server.URL + "/refreshed.txt"}}, "X-IP-Tags", "")
+		if err != nil {
+			t.Fatalf("failed to create remote list: %v", err)
+		}
+		list := parsed[0]
+		list.start(time.Now())
+		waitForDownloads(t, parsed)
+
+		// An invalid list keeps the previous one
+		lists.set("/refreshed.txt", "not-a-cidr\n")
+		list.refresh(time.Now())
+		if !list.contains(net.ParseIP("198.51.100.1")) {
+			t.Error("expected the previous list to be kept after an invalid download")
+		}
+
+		lists.set("/refreshed.txt", "203.0.113.0/24\n")
+		list.refresh(time.Now())
+		if list.contains(net.ParseIP("198.51.100.1")) || !list.contains(net.ParseIP("203.0.113.1")) {
+			t.Error("expected the refreshed list to replace the previous one")
+		}
+	})
+
+	t.Run("CachedCopy", func(t *testing.T) {
+		cacheDir := filepath.Join(t.TempDir(), "lists")
+		lists.set("/cached.txt", "198.51.100.0/24\n")
+		cached := []RemoteIPList{{Label: "vpn", URL: server.URL + "/cached.txt"}}
+
+		tagsOf := func(t *testing.T) string {
+			cfg := CreateConfig()
+			cfg.RemoteIPLists = cached
+			cfg.RemoteIPListsCacheDir = cacheDir
+
+			handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+			waitForDownloads(t, handler.(*Plugin).remoteLists)
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Forwarded-For", "198.51.100.7")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			return req.Header.Get("X-IP-Tags")
+		}
+
+		if tags := tagsOf(t); tags != "vpn" {
+			t.Fatalf("expected X-IP-Tags 'vpn' from the download, but got: '%s'", tags)
+		}
+
+		// The provider is down: the copy cached by the previous instance is used
+		lists.mu.Lock()
+		delete(lists.lists, "/cached.txt")
+		lists.mu.Unlock()
+		logs.Reset()
+		if tags := tagsOf(t); tags != "vpn" {
+			t.Errorf("expected X-IP-Tags 'vpn' from the cached copy, but got: '%s'", tags)
+		}
+		if !strings.Contains(logs.String(), "with the copy cached at") {
+			t.Errorf("expected the cached copy to be logged, but got: %s", logs.String())
+		}
+
+		// Without a cached copy the list starts empty
+		cacheDir = t.TempDir()
+		if tags := tagsOf(t); tags != "" {
+			t.Errorf("expected empty X-IP-Tags without a cached copy, but got: '%s'", tags)
+		}
+	})
+
+	t.Run("ConditionalRefresh", func(t *testing.T) {
+		var requests, notModified int
+		version := "v1"
+		var mu sync.Mutex
+		conditional := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests++
+			if req.Header.Get("If-None-Match") == `"`+version+`"` {
+				notModified++
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			rw.Header().Set("ETag", `"`+version+`"`)
+			_, _ = rw.Write([]byte("198.51.100.0/24\n"))
+		}))
+		defer conditional.Close()
+
+		parsed, err := newRemoteLists(pluginName, []RemoteIPList{{Label: "vpn", URL: conditional.URL}}, "X-IP-Tags", "")
+		if err != nil {
+			t.Fatalf("failed to create remote list: %v", err)
+		}
+		list := parsed[0]
+		list.start(time.Now())
+		waitForDownloads(t, parsed)
+
+		logs.Reset()
+		list.refresh(time.Now())
+		if notModified != 1 || !list.contains(net.ParseIP("198.51.100.1")) {
+			t.Errorf("expected a 304 keeping the list, but got %d 304s out of %d requests", notModified, requests)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("expected an unchanged list not to be logged, but got: %s", logs.String())
+		}
+
+		mu.Lock()
+		version = "v2"
+		mu.Unlock()
+		list.refresh(time.Now())
+		if requests != 3 || notModified != 1 || !strings.Contains(logs.String(), "refreshed remote IP list") {
+			t.Errorf("expected a full download of the changed list, but got %d 304s out of %d requests: %s", notModified, requests, logs.String())
+		}
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		parsed, err := newRemoteLists(pluginName, []RemoteIPList{{Label: "vpn", URL: server.URL + "/missing.txt", RefreshInterval: 600}}, "X-IP-Tags", "")
+		if err != nil {
+			t.Fatalf("failed to create remote list: %v", err)
+		}
+		list := parsed[0]
+
+		// Retries double from a minute up to the refresh interval, minus up to half as jitter
+		for _, expected := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute} {
+			if delay := list.failed(); delay < expected/2 || delay > expected {
+				t.Errorf("expected a retry delay between %s and %s, but got %s", expected/2, expected, delay)
+			}
+		}
+
+		// A failed refresh logs how old the list in use is
+		if err := list.load([]byte("198.51.100.0/24\n"), time.Now().Add(-2*time.Hour)); err != nil {
+			t.Fatalf("failed to load list: %v", err)
+		}
+		logs.Reset()
+		list.refresh(time.Now())
+		if !strings.Contains(logs.String(), "last downloaded 2h0m0s ago") {
+			t.Errorf("expected the staleness of the list to be logged, but got: %s", logs.String())
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		modify func(cfg *Config)
+	}{
+		{"RelativeURL", func(cfg *Config) { cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn", URL: "/vpn.txt"}} }},
+		{"UnsupportedScheme", func(cfg *Config) {
+			cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn", URL: "ftp://example.com/vpn.txt"}}
+		}},
+		{"NoLabelUntrusted", func(cfg *Config) { cfg.RemoteIPLists = []RemoteIPList{{URL: server.URL + "/vpn-a.txt"}} }},
+		{"LabelWithComma", func(cfg *Config) {
+			cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn,proxy", URL: server.URL + "/vpn-a.txt"}}
+		}},
+		{"NegativeRefreshInterval", func(cfg *Config) {
+			cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn", URL: server.URL + "/vpn-a.txt", RefreshInterval: -1}}
+		}},
+		{"NoHeaderName", func(cfg *Config) {
+			cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn", URL: server.URL + "/vpn-a.txt"}}
+			cfg.IPTagsHeaderName = ""
+		}},
+		{"CacheDirIsAFile", func(cfg *Config) {
+			cfg.RemoteIPLists = []RemoteIPList{{Label: "vpn", URL: server.URL + "/vpn-a.txt"}}
+			cfg.RemoteIPListsCacheDir = filepath.Join(t.TempDir(), "lists.txt")
+			writeCIDRFile(t, cfg.RemoteIPListsCacheDir, "", time.Now())
+		}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			tt.modify(cfg)
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for an invalid remoteIPLists configuration, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
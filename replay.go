@@ -0,0 +1,96 @@
+package traefik_realip
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReplayCacheEntries bounds the memory used by the replay detector
+const maxReplayCacheEntries = 10000
+
+// Defaults of replayWindow and replayThreshold
+const (
+	defaultReplayWindow    = 10 * time.Second
+	defaultReplayThreshold = 3
+)
+
+// replayEntry counts occurrences of a request tuple within the current window
+type replayEntry struct {
+	count       int
+	windowStart time.Time
+}
+
+// replayDetector counts identical (client IP, full chain, URL) tuples in a short
+// fixed window and reports those repeating at least threshold times.
+type replayDetector struct {
+	window    time.Duration
+	threshold int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*replayEntry
+}
+
+// newReplayDetector creates a detector for the given window and threshold
+func newReplayDetector(window time.Duration, threshold int) *replayDetector {
+	return &replayDetector{
+		window:    window,
+		threshold: threshold,
+		entries:   make(map[[sha256.Size]byte]*replayEntry),
+	}
+}
+
+// replayKey hashes the resolved client IP, the full forwarding chain (every
+// X-Forwarded-For value plus the connection address) and the requested URL.
+func replayKey(req *http.Request, realIP string) [sha256.Size]byte {
+	var b strings.Builder
+	b.WriteString(realIP)
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(req.Header.Values("X-Forwarded-For"), ","))
+	b.WriteByte('\n')
+	b.WriteString(req.RemoteAddr)
+	b.WriteByte('\n')
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.Host)
+	b.WriteString(req.URL.RequestURI())
+	return sha256.Sum256([]byte(b.String()))
+}
+
+// observe records an occurrence of key and reports whether it is a suspected replay
+func (d *replayDetector) observe(key [sha256.Size]byte, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[key]
+	if ok && now.Sub(entry.windowStart) < d.window {
+		entry.count++
+		return entry.count >= d.threshold
+	}
+
+	if !ok {
+		if len(d.entries) >= maxReplayCacheEntries {
+			d.purge(now)
+		}
+		entry = &replayEntry{}
+		d.entries[key] = entry
+	}
+	entry.count = 1
+	entry.windowStart = now
+
+	return entry.count >= d.threshold
+}
+
+// purge drops entries whose window has ended; if that is not enough the cache is cleared
+func (d *replayDetector) purge(now time.Time) {
+	for key, entry := range d.entries {
+		if now.Sub(entry.windowStart) >= d.window {
+			delete(d.entries, key)
+		}
+	}
+	if len(d.entries) >= maxReplayCacheEntries {
+		d.entries = make(map[[sha256.Size]byte]*replayEntry)
+	}
+}
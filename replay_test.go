@@ -0,0 +1,101 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReplayDetector(t *testing.T) {
+	now := time.Now()
+	detector := newReplayDetector(10*time.Second, 3)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook?id=1", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	key := replayKey(req, "203.0.113.1")
+
+	expected := []bool{false, false, true, true}
+	for i, want := range expected {
+		if got := detector.observe(key, now.Add(time.Duration(i)*time.Second)); got != want {
+			t.Errorf("observation %d: expected suspected=%v, but got %v", i+1, want, got)
+		}
+	}
+
+	if detector.observe(key, now.Add(20*time.Second)) {
+		t.Error("expected counter to reset after the window ended")
+	}
+
+	t.Run("DifferentTuplesAreIndependent", func(t *testing.T) {
+		other := httptest.NewRequest(http.MethodPost, "/webhook?id=2", nil)
+		other.RemoteAddr = "10.0.0.2:1234"
+		other.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+		if replayKey(other, "203.0.113.1") == key {
+			t.Error("expected different URLs to produce different keys")
+		}
+		if replayKey(req, "203.0.113.2") == key {
+			t.Error("expected different client IPs to produce different keys")
+		}
+	})
+}
+
+func TestReplayHeaderName(t *testing.T) {
+	cfg := &Config{
+		Enabled:          true,
+		HeaderName:       "X-Real-IP",
+		ProcessHeaders:   []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		ForceOverwrite:   true,
+		TrustAll:         true,
+		ReplayHeaderName: "X-Replay-Suspected",
+		ReplayWindow:     60,
+		ReplayThreshold:  2,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	serve := func(path string, spoofed bool) string {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		if spoofed {
+			req.Header.Set("X-Replay-Suspected", "yes")
+		}
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+		return req.Header.Get("X-Replay-Suspected")
+	}
+
+	if tag := serve("/hook", true); tag != "" {
+		t.Errorf("expected first delivery not to be tagged (and spoofed tag removed), but got: '%s'", tag)
+	}
+	if tag := serve("/hook", false); tag != "yes" {
+		t.Errorf("expected repeated delivery to be tagged, but got: '%s'", tag)
+	}
+	if tag := serve("/other", false); tag != "" {
+		t.Errorf("expected a different URL not to be tagged, but got: '%s'", tag)
+	}
+
+	t.Run("NegativeSettings", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:          true,
+			HeaderName:       "X-Real-IP",
+			ProcessHeaders:   []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:         true,
+			ReplayHeaderName: "X-Replay-Suspected",
+			ReplayThreshold:  -1,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for negative replayThreshold, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
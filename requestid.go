@@ -0,0 +1,40 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"strings"
+)
+
+// maxRequestIDLength bounds the request ID copied into log lines
+const maxRequestIDLength = 128
+
+// requestID returns the value of the first requestIDHeaders entry present on req, or ""
+func (r *Resolver) requestID(req *http.Request) string {
+	for _, header := range r.requestIDHeaders {
+		if id := strings.TrimSpace(req.Header.Get(header)); id != "" {
+			if len(id) > maxRequestIDLength {
+				id = id[:maxRequestIDLength]
+			}
+			return id
+		}
+	}
+	return ""
+}
+
+// requestLogf is logf for lines about req, appending its request ID when it has one, so
+// the line can be correlated with access logs and traces. The ID is quoted, as clients
+// can choose it.
+func (r *Resolver) requestLogf(req *http.Request, format string, args ...interface{}) {
+	if id := r.requestID(req); id != "" {
+		format += " requestID=%q"
+		args = append(args, id)
+	}
+	logf(r.name, format, args...)
+}
+
+// requestLogger returns requestLogf bound to req, for helpers that log on its behalf
+func (r *Resolver) requestLogger(req *http.Request) func(format string, args ...interface{}) {
+	return func(format string, args ...interface{}) {
+		r.requestLogf(req, format, args...)
+	}
+}
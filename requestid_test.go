@@ -0,0 +1,86 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDCorrelation(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) http.Handler {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.Debug = true
+		cfg.RequestIDHeaders = []string{"X-Request-ID", "Cf-Ray"}
+		if modify != nil {
+			modify(cfg)
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected string
+	}{
+		{"FirstPresentWins", map[string]string{"X-Request-ID": "abc-123", "Cf-Ray": "ray-1"}, `requestID="abc-123"`},
+		{"LaterHeader", map[string]string{"Cf-Ray": "ray-1"}, `requestID="ray-1"`},
+		{"QuotesControlCharacters", map[string]string{"X-Request-ID": "a\tb"}, `requestID="a\tb"`},
+		{"CutToMaxLength", map[string]string{"X-Request-ID": strings.Repeat("a", 200)}, `requestID="` + strings.Repeat("a", maxRequestIDLength) + `"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			newPlugin(t, nil).ServeHTTP(httptest.NewRecorder(), req)
+
+			if line := strings.TrimSpace(logs.String()); !strings.HasSuffix(line, tt.expected) {
+				t.Errorf("expected the line to end with '%s', but got: '%s'", tt.expected, line)
+			}
+		})
+	}
+
+	t.Run("NoRequestID", func(t *testing.T) {
+		logs.Reset()
+		newPlugin(t, nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		if strings.Contains(logs.String(), "requestID") {
+			t.Errorf("expected no request ID, but got: %s", logs.String())
+		}
+	})
+
+	t.Run("DecisionLogField", func(t *testing.T) {
+		logs.Reset()
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.Debug = false
+			cfg.DecisionLogLevel = decisionLogInfo
+			cfg.DecisionLogFields = []string{"level", "decision"}
+		})
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		expected := `{"level":"info","requestID":"abc-123","decision":"forwarded"}`
+		if line := strings.TrimSpace(logs.String()); line != expected {
+			t.Errorf("expected '%s', but got: '%s'", expected, line)
+		}
+	})
+}
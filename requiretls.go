@@ -0,0 +1,50 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// What happens to trusted sources forwarding headers over plaintext with requireTLS
+const (
+	requireTLSUntrust = "untrust"
+	requireTLSReject  = "reject"
+)
+
+// trustReasonPlaintext is the trust reason of sources untrusted because they did not use TLS
+const trustReasonPlaintext = "plaintext"
+
+// rejectReasonPlaintext is the reason code of requests rejected because they did not use TLS
+const rejectReasonPlaintext = "requireTLS"
+
+// parseRequireTLSAction validates the requireTLSAction configuration, defaulting to untrust
+func parseRequireTLSAction(name, action string) (string, error) {
+	switch action {
+	case "":
+		return requireTLSUntrust, nil
+	case requireTLSUntrust, requireTLSReject:
+		return action, nil
+	default:
+		return "", fmt.Errorf("%s: requireTLSAction must be %q or %q, got %q", name, requireTLSUntrust, requireTLSReject, action)
+	}
+}
+
+// secureTransport reports whether a request of a trusted source reached us over TLS, either
+// on this connection or, as the trusted hop reports in the rightmost X-Forwarded-Proto
+// value, on the connection the hop terminated. Headers injected on an unencrypted internal
+// segment cannot be told apart from the ones the proxy set.
+func secureTransport(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	proto := req.Header.Values("X-Forwarded-Proto")
+	if len(proto) == 0 {
+		return false
+	}
+	last := proto[len(proto)-1]
+	if i := strings.LastIndexByte(last, ','); i >= 0 {
+		last = last[i+1:]
+	}
+	return strings.EqualFold(strings.TrimSpace(last), "https")
+}
@@ -0,0 +1,107 @@
+package traefik_realip
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireTLS(t *testing.T) {
+	newPlugin := func(t *testing.T, action string) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.TrustedHeader = "X-Is-Trusted"
+		cfg.RejectReasonHeaderName = "X-Reject-Reason"
+		cfg.RequireTLS = true
+		cfg.RequireTLSAction = action
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		action          string
+		path            string
+		remoteAddr      string
+		tls             bool
+		proto           []string
+		expectedStatus  int
+		expectedIP      string
+		expectedTrusted string
+		expectedReasons string
+	}{
+		{"TLS", "", "/test", "10.0.0.1:1234", true, nil, http.StatusOK, "203.0.113.1", "yes", ""},
+		{"ForwardedProtoHTTPS", "", "/test", "10.0.0.1:1234", false, []string{"HTTPS"}, http.StatusOK, "203.0.113.1", "yes", ""},
+		{"ForwardedProtoRightmost", "", "/test", "10.0.0.1:1234", false, []string{"http", "http, https"}, http.StatusOK, "203.0.113.1", "yes", ""},
+		{"ForwardedProtoRightmostHTTP", "", "/test", "10.0.0.1:1234", false, []string{"https, http"}, http.StatusOK, "10.0.0.1", "no", ""},
+		{"PlaintextUntrusted", "", "/test", "10.0.0.1:1234", false, nil, http.StatusOK, "10.0.0.1", "no", ""},
+		{"PlaintextRejected", requireTLSReject, "/test", "10.0.0.1:1234", false, []string{"http"}, http.StatusForbidden, "", "", "requireTLS"},
+		{"PlaintextRejectExemptPath", requireTLSReject, "/.well-known/acme-challenge/token", "10.0.0.1:1234", false, nil, http.StatusOK, "10.0.0.1", "no", ""},
+		{"UntrustedSourceNotRejected", requireTLSReject, "/test", "192.0.2.1:1234", false, nil, http.StatusOK, "192.0.2.1", "no", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.action)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for _, proto := range tt.proto {
+				req.Header.Add("X-Forwarded-Proto", proto)
+			}
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, rr.Code)
+			}
+			if reasons := rr.Header().Get("X-Reject-Reason"); reasons != tt.expectedReasons {
+				t.Errorf("expected reasons '%s', but got: '%s'", tt.expectedReasons, reasons)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrusted {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTrusted, trusted)
+			}
+		})
+	}
+
+	t.Run("TrustReason", func(t *testing.T) {
+		plugin := newPlugin(t, "")
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+
+		if report := plugin.Explain(req); report.Trusted || report.TrustReason != trustReasonPlaintext {
+			t.Errorf("expected untrusted with reason '%s', but got trusted=%v reason '%s'", trustReasonPlaintext, report.Trusted, report.TrustReason)
+		}
+	})
+
+	t.Run("InvalidAction", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.RequireTLSAction = "deny"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown requireTLSAction, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
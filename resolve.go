@@ -0,0 +1,87 @@
+package traefik_realip
+
+import (
+	"net/http"
+)
+
+// resolveName prefixes the configuration errors and log lines of resolvers Resolve creates
+const resolveName = "realip"
+
+// Result is the real IP of a request with where it came from, for Go services that resolve
+// it without running the middleware.
+type Result struct {
+	IP          string   `json:"ip"`                    // Resolved real IP ("" if none)
+	Port        string   `json:"port,omitempty"`        // Port that accompanied the real IP, if any
+	Source      string   `json:"source,omitempty"`      // Header that produced the real IP
+	Index       int      `json:"index"`                 // Position of the real IP in Chain, counted from the left
+	Trusted     bool     `json:"trusted"`               // Trust verdict for the source
+	TrustReason string   `json:"trustReason,omitempty"` // Why the source was (or was not) trusted
+	Chain       []string `json:"chain,omitempty"`       // Cleaned IP list of the header that produced the real IP
+	Fallback    bool     `json:"fallback,omitempty"`    // Whether the real IP was produced by the fallback
+}
+
+// Resolve resolves the real IP of req with cfg, with the rules the middleware applies, and
+// returns it without modifying the request. It is meant for one-off checks: every call
+// validates cfg again and reopens the files it names, and it starts no background work, so
+// remote IP lists are never downloaded, only read from their cached copy. Services resolving
+// many requests must create a Resolver with NewResolver once and call its Resolve method.
+func Resolve(req *http.Request, cfg *Config) (Result, error) {
+	resolver, err := newResolver(cfg, resolveName)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, list := range resolver.remoteLists {
+		list.startOffline()
+	}
+	return resolver.Resolve(req), nil
+}
+
+// Resolve returns the real IP of req as the middleware would write it to headerName, before
+// anonymization and hashing. Enforcement rules are not applied and the request is not modified;
+// a disabled resolver returns an empty Result.
+func (r *Resolver) Resolve(req *http.Request) Result {
+	if !r.enabled {
+		return Result{}
+	}
+
+	isTrusted, trustReason := r.trustVerdict(req)
+	resolved, _ := r.resolveOutput(req, isTrusted, nil)
+	return newResult(resolved, isTrusted, trustReason)
+}
+
+// resolveOutput resolves the real IP of req as the middleware writes it: hardened for the
+// output headers, resolved without the source headers when they conflict under the ignore
+// policy, and walked past a trusted proxy by resolvedProxyCheck. conflict reports whether
+// the source headers disagree, for the reject policy. process, Resolve and Explain all
+// resolve through it, so they never differ. report, when not nil, records the outcome.
+func (r *Resolver) resolveOutput(req *http.Request, isTrusted bool, report *DecisionReport) (resolution, bool) {
+	resolved := r.hardenResolution(r.resolveRealIP(req, isTrusted, report))
+
+	conflict := r.conflictPolicy != conflictPreferFirst && r.sourcesConflict(resolved)
+	if conflict && r.conflictPolicy == conflictIgnore {
+		resolved = r.resolveConflict(req, resolved, report)
+	}
+
+	if r.resolvedProxyCheck != resolvedProxyOff {
+		resolved = r.checkResolvedProxy(resolved)
+	}
+
+	if report != nil {
+		report.RealIP, report.Source, report.Index = resolved.ip, resolved.header, resolved.index
+	}
+	return resolved, conflict
+}
+
+// newResult describes resolved and the trust verdict it was resolved under
+func newResult(resolved resolution, isTrusted bool, trustReason string) Result {
+	return Result{
+		IP:          resolved.ip,
+		Port:        resolved.port,
+		Source:      resolved.header,
+		Index:       resolved.index,
+		Trusted:     isTrusted,
+		TrustReason: trustReason,
+		Chain:       append([]string(nil), resolved.chain...),
+		Fallback:    resolved.fallback,
+	}
+}
@@ -0,0 +1,115 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	newConfig := func(modify func(cfg *Config)) *Config {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}, {HeaderName: "clientAddress"}}
+		if modify != nil {
+			modify(cfg)
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(cfg *Config)
+		remoteAddr string
+		xff        string
+		expected   Result
+	}{
+		{"Trusted", nil, "10.0.0.1:1234", "203.0.113.1:8080, 10.0.0.2", Result{
+			IP: "203.0.113.1", Port: "8080", Source: "X-Forwarded-For", Index: 0, Trusted: true, TrustReason: "trustedIPs", Chain: []string{"203.0.113.1", "10.0.0.2"},
+		}},
+		{"Untrusted", nil, "192.0.2.1:1234", "203.0.113.1, 10.0.0.2", Result{
+			IP: "192.0.2.1", Port: "1234", Source: "clientAddress", Index: 0, TrustReason: "notTrusted", Chain: []string{"192.0.2.1"},
+		}},
+		{"Fallback", func(cfg *Config) {
+			cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For"}}
+			cfg.Fallback = fallbackRemoteAddr
+		}, "10.0.0.1:1234", "", Result{
+			IP: "10.0.0.1", Port: "1234", Source: "clientAddress", Trusted: true, TrustReason: "trustedIPs", Chain: []string{"10.0.0.1"}, Fallback: true,
+		}},
+		{"CorrectedProxy", func(cfg *Config) { cfg.ResolvedProxyCheck = resolvedProxyCorrect }, "10.0.0.1:1234", "203.0.113.1, 10.0.0.3, 10.0.0.2", Result{
+			IP: "203.0.113.1", Source: "X-Forwarded-For", Trusted: true, TrustReason: "trustedIPs", Chain: []string{"203.0.113.1", "10.0.0.3", "10.0.0.2"},
+		}},
+		{"Disabled", func(cfg *Config) { cfg.Enabled = false }, "10.0.0.1:1234", "203.0.113.1, 10.0.0.2", Result{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logWriter = &logs
+			defer func() { logWriter = os.Stdout }()
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			result, err := Resolve(req, newConfig(tt.modify))
+			if err != nil {
+				t.Fatalf("failed to resolve: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected %+v, but got %+v", tt.expected, result)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+				t.Errorf("expected the request not to be modified, but X-Real-IP is '%s'", realIP)
+			}
+		})
+	}
+
+	t.Run("NoBackgroundWork", func(t *testing.T) {
+		var requests int64
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			_, _ = rw.Write([]byte("198.51.100.0/24\n"))
+		}))
+		defer server.Close()
+
+		cacheDir := t.TempDir()
+		writeCIDRFile(t, remoteListCachePath(cacheDir, server.URL+"/edge.txt"), "192.0.2.0/24\n", time.Now())
+		cfg := newConfig(func(cfg *Config) {
+			cfg.RemoteIPLists = []RemoteIPList{{URL: server.URL + "/edge.txt", Trusted: true}}
+			cfg.RemoteIPListsCacheDir = cacheDir
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		result, err := Resolve(req, cfg)
+		if err != nil {
+			t.Fatalf("failed to resolve: %v", err)
+		}
+		if !result.Trusted || result.TrustReason != trustReasonRemoteList {
+			t.Errorf("expected the source to be trusted by the cached list, but got (%v, %s)", result.Trusted, result.TrustReason)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if downloads := atomic.LoadInt64(&requests); downloads != 0 {
+			t.Errorf("expected Resolve not to download remote IP lists, but got %d requests", downloads)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		cfg := newConfig(func(cfg *Config) { cfg.TrustedIPs = []string{"not-a-cidr"} })
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		if _, err := Resolve(req, cfg); err == nil {
+			t.Error("expected error for an invalid configuration, but got none")
+		}
+	})
+}
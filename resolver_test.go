@@ -0,0 +1,79 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	newResolver := func(t *testing.T, modify func(cfg *Config)) *Resolver {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.TrustedHeader = "X-Is-Trusted"
+		cfg.DumpPath = "/__realip/dump"
+		if modify != nil {
+			modify(cfg)
+		}
+
+		resolver, err := NewResolver(cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create resolver: %v", err)
+		}
+		return resolver
+	}
+
+	tests := []struct {
+		name           string
+		modify         func(cfg *Config)
+		path           string
+		remoteAddr     string
+		xff            string
+		expectedStatus int
+		expectedIP     string
+		expectedTrust  string
+	}{
+		{"Trusted", nil, "/test", "10.0.0.1:1234", "203.0.113.1", 0, "203.0.113.1", "yes"},
+		{"Untrusted", nil, "/test", "192.0.2.1:1234", "203.0.113.1", 0, "192.0.2.1", "no"},
+		{"Denied", func(cfg *Config) { cfg.DenyIPs = []string{"203.0.113.0/24"} }, "/test", "10.0.0.1:1234", "203.0.113.1", http.StatusForbidden, "", ""},
+		{"DumpPath", nil, "/__realip/dump", "10.0.0.1:1234", "", http.StatusOK, "", ""},
+		{"Disabled", func(cfg *Config) { cfg.Enabled = false }, "/test", "10.0.0.1:1234", "203.0.113.1", 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := newResolver(t, tt.modify)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			status := 0
+			if resp := resolver.Process(req); resp != nil {
+				status = resp.Status
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d, but got %d", tt.expectedStatus, status)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrust {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTrust, trusted)
+			}
+		})
+	}
+
+	t.Run("NilConfig", func(t *testing.T) {
+		resolver, err := NewResolver(nil, pluginName)
+		if err == nil {
+			t.Error("expected error for nil config, but got none")
+		}
+		if resolver != nil {
+			t.Error("expected resolver to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// responseDebugValue summarizes the resolution process made for responseDebugHeader, e.g.
+// "ip=203.0.113.1; trusted=yes; reason=trustedIPs; source=X-Forwarded-For". resolved is
+// the hardened resolution the outputs are written from, so the value never resolves the
+// request again, and fields that are not plain tokens are quoted so none can be forged.
+func (r *Resolver) responseDebugValue(resolved resolution, isTrusted bool, trustReason string) string {
+	trusted := "no"
+	if isTrusted {
+		trusted = "yes"
+	}
+	source := resolved.header
+	if resolved.fallback {
+		source = "fallback:" + r.fallback
+	}
+	if source == "" {
+		source = "none"
+	}
+	return fmt.Sprintf("ip=%s; trusted=%s; reason=%s; source=%s",
+		debugField(resolved.ip), trusted, debugField(trustReason), debugField(source))
+}
+
+// debugField returns value as is when it is a plain token, and as a quoted string otherwise
+func debugField(value string) string {
+	if value == "" || validOutputToken(value) {
+		return value
+	}
+	return strconv.Quote(value)
+}
@@ -0,0 +1,81 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseDebugHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		xff        string
+		denyIPs    []string
+		expected   string
+	}{
+		{"Disabled", "", "10.0.0.1:1234", "203.0.113.1", nil, ""},
+		{"TrustedSource", "X-RealIP-Debug", "10.0.0.1:1234", "203.0.113.1", nil, "ip=203.0.113.1; trusted=yes; reason=trustedIPs; source=X-Forwarded-For"},
+		{"UntrustedSource", "X-RealIP-Debug", "192.0.2.1:1234", "203.0.113.1", nil, "ip=192.0.2.1; trusted=no; reason=notTrusted; source=clientAddress"},
+		{"RejectedRequest", "X-RealIP-Debug", "10.0.0.1:1234", "203.0.113.1", []string{"203.0.113.0/24"}, "ip=203.0.113.1; trusted=yes; reason=trustedIPs; source=X-Forwarded-For"},
+		{"ForgedFields", "X-RealIP-Debug", "10.0.0.1:1234", "1.2.3.4; trusted=no; reason=x", nil, "ip=; trusted=yes; reason=trustedIPs; source=X-Forwarded-For"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"10.0.0.0/8"}
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: 0},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+			cfg.DenyIPs = tt.denyIPs
+			cfg.ResponseDebugHeader = tt.header
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			rw := httptest.NewRecorder()
+
+			plugin.ServeHTTP(rw, req)
+
+			if value := rw.Header().Get("X-RealIP-Debug"); value != tt.expected {
+				t.Errorf("expected debug header '%s', but got: '%s'", tt.expected, value)
+			}
+		})
+	}
+
+	t.Run("QuotedFields", func(t *testing.T) {
+		for value, expected := range map[string]string{
+			"X-Forwarded-For": "X-Forwarded-For",
+			"":                "",
+			"a; trusted=no":   `"a; trusted=no"`,
+			"a\"\r\nb":        `"a\"\r\nb"`,
+		} {
+			if field := debugField(value); field != expected {
+				t.Errorf("debugField(%q): expected %s, but got %s", value, expected, field)
+			}
+		}
+	})
+
+	t.Run("ReservedName", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ResponseDebugHeader = "Connection"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected an error for a reserved response debug header")
+		}
+		if plugin != nil {
+			t.Error("expected nil plugin for a reserved response debug header")
+		}
+	})
+}
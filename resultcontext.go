@@ -0,0 +1,38 @@
+package traefik_realip
+
+import (
+	"context"
+)
+
+// resultContextKey is the type of ResultContextKey
+type resultContextKey struct{}
+
+// ResultContextKey holds the Result of a request passed on by the middleware in its context,
+// for Go code running in the same process; FromContext reads it.
+var ResultContextKey = resultContextKey{}
+
+// NewContext returns ctx carrying result, e.g. for embedders attaching what Resolve returned.
+func NewContext(ctx context.Context, result Result) context.Context {
+	return context.WithValue(ctx, ResultContextKey, result)
+}
+
+// FromContext returns the Result stored in ctx, if any. Downstream code reads typed data
+// instead of parsing the output headers:
+//
+//	if result, ok := traefik_realip.FromContext(req.Context()); ok {
+//		log.Printf("client %s (from %s)", result.IP, result.Source)
+//	}
+func FromContext(ctx context.Context) (Result, bool) {
+	result, ok := ctx.Value(ResultContextKey).(Result)
+	return result, ok
+}
+
+// emittedResult is the Result of a processed request as its output headers carry it: the IP
+// is anonymized with anonymize and withheld with hashOnly, like in headerName
+func (r *Resolver) emittedResult(emitted resolution, isTrusted bool, trustReason string) *Result {
+	result := newResult(emitted, isTrusted, trustReason)
+	if r.hashOnly {
+		result.IP, result.Port, result.Chain = "", "", nil
+	}
+	return &result
+}
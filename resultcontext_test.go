@@ -0,0 +1,93 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestResultContext(t *testing.T) {
+	newHandler := func(t *testing.T, modify func(cfg *Config), captured **http.Request) http.Handler {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 1}, {HeaderName: "clientAddress"}}
+		if modify != nil {
+			modify(cfg)
+		}
+
+		next := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { *captured = req })
+		handler, err := New(context.TODO(), next, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(cfg *Config)
+		xff      string
+		expected *Result
+	}{
+		{"Resolved", nil, "203.0.113.1:8080, 10.0.0.2", &Result{
+			IP: "203.0.113.1", Port: "8080", Source: "X-Forwarded-For", Trusted: true, TrustReason: "trustedIPs", Chain: []string{"203.0.113.1", "10.0.0.2"},
+		}},
+		{"Anonymized", func(cfg *Config) { cfg.Anonymize = true }, "203.0.113.1, 10.0.0.2", &Result{
+			IP: "203.0.113.0", Source: "X-Forwarded-For", Trusted: true, TrustReason: "trustedIPs", Chain: []string{"203.0.113.0", "10.0.0.2"},
+		}},
+		{"HashOnly", func(cfg *Config) {
+			cfg.HashOnly = true
+			cfg.HashedHeaderName = "X-Real-IP-Hash"
+			cfg.HashKey = "0123456789abcdef0123456789abcdef"
+		}, "203.0.113.1:8080, 10.0.0.2", &Result{
+			Source: "X-Forwarded-For", Trusted: true, TrustReason: "trustedIPs",
+		}},
+		{"Rejected", func(cfg *Config) { cfg.DenyIPs = []string{"203.0.113.0/24"} }, "203.0.113.1, 10.0.0.2", nil},
+		{"Disabled", func(cfg *Config) { cfg.Enabled = false }, "203.0.113.1, 10.0.0.2", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var captured *http.Request
+			handler := newHandler(t, tt.modify, &captured)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.expected == nil {
+				if captured == nil {
+					return
+				}
+				if result, ok := FromContext(captured.Context()); ok {
+					t.Errorf("expected no result in the context, but got %+v", result)
+				}
+				return
+			}
+			if captured == nil {
+				t.Fatal("expected the request to be passed on")
+			}
+			result, ok := FromContext(captured.Context())
+			if !ok {
+				t.Fatal("expected a result in the context, but got none")
+			}
+			if !reflect.DeepEqual(result, *tt.expected) {
+				t.Errorf("expected %+v, but got %+v", *tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("NewContext", func(t *testing.T) {
+		ctx := NewContext(context.Background(), Result{IP: "203.0.113.1"})
+		if result, ok := FromContext(ctx); !ok || result.IP != "203.0.113.1" {
+			t.Errorf("expected IP '203.0.113.1' from the context, but got %+v (%v)", result, ok)
+		}
+		if _, ok := FromContext(context.Background()); ok {
+			t.Error("expected no result in an empty context")
+		}
+	})
+}
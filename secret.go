@@ -0,0 +1,41 @@
+package traefik_realip
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+// sharedSecret trusts requests carrying a pre-shared secret from an upstream proxy whose
+// source IP cannot be listed, e.g. serverless egress
+type sharedSecret struct {
+	header string
+	digest [sha256.Size]byte // Digest of the secret, so comparisons do not leak its length
+}
+
+// newSharedSecret validates the trustedSecretHeader and trustedSecretValue configuration
+func newSharedSecret(name, header, value string) (*sharedSecret, error) {
+	if header == "" && value == "" {
+		return nil, nil
+	}
+	if header == "" || value == "" {
+		return nil, fmt.Errorf("%s: trustedSecretHeader and trustedSecretValue must be set together", name)
+	}
+	return &sharedSecret{header: header, digest: sha256.Sum256([]byte(value))}, nil
+}
+
+// matches reports whether req carries the secret, comparing in constant time
+func (s *sharedSecret) matches(req *http.Request) bool {
+	value := req.Header.Get(s.header)
+	if value == "" {
+		return false
+	}
+	digest := sha256.Sum256([]byte(value))
+	return subtle.ConstantTimeCompare(digest[:], s.digest[:]) == 1
+}
+
+// strip removes the secret so it never reaches the backend
+func (s *sharedSecret) strip(req *http.Request) {
+	req.Header.Del(s.header)
+}
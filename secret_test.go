@@ -0,0 +1,145 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSharedSecretTrust(t *testing.T) {
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) *Plugin {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "X-Forwarded-For", Depth: -1},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.TrustedHeader = "X-Is-Trusted"
+		cfg.TrustedSecretHeader = "X-Edge-Secret"
+		cfg.TrustedSecretValue = "s3cr3t"
+		if modify != nil {
+			modify(cfg)
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		secret        string
+		expectedIP    string
+		expectedTrust string
+	}{
+		{"SecretFromDynamicIP", "192.0.2.1:1234", "s3cr3t", "203.0.113.1", "yes"},
+		{"WrongSecret", "192.0.2.1:1234", "guess", "192.0.2.1", "no"},
+		{"SecretPrefix", "192.0.2.1:1234", "s3cr3t-and-more", "192.0.2.1", "no"},
+		{"NoSecret", "192.0.2.1:1234", "", "192.0.2.1", "no"},
+		{"TrustedRangeWithoutSecret", "10.0.0.1:1234", "", "203.0.113.1", "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			if tt.secret != "" {
+				req.Header.Set("X-Edge-Secret", tt.secret)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrust {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTrust, trusted)
+			}
+			if _, present := req.Header["X-Edge-Secret"]; present {
+				t.Error("expected the secret to be stripped before forwarding")
+			}
+		})
+	}
+
+	t.Run("NotCachedPerIP", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.TrustCacheTTL = 60
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Edge-Secret", "s3cr3t")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		req = httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if trusted := req.Header.Get("X-Is-Trusted"); trusted != "no" {
+			t.Errorf("expected the next request without secret to be untrusted, but got: '%s'", trusted)
+		}
+	})
+
+	t.Run("SecretOnly", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.TrustedIPs = nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Edge-Secret", "s3cr3t")
+
+		trusted, reason := plugin.trustVerdict(req)
+		if !trusted || reason != trustReasonSharedSecret {
+			t.Errorf("expected trust through the secret, but got trusted=%v reason=%q", trusted, reason)
+		}
+	})
+
+	t.Run("RedactedInDump", func(t *testing.T) {
+		var logs bytes.Buffer
+		logWriter = &logs
+		defer func() { logWriter = os.Stdout }()
+
+		newPlugin(t, nil).dump(time.Now())
+
+		if strings.Contains(logs.String(), "s3cr3t") {
+			t.Errorf("expected the secret to be redacted, but got: %s", logs.String())
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		header string
+		value  string
+	}{
+		{"HeaderWithoutValue", "X-Edge-Secret", ""},
+		{"ValueWithoutHeader", "", "s3cr3t"},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustedSecretHeader = tt.header
+			cfg.TrustedSecretValue = tt.value
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for incomplete shared secret, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
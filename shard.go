@@ -0,0 +1,18 @@
+package traefik_realip
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// shardOf returns the shard of ip as a decimal string: the 32-bit FNV-1a hash of the
+// IP text modulo count. The algorithm is part of the documented contract, so other
+// services can reproduce it. Returns "" when ip is empty.
+func shardOf(ip string, count int) string {
+	if ip == "" || count <= 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return strconv.FormatUint(uint64(h.Sum32()%uint32(count)), 10)
+}
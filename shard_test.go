@@ -0,0 +1,81 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShardOf(t *testing.T) {
+	tests := []struct {
+		ip       string
+		count    int
+		expected string
+	}{
+		{"203.0.113.1", 16, "2"},
+		{"2001:db8::1", 16, "7"},
+		{"198.51.100.7", 16, "5"},
+		{"203.0.113.1", 1, "0"},
+		{"", 16, ""},
+		{"203.0.113.1", 0, ""},
+	}
+
+	for _, tt := range tests {
+		if shard := shardOf(tt.ip, tt.count); shard != tt.expected {
+			t.Errorf("shardOf(%q, %d) = %q, expected %q", tt.ip, tt.count, shard, tt.expected)
+		}
+	}
+}
+
+func TestShardHeader(t *testing.T) {
+	cfg := &Config{
+		Enabled:         true,
+		HeaderName:      "X-Real-IP",
+		ProcessHeaders:  []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		ForceOverwrite:  true,
+		TrustAll:        true,
+		Anonymize:       true,
+		ShardHeaderName: "X-Client-Shard",
+		ShardCount:      16,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	t.Run("Resolved", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		// The shard is derived from the full IP, not the anonymized one
+		if shard := req.Header.Get("X-Client-Shard"); shard != "2" {
+			t.Errorf("expected shard '2', but got: '%s'", shard)
+		}
+	})
+
+	t.Run("Unresolved", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Client-Shard", "9")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if shard := req.Header.Get("X-Client-Shard"); shard != "" {
+			t.Errorf("expected empty shard, but got: '%s'", shard)
+		}
+	})
+
+	t.Run("MissingCount", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ShardHeaderName = "X-Client-Shard"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a missing shardCount, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package traefik_realip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ipSigner signs the emitted IP, so downstream services can verify it was set by this
+// middleware and not injected by an intermediate hop
+type ipSigner struct {
+	key []byte
+}
+
+// newIPSigner returns a signer for key
+func newIPSigner(key string) *ipSigner {
+	return &ipSigner{key: []byte(key)}
+}
+
+// sign returns the signature of ip at now, formatted as "t=<unix seconds>,v1=<hex HMAC-SHA256>"
+// where the HMAC covers "<unix seconds>.<ip>"
+func (s *ipSigner) sign(ip string, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signatureMAC(s.key, timestamp, ip)
+}
+
+// signatureMAC computes the hex HMAC-SHA256 of "<timestamp>.<ip>"
+func signatureMAC(key []byte, timestamp, ip string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp + "." + ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature emitted in signatureHeaderName for ip, as received by a
+// downstream service sharing key. Signatures older than maxAge (or from more than maxAge in
+// the future) are rejected; a maxAge of 0 disables the age check.
+func VerifySignature(key, ip, signature string, now time.Time, maxAge time.Duration) error {
+	var timestamp, mac string
+	for _, part := range strings.Split(signature, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			mac = value
+		}
+	}
+	if timestamp == "" || mac == "" {
+		return fmt.Errorf("malformed signature %q", signature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed signature timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); maxAge > 0 && (age > maxAge || age < -maxAge) {
+		return fmt.Errorf("signature timestamp %s is outside the allowed age of %s", time.Unix(seconds, 0).UTC().Format(time.RFC3339), maxAge)
+	}
+
+	if !hmac.Equal([]byte(mac), []byte(signatureMAC([]byte(key), timestamp, ip))) {
+		return fmt.Errorf("signature does not match %q", ip)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignatureHeader(t *testing.T) {
+	const key = "downstream-key"
+
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) http.Handler {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}}
+		cfg.SignatureHeaderName = "X-Real-IP-Signature"
+		cfg.SignatureKey = key
+		if modify != nil {
+			modify(cfg)
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	t.Run("Verifiable", func(t *testing.T) {
+		plugin := newPlugin(t, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		signature := req.Header.Get("X-Real-IP-Signature")
+		if err := VerifySignature(key, req.Header.Get("X-Real-IP"), signature, time.Now(), time.Minute); err != nil {
+			t.Errorf("expected signature to verify, but got: %v (signature %q)", err, signature)
+		}
+		if err := VerifySignature(key, "198.51.100.1", signature, time.Now(), time.Minute); err == nil {
+			t.Error("expected signature not to verify for another IP")
+		}
+		if err := VerifySignature("other-key", "203.0.113.1", signature, time.Now(), time.Minute); err == nil {
+			t.Error("expected signature not to verify with another key")
+		}
+	})
+
+	t.Run("ClientValueNotSigned", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.ForceOverwrite = false
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Real-IP", "198.51.100.1")
+		req.Header.Set("X-Real-IP-Signature", "t=1,v1=forged")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if req.Header.Get("X-Real-IP") != "198.51.100.1" {
+			t.Fatalf("expected the client value to be kept without forceOverwrite")
+		}
+		if signature := req.Header.Get("X-Real-IP-Signature"); signature != "" {
+			t.Errorf("expected no signature for a value this middleware did not write, but got: '%s'", signature)
+		}
+	})
+
+	t.Run("Anonymized", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.Anonymize = true
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.57")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if err := VerifySignature(key, "203.0.113.0", req.Header.Get("X-Real-IP-Signature"), time.Now(), 0); err != nil {
+			t.Errorf("expected the emitted (anonymized) value to be signed, but got: %v", err)
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		modify func(cfg *Config)
+	}{
+		{"MissingKey", func(cfg *Config) { cfg.SignatureKey = "" }},
+		{"HashOnly", func(cfg *Config) {
+			cfg.HashedHeaderName = "X-Real-IP-Hash"
+			cfg.HashKey = "hash-key"
+			cfg.HashOnly = true
+		}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.SignatureHeaderName = "X-Real-IP-Signature"
+			cfg.SignatureKey = key
+			tt.modify(cfg)
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for invalid signature configuration, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signature := newIPSigner("key").sign("203.0.113.1", now)
+
+	tests := []struct {
+		name      string
+		signature string
+		now       time.Time
+		maxAge    time.Duration
+		valid     bool
+	}{
+		{"Fresh", signature, now.Add(10 * time.Second), time.Minute, true},
+		{"Expired", signature, now.Add(2 * time.Minute), time.Minute, false},
+		{"FromTheFuture", signature, now.Add(-2 * time.Minute), time.Minute, false},
+		{"NoAgeCheck", signature, now.Add(24 * time.Hour), 0, true},
+		{"Malformed", "garbage", now, time.Minute, false},
+		{"BadTimestamp", "t=abc,v1=00", now, time.Minute, false},
+		{"TamperedTimestamp", "t=1700000001" + signature[len("t=1700000000"):], now, time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature("key", "203.0.113.1", tt.signature, tt.now, tt.maxAge)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid signature, but got: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected invalid signature, but got none")
+			}
+		})
+	}
+}
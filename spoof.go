@@ -0,0 +1,53 @@
+package traefik_realip
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// spoofableHeaders returns the inbound headers an untrusted client has no business sending:
+// the output headers, its legacy names and every processed header except the synthetic clientAddress
+func (r *Resolver) spoofableHeaders() []string {
+	headers := []string{r.headerName}
+	headers = append(headers, r.legacyHeaderNames...)
+	for _, headerConfig := range r.processHeaders {
+		if !r.isSynthetic(headerConfig.HeaderName) {
+			headers = append(headers, headerConfig.HeaderName)
+		}
+		if headerConfig.TargetHeaderName != "" {
+			headers = append(headers, headerConfig.TargetHeaderName)
+		}
+	}
+	return headers
+}
+
+// detectSpoofing reports whether an untrusted request carries any spoofable header,
+// removing them all when stripSpoofedHeaders is enabled. Headers whose own trust set
+// honors the source are expected from it and left alone.
+func (r *Resolver) detectSpoofing(req *http.Request) bool {
+	spoofed := false
+	for _, header := range r.spoofHeaders {
+		if _, present := req.Header[http.CanonicalHeaderKey(header)]; present {
+			if r.headerTrustedByOverride(header, req) {
+				continue
+			}
+			spoofed = true
+			if !r.stripSpoofedHeaders {
+				break
+			}
+			req.Header.Del(header)
+		}
+	}
+
+	if spoofed {
+		atomic.AddInt64(&r.stats.spoofAttempts, 1)
+	}
+	return spoofed
+}
+
+// sanitize deletes the sanitizeHeaders from a request of an untrusted source
+func (r *Resolver) sanitize(req *http.Request) {
+	for _, header := range r.sanitizeHeaders {
+		req.Header.Del(header)
+	}
+}
@@ -0,0 +1,143 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpoofDetection(t *testing.T) {
+	newPlugin := func(t *testing.T, strip bool, spoofHeaderName string) *Plugin {
+		cfg := &Config{
+			Enabled:    true,
+			HeaderName: "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: -1},
+				{HeaderName: "CF-Connecting-IP", Depth: -1},
+				{HeaderName: "clientAddress", Depth: -1},
+			},
+			ForceOverwrite:      false,
+			TrustedIPs:          []string{"10.0.0.0/8"},
+			StripSpoofedHeaders: strip,
+			SpoofHeaderName:     spoofHeaderName,
+			LegacyHeaderNames:   []string{"X-Client-IP"},
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name          string
+		strip         bool
+		remoteAddr    string
+		headers       map[string]string
+		expectedSpoof string
+		expectedXFF   string
+	}{
+		{"UntrustedWithXFF", true, "198.51.100.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "yes", ""},
+		{"UntrustedWithOutputHeader", true, "198.51.100.1:1234", map[string]string{"X-Real-IP": "1.2.3.4"}, "yes", ""},
+		{"UntrustedWithLegacyHeader", true, "198.51.100.1:1234", map[string]string{"X-Client-IP": "1.2.3.4"}, "yes", ""},
+		{"UntrustedDetectOnly", false, "198.51.100.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "yes", "1.2.3.4"},
+		{"UntrustedClean", true, "198.51.100.1:1234", nil, "", ""},
+		{"UntrustedForgedTag", true, "198.51.100.1:1234", map[string]string{"X-Spoof-Attempt": "no"}, "", ""},
+		{"Trusted", true, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "", "1.2.3.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.strip, "X-Spoof-Attempt")
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if spoof := req.Header.Get("X-Spoof-Attempt"); spoof != tt.expectedSpoof {
+				t.Errorf("expected spoof header '%s', but got: '%s'", tt.expectedSpoof, spoof)
+			}
+			if xff := req.Header.Get("X-Forwarded-For"); xff != tt.expectedXFF {
+				t.Errorf("expected X-Forwarded-For '%s', but got: '%s'", tt.expectedXFF, xff)
+			}
+			if tt.strip && tt.expectedSpoof == "yes" {
+				for _, header := range []string{"X-Real-IP", "X-Client-IP"} {
+					if value := req.Header.Get(header); value == "1.2.3.4" {
+						t.Errorf("expected spoofed %s to be stripped", header)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("StripWithoutTag", func(t *testing.T) {
+		plugin := newPlugin(t, true, "")
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		req.Header.Set("CF-Connecting-IP", "1.2.3.4")
+
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if value := req.Header.Get("CF-Connecting-IP"); value != "" {
+			t.Errorf("expected CF-Connecting-IP to be stripped, but got: '%s'", value)
+		}
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "198.51.100.1" {
+			t.Errorf("expected real IP from clientAddress, but got: '%s'", realIP)
+		}
+		if stats := plugin.Stats(); stats.SpoofAttempts != 1 {
+			t.Errorf("expected 1 spoof attempt, but got %d", stats.SpoofAttempts)
+		}
+	})
+}
+
+func TestSanitizeHeaders(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.TrustAll = false
+	cfg.TrustedIPs = []string{"10.0.0.0/8"}
+	cfg.SanitizeHeaders = []string{"CF-IPCountry", "x-forwarded-proto", "True-Client-IP"}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		expectKept bool
+	}{
+		{"Untrusted", "192.0.2.1:1234", false},
+		{"Trusted", "10.0.0.1:1234", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("CF-IPCountry", "US")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Add("True-Client-IP", "203.0.113.1")
+			req.Header.Add("True-Client-IP", "203.0.113.2")
+			req.Header.Set("Accept", "text/html")
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			for _, header := range []string{"CF-IPCountry", "X-Forwarded-Proto", "True-Client-IP"} {
+				_, present := req.Header[http.CanonicalHeaderKey(header)]
+				if present != tt.expectKept {
+					t.Errorf("expected %s present=%v, but got %v", header, tt.expectKept, present)
+				}
+			}
+			if req.Header.Get("Accept") != "text/html" {
+				t.Error("expected headers outside the list to be kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package traefik_realip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters of a plugin instance.
+type Stats struct {
+	Requests        int64 `json:"requests"`        // Requests processed while enabled
+	Trusted         int64 `json:"trusted"`         // Requests from trusted sources
+	Untrusted       int64 `json:"untrusted"`       // Requests from untrusted sources
+	Resolved        int64 `json:"resolved"`        // Requests for which a real IP was resolved
+	Unresolved      int64 `json:"unresolved"`      // Requests for which no header yielded an IP
+	Fallbacks       int64 `json:"fallbacks"`       // Requests whose real IP was produced by the fallback
+	ResolvedProxies int64 `json:"resolvedProxies"` // Requests whose headers resolved to an IP in the trusted ranges (with resolvedProxyCheck)
+	ReplaySuspected int64 `json:"replaySuspected"` // Requests tagged as suspected replays
+	Dumps           int64 `json:"dumps"`           // Diagnostic dumps written to the log
+	Rejected        int64 `json:"rejected"`        // Requests rejected by enforcement features or failureMode
+	Failures        int64 `json:"failures"`        // Processing failures handled according to failureMode
+	SpoofAttempts   int64 `json:"spoofAttempts"`   // Untrusted requests carrying headerName or processed headers
+	HostMismatches  int64 `json:"hostMismatches"`  // Requests whose Host is an IP literal other than the real IP and outside the trusted ranges
+	LegacyWrites    int64 `json:"legacyWrites"`    // Requests whose value was dual-written to legacyHeaderNames
+	LegacyOverdue   int64 `json:"legacyOverdue"`   // Legacy writes after legacyHeaderNamesExpiry
+
+	TrustedIPsFileReloads int64     `json:"trustedIPsFileReloads"`        // Reloads of trustedIPsFile after it changed
+	GraceMatches          int64     `json:"graceMatches"`                 // Sources trusted only through a removed prefix in its grace period
+	TrustedIPsFileDiff    *ListDiff `json:"trustedIPsFileDiff,omitempty"` // Last change of trustedIPsFile
+}
+
+// statsCounters holds the live counters, updated atomically from concurrent requests.
+type statsCounters struct {
+	requests        int64
+	trusted         int64
+	untrusted       int64
+	resolved        int64
+	unresolved      int64
+	fallbacks       int64
+	resolvedProxies int64
+	replaySuspected int64
+	dumps           int64
+	rejected        int64
+	failures        int64
+	spoofAttempts   int64
+	hostMismatches  int64
+	legacyWrites    int64
+	legacyOverdue   int64
+	graceMatches    int64
+}
+
+// Stats returns a snapshot of the plugin counters.
+func (r *Resolver) Stats() Stats {
+	stats := Stats{
+		Requests:        atomic.LoadInt64(&r.stats.requests),
+		Trusted:         atomic.LoadInt64(&r.stats.trusted),
+		Untrusted:       atomic.LoadInt64(&r.stats.untrusted),
+		Resolved:        atomic.LoadInt64(&r.stats.resolved),
+		Unresolved:      atomic.LoadInt64(&r.stats.unresolved),
+		Fallbacks:       atomic.LoadInt64(&r.stats.fallbacks),
+		ResolvedProxies: atomic.LoadInt64(&r.stats.resolvedProxies),
+		ReplaySuspected: atomic.LoadInt64(&r.stats.replaySuspected),
+		Dumps:           atomic.LoadInt64(&r.stats.dumps),
+		Rejected:        atomic.LoadInt64(&r.stats.rejected),
+		Failures:        atomic.LoadInt64(&r.stats.failures),
+		SpoofAttempts:   atomic.LoadInt64(&r.stats.spoofAttempts),
+		HostMismatches:  atomic.LoadInt64(&r.stats.hostMismatches),
+		LegacyWrites:    atomic.LoadInt64(&r.stats.legacyWrites),
+		LegacyOverdue:   atomic.LoadInt64(&r.stats.legacyOverdue),
+	}
+	stats.GraceMatches = atomic.LoadInt64(&r.stats.graceMatches)
+	if r.trustedIPsFile != nil {
+		stats.TrustedIPsFileReloads, stats.TrustedIPsFileDiff = r.trustedIPsFile.LastDiff()
+	}
+	return stats
+}
+
+// dumpContextKey is the type of DumpContextKey
+type dumpContextKey struct{}
+
+// DumpContextKey can be set to true in a request context by embedders to make the plugin
+// write a one-shot dump of Stats() and its effective configuration to the log stream:
+//
+//	req = req.WithContext(context.WithValue(req.Context(), traefik_realip.DumpContextKey, true))
+var DumpContextKey = dumpContextKey{}
+
+// minDumpInterval rate-limits diagnostic dumps so the trigger cannot flood the logs
+const minDumpInterval = time.Second
+
+// dumpRequested reports whether the request context asks for a diagnostic dump
+func dumpRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(DumpContextKey).(bool)
+	return requested
+}
+
+// isDumpPath reports whether req targets the configured dump path
+func (r *Resolver) isDumpPath(req *http.Request) bool {
+	return r.dumpPath != "" && req.URL.Path == r.dumpPath
+}
+
+// redactedConfig returns the configuration with secrets replaced, for diagnostics
+func (r *Resolver) redactedConfig() Config {
+	config := r.config
+	if config.HashKey != "" {
+		config.HashKey = redactedValue
+	}
+	if config.IntrospectionClientSecret != "" {
+		config.IntrospectionClientSecret = redactedValue
+	}
+	if config.SignatureKey != "" {
+		config.SignatureKey = redactedValue
+	}
+	if config.TrustedSecretValue != "" {
+		config.TrustedSecretValue = redactedValue
+	}
+	return config
+}
+
+// dump writes Stats() and the effective configuration to the log, at most once per minDumpInterval
+func (r *Resolver) dump(now time.Time) {
+	last := atomic.LoadInt64(&r.lastDump)
+	if last != 0 && now.Sub(time.Unix(0, last)) < minDumpInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&r.lastDump, last, now.UnixNano()) {
+		return
+	}
+	atomic.AddInt64(&r.stats.dumps, 1)
+
+	payload, err := json.Marshal(struct {
+		Version string `json:"version"`
+		Stats   Stats  `json:"stats"`
+		Config  Config `json:"config"`
+	}{
+		Version: r.versionStamp(),
+		Stats:   r.Stats(),
+		Config:  r.redactedConfig(),
+	})
+	if err != nil {
+		logf(r.name, "failed to encode dump: %v", err)
+		return
+	}
+
+	logf(r.name, "dump: %s", payload)
+}
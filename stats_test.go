@@ -0,0 +1,137 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	cfg := &Config{
+		Enabled:          true,
+		HeaderName:       "X-Real-IP",
+		ProcessHeaders:   []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		ForceOverwrite:   true,
+		TrustAll:         false,
+		TrustedIPs:       []string{"10.0.0.0/8"},
+		ReplayHeaderName: "X-Replay-Suspected",
+		ReplayThreshold:  2,
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	p := handler.(*Plugin)
+
+	for _, remoteAddr := range []string{"10.0.0.2:1234", "10.0.0.2:1234", "8.8.8.8:1234"} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	expected := Stats{Requests: 3, Trusted: 2, Untrusted: 1, Resolved: 2, Unresolved: 1, ReplaySuspected: 1}
+	if stats := p.Stats(); stats != expected {
+		t.Errorf("expected stats %+v, but got %+v", expected, stats)
+	}
+}
+
+func TestDump(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	cfg := &Config{
+		Enabled:        true,
+		HeaderName:     "X-Real-IP",
+		ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		TrustAll:       false,
+		TrustedIPs:     []string{"10.0.0.0/8"},
+		DumpPath:       "/__realip/dump",
+	}
+
+	nextCalled := false
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextCalled = true
+	})
+
+	handler, err := New(context.TODO(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	p := handler.(*Plugin)
+
+	t.Run("UntrustedDumpPathIsProxied", func(t *testing.T) {
+		logs.Reset()
+		nextCalled = false
+
+		req := httptest.NewRequest(http.MethodGet, "/__realip/dump", nil)
+		req.RemoteAddr = "8.8.8.8:1234"
+		p.ServeHTTP(httptest.NewRecorder(), req)
+
+		if !nextCalled {
+			t.Error("expected untrusted request to the dump path to be proxied")
+		}
+		if logs.Len() != 0 {
+			t.Errorf("expected no dump for untrusted source, but got: %q", logs.String())
+		}
+	})
+
+	t.Run("TrustedDumpPath", func(t *testing.T) {
+		logs.Reset()
+		nextCalled = false
+
+		req := httptest.NewRequest(http.MethodGet, "/__realip/dump", nil)
+		req.RemoteAddr = "10.0.0.2:1234"
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if nextCalled {
+			t.Error("expected dump path to be answered by the plugin")
+		}
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("expected JSON response, but got content type: '%s'", contentType)
+		}
+		if body := rr.Body.String(); !strings.Contains(body, `"dumpPath": "/__realip/dump"`) {
+			t.Errorf("expected the effective configuration in the response, but got: %s", body)
+		}
+		output := logs.String()
+		if !strings.Contains(output, `"stats":{"requests":2`) || !strings.Contains(output, `"dumpPath":"/__realip/dump"`) {
+			t.Errorf("expected stats and configuration in the dump, but got: %q", output)
+		}
+	})
+
+	t.Run("ContextValueAndRateLimit", func(t *testing.T) {
+		logs.Reset()
+		nextCalled = false
+		p.lastDump = 0
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "8.8.8.8:1234"
+			req = req.WithContext(context.WithValue(req.Context(), DumpContextKey, true))
+			p.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		if !nextCalled {
+			t.Error("expected request with dump context value to be proxied")
+		}
+		if count := strings.Count(logs.String(), "dump:"); count != 1 {
+			t.Errorf("expected exactly one rate-limited dump, but got %d: %q", count, logs.String())
+		}
+
+		p.dump(time.Now().Add(2 * minDumpInterval))
+		if count := strings.Count(logs.String(), "dump:"); count != 2 {
+			t.Errorf("expected a dump after the rate limit interval, but got %d", count)
+		}
+	})
+}
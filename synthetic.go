@@ -0,0 +1,120 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultSyntheticHeaderName is the processHeaders name mapped to the connection address
+const defaultSyntheticHeaderName = "clientAddress"
+
+// Further synthetic sources, carrying topology information beyond the client IP
+const (
+	syntheticClientPort            = "clientPort"            // Port of the connection address
+	syntheticClientAddressWithPort = "clientAddressWithPort" // Connection address with its port
+	syntheticLocalAddress          = "localAddress"          // Address of the Traefik listener the request arrived on
+)
+
+// parseSyntheticHeaderName returns the processHeaders name mapped to the connection address,
+// defaulting to clientAddress, or "" when the synthetic source is disabled, so that an entry
+// of that name reads a real header.
+func parseSyntheticHeaderName(name, headerName string, disabled bool) (string, error) {
+	if disabled {
+		return "", nil
+	}
+	if headerName == "" {
+		return defaultSyntheticHeaderName, nil
+	}
+	if strings.TrimSpace(headerName) != headerName || strings.ContainsAny(headerName, " ,;") {
+		return "", fmt.Errorf("%s: syntheticHeaderName cannot contain spaces, commas or semicolons, got %q", name, headerName)
+	}
+	return headerName, nil
+}
+
+// isSynthetic reports whether a processHeaders entry named headerName reads the connection
+// rather than a header: the synthetic name, "" when disabled, or one of the further sources
+func isSynthetic(headerName, synthetic string) bool {
+	if synthetic == "" {
+		return false
+	}
+	switch headerName {
+	case synthetic, syntheticClientPort, syntheticClientAddressWithPort, syntheticLocalAddress:
+		return true
+	}
+	return false
+}
+
+// isSynthetic reports whether a processHeaders entry named headerName reads the connection
+func (r *Resolver) isSynthetic(headerName string) bool {
+	return isSynthetic(headerName, r.syntheticHeaderName)
+}
+
+// validateSyntheticSources refuses clientPort entries without a target: a port cannot resolve headerName
+func validateSyntheticSources(name string, headers []HeaderConfig, synthetic string) error {
+	var problems configErrors
+	for i, headerConfig := range headers {
+		if headerConfig.HeaderName == syntheticClientPort && isSynthetic(headerConfig.HeaderName, synthetic) && headerConfig.TargetHeaderName == "" {
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): targetHeaderName cannot be empty, a port is not a client IP", name, i, headerConfig.HeaderName))
+		}
+	}
+	return problems.err()
+}
+
+// syntheticValue returns the value a synthetic processHeaders entry reads from the connection.
+// clientPort yields no candidate IP; its port is only written by syntheticTarget.
+func (r *Resolver) syntheticValue(headerName string, req *http.Request) string {
+	switch headerName {
+	case syntheticClientPort:
+		return ""
+	case syntheticLocalAddress:
+		if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			return addr.String()
+		}
+		return ""
+	default:
+		return req.RemoteAddr
+	}
+}
+
+// syntheticTarget writes the value of a clientPort or clientAddressWithPort entry to its target
+// header, which unlike other targets carries a port. It reports false for other entries.
+func (r *Resolver) syntheticTarget(out *outputWriter, headerConfig HeaderConfig, req *http.Request) bool {
+	if !r.isSynthetic(headerConfig.HeaderName) {
+		return false
+	}
+	ip, port := r.splitIPAddress(req.RemoteAddr)
+	if !validOutputPort(port) {
+		port = ""
+	}
+
+	switch headerConfig.HeaderName {
+	case syntheticClientPort:
+		out.set(headerConfig.TargetHeaderName, port)
+	case syntheticClientAddressWithPort:
+		if r.hashOnly {
+			out.req.Header.Del(headerConfig.TargetHeaderName)
+			return true
+		}
+		ip = r.outputIP(ip)
+		if r.anonymizer != nil && ip != "" {
+			ip = r.anonymizer.anonymize(ip)
+		}
+		if ip != "" && port != "" {
+			ip = net.JoinHostPort(ip, port)
+		}
+		out.set(headerConfig.TargetHeaderName, ip)
+	default:
+		return false
+	}
+	return true
+}
+
+// syntheticSource is the source reported for IPs taken from the connection address
+func (r *Resolver) syntheticSource() string {
+	if r.syntheticHeaderName == "" {
+		return defaultSyntheticHeaderName
+	}
+	return r.syntheticHeaderName
+}
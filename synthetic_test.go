@@ -0,0 +1,171 @@
+package traefik_realip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSyntheticHeaderName(t *testing.T) {
+	tests := []struct {
+		name           string
+		synthetic      string
+		disabled       bool
+		fallback       string
+		headers        []HeaderConfig
+		expectedIP     string
+		expectedSource string
+	}{
+		{"Default", "", false, "", []HeaderConfig{{HeaderName: "X-Forwarded-For"}, {HeaderName: "clientAddress"}}, "192.0.2.1", "clientAddress[0]"},
+		{"Renamed", "@remoteAddr", false, "", []HeaderConfig{{HeaderName: "X-Forwarded-For"}, {HeaderName: "@remoteAddr"}}, "192.0.2.1", "@remoteAddr[0]"},
+		{"RenamedReadsRealHeader", "@remoteAddr", false, "", []HeaderConfig{{HeaderName: "clientAddress"}, {HeaderName: "@remoteAddr"}}, "198.51.100.7", "clientAddress[0]"},
+		{"Disabled", "", true, "", []HeaderConfig{{HeaderName: "clientAddress"}}, "198.51.100.7", "clientAddress[0]"},
+		{"DisabledFallback", "", true, fallbackRemoteAddr, []HeaderConfig{{HeaderName: "X-Missing"}}, "192.0.2.1", "clientAddress[0]"},
+		{"RenamedFallback", "@remoteAddr", false, fallbackRemoteAddr, []HeaderConfig{{HeaderName: "X-Missing"}}, "192.0.2.1", "@remoteAddr[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.SyntheticHeaderName = tt.synthetic
+			cfg.DisableSyntheticHeader = tt.disabled
+			cfg.Fallback = tt.fallback
+			cfg.ProcessHeaders = tt.headers
+			cfg.SourceHeaderName = "X-Real-IP-Source"
+
+			handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("ClientAddress", "198.51.100.7")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if source := req.Header.Get("X-Real-IP-Source"); source != tt.expectedSource {
+				t.Errorf("expected source '%s', but got: '%s'", tt.expectedSource, source)
+			}
+		})
+	}
+
+	t.Run("UntrustedSourceCannotUseRealHeader", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.SyntheticHeaderName = "@remoteAddr"
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "clientAddress"}, {HeaderName: "@remoteAddr"}}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("ClientAddress", "198.51.100.7")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "192.0.2.1" {
+			t.Errorf("expected the connection address '192.0.2.1', but got: '%s'", realIP)
+		}
+	})
+
+	t.Run("InvalidName", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.SyntheticHeaderName = "remote addr"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a syntheticHeaderName with a space, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestSyntheticSources(t *testing.T) {
+	newPlugin := func(t *testing.T, headers []HeaderConfig) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = headers
+		cfg.SourceHeaderName = "X-Real-IP-Source"
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	targets := []HeaderConfig{
+		{HeaderName: "X-Forwarded-For"},
+		{HeaderName: "clientPort", TargetHeaderName: "X-Client-Port"},
+		{HeaderName: "clientAddressWithPort", TargetHeaderName: "X-Client-Address"},
+		{HeaderName: "localAddress", TargetHeaderName: "X-Local-IP"},
+		{HeaderName: "clientAddress"},
+	}
+
+	tests := []struct {
+		name       string
+		headers    []HeaderConfig
+		remoteAddr string
+		local      net.Addr
+		expected   map[string]string
+	}{
+		{"Targets", targets, "192.0.2.1:1234", &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443}, map[string]string{
+			"X-Client-Port": "1234", "X-Client-Address": "192.0.2.1:1234", "X-Local-IP": "10.0.0.5", "X-Real-IP": "192.0.2.1", "X-Real-IP-Source": "clientAddress[0]",
+		}},
+		{"TargetsIPv6", targets, "[2001:db8::1]:8080", nil, map[string]string{
+			"X-Client-Port": "8080", "X-Client-Address": "[2001:db8::1]:8080", "X-Local-IP": "", "X-Real-IP": "2001:db8::1",
+		}},
+		{"TargetsWithoutPort", targets, "192.0.2.1", nil, map[string]string{
+			"X-Client-Port": "", "X-Client-Address": "192.0.2.1",
+		}},
+		{"LocalAddressSource", []HeaderConfig{{HeaderName: "localAddress"}}, "192.0.2.1:1234", &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443}, map[string]string{
+			"X-Real-IP": "10.0.0.5", "X-Real-IP-Source": "localAddress[0]",
+		}},
+		{"AddressWithPortSource", []HeaderConfig{{HeaderName: "clientAddressWithPort"}}, "192.0.2.1:1234", nil, map[string]string{
+			"X-Real-IP": "192.0.2.1", "X-Real-IP-Source": "clientAddressWithPort[0]",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.headers)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.local != nil {
+				req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, tt.local))
+			}
+			req.Header.Set("X-Client-Port", "forged")
+			req.Header.Set("ClientPort", "9999")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			for header, expected := range tt.expected {
+				if value := req.Header.Get(header); value != expected {
+					t.Errorf("expected %s '%s', but got: '%s'", header, expected, value)
+				}
+			}
+		})
+	}
+
+	t.Run("ClientPortNeedsTarget", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "clientPort"}}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for clientPort without targetHeaderName, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
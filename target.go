@@ -0,0 +1,37 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// skipReasonOwnTarget marks processHeaders entries resolved into their own target header
+const skipReasonOwnTarget = "own target header"
+
+// validateTargets refuses target headers that would overwrite headerName or each other
+func validateTargets(name, headerName string, headers []HeaderConfig) error {
+	targets := map[string]bool{http.CanonicalHeaderKey(headerName): true}
+	var problems configErrors
+	for i, headerConfig := range headers {
+		if headerConfig.TargetHeaderName == "" {
+			continue
+		}
+		target := http.CanonicalHeaderKey(headerConfig.TargetHeaderName)
+		if targets[target] {
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): targetHeaderName %q is already written", name, i, headerConfig.HeaderName, headerConfig.TargetHeaderName))
+		}
+		targets[target] = true
+	}
+	return problems.err()
+}
+
+// writeTargets writes the entry every processHeaders entry with a target header yields to
+// that header, so e.g. the IP of CF-Connecting-IP can go to X-CDN-Client-IP while the rest
+// of the entries resolve headerName. Entries not honored for the source write an empty value.
+func (r *Resolver) writeTargets(out *outputWriter, req *http.Request, resolved resolution) {
+	for i, headerConfig := range r.processHeaders {
+		if headerConfig.TargetHeaderName != "" && !r.syntheticTarget(out, headerConfig, req) {
+			r.setDerivedIP(out, headerConfig.TargetHeaderName, r.outputIP(resolved.candidates[i]))
+		}
+	}
+}
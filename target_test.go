@@ -0,0 +1,94 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTargetHeaderName(t *testing.T) {
+	newPlugin := func(t *testing.T) http.Handler {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP", TargetHeaderName: "X-CDN-Client-IP"},
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress"},
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	tests := []struct {
+		name              string
+		remoteAddr        string
+		cfConnectingIP    string
+		xff               string
+		expectedRealIP    string
+		expectedCDNClient string
+	}{
+		{"BothResolved", "10.0.0.1:1234", "203.0.113.5", "198.51.100.7", "198.51.100.7", "203.0.113.5"},
+		{"TargetDoesNotFeedHeaderName", "10.0.0.1:1234", "203.0.113.5", "", "10.0.0.1", "203.0.113.5"},
+		{"TargetMissing", "10.0.0.1:1234", "", "198.51.100.7", "198.51.100.7", ""},
+		{"UntrustedSource", "192.0.2.1:1234", "203.0.113.5", "198.51.100.7", "192.0.2.1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.cfConnectingIP != "" {
+				req.Header.Set("CF-Connecting-IP", tt.cfConnectingIP)
+			}
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			req.Header.Set("X-CDN-Client-IP", "1.1.1.1")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedRealIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedRealIP, realIP)
+			}
+			if cdnClientIP := req.Header.Get("X-CDN-Client-IP"); cdnClientIP != tt.expectedCDNClient {
+				t.Errorf("expected X-CDN-Client-IP '%s', but got: '%s'", tt.expectedCDNClient, cdnClientIP)
+			}
+		})
+	}
+
+	t.Run("InvalidTargets", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			headers []HeaderConfig
+		}{
+			{"HeaderName", []HeaderConfig{{HeaderName: "CF-Connecting-IP", TargetHeaderName: "x-real-ip"}}},
+			{"Duplicate", []HeaderConfig{
+				{HeaderName: "CF-Connecting-IP", TargetHeaderName: "X-CDN-Client-IP"},
+				{HeaderName: "True-Client-IP", TargetHeaderName: "X-CDN-Client-IP"},
+			}},
+			{"Reserved", []HeaderConfig{{HeaderName: "CF-Connecting-IP", TargetHeaderName: "Host"}}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := CreateConfig()
+				cfg.ProcessHeaders = tt.headers
+
+				plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+				if err == nil {
+					t.Error("expected error, but got none")
+				}
+				if plugin != nil {
+					t.Error("expected plugin to be nil, but got instance")
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package traefik_realip
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultTrustCacheSize bounds the number of source IPs whose trust verdict is cached
+const defaultTrustCacheSize = 10000
+
+// trustCacheEntry is a cached trust verdict for a source IP and its expiry time
+type trustCacheEntry struct {
+	key     string
+	trusted bool
+	reason  string
+	expires time.Time
+}
+
+// trustCache is a size-bounded LRU cache of trust verdicts keyed by source IP, so requests
+// from the same proxy fleet skip RemoteAddr parsing and the trusted list lookup.
+// Verdicts also expire after ttl, so changes to the trusted lists are eventually applied.
+type trustCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Values are *trustCacheEntry
+	order   *list.List               // Most recently used first
+}
+
+// newTrustCache creates a cache of at most size verdicts, each expiring after ttl
+func newTrustCache(ttl time.Duration, size int) *trustCache {
+	if size <= 0 {
+		size = defaultTrustCacheSize
+	}
+	return &trustCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// trustCacheKey returns the source IP of remoteAddr without fully parsing it; addresses
+// without a port are used as they are
+func trustCacheKey(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// get returns the cached verdict and its reason for key, if present and not expired
+func (c *trustCache) get(key string, now time.Time) (bool, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return false, "", false
+	}
+	entry := element.Value.(*trustCacheEntry)
+	if now.After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return false, "", false
+	}
+	c.order.MoveToFront(element)
+	return entry.trusted, entry.reason, true
+}
+
+// set stores a verdict and its reason for key, evicting the least recently used verdict when full
+func (c *trustCache) set(key string, trusted bool, reason string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*trustCacheEntry)
+		entry.trusted, entry.reason, entry.expires = trusted, reason, now.Add(c.ttl)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*trustCacheEntry).key)
+	}
+
+	entry := &trustCacheEntry{key: key, trusted: trusted, reason: reason, expires: now.Add(c.ttl)}
+	c.entries[key] = c.order.PushFront(entry)
+}
+
+// Len returns the number of cached verdicts
+func (c *trustCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
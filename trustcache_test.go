@@ -0,0 +1,207 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTrustCache(t *testing.T) {
+	now := time.Now()
+	cache := newTrustCache(10*time.Second, 0)
+
+	if _, _, ok := cache.get("10.0.0.1", now); ok {
+		t.Error("expected miss on empty cache")
+	}
+
+	cache.set("10.0.0.1", true, trustReasonTrustedIPs, now)
+
+	trusted, reason, ok := cache.get("10.0.0.1", now.Add(5*time.Second))
+	if !ok || !trusted || reason != trustReasonTrustedIPs {
+		t.Errorf("expected cached trusted verdict, but got trusted=%v reason=%q ok=%v", trusted, reason, ok)
+	}
+
+	if _, _, ok := cache.get("10.0.0.1", now.Add(11*time.Second)); ok {
+		t.Error("expected miss after TTL expired")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("expected expired entry to be removed, but got %d entries", cache.Len())
+	}
+
+	t.Run("BoundedSize", func(t *testing.T) {
+		cache := newTrustCache(time.Second, 0)
+		for i := 0; i < defaultTrustCacheSize+10; i++ {
+			cache.set("10.0."+strconv.Itoa(i/256)+"."+strconv.Itoa(i%256), true, trustReasonTrustedIPs, now)
+		}
+		if cache.Len() != defaultTrustCacheSize {
+			t.Errorf("expected %d entries, but got %d", defaultTrustCacheSize, cache.Len())
+		}
+	})
+
+	t.Run("EvictsLeastRecentlyUsed", func(t *testing.T) {
+		cache := newTrustCache(time.Minute, 2)
+		cache.set("10.0.0.1", true, trustReasonTrustedIPs, now)
+		cache.set("10.0.0.2", true, trustReasonTrustedIPs, now)
+
+		// Touch the first entry so the second becomes the least recently used
+		cache.get("10.0.0.1", now)
+		cache.set("10.0.0.3", false, trustReasonNotTrusted, now)
+
+		if _, _, ok := cache.get("10.0.0.2", now); ok {
+			t.Error("expected least recently used entry to be evicted")
+		}
+		if _, _, ok := cache.get("10.0.0.1", now); !ok {
+			t.Error("expected recently used entry to be kept")
+		}
+		if trusted, _, ok := cache.get("10.0.0.3", now); !ok || trusted {
+			t.Errorf("expected newest entry to be cached as untrusted, but got trusted=%v ok=%v", trusted, ok)
+		}
+	})
+
+	t.Run("UpdateRefreshesEntry", func(t *testing.T) {
+		cache := newTrustCache(10*time.Second, 2)
+		cache.set("10.0.0.1", true, trustReasonTrustedIPs, now)
+		cache.set("10.0.0.1", false, trustReasonNotTrusted, now.Add(8*time.Second))
+
+		trusted, reason, ok := cache.get("10.0.0.1", now.Add(15*time.Second))
+		if !ok || trusted || reason != trustReasonNotTrusted {
+			t.Errorf("expected updated verdict, but got trusted=%v reason=%q ok=%v", trusted, reason, ok)
+		}
+		if cache.Len() != 1 {
+			t.Errorf("expected a single entry, but got %d", cache.Len())
+		}
+	})
+}
+
+func TestTrustCacheKey(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{"10.0.0.1:1234", "10.0.0.1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			if key := trustCacheKey(tt.remoteAddr); key != tt.expected {
+				t.Errorf("expected key '%s', but got: '%s'", tt.expected, key)
+			}
+		})
+	}
+}
+
+func TestTrustCacheTTL(t *testing.T) {
+	t.Run("NegativeTTL", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:       false,
+			TrustedIPs:     []string{"10.0.0.0/8"},
+			TrustCacheTTL:  -1,
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for negative trustCacheTTL, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+
+	t.Run("NegativeSize", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.TrustCacheTTL = 60
+		cfg.TrustCacheSize = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for negative trustCacheSize, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+
+	path := filepath.Join(t.TempDir(), "trusted.txt")
+	writeCIDRFile(t, path, "10.0.0.0/8\n", time.Now().Add(-time.Hour))
+
+	newPlugin := func(t *testing.T, ttl int) *Plugin {
+		cfg := &Config{
+			Enabled:                       true,
+			HeaderName:                    "X-Real-IP",
+			ProcessHeaders:                []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:                      false,
+			TrustedIPsFile:                path,
+			TrustedIPsFileRefreshInterval: 3600,
+			TrustedHeader:                 "X-Is-Trusted",
+			TrustCacheTTL:                 ttl,
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	serve := func(p *Plugin, remoteAddr string) string {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		p.ServeHTTP(httptest.NewRecorder(), req)
+		return req.Header.Get("X-Is-Trusted")
+	}
+
+	t.Run("CachedVerdictPerSourceIP", func(t *testing.T) {
+		writeCIDRFile(t, path, "10.0.0.0/8\n", time.Now().Add(-time.Hour))
+		p := newPlugin(t, 60)
+
+		if trusted := serve(p, "10.1.2.3:5000"); trusted != "yes" {
+			t.Fatalf("expected connection to be trusted, but got: '%s'", trusted)
+		}
+
+		// Remove the range from the file; the source IP keeps its cached verdict
+		writeCIDRFile(t, path, "192.168.0.0/16\n", time.Now())
+		atomic.StoreInt64(&p.trustedIPsFile.nextCheck, 0)
+
+		if trusted := serve(p, "10.1.2.3:5000"); trusted != "yes" {
+			t.Errorf("expected cached verdict for the same connection, but got: '%s'", trusted)
+		}
+		if trusted := serve(p, "10.1.2.3:5001"); trusted != "yes" {
+			t.Errorf("expected cached verdict for a new connection from the same IP, but got: '%s'", trusted)
+		}
+		if trusted := serve(p, "10.1.2.4:5000"); trusted != "no" {
+			t.Errorf("expected a new source IP to be re-evaluated, but got: '%s'", trusted)
+		}
+	})
+
+	t.Run("NoCacheEvaluatesEveryRequest", func(t *testing.T) {
+		writeCIDRFile(t, path, "10.0.0.0/8\n", time.Now().Add(-30*time.Minute))
+		p := newPlugin(t, 0)
+		if p.trustCache != nil {
+			t.Fatal("expected no trust cache when trustCacheTTL is 0")
+		}
+
+		if trusted := serve(p, "10.1.2.3:5000"); trusted != "yes" {
+			t.Fatalf("expected connection to be trusted, but got: '%s'", trusted)
+		}
+
+		writeCIDRFile(t, path, "192.168.0.0/16\n", time.Now().Add(time.Minute))
+		atomic.StoreInt64(&p.trustedIPsFile.nextCheck, 0)
+
+		if trusted := serve(p, "10.1.2.3:5000"); trusted != "no" {
+			t.Errorf("expected verdict to be re-evaluated on every request, but got: '%s'", trusted)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package traefik_realip
+
+import (
+	"net/http"
+)
+
+// chainTrusted reports whether every X-Forwarded-For hop but the leftmost, the client, is in
+// the trusted ranges (or is loopback with trustLoopbackAlways). When maxHeaderLength or
+// maxChainLength cut the chain, its leftmost remaining entry is a hop too, and a chain skipped
+// for its length is not trusted, since its hops cannot be checked. Requests without the
+// header have no hops.
+func (r *Resolver) chainTrusted(req *http.Request) bool {
+	value, oversized := r.limitHeaderValue(r.headerValue(req, "X-Forwarded-For"))
+	if value == "" {
+		return !oversized
+	}
+
+	hops, exceeded := r.splitCandidates("X-Forwarded-For", value)
+	if !oversized && !exceeded && len(hops) > 0 {
+		hops = hops[1:]
+	}
+	for _, hop := range hops {
+		ip := parseAddress(r.cleanIPAddress(hop))
+		if ip == nil {
+			return false
+		}
+		if r.trustLoopbackAlways && ip.IsLoopback() {
+			continue
+		}
+		if !r.inTrustedRanges(ip) {
+			return false
+		}
+	}
+	return true
+}
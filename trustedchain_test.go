@@ -0,0 +1,97 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireTrustedChain(t *testing.T) {
+	tests := []struct {
+		name            string
+		remoteAddr      string
+		xff             string
+		oversized       string
+		expectedTrusted string
+		expectedIP      string
+	}{
+		{"AllHopsTrusted", "10.0.0.1:1234", "203.0.113.5, 10.0.0.2, 10.0.0.3", "", "yes", "203.0.113.5"},
+		{"NoChain", "10.0.0.1:1234", "", "", "yes", "10.0.0.1"},
+		{"ClientOnly", "10.0.0.1:1234", "203.0.113.5", "", "yes", "203.0.113.5"},
+		{"LoopbackHop", "10.0.0.1:1234", "203.0.113.5, 127.0.0.1", "", "yes", "203.0.113.5"},
+		{"UntrustedIntermediary", "10.0.0.1:1234", "203.0.113.5, 198.51.100.7, 10.0.0.2", "", "no", "10.0.0.1"},
+		{"UnparseableHop", "10.0.0.1:1234", "203.0.113.5, unknown", "", "no", "10.0.0.1"},
+		{"UntrustedSource", "192.0.2.1:1234", "203.0.113.5, 10.0.0.2", "", "no", "192.0.2.1"},
+		{"OversizedChain", "10.0.0.1:1234", "1.2.3.4,198.51.100.7,198.51.100.8,10.0.0.2", oversizedHeaderSkip, "no", "10.0.0.1"},
+		{"TruncatedChainKeepsLeftmostHop", "10.0.0.1:1234", "1.2.3.4,198.51.100.7,10.0.0.2", oversizedHeaderTruncate, "no", "10.0.0.1"},
+		{"TruncatedTrustedChain", "10.0.0.1:1234", "1.2.3.4,10.0.0.7,10.0.0.2", oversizedHeaderTruncate, "yes", "10.0.0.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"10.0.0.0/8"}
+			cfg.TrustLoopbackAlways = true
+			cfg.TrustedHeader = "X-Is-Trusted"
+			cfg.RequireTrustedChain = true
+			if tt.oversized != "" {
+				cfg.MaxHeaderLength = 21
+				cfg.OversizedHeaders = tt.oversized
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrusted {
+				t.Errorf("expected X-Is-Trusted '%s', but got: '%s'", tt.expectedTrusted, trusted)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	t.Run("ExplainedReason", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.RequireTrustedChain = true
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.5, 198.51.100.7")
+
+		if report := plugin.(*Plugin).Explain(req); report.TrustReason != trustReasonUntrustedHop {
+			t.Errorf("expected trust reason %q, but got %q", trustReasonUntrustedHop, report.TrustReason)
+		}
+	})
+
+	t.Run("TrustAll", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.RequireTrustedChain = true
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for requireTrustedChain with trustAll, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
@@ -0,0 +1,311 @@
+package traefik_realip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTrustedIPsFileRefreshInterval is how often the trusted IPs file is checked for changes
+const defaultTrustedIPsFileRefreshInterval = 10 * time.Second
+
+// maxLoggedCIDRChanges is the largest diff whose individual prefixes are logged on reload;
+// bigger diffs are only summarized
+const maxLoggedCIDRChanges = 10
+
+// ListDiff summarizes the last change of a dynamically refreshed CIDR list.
+type ListDiff struct {
+	Source  string    `json:"source"`  // Path of the list
+	Time    time.Time `json:"time"`    // When the change was loaded
+	Added   int       `json:"added"`   // Prefixes present in the new list only
+	Removed int       `json:"removed"` // Prefixes present in the previous list only
+	Total   int       `json:"total"`   // Prefixes in the new list
+}
+
+// gracedCIDR is a prefix removed from the file that is still honored until expires
+type gracedCIDR struct {
+	cidr    string
+	block   *net.IPNet
+	expires time.Time
+}
+
+// cidrFileWatcher keeps an IpLookupHelper in sync with a newline-delimited CIDR file.
+// Changes are detected by polling the file's modification time and size. Polling is
+// driven by lookups instead of a background goroutine, so no goroutine outlives a
+// Traefik configuration reload.
+type cidrFileWatcher struct {
+	name     string
+	path     string
+	interval time.Duration
+	grace    time.Duration // How long removed prefixes keep matching
+
+	mu      sync.RWMutex
+	helper  *IpLookupHelper
+	cidrs   []string
+	modTime time.Time
+	size    int64
+	reloads int64     // Successful reloads after the initial load
+	diff    *ListDiff // Last change, nil until the list is reloaded
+	graced  []gracedCIDR
+
+	nextCheck int64 // Unix nanoseconds of the next allowed stat, accessed atomically
+}
+
+// newCIDRFileWatcher loads the file once and returns a watcher for it. Prefixes removed
+// by a reload keep matching for grace (0 disables the grace period).
+// A missing or invalid file at startup is reported as an error.
+func newCIDRFileWatcher(name, path string, interval, grace time.Duration) (*cidrFileWatcher, error) {
+	if interval <= 0 {
+		interval = defaultTrustedIPsFileRefreshInterval
+	}
+
+	watcher := &cidrFileWatcher{
+		name:     name,
+		path:     path,
+		interval: interval,
+		grace:    grace,
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.load(info); err != nil {
+		return nil, err
+	}
+	atomic.StoreInt64(&watcher.nextCheck, time.Now().Add(interval).UnixNano())
+
+	return watcher, nil
+}
+
+// Helper returns the current lookup helper, reloading the file first if it changed
+// and the polling interval has elapsed.
+func (w *cidrFileWatcher) Helper() *IpLookupHelper {
+	w.poll(time.Now())
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.helper
+}
+
+// poll checks the file for changes at most once per interval. Only one caller
+// performs the check; concurrent callers keep using the current helper.
+func (w *cidrFileWatcher) poll(now time.Time) {
+	next := atomic.LoadInt64(&w.nextCheck)
+	if now.UnixNano() < next {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&w.nextCheck, next, now.Add(w.interval).UnixNano()) {
+		return
+	}
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		logf(w.name, "failed to stat trusted IPs file %q, keeping previous list: %v", w.path, err)
+		return
+	}
+
+	w.mu.RLock()
+	unchanged := info.ModTime().Equal(w.modTime) && info.Size() == w.size
+	w.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	w.mu.RLock()
+	previous := w.cidrs
+	w.mu.RUnlock()
+
+	if err := w.load(info); err != nil {
+		logf(w.name, "failed to reload trusted IPs file %q, keeping previous list: %v", w.path, err)
+		return
+	}
+
+	w.mu.RLock()
+	current := w.cidrs
+	w.mu.RUnlock()
+
+	added, removed := diffCIDRs(previous, current)
+	diff := &ListDiff{Source: w.path, Time: now, Added: len(added), Removed: len(removed), Total: len(current)}
+
+	w.mu.Lock()
+	w.reloads++
+	w.diff = diff
+	w.updateGraced(added, removed, now)
+	w.mu.Unlock()
+
+	logf(w.name, "reloaded trusted IPs file %q: %d prefixes, %d added, %d removed", w.path, diff.Total, diff.Added, diff.Removed)
+	if changes := len(added) + len(removed); changes > 0 && changes <= maxLoggedCIDRChanges {
+		var details []string
+		for _, cidr := range added {
+			details = append(details, "+"+cidr)
+		}
+		for _, cidr := range removed {
+			details = append(details, "-"+cidr)
+		}
+		logf(w.name, "trusted IPs file %q changes: %s", w.path, strings.Join(details, " "))
+	}
+}
+
+// updateGraced starts the grace period of removed prefixes, ends it for prefixes that were
+// added back and drops expired ones. Must be called with mu held.
+func (w *cidrFileWatcher) updateGraced(added, removed []string, now time.Time) {
+	if w.grace <= 0 {
+		return
+	}
+
+	readded := make(map[string]bool, len(added))
+	for _, cidr := range added {
+		readded[cidr] = true
+	}
+
+	graced := w.graced[:0]
+	for _, entry := range w.graced {
+		if !readded[entry.cidr] && now.Before(entry.expires) {
+			graced = append(graced, entry)
+		}
+	}
+	for _, cidr := range removed {
+		if blocks, err := parseBlocks(cidr); err == nil {
+			for _, block := range blocks {
+				graced = append(graced, gracedCIDR{cidr: cidr, block: block, expires: now.Add(w.grace)})
+			}
+			logf(w.name, "prefix %s was removed from trusted IPs file %q and stays trusted for its grace period until %s", cidr, w.path, now.Add(w.grace).Format(time.RFC3339))
+		}
+	}
+	w.graced = graced
+}
+
+// InGracePeriod reports whether ip is only trusted because it falls in a removed prefix whose grace period is running
+func (w *cidrFileWatcher) InGracePeriod(ip net.IP, now time.Time) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, entry := range w.graced {
+		if now.Before(entry.expires) && entry.block.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastDiff returns the number of reloads and the last change of the list (nil before the first reload)
+func (w *cidrFileWatcher) LastDiff() (int64, *ListDiff) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.diff == nil {
+		return w.reloads, nil
+	}
+	diff := *w.diff
+	return w.reloads, &diff
+}
+
+// diffCIDRs returns the prefixes only in current (added) and only in previous (removed), in
+// list order. Prefixes are compared in canonical form, so "10.0.0.1/8" equals "10.0.0.0/8".
+func diffCIDRs(previous, current []string) ([]string, []string) {
+	before := make(map[string]bool, len(previous))
+	for _, cidr := range previous {
+		before[canonicalCIDR(cidr)] = true
+	}
+	after := make(map[string]bool, len(current))
+	for _, cidr := range current {
+		after[canonicalCIDR(cidr)] = true
+	}
+
+	var added, removed []string
+	for _, cidr := range current {
+		canonical := canonicalCIDR(cidr)
+		if !before[canonical] {
+			added = append(added, canonical)
+			before[canonical] = true // Report duplicates once
+		}
+	}
+	for _, cidr := range previous {
+		canonical := canonicalCIDR(cidr)
+		if !after[canonical] {
+			removed = append(removed, canonical)
+			after[canonical] = true
+		}
+	}
+
+	return added, removed
+}
+
+// canonicalCIDR returns the network form of cidr, or cidr itself if it does not parse or is a
+// range spanning several blocks
+func canonicalCIDR(cidr string) string {
+	blocks, excluded, err := parseEntry(cidr)
+	if err != nil || len(blocks) != 1 {
+		return cidr
+	}
+	if excluded {
+		return "!" + blocks[0].String()
+	}
+	return blocks[0].String()
+}
+
+// load parses the file and atomically swaps in the new helper.
+func (w *cidrFileWatcher) load(info os.FileInfo) error {
+	cidrs, err := readCIDRFile(w.path)
+	if err != nil {
+		return err
+	}
+
+	helper, err := NewIpLookupHelper(cidrs)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.helper = helper
+	w.cidrs = cidrs
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	w.mu.Unlock()
+
+	return nil
+}
+
+// readCIDRFile reads one CIDR per line. Blank lines and anything after a '#' are ignored.
+func readCIDRFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readCIDRs(file)
+}
+
+// readCIDRs reads one CIDR per line from r, with the format of readCIDRFile
+func readCIDRs(r io.Reader) ([]string, error) {
+	var cidrs []string
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("line %d: expected a single CIDR, got %q", lineNumber, line)
+		}
+		cidrs = append(cidrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cidrs, nil
+}
@@ -0,0 +1,395 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeCIDRFile writes content to path and moves its mtime forward so a change is always detected.
+func writeCIDRFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write CIDR file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set CIDR file mtime: %v", err)
+	}
+}
+
+func TestReadCIDRFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted.txt")
+	writeCIDRFile(t, path, "# proxies\n10.0.0.0/8\n\n  192.168.0.0/16  # office\n::1/128\n", time.Now())
+
+	cidrs, err := readCIDRFile(path)
+	if err != nil {
+		t.Fatalf("readCIDRFile returned error: %v", err)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.168.0.0/16", "::1/128"}
+	if len(cidrs) != len(expected) {
+		t.Fatalf("expected %d CIDRs, but got %d: %v", len(expected), len(cidrs), cidrs)
+	}
+	for i := range expected {
+		if cidrs[i] != expected[i] {
+			t.Errorf("expected CIDR %d to be %q, but got %q", i, expected[i], cidrs[i])
+		}
+	}
+
+	t.Run("MultipleValuesOnALine", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "trusted.txt")
+		writeCIDRFile(t, path, "10.0.0.0/8 192.168.0.0/16\n", time.Now())
+
+		if _, err := readCIDRFile(path); err == nil {
+			t.Error("expected error for a line with several values, but got none")
+		}
+	})
+}
+
+func TestCIDRFileWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted.txt")
+	start := time.Now().Add(-time.Hour)
+	writeCIDRFile(t, path, "10.0.0.0/8\n", start)
+
+	watcher, err := newCIDRFileWatcher(pluginName, path, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	contains := func(ip string) bool {
+		found, _, _ := watcher.Helper().IsContained(net.ParseIP(ip))
+		return found
+	}
+
+	if !contains("10.1.2.3") {
+		t.Error("expected 10.1.2.3 to be contained after initial load")
+	}
+
+	t.Run("NoReloadBeforeInterval", func(t *testing.T) {
+		writeCIDRFile(t, path, "192.168.0.0/16\n", start.Add(time.Minute))
+
+		if !contains("10.1.2.3") {
+			t.Error("expected previous list to be used until the refresh interval elapses")
+		}
+	})
+
+	t.Run("ReloadAfterInterval", func(t *testing.T) {
+		atomic.StoreInt64(&watcher.nextCheck, 0)
+
+		if contains("10.1.2.3") {
+			t.Error("expected 10.1.2.3 to be removed after reload")
+		}
+		if !contains("192.168.1.1") {
+			t.Error("expected 192.168.1.1 to be contained after reload")
+		}
+	})
+
+	t.Run("InvalidReloadKeepsPreviousList", func(t *testing.T) {
+		writeCIDRFile(t, path, "not-a-cidr\n", start.Add(2*time.Minute))
+		atomic.StoreInt64(&watcher.nextCheck, 0)
+
+		if !contains("192.168.1.1") {
+			t.Error("expected previous list to be kept when the file is invalid")
+		}
+	})
+
+	t.Run("MissingFileKeepsPreviousList", func(t *testing.T) {
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("failed to remove file: %v", err)
+		}
+		atomic.StoreInt64(&watcher.nextCheck, 0)
+
+		if !contains("192.168.1.1") {
+			t.Error("expected previous list to be kept when the file is missing")
+		}
+	})
+}
+
+func TestCIDRFileDiff(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	path := filepath.Join(t.TempDir(), "trusted.txt")
+	start := time.Now().Add(-time.Hour)
+	writeCIDRFile(t, path, "10.0.0.0/8\n192.168.0.0/16\n", start)
+
+	watcher, err := newCIDRFileWatcher(pluginName, path, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	if reloads, diff := watcher.LastDiff(); reloads != 0 || diff != nil {
+		t.Errorf("expected no diff before a reload, but got %d reloads and %+v", reloads, diff)
+	}
+
+	t.Run("SmallDiffIsListed", func(t *testing.T) {
+		logs.Reset()
+		writeCIDRFile(t, path, "10.0.0.1/8\n172.16.0.0/12\n", start.Add(time.Minute))
+		atomic.StoreInt64(&watcher.nextCheck, 0)
+		watcher.Helper()
+
+		reloads, diff := watcher.LastDiff()
+		if reloads != 1 || diff == nil {
+			t.Fatalf("expected 1 reload with a diff, but got %d and %+v", reloads, diff)
+		}
+		if diff.Added != 1 || diff.Removed != 1 || diff.Total != 2 || diff.Source != path {
+			t.Errorf("unexpected diff: %+v", diff)
+		}
+		if !strings.Contains(logs.String(), "1 added, 1 removed") {
+			t.Errorf("expected summary in logs, but got: %s", logs.String())
+		}
+		if !strings.Contains(logs.String(), "+172.16.0.0/12 -192.168.0.0/16") {
+			t.Errorf("expected changed prefixes in logs, but got: %s", logs.String())
+		}
+	})
+
+	t.Run("LargeDiffIsSummarized", func(t *testing.T) {
+		logs.Reset()
+		var content strings.Builder
+		for i := 0; i <= maxLoggedCIDRChanges; i++ {
+			content.WriteString("100.64." + strconv.Itoa(i) + ".0/24\n")
+		}
+		writeCIDRFile(t, path, content.String(), start.Add(2*time.Minute))
+		atomic.StoreInt64(&watcher.nextCheck, 0)
+		watcher.Helper()
+
+		_, diff := watcher.LastDiff()
+		if diff.Added != maxLoggedCIDRChanges+1 || diff.Removed != 2 {
+			t.Errorf("unexpected diff: %+v", diff)
+		}
+		if strings.Contains(logs.String(), "changes:") {
+			t.Errorf("expected large diff to be summarized only, but got: %s", logs.String())
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPsFile = path
+		cfg.TrustedIPsFileRefreshInterval = 3600
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		plugin := handler.(*Plugin)
+
+		if stats := plugin.Stats(); stats.TrustedIPsFileDiff != nil {
+			t.Errorf("expected no diff before a reload, but got %+v", stats.TrustedIPsFileDiff)
+		}
+
+		writeCIDRFile(t, path, "10.0.0.0/8\n", start.Add(3*time.Minute))
+		atomic.StoreInt64(&plugin.trustedIPsFile.nextCheck, 0)
+		plugin.trustedIPsFile.Helper()
+
+		stats := plugin.Stats()
+		if stats.TrustedIPsFileReloads != 1 || stats.TrustedIPsFileDiff == nil || stats.TrustedIPsFileDiff.Added != 1 {
+			t.Errorf("expected reload diff in stats, but got %d and %+v", stats.TrustedIPsFileReloads, stats.TrustedIPsFileDiff)
+		}
+	})
+}
+
+func TestTrustedIPsFileGracePeriod(t *testing.T) {
+	var logs bytes.Buffer
+	logWriter = &logs
+	defer func() { logWriter = os.Stdout }()
+
+	path := filepath.Join(t.TempDir(), "trusted.txt")
+	start := time.Now().Add(-time.Hour)
+	writeCIDRFile(t, path, "10.0.0.0/8\n192.168.0.0/16\n", start)
+
+	cfg := &Config{
+		Enabled:                       true,
+		HeaderName:                    "X-Real-IP",
+		ProcessHeaders:                []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+		TrustedIPsFile:                path,
+		TrustedIPsFileRefreshInterval: 3600,
+		TrustedIPsFileGracePeriod:     300,
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	explain := func(remoteAddr string) DecisionReport {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		return plugin.Explain(req)
+	}
+
+	// Remove 192.168.0.0/16 from the list
+	writeCIDRFile(t, path, "10.0.0.0/8\n", start.Add(time.Minute))
+	atomic.StoreInt64(&plugin.trustedIPsFile.nextCheck, 0)
+	plugin.trustedIPsFile.Helper()
+
+	if !strings.Contains(logs.String(), "192.168.0.0/16 was removed") {
+		t.Errorf("expected grace period to be logged, but got: %s", logs.String())
+	}
+
+	t.Run("RemovedPrefixInGracePeriod", func(t *testing.T) {
+		report := explain("192.168.1.1:1234")
+		if !report.Trusted || report.TrustReason != trustReasonGracePeriod {
+			t.Errorf("expected trust through the grace period, but got %v (%s)", report.Trusted, report.TrustReason)
+		}
+		if stats := plugin.Stats(); stats.GraceMatches == 0 {
+			t.Error("expected grace matches to be counted")
+		}
+	})
+
+	t.Run("KeptPrefix", func(t *testing.T) {
+		report := explain("10.1.1.1:1234")
+		if !report.Trusted || report.TrustReason != trustReasonTrustedIPsFile {
+			t.Errorf("expected trust through the file, but got %v (%s)", report.Trusted, report.TrustReason)
+		}
+	})
+
+	t.Run("GracePeriodExpires", func(t *testing.T) {
+		ip := net.ParseIP("192.168.1.1")
+		if !plugin.trustedIPsFile.InGracePeriod(ip, time.Now().Add(4*time.Minute)) {
+			t.Error("expected prefix to be in its grace period before expiry")
+		}
+		if plugin.trustedIPsFile.InGracePeriod(ip, time.Now().Add(6*time.Minute)) {
+			t.Error("expected grace period to end after 300 seconds")
+		}
+	})
+
+	t.Run("ReaddedPrefixEndsGracePeriod", func(t *testing.T) {
+		writeCIDRFile(t, path, "10.0.0.0/8\n192.168.0.0/16\n", start.Add(2*time.Minute))
+		atomic.StoreInt64(&plugin.trustedIPsFile.nextCheck, 0)
+		plugin.trustedIPsFile.Helper()
+
+		if plugin.trustedIPsFile.InGracePeriod(net.ParseIP("192.168.1.1"), time.Now()) {
+			t.Error("expected re-added prefix to leave the grace period")
+		}
+		if report := explain("192.168.1.1:1234"); report.TrustReason != trustReasonTrustedIPsFile {
+			t.Errorf("expected trust through the file again, but got %s", report.TrustReason)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "trusted.txt")
+		writeCIDRFile(t, path, "192.168.0.0/16\n", start)
+		watcher, err := newCIDRFileWatcher(pluginName, path, time.Hour, 0)
+		if err != nil {
+			t.Fatalf("failed to create watcher: %v", err)
+		}
+
+		writeCIDRFile(t, path, "10.0.0.0/8\n", start.Add(time.Minute))
+		atomic.StoreInt64(&watcher.nextCheck, 0)
+		watcher.Helper()
+
+		if watcher.InGracePeriod(net.ParseIP("192.168.1.1"), time.Now()) {
+			t.Error("expected no grace period when disabled")
+		}
+	})
+
+	t.Run("NegativeGracePeriod", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.TrustedIPsFileGracePeriod = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for a negative grace period, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}
+
+func TestDiffCIDRs(t *testing.T) {
+	added, removed := diffCIDRs(
+		[]string{"10.0.0.0/8", "192.168.0.0/16", "192.168.0.0/16"},
+		[]string{"10.1.0.0/8", "2001:db8::/32", "2001:db8::/32"},
+	)
+
+	if len(added) != 1 || added[0] != "2001:db8::/32" {
+		t.Errorf("expected added [2001:db8::/32], but got %v", added)
+	}
+	if len(removed) != 1 || removed[0] != "192.168.0.0/16" {
+		t.Errorf("expected removed [192.168.0.0/16], but got %v", removed)
+	}
+}
+
+func TestTrustedIPsFile(t *testing.T) {
+	t.Run("MissingFile", func(t *testing.T) {
+		cfg := &Config{
+			Enabled:        true,
+			HeaderName:     "X-Real-IP",
+			ProcessHeaders: []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}},
+			TrustAll:       false,
+			TrustedIPsFile: filepath.Join(t.TempDir(), "missing.txt"),
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for missing trustedIPsFile, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+
+	t.Run("TrustFromFileAndStaticList", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "trusted.txt")
+		writeCIDRFile(t, path, "10.0.0.0/8\n", time.Now().Add(-time.Hour))
+
+		cfg := &Config{
+			Enabled:                       true,
+			HeaderName:                    "X-Real-IP",
+			ProcessHeaders:                []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: -1}, {HeaderName: "clientAddress", Depth: -1}},
+			ForceOverwrite:                true,
+			TrustAll:                      false,
+			TrustedIPs:                    []string{"192.168.0.0/16"},
+			TrustedIPsFile:                path,
+			TrustedIPsFileRefreshInterval: 3600,
+			TrustedHeader:                 "X-Is-Trusted",
+		}
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		serve := func(remoteAddr string) string {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.1")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			return req.Header.Get("X-Is-Trusted")
+		}
+
+		if trusted := serve("10.1.2.3:1234"); trusted != "yes" {
+			t.Errorf("expected source from file to be trusted, but got: '%s'", trusted)
+		}
+		if trusted := serve("192.168.1.1:1234"); trusted != "yes" {
+			t.Errorf("expected source from static list to be trusted, but got: '%s'", trusted)
+		}
+		if trusted := serve("172.16.0.1:1234"); trusted != "no" {
+			t.Errorf("expected unknown source to be untrusted, but got: '%s'", trusted)
+		}
+
+		// Replace the file contents and force the next poll
+		writeCIDRFile(t, path, "172.16.0.0/12\n", time.Now())
+		atomic.StoreInt64(&handler.(*Plugin).trustedIPsFile.nextCheck, 0)
+
+		if trusted := serve("172.16.0.1:1234"); trusted != "yes" {
+			t.Errorf("expected source added to file to be trusted after reload, but got: '%s'", trusted)
+		}
+		if trusted := serve("10.1.2.3:1234"); trusted != "no" {
+			t.Errorf("expected source removed from file to be untrusted after reload, but got: '%s'", trusted)
+		}
+	})
+}
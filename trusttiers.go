@@ -0,0 +1,85 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// TrustTier is a named set of trusted sources, such as the CDN edge or internal load balancers.
+type TrustTier struct {
+	Name           string   `json:"name"`                     // Name written to trustedHeader for sources of the tier (e.g., "edge")
+	TrustedIPs     []string `json:"trustedIPs"`               // CIDR blocks of the tier's sources
+	ProcessHeaders []string `json:"processHeaders,omitempty"` // processHeaders entries honored from the tier (default: all)
+}
+
+// trustTier is a parsed TrustTier
+type trustTier struct {
+	name    string
+	ips     *IpLookupHelper
+	headers map[string]bool // Canonical names of the honored processHeaders entries, nil for all
+}
+
+// newTrustTiers parses the trust tiers. Names must be unique and every tier needs trusted
+// IPs; the headers a tier is restricted to must be processHeaders entries.
+func newTrustTiers(name string, tiers []TrustTier, processHeaders []HeaderConfig) ([]*trustTier, error) {
+	configured := make(map[string]bool, len(processHeaders))
+	for _, headerConfig := range processHeaders {
+		configured[http.CanonicalHeaderKey(headerConfig.HeaderName)] = true
+	}
+
+	var parsed []*trustTier
+	seen := make(map[string]bool, len(tiers))
+	for i, tier := range tiers {
+		if tier.Name == "" {
+			return nil, fmt.Errorf("%s: trustTiers[%d]: name cannot be empty", name, i)
+		}
+		if seen[tier.Name] {
+			return nil, fmt.Errorf("%s: trustTiers[%d]: duplicate name %q", name, i, tier.Name)
+		}
+		seen[tier.Name] = true
+
+		if len(tier.TrustedIPs) == 0 {
+			return nil, fmt.Errorf("%s: trustTiers[%d] (%s): trustedIPs cannot be empty", name, i, tier.Name)
+		}
+		ips, err := NewIpLookupHelper(tier.TrustedIPs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: trustTiers[%d] (%s): failed to parse trusted IPs: %w", name, i, tier.Name, err)
+		}
+
+		parsedTier := &trustTier{name: tier.Name, ips: ips}
+		for _, header := range tier.ProcessHeaders {
+			canonical := http.CanonicalHeaderKey(header)
+			if !configured[canonical] {
+				return nil, fmt.Errorf("%s: trustTiers[%d] (%s): processHeaders references %q, which is not in processHeaders", name, i, tier.Name, header)
+			}
+			if parsedTier.headers == nil {
+				parsedTier.headers = make(map[string]bool, len(tier.ProcessHeaders))
+			}
+			parsedTier.headers[canonical] = true
+		}
+		parsed = append(parsed, parsedTier)
+	}
+	return parsed, nil
+}
+
+// allows reports whether the tier honors the processHeaders entry named header
+func (t *trustTier) allows(header string) bool {
+	return t.headers == nil || t.headers[http.CanonicalHeaderKey(header)]
+}
+
+// sourceTier returns the first tier containing the source of req, or nil
+func (r *Resolver) sourceTier(req *http.Request) *trustTier {
+	if len(r.trustTiers) == 0 {
+		return nil
+	}
+	ip := parseAddress(r.cleanIPAddress(req.RemoteAddr))
+	if ip == nil {
+		return nil
+	}
+	for _, tier := range r.trustTiers {
+		if contained, _, err := tier.ips.IsContained(ip); err == nil && contained {
+			return tier
+		}
+	}
+	return nil
+}
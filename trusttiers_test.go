@@ -0,0 +1,112 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustTiers(t *testing.T) {
+	newConfig := func() *Config {
+		cfg := CreateConfig()
+		cfg.ProcessHeaders = []HeaderConfig{
+			{HeaderName: "CF-Connecting-IP", Depth: -1},
+			{HeaderName: "X-Forwarded-For", Depth: 0},
+			{HeaderName: "clientAddress", Depth: -1},
+		}
+		cfg.TrustAll = false
+		cfg.TrustedIPs = nil
+		cfg.TrustedHeader = "X-Trust-Tier"
+		cfg.TrustTiers = []TrustTier{
+			{Name: "edge", TrustedIPs: []string{"173.245.48.0/20"}, ProcessHeaders: []string{"cf-connecting-ip"}},
+			{Name: "internal", TrustedIPs: []string{"10.0.0.0/8"}},
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		expectedIP    string
+		expectedTier  string
+		expectedTrust bool
+	}{
+		{"EdgeHonorsOnlyItsHeaders", "173.245.48.10:443", "203.0.113.1", "edge", true},
+		{"InternalHonorsAllHeaders", "10.0.0.1:1234", "203.0.113.1", "internal", true},
+		{"UnknownSource", "192.0.2.1:1234", "192.0.2.1", "no", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin, err := New(context.TODO(), &noopHandler{}, newConfig(), pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("CF-Connecting-IP", "203.0.113.1")
+
+			report := plugin.(*Plugin).Explain(req)
+			if report.Trusted != tt.expectedTrust {
+				t.Errorf("expected trusted %v, but got: %v", tt.expectedTrust, report.Trusted)
+			}
+			if tt.expectedTrust && report.TrustReason != trustReasonTrustTier {
+				t.Errorf("expected trust reason '%s', but got: '%s'", trustReasonTrustTier, report.TrustReason)
+			}
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if tier := req.Header.Get("X-Trust-Tier"); tier != tt.expectedTier {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expectedTier, tier)
+			}
+		})
+	}
+
+	t.Run("EdgeSkipsUnlistedHeader", func(t *testing.T) {
+		plugin, err := New(context.TODO(), &noopHandler{}, newConfig(), pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "173.245.48.10:443"
+		req.Header.Set("X-Forwarded-For", "198.51.100.9")
+
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "173.245.48.10" {
+			t.Errorf("expected real IP '173.245.48.10', but got: '%s'", realIP)
+		}
+	})
+
+	invalid := []struct {
+		name  string
+		tiers []TrustTier
+	}{
+		{"EmptyName", []TrustTier{{TrustedIPs: []string{"10.0.0.0/8"}}}},
+		{"DuplicateName", []TrustTier{{Name: "a", TrustedIPs: []string{"10.0.0.0/8"}}, {Name: "a", TrustedIPs: []string{"172.16.0.0/12"}}}},
+		{"NoTrustedIPs", []TrustTier{{Name: "a"}}},
+		{"InvalidCIDR", []TrustTier{{Name: "a", TrustedIPs: []string{"not-a-cidr"}}}},
+		{"UnknownHeader", []TrustTier{{Name: "a", TrustedIPs: []string{"10.0.0.0/8"}, ProcessHeaders: []string{"True-Client-IP"}}}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig()
+			cfg.TrustTiers = tt.tiers
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected an error for invalid trust tiers")
+			}
+			if plugin != nil {
+				t.Error("expected nil plugin for invalid trust tiers")
+			}
+		})
+	}
+}
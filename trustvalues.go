@@ -0,0 +1,55 @@
+package traefik_realip
+
+import "fmt"
+
+// Trust states the values of trustedHeader can be configured for
+const (
+	trustStateTrusted   = "trusted"
+	trustStateUntrusted = "untrusted"
+	trustStateUnknown   = "unknown" // RemoteAddr could not be parsed or the trust lookup failed
+)
+
+// trustedHeaderValues are the values written to trustedHeader for each trust state
+type trustedHeaderValues struct {
+	trusted   string
+	untrusted string
+	unknown   string
+}
+
+// newTrustedHeaderValues parses the trustedHeaderValues configuration. Unset states keep
+// the defaults "yes" and "no"; unknown defaults to the untrusted value.
+func newTrustedHeaderValues(name string, configured map[string]string) (trustedHeaderValues, error) {
+	values := trustedHeaderValues{trusted: "yes", untrusted: "no"}
+	for state, value := range configured {
+		if value == "" {
+			return values, fmt.Errorf("%s: trustedHeaderValues for %q cannot be empty", name, state)
+		}
+		switch state {
+		case trustStateTrusted:
+			values.trusted = value
+		case trustStateUntrusted:
+			values.untrusted = value
+		case trustStateUnknown:
+			values.unknown = value
+		default:
+			return values, fmt.Errorf("%s: trustedHeaderValues has unknown state %q (expected trusted, untrusted or unknown)", name, state)
+		}
+	}
+	if values.unknown == "" {
+		values.unknown = values.untrusted
+	}
+	return values, nil
+}
+
+// value returns the value for a trust verdict; known is false when the verdict could not be
+// established from the source
+func (v trustedHeaderValues) value(isTrusted, known bool) string {
+	switch {
+	case isTrusted:
+		return v.trusted
+	case !known:
+		return v.unknown
+	default:
+		return v.untrusted
+	}
+}
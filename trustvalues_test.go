@@ -0,0 +1,99 @@
+package traefik_realip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedHeaderValues(t *testing.T) {
+	newPlugin := func(t *testing.T, values map[string]string) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.TrustedHeader = "X-Is-Trusted"
+		cfg.TrustedHeaderValues = values
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	custom := map[string]string{"trusted": "1", "untrusted": "0", "unknown": "?"}
+
+	tests := []struct {
+		name       string
+		values     map[string]string
+		remoteAddr string
+		expected   string
+	}{
+		{"DefaultTrusted", nil, "10.0.0.1:1234", "yes"},
+		{"DefaultUntrusted", nil, "192.0.2.1:1234", "no"},
+		{"DefaultUnknownIsUntrusted", nil, "garbage", "no"},
+		{"CustomTrusted", custom, "10.0.0.1:1234", "1"},
+		{"CustomUntrusted", custom, "192.0.2.1:1234", "0"},
+		{"CustomUnknown", custom, "garbage", "?"},
+		{"UnknownFollowsUntrusted", map[string]string{"untrusted": "false"}, "garbage", "false"},
+		{"PartialOverride", map[string]string{"trusted": "true"}, "192.0.2.1:1234", "no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.values)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expected {
+				t.Errorf("expected trusted header '%s', but got: '%s'", tt.expected, trusted)
+			}
+		})
+	}
+
+	t.Run("FailedLookupIsUnknown", func(t *testing.T) {
+		plugin := newPlugin(t, custom)
+		plugin.faults = func(point string) error {
+			if point == faultPointTrustLookup {
+				return errors.New("injected")
+			}
+			return nil
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+		if trusted := req.Header.Get("X-Is-Trusted"); trusted != "?" {
+			t.Errorf("expected unknown value, but got: '%s'", trusted)
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		values map[string]string
+	}{
+		{"UnknownState", map[string]string{"maybe": "1"}},
+		{"EmptyValue", map[string]string{"trusted": ""}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustedHeader = "X-Is-Trusted"
+			cfg.TrustedHeaderValues = tt.values
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected error for invalid trustedHeaderValues, but got none")
+			}
+			if plugin != nil {
+				t.Error("expected plugin to be nil, but got instance")
+			}
+		})
+	}
+}
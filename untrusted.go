@@ -0,0 +1,88 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// untrustedDepthKeyword selects relative to the rightmost entry outside the trusted ranges
+const untrustedDepthKeyword = "rightmost-untrusted"
+
+// parseUntrustedDepth parses a "rightmost-untrusted" or "rightmost-untrusted+N" depth into
+// the offset N to the left of the rightmost untrusted entry. ok is false for other depths.
+func parseUntrustedDepth(value interface{}) (offset int, ok bool, err error) {
+	depth, isString := value.(string)
+	if !isString {
+		return 0, false, nil
+	}
+	keyword := strings.ToLower(strings.TrimSpace(depth))
+	if !strings.HasPrefix(keyword, untrustedDepthKeyword) {
+		return 0, false, nil
+	}
+	rest := strings.TrimPrefix(keyword, untrustedDepthKeyword)
+	if rest == "" {
+		return 0, true, nil
+	}
+
+	offset, err = strconv.Atoi(strings.TrimPrefix(rest, "+"))
+	if !strings.HasPrefix(rest, "+") || err != nil || offset < 0 {
+		return 0, true, fmt.Errorf("unknown depth %q (expected %q or %q)", depth, untrustedDepthKeyword, untrustedDepthKeyword+"+N")
+	}
+	return offset, true, nil
+}
+
+// parseUntrustedDepths returns the untrusted offset of every processed header, -1 for headers
+// with a positional depth, or nil when no header selects relative to the untrusted entry
+func parseUntrustedDepths(name string, headers []HeaderConfig, defaultDepth interface{}, synthetic string) ([]int, error) {
+	var offsets []int
+	var problems configErrors
+	for i, headerConfig := range headers {
+		offset, ok, err := parseUntrustedDepth(depthValue(headerConfig, defaultDepth, synthetic))
+		if err != nil {
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): %w", name, i, headerConfig.HeaderName, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if isSynthetic(headerConfig.HeaderName, synthetic) {
+			problems.add(fmt.Errorf("%s: processHeaders[%d] (%s): depth %q needs a header with a chain", name, i, headerConfig.HeaderName, untrustedDepthKeyword))
+			continue
+		}
+		if offsets == nil {
+			offsets = make([]int, len(headers))
+			for j := range offsets {
+				offsets[j] = -1
+			}
+		}
+		offsets[i] = offset
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// selectCandidate returns the position processHeaders[i] selects among cleanIPs: by depth,
+// or, for "rightmost-untrusted+N", N entries left of the rightmost entry outside the trusted
+// ranges. When every entry is trusted, the leftmost one counts as the untrusted entry.
+func (r *Resolver) selectCandidate(i int, cleanIPs []string) (int, bool) {
+	if r.untrustedDepths == nil || r.untrustedDepths[i] < 0 {
+		return selectIndex(len(cleanIPs), r.depths[i])
+	}
+
+	untrusted := 0
+	for j := len(cleanIPs) - 1; j >= 0; j-- {
+		if ip := parseAddress(cleanIPs[j]); ip == nil || !r.inTrustedRanges(ip) {
+			untrusted = j
+			break
+		}
+	}
+
+	index := untrusted - r.untrustedDepths[i]
+	if index < 0 || len(cleanIPs) == 0 {
+		return 0, false
+	}
+	return index, true
+}
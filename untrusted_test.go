@@ -0,0 +1,103 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseUntrustedDepth(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          interface{}
+		expectedOffset int
+		expectedOK     bool
+		expectError    bool
+	}{
+		{"Positional", 1, 0, false, false},
+		{"OtherKeyword", "first", 0, false, false},
+		{"Plain", "rightmost-untrusted", 0, true, false},
+		{"Offset", " Rightmost-Untrusted+2 ", 2, true, false},
+		{"MissingPlus", "rightmost-untrusted1", 0, true, true},
+		{"NegativeOffset", "rightmost-untrusted+-1", 0, true, true},
+		{"NotANumber", "rightmost-untrusted+x", 0, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, ok, err := parseUntrustedDepth(tt.value)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, but got: %v", tt.expectError, err)
+			}
+			if ok != tt.expectedOK || offset != tt.expectedOffset {
+				t.Errorf("expected (%d, %v), but got (%d, %v)", tt.expectedOffset, tt.expectedOK, offset, ok)
+			}
+		})
+	}
+}
+
+func TestUntrustedDepthSelection(t *testing.T) {
+	tests := []struct {
+		name       string
+		depth      string
+		xff        string
+		expectedIP string
+	}{
+		{"RightmostUntrusted", "rightmost-untrusted", "203.0.113.1, 198.51.100.1, 173.245.48.5, 10.0.0.2", "198.51.100.1"},
+		{"LeftOfCorporateProxy", "rightmost-untrusted+1", "203.0.113.1, 198.51.100.1, 173.245.48.5, 10.0.0.2", "203.0.113.1"},
+		{"VaryingProxyCount", "rightmost-untrusted+1", "203.0.113.1, 198.51.100.1, 10.0.0.2", "203.0.113.1"},
+		{"AllTrusted", "rightmost-untrusted", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"OutOfBoundsFallsThrough", "rightmost-untrusted+1", "198.51.100.1, 10.0.0.2", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.TrustAll = false
+			cfg.TrustedIPs = []string{"173.245.48.0/20", "10.0.0.0/8"}
+			cfg.ProcessHeaders = []HeaderConfig{
+				{HeaderName: "X-Forwarded-For", Depth: tt.depth},
+				{HeaderName: "clientAddress", Depth: -1},
+			}
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("failed to create plugin: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", tt.xff)
+
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected real IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name    string
+		headers []HeaderConfig
+	}{
+		{"InvalidOffset", []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: "rightmost-untrusted+x"}}},
+		{"ClientAddress", []HeaderConfig{{HeaderName: "clientAddress", Depth: "rightmost-untrusted"}}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.ProcessHeaders = tt.headers
+
+			plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err == nil {
+				t.Error("expected an error for an invalid untrusted depth")
+			}
+			if plugin != nil {
+				t.Error("expected nil plugin for an invalid untrusted depth")
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package traefik_realip
+
+import "strconv"
+
+// pluginVersion is the version of the plugin, stamped on versionHeaderName and diagnostic dumps
+const pluginVersion = "v1.1.0-dev"
+
+// compatVersion is the version of the resolution semantics: it is bumped whenever the same
+// configuration resolves a request differently, which a plugin version alone does not tell
+const compatVersion = 1
+
+// versionStamp identifies the semantics a router runs, so staged upgrades can be verified fleet-wide.
+// The compatibility version and the profile, which changes them as much as an upgrade, are appended
+// as build metadata, e.g. "v1.1.0-dev+compat.1.behind-cdn".
+func (r *Resolver) versionStamp() string {
+	stamp := pluginVersion + "+compat." + strconv.Itoa(compatVersion)
+	if r.config.Profile != "" {
+		stamp += "." + r.config.Profile
+	}
+	return stamp
+}
@@ -0,0 +1,101 @@
+package traefik_realip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersionHeader(t *testing.T) {
+	newPlugin := func(t *testing.T, modify func(cfg *Config)) http.Handler {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"10.0.0.0/8"}
+		cfg.VersionHeaderName = "X-RealIP-Version"
+		if modify != nil {
+			modify(cfg)
+		}
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return plugin
+	}
+
+	serve := func(plugin http.Handler, remoteAddr string) string {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-RealIP-Version", "spoofed")
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+		return req.Header.Get("X-RealIP-Version")
+	}
+
+	stamp := pluginVersion + "+compat.1"
+
+	t.Run("EveryRequest", func(t *testing.T) {
+		plugin := newPlugin(t, nil)
+
+		for i := 0; i < 3; i++ {
+			if version := serve(plugin, "10.0.0.1:1234"); version != stamp {
+				t.Errorf("request %d: expected version '%s', but got: '%s'", i, stamp, version)
+			}
+		}
+	})
+
+	t.Run("Sampled", func(t *testing.T) {
+		plugin := newPlugin(t, func(cfg *Config) {
+			cfg.VersionHeaderSampleRate = 2
+		})
+
+		expected := []string{stamp, "", stamp, ""}
+		for i, want := range expected {
+			if version := serve(plugin, "10.0.0.1:1234"); version != want {
+				t.Errorf("request %d: expected version '%s', but got: '%s'", i, want, version)
+			}
+		}
+	})
+
+	t.Run("UntrustedClient", func(t *testing.T) {
+		plugin := newPlugin(t, nil)
+
+		if version := serve(plugin, "192.0.2.1:1234"); version != "" {
+			t.Errorf("expected no version for untrusted source, but got: '%s'", version)
+		}
+		if version := serve(plugin, "10.0.0.1:1234"); version != stamp {
+			t.Errorf("expected version '%s' for trusted source, but got: '%s'", stamp, version)
+		}
+	})
+
+	t.Run("NegativeSampleRate", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.VersionHeaderName = "X-RealIP-Version"
+		cfg.VersionHeaderSampleRate = -1
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for negative versionHeaderSampleRate, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+
+	t.Run("InDump", func(t *testing.T) {
+		var logs bytes.Buffer
+		logWriter = &logs
+		defer func() { logWriter = os.Stdout }()
+
+		handler := newPlugin(t, nil)
+		handler.(*Plugin).dump(time.Now())
+
+		if !strings.Contains(logs.String(), `"version":"`+stamp+`"`) {
+			t.Errorf("expected dump to contain the version, but got: %s", logs.String())
+		}
+	})
+}
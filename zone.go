@@ -0,0 +1,39 @@
+package traefik_realip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// What happens to IPv6 zone identifiers of candidates, such as "eth0" in "fe80::1%eth0"
+const (
+	zoneIdentifiersStrip    = "strip"
+	zoneIdentifiersPreserve = "preserve"
+)
+
+// parseZoneIdentifiers validates the zoneIdentifiers configuration, defaulting to strip
+func parseZoneIdentifiers(name, mode string) (string, error) {
+	switch mode {
+	case "":
+		return zoneIdentifiersStrip, nil
+	case zoneIdentifiersStrip, zoneIdentifiersPreserve:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s: zoneIdentifiers must be %q or %q, got %q", name, zoneIdentifiersStrip, zoneIdentifiersPreserve, mode)
+	}
+}
+
+// stripZone removes the zone identifier of an IPv6 address, also in its URI form ("%25eth0")
+func stripZone(addr string) string {
+	if i := strings.IndexByte(addr, '%'); i >= 0 && strings.Contains(addr[:i], ":") {
+		return addr[:i]
+	}
+	return addr
+}
+
+// parseAddress parses an IP address, ignoring any IPv6 zone identifier. The zone only
+// selects a link on the host, so it never takes part in trust checks or range matching.
+func parseAddress(addr string) net.IP {
+	return net.ParseIP(stripZone(addr))
+}
@@ -0,0 +1,97 @@
+package traefik_realip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripZone(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"fe80::1%eth0", "fe80::1"},
+		{"fe80::1%25eth0", "fe80::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"100%", "100%"},
+	}
+
+	for _, tt := range tests {
+		if result := stripZone(tt.addr); result != tt.expected {
+			t.Errorf("stripZone(%q) = %q, expected %q", tt.addr, result, tt.expected)
+		}
+	}
+}
+
+func TestZoneIdentifiers(t *testing.T) {
+	newPlugin := func(t *testing.T, mode string) *Plugin {
+		cfg := CreateConfig()
+		cfg.TrustAll = false
+		cfg.TrustedIPs = []string{"fe80::/10"}
+		cfg.TrustedHeader = "X-Is-Trusted"
+		cfg.ProcessHeaders = []HeaderConfig{{HeaderName: "X-Forwarded-For", Depth: 0}, {HeaderName: "clientAddress"}}
+		cfg.ZoneIdentifiers = mode
+		cfg.StrictMode = true
+
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("failed to create plugin: %v", err)
+		}
+		return handler.(*Plugin)
+	}
+
+	tests := []struct {
+		name            string
+		mode            string
+		remoteAddr      string
+		xff             string
+		expectedIP      string
+		expectedTrusted string
+	}{
+		{"StrippedFromHeader", "", "[fe80::2%eth0]:1234", "fe80::1%eth0", "fe80::1", "yes"},
+		{"StrippedFromBracketedHeader", zoneIdentifiersStrip, "[fe80::2%eth0]:1234", "[fe80::1%25eth0]:8080", "fe80::1", "yes"},
+		{"Preserved", zoneIdentifiersPreserve, "[fe80::2%eth0]:1234", "fe80::1%eth0", "fe80::1%eth0", "yes"},
+		{"PreservedClientAddress", zoneIdentifiersPreserve, "[fe80::2%eth1]:1234", "", "fe80::2%eth1", "yes"},
+		{"ZoneDoesNotAffectUntrusted", zoneIdentifiersPreserve, "[2001:db8::2%eth0]:1234", "fe80::1", "2001:db8::2%eth0", "no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := newPlugin(t, tt.mode)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, but got %d", http.StatusOK, rr.Code)
+			}
+			if realIP := req.Header.Get("X-Real-IP"); realIP != tt.expectedIP {
+				t.Errorf("expected X-Real-IP '%s', but got: '%s'", tt.expectedIP, realIP)
+			}
+			if trusted := req.Header.Get("X-Is-Trusted"); trusted != tt.expectedTrusted {
+				t.Errorf("expected X-Is-Trusted '%s', but got: '%s'", tt.expectedTrusted, trusted)
+			}
+		})
+	}
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		cfg := CreateConfig()
+		cfg.ZoneIdentifiers = "keep"
+
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err == nil {
+			t.Error("expected error for an unknown zoneIdentifiers mode, but got none")
+		}
+		if plugin != nil {
+			t.Error("expected plugin to be nil, but got instance")
+		}
+	})
+}